@@ -31,6 +31,20 @@ func ParseCipherSuite(name string) (uint16, error) {
 	return 0, fmt.Errorf("unknown cipher suite %q", name)
 }
 
+// KnownCipherSuites returns every cipher suite that ParseCipherSuite
+// accepts, namely those returned by tls.CipherSuites followed by those
+// returned by tls.InsecureCipherSuites.
+func KnownCipherSuites() CipherSuites {
+	var suites CipherSuites
+	for _, cs := range tls.CipherSuites() {
+		suites = append(suites, cs.ID)
+	}
+	for _, cs := range tls.InsecureCipherSuites() {
+		suites = append(suites, cs.ID)
+	}
+	return suites
+}
+
 // signatureAlgorithms lists every x509.SignatureAlgorithm that has a non-empty
 // human readable name, i.e. excluding x509.UnknownSignatureAlgorithm and
 // x509.MD2WithRSA (which crypto/x509 never assigns a name to).
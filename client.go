@@ -38,6 +38,15 @@ func WithCustomCAPool(caPool *x509.CertPool) HTTPClientOption {
 	}
 }
 
+// WithClientCertificates configures the HTTP client to present the
+// specified certificates to servers that request client certificates,
+// ie. for mutual TLS.
+func WithClientCertificates(certs ...tls.Certificate) HTTPClientOption {
+	return func(o *httpClientOptions) {
+		o.clientCerts = slices.Clone(certs)
+	}
+}
+
 // WithTracingTransport configures the HTTP client to use a tracing
 // round tripper with the specified options.
 func WithTracingTransport(to ...httptracing.TraceRoundtripOption) HTTPClientOption {
@@ -62,6 +71,7 @@ type httpClientOptions struct {
 	caPool          *x509.CertPool
 	tracingOpts     []httptracing.TraceRoundtripOption
 	dnsResolverAddr string
+	clientCerts     []tls.Certificate
 }
 
 // NewHTTPClient creates a new HTTP client configured according to the specified options.
@@ -83,6 +93,7 @@ func NewHTTPClient(ctx context.Context, opts ...HTTPClientOption) (*http.Client,
 			//  MaxVersion is left unset.
 			MinVersion:   tls.VersionTLS12,
 			CipherSuites: PreferredCipherSuites,
+			Certificates: options.clientCerts,
 		}}
 	if options.caPool != nil {
 		ctxlog.Logger(ctx).Warn("services.NewHTTPClient: using custom root CA pool")
@@ -0,0 +1,61 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// ParseClientAuthType parses the supplied client certificate verification
+// mode, which must be one of:
+//   - "" or "none": client certificates are neither requested nor verified.
+//   - "request": client certificates are requested but not required or verified.
+//   - "require-any": a client certificate is required but not verified.
+//   - "verify-if-given": client certificates are verified if presented.
+//   - "require-and-verify": a verified client certificate is required.
+func ParseClientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require-any":
+		return tls.RequireAnyClientCert, nil
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require-and-verify":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unsupported client certificate verification mode: %q", mode)
+}
+
+// ConfigureClientAuth configures cfg to request and verify client
+// certificates, for mutual TLS, against the CAs in the PEM file caFile
+// using the verification mode as per ParseClientAuthType. If mode is empty
+// and caFile is specified then "require-and-verify" is used. Modes that
+// verify client certificates require that caFile be specified.
+func ConfigureClientAuth(cfg *tls.Config, caFile, mode string) error {
+	if len(mode) == 0 && len(caFile) > 0 {
+		mode = "require-and-verify"
+	}
+	clientAuth, err := ParseClientAuthType(mode)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if len(caFile) > 0 {
+		if clientCAs, err = certPool(caFile); err != nil {
+			return fmt.Errorf("failed to obtain client CA pool from %v: %w", caFile, err)
+		}
+	}
+	if clientCAs == nil && clientAuth >= tls.VerifyClientCertIfGiven {
+		return fmt.Errorf("client certificate verification mode %q requires a client CA file", mode)
+	}
+	cfg.ClientAuth = clientAuth
+	cfg.ClientCAs = clientCAs
+	return nil
+}
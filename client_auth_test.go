@@ -0,0 +1,61 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp_test
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloudeng.io/webapp"
+)
+
+func TestConfigureClientAuth(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		want tls.ClientAuthType
+	}{
+		{"", tls.NoClientCert},
+		{"none", tls.NoClientCert},
+		{"request", tls.RequestClientCert},
+		{"require-any", tls.RequireAnyClientCert},
+		{"verify-if-given", tls.VerifyClientCertIfGiven},
+		{"require-and-verify", tls.RequireAndVerifyClientCert},
+	} {
+		got, err := webapp.ParseClientAuthType(tc.mode)
+		if err != nil || got != tc.want {
+			t.Errorf("%q: got %v, %v, want %v", tc.mode, got, err, tc.want)
+		}
+	}
+	if _, err := webapp.ParseClientAuthType("optional"); err == nil {
+		t.Errorf("expected an error for an unsupported mode")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := newALPNTestCert(t, "client-ca")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if err := webapp.ConfigureClientAuth(cfg, caFile, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.ClientAuth, tls.RequireAndVerifyClientCert; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if cfg.ClientCAs == nil {
+		t.Errorf("expected a client CA pool")
+	}
+
+	if err := webapp.ConfigureClientAuth(&tls.Config{}, "", "verify-if-given"); err == nil {
+		t.Errorf("expected an error for a verification mode without a CA file")
+	}
+	if err := webapp.ConfigureClientAuth(&tls.Config{}, "", "request"); err != nil {
+		t.Error(err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"cloudeng.io/aws/awsconfig"
@@ -38,11 +39,38 @@ type certManagerFlags struct {
 	TestingCAPEMFlag
 	TLSCertStoreFlags
 	AccountKeyAliasFlag
+	LeaderElectionFlags
 	awsconfig.AWSFlags
 	HTTPPort        int           `subcmd:"http-port,80,address to run http acme challenge server on"`
+	TLSALPNPort     int           `subcmd:"tls-alpn-port,0,'port to run the tls acme tls-alpn-01 challenge server on, 0 disables the server'"`
 	RefreshInterval time.Duration `subcmd:"cert-refresh-interval,6h,interval between certificate refresh attempts"`
 	Trace           bool          `subcmd:"trace,false,enable http tracing for acme client operations"`
 }
+
+// LeaderElectionFlags defines the flags used to configure leader election
+// amongst multiple cert-manager replicas that share the same certificate
+// store.
+type LeaderElectionFlags struct {
+	LeaderElection bool          `subcmd:"leader-election,false,'elect a leader amongst cert-manager replicas that share the same certificate store, only the leader refreshes certificates'"`
+	LeaseName      string        `subcmd:"leader-lease,acme-cert-manager.lease,'the name of the leader election lease in the certificate store'"`
+	LeaseTTL       time.Duration `subcmd:"leader-lease-ttl,1m,'the duration for which the leader election lease is valid unless renewed'"`
+	ReplicaID      string        `subcmd:"replica-id,,'the unique identity of this replica for leader election, defaults to <hostname>:<pid>'"`
+}
+
+func newLeaderElector(ctx context.Context, cl LeaderElectionFlags, cache *certcache.CachingStore) (*certcache.LeaderElector, error) {
+	id := cl.ReplicaID
+	if len(id) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	}
+	return certcache.NewLeaderElector(cache.BackingStore(), cl.LeaseName, id,
+		certcache.WithLeaseTTL(cl.LeaseTTL),
+		certcache.WithElectorLogger(ctxlog.Logger(ctx)))
+}
+
 type certManagerCmd struct{}
 
 func (certManagerCmd) manageCerts(ctx context.Context, flags any, args []string) error {
@@ -56,7 +84,8 @@ func (certManagerCmd) manageCerts(ctx context.Context, flags any, args []string)
 
 	cache, err := newCertStore(ctx, cl.TLSCertStoreFlags, cl.AWSFlags,
 		certcache.WithReadonly(false),
-		certcache.WithSaveAccountKey(cl.AccountKeyAlias))
+		certcache.WithSaveAccountKey(cl.AccountKeyAlias),
+		certcache.WithSharedChallengeTokens(cl.LeaderElection))
 	if err != nil {
 		return err
 	}
@@ -115,7 +144,7 @@ func (certManagerCmd) manageCerts(ctx context.Context, flags any, args []string)
 		return err
 	}
 
-	errCh := make(chan error, 1)
+	errCh := make(chan error, 2)
 	go func() {
 		err := webapp.ServeWithShutdown(ctx, httpListener, httpServer, time.Minute)
 		errCh <- err
@@ -125,7 +154,23 @@ func (certManagerCmd) manageCerts(ctx context.Context, flags any, args []string)
 		return fmt.Errorf("http server failed to start: %w", err)
 	}
 
-	acmeClient := acme.NewClient(mgr, acme.WithRefreshInterval(cl.RefreshInterval))
+	if cl.TLSALPNPort != 0 {
+		addr, err := serveTLSALPN01(ctx, mgr, cl.TLSALPNPort, errCh)
+		if err != nil {
+			return err
+		}
+		logger.Info("acme tls-alpn-01 challenge server started", "addr", addr)
+	}
+
+	acmeOpts := []acme.ClientOption{acme.WithRefreshInterval(cl.RefreshInterval)}
+	if cl.LeaderElection {
+		elector, err := newLeaderElector(ctx, cl.LeaderElectionFlags, cache)
+		if err != nil {
+			return fmt.Errorf("failed to create leader elector: %w", err)
+		}
+		acmeOpts = append(acmeOpts, acme.WithLeaderElection(elector))
+	}
+	acmeClient := acme.NewClient(mgr, acmeOpts...)
 
 	stopAcmeClient, err := acmeClient.Start(ctx, args...)
 	if err != nil {
@@ -134,6 +179,29 @@ func (certManagerCmd) manageCerts(ctx context.Context, flags any, args []string)
 
 	var errs errors.M
 	errs.Append(<-errCh)
+	if cl.TLSALPNPort != 0 {
+		errs.Append(<-errCh)
+	}
 	errs.Append(stopAcmeClient())
 	return errs.Err()
 }
+
+// serveTLSALPN01 starts a TLS server on the specified port that answers
+// acme tls-alpn-01 challenges using mgr and rejects all other requests.
+func serveTLSALPN01(ctx context.Context, mgr *acme.Manager, port int, errCh chan<- error) (string, error) {
+	reject := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxlog.Logger(r.Context()).Info("tls-alpn-01 server fallback handler called, rejecting request")
+		w.WriteHeader(http.StatusForbidden)
+	})
+	ln, srv, err := webapp.NewTLSServer(ctx, fmt.Sprintf(":%d", port), reject, mgr.TLSConfig())
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		errCh <- webapp.ServeTLSWithShutdown(ctx, ln, srv, time.Minute)
+	}()
+	if err := webapp.WaitForServers(ctx, time.Second*2, ln.Addr().String()); err != nil {
+		return "", fmt.Errorf("tls-alpn-01 server failed to start: %w", err)
+	}
+	return ln.Addr().String(), nil
+}
@@ -41,6 +41,28 @@
 //	fargate, ECS/EKS etc with no overhead other than implementing the http-01 redirect
 //	and having access to the certificates.
 //
+//	Wildcard certificates, and certificates for hosts that are not reachable on
+//	port 80, can be obtained using the 'certs dns01' command, which uses the acme
+//	dns-01 challenge and a dns server that supports RFC 2136 dynamic updates. It
+//	only obtains a new certificate when the stored one is due for renewal and hence
+//	may be run periodically, e.g. via cron.
+//
+//	Multiple cert-manager replicas may share the same certificate store by enabling
+//	leader election via the --leader-election flag. The replicas elect a leader
+//	using a lease stored in the certificate store and only the leader refreshes
+//	certificates, the others act as hot standbys that take over if the leader fails
+//	to renew its lease. Leader election requires a certificate store that supports
+//	compare-and-swap writes, such as a local directory shared by all replicas.
+//	Challenge tokens are written to the certificate store when leader election is
+//	enabled so that any replica can answer the acme challenges, hence the
+//	--acme-client-host used by the http-01 redirect may resolve to any replica.
+//
+//	Hosts that are reachable on port 443 but not on port 80 can use the acme
+//	tls-alpn-01 challenge instead. Run cert-manager with the --tls-alpn-port flag
+//	to answer these challenges and have all other services proxy acme-tls/1 TLS
+//	handshakes to it, as implemented by the redirect test's --acme-tls-alpn-host
+//	flag.
+//
 //	servers - run acme related servers
 //	  certs - manage ACME issued TLS certificates
 package main
@@ -0,0 +1,114 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cloudeng.io/aws/awsconfig"
+	"cloudeng.io/logging/ctxlog"
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/webauth/acme"
+	"cloudeng.io/webapp/webauth/acme/certcache"
+)
+
+// RFC2136Flags defines the flags used to configure a DNS server that
+// supports RFC 2136 dynamic updates for the dns-01 challenge.
+type RFC2136Flags struct {
+	Server         string        `subcmd:"rfc2136-server,,'the address, host:port, of the dns server to send dynamic updates to'"`
+	Zone           string        `subcmd:"rfc2136-zone,,'the zone to update, if not set it is determined by querying the dns server'"`
+	TSIGKeyName    string        `subcmd:"rfc2136-tsig-key,,'the name of the tsig key used to sign updates'"`
+	TSIGAlgorithm  string        `subcmd:"rfc2136-tsig-algorithm,hmac-sha256,'the tsig algorithm, one of hmac-sha256 or hmac-sha512'"`
+	TSIGSecretFile string        `subcmd:"rfc2136-tsig-secret-file,,'file containing the base64 encoded tsig secret'"`
+	RecordTTL      time.Duration `subcmd:"rfc2136-ttl,60s,'the ttl of the challenge records'"`
+}
+
+type dns01Flags struct {
+	acme.ServiceFlags
+	TestingCAPEMFlag
+	TLSCertStoreFlags
+	AccountKeyAliasFlag
+	RFC2136Flags
+	awsconfig.AWSFlags
+	CertName         string        `subcmd:"cert-name,,'the name to store the certificate under in the certificate store, defaults to the first domain with any wildcard prefix replaced by _wildcard, as expected by webapp.CertServingCache'"`
+	PropagationDelay time.Duration `subcmd:"propagation-delay,0s,'time to wait for the challenge records to propagate before requesting validation'"`
+	Force            bool          `subcmd:"force,false,'obtain a new certificate even if the existing one is not due for renewal'"`
+}
+
+type dns01Cmd struct{}
+
+func newRFC2136Provider(cl RFC2136Flags) (*acme.RFC2136Provider, error) {
+	if len(cl.Server) == 0 {
+		return nil, fmt.Errorf("--rfc2136-server must be specified")
+	}
+	opts := []acme.RFC2136Option{acme.WithRecordTTL(cl.RecordTTL)}
+	if len(cl.Zone) > 0 {
+		opts = append(opts, acme.WithZone(cl.Zone))
+	}
+	if len(cl.TSIGKeyName) > 0 {
+		data, err := os.ReadFile(cl.TSIGSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tsig secret: %w", err)
+		}
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tsig secret: %w", err)
+		}
+		opts = append(opts, acme.WithTSIG(cl.TSIGKeyName, cl.TSIGAlgorithm, secret))
+	}
+	return acme.NewRFC2136Provider(cl.Server, opts...)
+}
+
+func (dns01Cmd) obtain(ctx context.Context, flags any, args []string) error {
+	cl := flags.(*dns01Flags)
+	logger := ctxlog.Logger(ctx)
+
+	cache, err := newCertStore(ctx, cl.TLSCertStoreFlags, cl.AWSFlags,
+		certcache.WithReadonly(false),
+		certcache.WithSaveAccountKey(cl.AccountKeyAlias),
+		certcache.WithLogger(logger))
+	if err != nil {
+		return err
+	}
+	provider, err := newRFC2136Provider(cl.RFC2136Flags)
+	if err != nil {
+		return err
+	}
+	httpClient, err := webapp.NewHTTPClient(ctx, webapp.WithCustomCAPEMFile(cl.TestingCAPEM))
+	if err != nil {
+		return fmt.Errorf("failed to create acme http client: %w", err)
+	}
+	issuer, err := acme.NewDNS01Issuer(cache, cl.AutocertConfig(), provider,
+		acme.WithDNS01HTTPClient(httpClient),
+		acme.WithPropagationDelay(cl.PropagationDelay),
+		acme.WithDNS01Logger(logger))
+	if err != nil {
+		return err
+	}
+
+	name := cl.CertName
+	if len(name) == 0 {
+		name = webapp.WildcardCertName(args[0])
+	}
+	if cl.Force {
+		cert, err := issuer.Issue(ctx, name, args...)
+		if err != nil {
+			return err
+		}
+		logger.Info("obtained certificate", "name", name, "domains", args, "not-after", cert.Leaf.NotAfter)
+		return nil
+	}
+	cert, issued, err := issuer.Renew(ctx, name, args...)
+	if err != nil {
+		return err
+	}
+	logger.Info("certificate checked", "name", name, "domains", args, "issued", issued, "not-after", cert.Leaf.NotAfter)
+	return nil
+}
@@ -25,7 +25,7 @@ commands:
         args:
           - <hosts>...  # hosts for which to manage certificates
       - name: redirect
-        summary: run an http server that redirects acme http-01 challenges back to a central server that implements the acme client, as run by cert-manager for example.
+        summary: run an http server that redirects acme http-01 challenges, and optionally proxies acme tls-alpn-01 challenges, back to a central server that implements the acme client, as run by cert-manager for example.
   - name: certs
     summary: manage ACME issued TLS certificates
     commands:
@@ -33,6 +33,10 @@ commands:
         summary: validate the certificates served for specified hosts
         args:
           - <hosts>+  # hosts to validate certificates for          
+      - name: scan-hosts
+        summary: scan the TLS versions, cipher suites, curves, signature schemes and ALPN protocols accepted by the specified hosts
+        args:
+          - <hosts>+  # hosts to scan
       - name: validate-pem-files
         summary: validate the pem encoded certificates served for specified hosts
         args:
@@ -44,6 +48,10 @@ commands:
             summary: store a certificate in a cert store
           - name: get
             summary: retrieve a certificate from a cert store
+      - name: dns01
+        summary: obtain or renew a certificate, which may include wildcard domains, using the acme dns-01 challenge with a dns server that supports RFC 2136 dynamic updates
+        args:
+          - <domains>+ # domains to include in the certificate, e.g. '*.an.example' an.example
       - name: revoke
         summary: revoke a certificate stored in a cert store using either the private key of the certificate or the private key of the acme account used to obtain the certificate
         args:
@@ -59,10 +67,14 @@ func cli() *subcmd.CommandSetYAML {
 
 	certsCmd := certsCmd{}
 	cmd.Set("certs", "validate-hosts").MustRunner(certsCmd.validateHostCertificatesCmd, &validateHostFlags{})
+	cmd.Set("certs", "scan-hosts").MustRunner(certsCmd.scanHostsCmd, &scanHostFlags{})
 	cmd.Set("certs", "validate-pem-files").MustRunner(certsCmd.validatePEMFilesCmd, &validateFileFlags{})
 	cmd.Set("certs", "store", "put").MustRunner(putCert, &putCertFlags{})
 	cmd.Set("certs", "store", "get").MustRunner(getCert, &getCertFlags{})
 
+	dns01Cmd := dns01Cmd{}
+	cmd.Set("certs", "dns01").MustRunner(dns01Cmd.obtain, &dns01Flags{})
+
 	revokeCmd := revokeCmd{}
 	cmd.Set("certs", "revoke").MustRunner(revokeCmd.revokeUsingKey, &revokeFlags{})
 
@@ -108,6 +120,29 @@ This approach allows for automated management TLS certifcates for server
 farms that live behind firewalls/loadbalancers, are hosted on services
 such as AWS fargate, ECS/EKS etc with no overhead other than implementing
 the http-01 redirect and having access to the certificates.
+
+Wildcard certificates, and certificates for hosts that are not reachable
+on port 80, can be obtained using the 'certs dns01' command, which uses
+the acme dns-01 challenge and a dns server that supports RFC 2136 dynamic
+updates. It only obtains a new certificate when the stored one is due for
+renewal and hence may be run periodically, e.g. via cron.
+
+Multiple cert-manager replicas may share the same certificate store
+by enabling leader election via the --leader-election flag. The replicas
+elect a leader using a lease stored in the certificate store and only the
+leader refreshes certificates, the others act as hot standbys that take over
+if the leader fails to renew its lease. Leader election requires a
+certificate store that supports compare-and-swap writes, such as a local
+directory shared by all replicas. Challenge tokens are written to the
+certificate store when leader election is enabled so that any replica can
+answer the acme challenges, hence the --acme-client-host used by the http-01
+redirect may resolve to any replica.
+
+Hosts that are reachable on port 443 but not on port 80 can use the acme
+tls-alpn-01 challenge instead. Run cert-manager with the --tls-alpn-port flag
+to answer these challenges and have all other services proxy acme-tls/1 TLS
+handshakes to it, as implemented by the redirect test's --acme-tls-alpn-host
+flag.
 `)
 	return cmd
 }
@@ -20,7 +20,8 @@ import (
 type testRedirectFlags struct {
 	TLSCertStoreFlags
 	webapp.HTTPServerFlags
-	AcmeClientHost string `subcmd:"acme-client-host,,the host (with optional port) to which ACME HTTP-01 challenge requests will be redirected."`
+	AcmeClientHost  string `subcmd:"acme-client-host,,the host (with optional port) to which ACME HTTP-01 challenge requests will be redirected."`
+	AcmeTLSALPNHost string `subcmd:"acme-tls-alpn-host,,'the host (with optional port, defaults to 443) to which ACME TLS-ALPN-01 challenge handshakes will be proxied, if not set these handshakes are not proxied.'"`
 	awsconfig.AWSFlags
 }
 
@@ -65,6 +66,9 @@ func (testRedirectCmd) redirect(ctx context.Context, values any, _ []string) err
 	if err != nil {
 		return err
 	}
+	if len(cl.AcmeTLSALPNHost) > 0 {
+		ln = webapp.ProxyAcmeTLSALPN01(ctx, ln, cl.AcmeTLSALPNHost)
+	}
 	fmt.Printf("listening on: %v\n", ln.Addr())
 	srv.TLSConfig = tlsCfg
 	return webapp.ServeTLSWithShutdown(ctx, ln, srv, time.Minute)
@@ -0,0 +1,110 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudeng.io/errors"
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/tlsvalidate"
+)
+
+type scanHostFlags struct {
+	TLSPort         string        `subcmd:"tls-port,443,the TLS port to scan"`
+	Timeout         time.Duration `subcmd:"timeout,10s,the time allowed for each of the handshakes used to scan a host"`
+	ALPN            string        `subcmd:"alpn,,'comma separated list of ALPN protocols to probe for, the default is h2,http/1.1'"`
+	AllowedVersions string        `subcmd:"allowed-versions,,'comma separated list of the only TLS versions that hosts may accept, e.g. TLS 1.3'"`
+	DenyCBC         bool          `subcmd:"deny-cbc,false,fail if a host accepts any CBC mode cipher suite"`
+	Policy          string        `subcmd:"policy,,'fail if a host does not conform to the named TLS policy: modern, intermediate or legacy'"`
+	Format          string        `subcmd:"format,text,'output format, one of text, json or yaml'"`
+}
+
+func (certsCmd) scanHostsCmd(ctx context.Context, values any, args []string) error {
+	cl := values.(*scanHostFlags)
+	if err := checkFormat(cl.Format); err != nil {
+		return err
+	}
+	var allowed webapp.TLSVersions
+	for _, name := range splitList(cl.AllowedVersions) {
+		v, err := webapp.ParseTLSVersion(name)
+		if err != nil {
+			return err
+		}
+		allowed = append(allowed, v)
+	}
+	var policy *webapp.TLSPolicy
+	if len(cl.Policy) > 0 {
+		p, err := webapp.ParseTLSPolicy(cl.Policy)
+		if err != nil {
+			return err
+		}
+		policy = &p
+	}
+	opts := []tlsvalidate.ScanOption{tlsvalidate.WithScanTimeout(cl.Timeout)}
+	if protocols := splitList(cl.ALPN); len(protocols) > 0 {
+		opts = append(opts, tlsvalidate.WithScanALPNProtocols(protocols...))
+	}
+	scanner := tlsvalidate.NewScanner(opts...)
+	var errs errors.M
+	results := make([]*tlsvalidate.ScanResult, 0, len(args))
+	for _, host := range args {
+		result, err := scanner.Scan(ctx, host, cl.TLSPort)
+		if err != nil {
+			return err
+		}
+		errs.Append(checkScanPolicy(result, allowed, cl.DenyCBC))
+		if policy != nil {
+			errs.Append(result.CheckPolicy(*policy))
+		}
+		if cl.Format == "text" {
+			fmt.Print(result.String())
+			continue
+		}
+		results = append(results, result)
+	}
+	if cl.Format != "text" {
+		if err := printReports(cl.Format, results); err != nil {
+			return err
+		}
+	}
+	return errs.Err()
+}
+
+func splitList(list string) []string {
+	var items []string
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func checkScanPolicy(result *tlsvalidate.ScanResult, allowed webapp.TLSVersions, denyCBC bool) error {
+	var errs errors.M
+	host := result.Host
+	if len(result.Versions) == 0 {
+		errs.Append(fmt.Errorf("%v: no TLS versions accepted", host))
+	}
+	for _, v := range result.Versions {
+		if len(allowed) > 0 && !slices.Contains(allowed, v) {
+			errs.Append(fmt.Errorf("%v: accepts %v, allowed versions are: %v", host, tls.VersionName(v), allowed))
+		}
+	}
+	if denyCBC {
+		for _, cs := range result.CipherSuites {
+			if name := tls.CipherSuiteName(cs); strings.Contains(name, "_CBC_") {
+				errs.Append(fmt.Errorf("%v: accepts CBC cipher suite %v", host, name))
+			}
+		}
+	}
+	return errs.Err()
+}
@@ -6,15 +6,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"regexp"
 	"time"
 
 	"cloudeng.io/cmdutil/flags"
+	"cloudeng.io/errors"
 	"cloudeng.io/file/localfs"
 	"cloudeng.io/webapp"
 	"cloudeng.io/webapp/devtest"
 	"cloudeng.io/webapp/tlsvalidate"
+	"gopkg.in/yaml.v3"
 )
 
 type ValidateFlags struct {
@@ -23,6 +27,7 @@ type ValidateFlags struct {
 	CheckSerialNumbers bool            `subcmd:"same-serial-numbers,true,check that all of the serial numbers for certs found on the same host are the same"`
 	ValidFor           time.Duration   `subcmd:"valid-for,360h,check that the certifcates are valid for at least this duration"`
 	Issuer             flags.Repeating `subcmd:"issuer,,check that the issuer urls match this regular expression"`
+	Format             string          `subcmd:"format,text,'output format, one of text, json or yaml. The json and yaml formats print a report for every host or pem file, including those that fail validation'"`
 }
 
 type validateFileFlags struct {
@@ -31,31 +36,57 @@ type validateFileFlags struct {
 
 type validateHostFlags struct {
 	ValidateFlags
-	AllHosts bool `subcmd:"all,false,set to validate all of the hosts for a given DNS hostname or domain"`
+	AllHosts   bool   `subcmd:"all,false,set to validate all of the hosts for a given DNS hostname or domain"`
+	Revocation string `subcmd:"revocation,,'check that the certificates have not been revoked using ocsp, crl or both, ie. ocsp,crl. Stapled ocsp responses are always verified when checking revocation'"`
 }
 
 func (certsCmd) validateHostCertificatesCmd(ctx context.Context, values any, args []string) error {
 	cl := values.(*validateHostFlags)
-	for _, host := range args {
-		if err := validateCerts(ctx, cl, host); err != nil {
-			return err
+	if err := checkFormat(cl.Format); err != nil {
+		return err
+	}
+	validator, err := newHostValidator(cl)
+	if err != nil {
+		return err
+	}
+	if cl.Format == "text" {
+		for _, host := range args {
+			if err := validator.Validate(ctx, host, cl.TLSPort); err != nil {
+				return err
+			}
+			fmt.Printf("%v: ok\n", host)
 		}
-		fmt.Printf("%v: ok\n", host)
+		return nil
+	}
+	var errs errors.M
+	reports := make([]*tlsvalidate.Report, 0, len(args))
+	for _, host := range args {
+		report, err := validator.ValidateReport(ctx, host, cl.TLSPort)
+		errs.Append(err)
+		reports = append(reports, report)
 	}
-	return nil
+	if err := printReports(cl.Format, reports); err != nil {
+		return err
+	}
+	return errs.Err()
 }
 
-func validateCerts(ctx context.Context, cl *validateHostFlags, host string) error {
+func newHostValidator(cl *validateHostFlags) (*tlsvalidate.Validator, error) {
 	regexps := []*regexp.Regexp{}
 	for _, expr := range cl.Issuer.Values {
 		re, err := regexp.Compile(expr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		regexps = append(regexps, re)
 	}
+	revocation, err := tlsvalidate.ParseRevocationMethods(cl.Revocation)
+	if err != nil {
+		return nil, err
+	}
 	opts := []tlsvalidate.Option{
 		tlsvalidate.WithExpandDNSNames(cl.AllHosts),
+		tlsvalidate.WithRevocationCheck(revocation),
 		tlsvalidate.WithCheckSerialNumbers(cl.CheckSerialNumbers),
 		tlsvalidate.WithValidForAtLeast(cl.ValidFor),
 		tlsvalidate.WithIssuerRegexps(regexps...),
@@ -63,35 +94,86 @@ func validateCerts(ctx context.Context, cl *validateHostFlags, host string) erro
 	if len(cl.CustomROOTCA) > 0 {
 		root, err := devtest.CertPoolForTesting(cl.CustomROOTCA)
 		if err != nil {
-			return fmt.Errorf("failed to obtain cert pool containing %v: %w", cl.CustomROOTCA, err)
+			return nil, fmt.Errorf("failed to obtain cert pool containing %v: %w", cl.CustomROOTCA, err)
 		}
 		opts = append(opts, tlsvalidate.WithRootCAs(root))
 	}
+	return tlsvalidate.NewValidator(opts...), nil
+}
 
-	validator := tlsvalidate.NewValidator(opts...)
-	return validator.Validate(ctx, host, cl.TLSPort)
+func checkFormat(format string) error {
+	switch format {
+	case "text", "json", "yaml":
+		return nil
+	}
+	return fmt.Errorf("unsupported output format: %q, must be one of text, json or yaml", format)
 }
 
-func (certsCmd) validatePEMFile(ctx context.Context, pemFile, rootCA string) error {
-	certs, err := webapp.ReadAndParseCertsPEM(ctx, localfs.New(), pemFile)
+func printReports[T any](format string, reports []T) error {
+	var out []byte
+	var err error
+	if format == "json" {
+		out, err = json.MarshalIndent(reports, "", "  ")
+		out = append(out, '\n')
+	} else {
+		out, err = yaml.Marshal(reports)
+	}
 	if err != nil {
 		return err
 	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// pemFileReport represents the results of validating a pem file.
+type pemFileReport struct {
+	File   string                        `yaml:"file" json:"file"`
+	Passed bool                          `yaml:"passed" json:"passed"`
+	Chain  []tlsvalidate.CertificateInfo `yaml:"chain" json:"chain"`
+	Checks []tlsvalidate.CheckResult     `yaml:"checks" json:"checks"`
+}
+
+func (certsCmd) validatePEMFile(ctx context.Context, pemFile, rootCA string) (pemFileReport, error) {
+	report := pemFileReport{File: pemFile}
+	certs, err := webapp.ReadAndParseCertsPEM(ctx, localfs.New(), pemFile)
+	if err != nil {
+		return report, err
+	}
+	report.Chain = tlsvalidate.NewCertificateInfoChain(certs)
 	root, err := devtest.CertPoolForTesting(rootCA)
 	if err != nil {
-		return fmt.Errorf("failed to obtain cert pool containing %v: %w", rootCA, err)
+		return report, fmt.Errorf("failed to obtain cert pool containing %v: %w", rootCA, err)
 	}
 	_, err = webapp.VerifyCertChain("", certs, root)
-	return err
+	report.Checks = append(report.Checks, tlsvalidate.NewCheckResult("verify-chain", err))
+	report.Passed = err == nil
+	return report, err
 }
 
 func (c certsCmd) validatePEMFilesCmd(ctx context.Context, values any, args []string) error {
 	cl := values.(*validateFileFlags)
+	if err := checkFormat(cl.Format); err != nil {
+		return err
+	}
+	var errs errors.M
+	reports := make([]pemFileReport, 0, len(args))
 	for _, pemFile := range args {
-		if err := c.validatePEMFile(ctx, pemFile, cl.CustomROOTCA); err != nil {
-			return err
+		report, err := c.validatePEMFile(ctx, pemFile, cl.CustomROOTCA)
+		if cl.Format == "text" {
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%v: ok\n", pemFile)
+			continue
 		}
-		fmt.Printf("%v: ok\n", pemFile)
+		errs.Append(err)
+		reports = append(reports, report)
+	}
+	if cl.Format == "text" {
+		return nil
+	}
+	if err := printReports(cl.Format, reports); err != nil {
+		return err
 	}
-	return nil
+	return errs.Err()
 }
@@ -14,10 +14,17 @@ import (
 
 // TLSCertFlags defines commonly used flags for obtaining TLS/SSL certificates.
 // Certificates may be obtained in one of two ways: from a cache of
-// certificates, or from local files.
+// certificates, or from local files. Client certificates, for mutual TLS,
+// are verified against the CAs in tls-client-ca using the verification mode
+// specified by tls-client-auth as per ParseClientAuthType. The TLS
+// versions, cipher suites and curves may be set using one of the named
+// policies supported by ParseTLSPolicy via tls-policy.
 type TLSCertFlags struct {
-	CertFile string `subcmd:"tls-cert,,tls certificate file"`
-	KeyFile  string `subcmd:"tls-key,,tls private key file"`
+	CertFile     string `subcmd:"tls-cert,,tls certificate file"`
+	KeyFile      string `subcmd:"tls-key,,tls private key file"`
+	ClientCAFile string `subcmd:"tls-client-ca,,pem file containing the CAs used to verify client certificates"`
+	ClientAuth   string `subcmd:"tls-client-auth,,'client certificate verification mode: none, request, require-any, verify-if-given or require-and-verify'"`
+	Policy       string `subcmd:"tls-policy,,'TLS policy profile: modern, intermediate or legacy'"`
 }
 
 // Config returns a TLSCertConfig based on the supplied flags.
@@ -26,15 +33,40 @@ func (cl TLSCertFlags) TLSCertConfig() TLSCertConfig {
 }
 
 // TLSCertConfig defines configuration for TLS certificates obtained
-// from local files.
+// from local files, for the verification of client certificates and
+// the TLS policy profile, as per ParseTLSPolicy, to use.
 type TLSCertConfig struct {
-	CertFile string `yaml:"cert_file,omitempty"`
-	KeyFile  string `yaml:"key_file,omitempty"`
+	CertFile     string `yaml:"cert_file,omitempty"`
+	KeyFile      string `yaml:"key_file,omitempty"`
+	ClientCAFile string `yaml:"client_ca_file,omitempty"`
+	ClientAuth   string `yaml:"client_auth,omitempty"`
+	Policy       string `yaml:"policy,omitempty"`
 }
 
-// TLSConfig returns a tls.Config.
+// TLSConfig returns a tls.Config, configured to verify client
+// certificates as per ConfigureClientAuth if either ClientCAFile or
+// ClientAuth is specified. If Policy is specified, the versions, cipher
+// suites and curves are those of the named TLSPolicy rather than the
+// Preferred... defaults used by TLSConfigUsingCertFiles.
 func (tc TLSCertConfig) TLSConfig() (*tls.Config, error) {
-	return TLSConfigUsingCertFiles(tc.CertFile, tc.KeyFile)
+	cfg, err := TLSConfigUsingCertFiles(tc.CertFile, tc.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(tc.Policy) > 0 {
+		policy, err := ParseTLSPolicy(tc.Policy)
+		if err != nil {
+			return nil, err
+		}
+		policy.Configure(cfg)
+	}
+	if len(tc.ClientCAFile) == 0 && len(tc.ClientAuth) == 0 {
+		return cfg, nil
+	}
+	if err := ConfigureClientAuth(cfg, tc.ClientCAFile, tc.ClientAuth); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
 // HTTPServerFlags defines commonly used flags for running an http server.
@@ -0,0 +1,68 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// QueryOCSP obtains an OCSP response for leaf, which must have been issued
+// by issuer, from the first of the OCSP responders specified in leaf
+// using client. It returns the parsed response, whose signature has been
+// verified, along with the raw response which is suitable for stapling.
+func QueryOCSP(ctx context.Context, client *http.Client, leaf, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil, fmt.Errorf("certificate %v does not specify an OCSP responder", SerialNumberHex(leaf.SerialNumber))
+	}
+	der, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(der))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("ocsp responder %v: %v", leaf.OCSPServer[0], resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := ParseOCSPResponse(body, leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parsed, body, nil
+}
+
+// ParseOCSPResponse parses and verifies the signature of an OCSP response
+// for leaf, which must have been issued by issuer. Unlike
+// ocsp.ParseResponseForCert it returns an error if the response is not
+// for leaf.
+func ParseOCSPResponse(der []byte, leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	parsed, err := ocsp.ParseResponseForCert(der, leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.SerialNumber == nil || parsed.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		return nil, fmt.Errorf("ocsp response is for serial %v, not %v", SerialNumberHex(parsed.SerialNumber), SerialNumberHex(leaf.SerialNumber))
+	}
+	return parsed, nil
+}
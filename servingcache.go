@@ -9,19 +9,53 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
 	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"cloudeng.io/file"
+	"golang.org/x/crypto/ocsp"
 	"golang.org/x/net/idna"
 )
 
 type entry struct {
 	cert   *tls.Certificate
 	expiry time.Time
+	// verifyName is the host name that the certificate was verified
+	// against when it was loaded, which differs from the name under
+	// which it is stored for wildcard certificates.
+	verifyName string
+
+	// OCSP state, issuer is nil if OCSP stapling is disabled or
+	// is not possible for this certificate.
+	issuer       *x509.Certificate
+	ocspRefresh  time.Time
+	ocspFetching bool
+	// ocspExpiry is the next update time of the stapled response, after
+	// which it must no longer be served, or zero if the response does not
+	// specify one.
+	ocspExpiry time.Time
+}
+
+// dropStaple replaces the entry's certificate with a copy that has no OCSP
+// staple. The current certificate may be in use by concurrent handshakes
+// and hence must not be modified in place.
+func (e *entry) dropStaple() {
+	updated := *e.cert
+	updated.OCSPStaple = nil
+	e.cert = &updated
+	e.ocspExpiry = time.Time{}
+}
+
+// stapleExpired returns true if the entry's OCSP staple is no longer valid
+// at the specified time.
+func (e *entry) stapleExpired(when time.Time) bool {
+	return len(e.cert.OCSPStaple) > 0 && !e.ocspExpiry.IsZero() && !when.Before(e.ocspExpiry)
 }
 
 // CertServingCache implements an in-memory cache of TLS/SSL certificates
@@ -31,16 +65,57 @@ type entry struct {
 // A TTL (default of 6 hours) is used so that the in-memory cache will
 // reload certificates from the store on a periodic basis (with some jitter)
 // to allow for certificates to be refreshed.
+// Certificates are looked up in the store using the server name. If there
+// is no certificate stored under that name, a cached certificate whose SANs
+// cover it, or a certificate stored under the WildcardCertName, or name,
+// of its parent domain whose SANs cover it is served instead. Hence a
+// single wildcard certificate can be used for all subdomains.
+// A host may have both an ECDSA and an RSA certificate, the latter being
+// stored under its RSACertName. The certificate stored under the host's
+// name, typically ECDSA, is preferred and the RSA certificate is only
+// loaded and served for clients that do not support the preferred one
+// as determined by tls.ClientHelloInfo.SupportsCertificate.
+// If OCSP stapling is enabled, via WithCertCacheOCSPStapling, an OCSP
+// response is obtained in the background from the leaf certificate's OCSP
+// responder when it is loaded, the certificate being served without a
+// staple until then, and is refreshed in the background thereafter. Good
+// responses are stapled to the certificate until their next update time
+// and a certificate that the responder reports as revoked is evicted from
+// the cache and will not be served.
 type CertServingCache struct {
 	certStore    file.ReadFileFS
 	ttl          time.Duration
 	rootCAs      *x509.CertPool
 	nowFunc      func() time.Time
 	cacheMu      sync.Mutex
-	cache        map[string]entry
+	cache        map[string]entry     // keyed by store name
+	aliases      map[string]string    // server name to store name
+	absent       map[string]time.Time // RSA store names known not to exist
+	revoked      map[string]revocation
 	allowedHosts []string
+
+	ocspClient  *http.Client
+	ocspRetry   time.Duration
+	ocspTimeout time.Duration
+
+	eventHandler  func(context.Context, CertCacheEvent)
+	eventMetric   CounterVecInc
+	expiryWarning time.Duration
 }
 
+// revocation records that the certificate stored under a given name has
+// been revoked so that it is neither reloaded nor rechecked, which would
+// serve it again until a new OCSP response is obtained, until the OCSP
+// retry interval has elapsed.
+type revocation struct {
+	err   error
+	until time.Time
+}
+
+// ErrCertificateRevoked is returned by CertServingCache.GetCertificate when
+// the OCSP responder for a certificate reports that it has been revoked.
+var ErrCertificateRevoked = errors.New("certificate has been revoked")
+
 // CertServingCacheOption represents options to NewCertServingCache.
 type CertServingCacheOption func(*CertServingCache)
 
@@ -69,23 +144,58 @@ func WithCertCacheNowFunc(fn func() time.Time) CertServingCacheOption {
 }
 
 // WithCertCacheAllowedHosts sets the allowed hosts that the cache will
-// serve certificates for.
+// serve certificates for. A host may be a wildcard pattern, such as
+// *.example.com, that matches any single label in place of the *.
 func WithCertCacheAllowedHosts(hosts ...string) CertServingCacheOption {
 	return func(cs *CertServingCache) {
 		cs.allowedHosts = hosts
 	}
 }
 
+// WithCertCacheOCSPStapling enables OCSP stapling and revocation checking
+// using the supplied http.Client, or http.DefaultClient if nil, to
+// communicate with the OCSP responder specified in the leaf certificate's
+// Authority Information Access extension. Responses are refreshed half way
+// through their validity period. Certificates that do not specify an OCSP
+// responder, or whose issuer is not included in the stored chain, are
+// served without a staple.
+func WithCertCacheOCSPStapling(client *http.Client) CertServingCacheOption {
+	return func(cs *CertServingCache) {
+		if client == nil {
+			client = http.DefaultClient
+		}
+		cs.ocspClient = client
+	}
+}
+
+// WithCertCacheOCSPRetry sets the interval after which a failed attempt to
+// obtain an OCSP response is retried, the interval at which responses
+// that do not specify a next update time are refreshed and the interval
+// for which a revoked certificate is remembered before being reloaded
+// from the store. The default is 5 minutes.
+func WithCertCacheOCSPRetry(interval time.Duration) CertServingCacheOption {
+	return func(cs *CertServingCache) {
+		cs.ocspRetry = interval
+	}
+}
+
 // NewCertServingCache returns a new instance of CertServingCache that
 // uses the supplied file.ReadFileFS. The supplied context is a placeholder
 // for future use and is not currently used. The GetCertificate method uses
 // the context in the tls.ClientHelloInfo to read the certificate from the store.
 func NewCertServingCache(_ context.Context, certStore file.ReadFileFS, opts ...CertServingCacheOption) *CertServingCache {
 	sc := &CertServingCache{
-		cache:     map[string]entry{},
-		certStore: certStore,
-		nowFunc:   time.Now,
-		ttl:       time.Hour * 6,
+		cache:       map[string]entry{},
+		aliases:     map[string]string{},
+		absent:      map[string]time.Time{},
+		revoked:     map[string]revocation{},
+		certStore:   certStore,
+		nowFunc:     time.Now,
+		ttl:         time.Hour * 6,
+		ocspRetry:   time.Minute * 5,
+		ocspTimeout: time.Second * 10,
+
+		expiryWarning: DefaultCertExpiryWarning,
 	}
 	for _, fn := range opts {
 		fn(sc)
@@ -93,24 +203,158 @@ func NewCertServingCache(_ context.Context, certStore file.ReadFileFS, opts ...C
 	return sc
 }
 
-func (m *CertServingCache) get(name string, when time.Time) *tls.Certificate {
+// get returns the cached certificate for name, or for the store name
+// that it is an alias for, along with the store name.
+func (m *CertServingCache) get(name string, when time.Time) (string, *tls.Certificate) {
 	m.cacheMu.Lock()
 	defer m.cacheMu.Unlock()
-	if entry, ok := m.cache[name]; ok {
-		if entry.expiry.After(when) {
-			return entry.cert
+	if alias, ok := m.aliases[name]; ok {
+		if _, ok := m.cache[alias]; !ok {
+			delete(m.aliases, name)
+		} else {
+			name = alias
 		}
 	}
-	return nil
+	e, ok := m.cache[name]
+	if !ok || !e.expiry.After(when) {
+		return "", nil
+	}
+	if e.stapleExpired(when) {
+		e.dropStaple()
+		m.cache[name] = e
+	}
+	if e.issuer != nil && !e.ocspFetching && !when.Before(e.ocspRefresh) {
+		e.ocspFetching = true
+		m.cache[name] = e
+		go m.refreshOCSP(name, e.cert, e.issuer)
+	}
+	return name, e.cert
 }
 
-func (m *CertServingCache) put(name string, cert *tls.Certificate, expiration time.Duration) {
+// put adds the entry to the cache. If OCSP stapling is enabled for the
+// entry but no response has been obtained for it, one is obtained in the
+// background so that handshakes need not wait on the OCSP responder; the
+// certificate is served without a staple in the meantime.
+func (m *CertServingCache) put(name string, e entry) {
 	m.cacheMu.Lock()
 	defer m.cacheMu.Unlock()
-	m.cache[name] = entry{
-		cert:   cert,
-		expiry: m.nowFunc().Add(expiration),
+	e.expiry = m.nowFunc().Add(m.ttl)
+	if e.issuer != nil && e.ocspRefresh.IsZero() {
+		e.ocspFetching = true
+		go m.refreshOCSP(name, e.cert, e.issuer)
+	}
+	m.cache[name] = e
+	delete(m.revoked, name)
+}
+
+// revokedErr returns the error recorded for the certificate stored as
+// storeName if it has been found to be revoked within the OCSP retry
+// interval.
+func (m *CertServingCache) revokedErr(storeName string, when time.Time) error {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	r, ok := m.revoked[storeName]
+	if !ok {
+		return nil
+	}
+	if !when.Before(r.until) {
+		delete(m.revoked, storeName)
+		return nil
+	}
+	return r.err
+}
+
+// covering returns a cached certificate, and its store name, whose SANs
+// cover name and records an alias for name so that subsequent lookups need
+// not search the cache. RSA certificates are ignored since they are only
+// ever served as alternatives to the preferred certificate.
+func (m *CertServingCache) covering(name string, when time.Time) (string, *tls.Certificate) {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	for _, key := range slices.Sorted(maps.Keys(m.cache)) {
+		if isRSACertName(key) {
+			continue
+		}
+		e := m.cache[key]
+		if e.expiry.After(when) && e.cert.Leaf.VerifyHostname(name) == nil {
+			m.aliases[name] = key
+			return key, e.cert
+		}
+	}
+	return "", nil
+}
+
+func (m *CertServingCache) alias(name, storeName string) {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	m.aliases[name] = storeName
+}
+
+// WildcardCertName returns the name under which the certificate for
+// a wildcard domain, such as *.example.com, is stored, namely with the
+// wildcard prefix replaced by _wildcard, eg. _wildcard.example.com, since
+// * is not a valid character for many stores. Domains without a wildcard
+// prefix are returned unchanged.
+func WildcardCertName(domain string) string {
+	if parent, ok := strings.CutPrefix(domain, "*."); ok {
+		return "_wildcard." + parent
+	}
+	return domain
+}
+
+// RSACertNameSuffix is appended to a certificate's store name to obtain
+// the name under which an RSA certificate for the same host is stored.
+// This is the convention used by autocert, and hence by certcache, which
+// only stores such certificates when configured with certcache.WithAllowRSAKeys.
+const RSACertNameSuffix = "+rsa"
+
+// RSACertName returns the name under which the RSA certificate for the
+// host whose certificate is stored as name is stored, eg.
+// example.com+rsa.
+func RSACertName(name string) string {
+	return name + RSACertNameSuffix
+}
+
+func isRSACertName(name string) bool {
+	return strings.HasSuffix(name, RSACertNameSuffix)
+}
+
+// fallbackNames returns the names, in order of preference, under which a
+// certificate that covers name may be stored if there is none stored
+// under name itself, namely the wildcard entry for its parent domain,
+// using either the WildcardCertName or literal form, and the parent
+// domain itself, which may have been issued with a wildcard SAN.
+func fallbackNames(name string) []string {
+	_, parent, ok := strings.Cut(name, ".")
+	if !ok || !strings.Contains(parent, ".") {
+		return nil
+	}
+	return []string{WildcardCertName("*." + parent), "*." + parent, parent}
+}
+
+// hostAllowed returns true if name matches one of the allowed host
+// patterns.
+func (m *CertServingCache) hostAllowed(name string) bool {
+	if len(m.allowedHosts) == 0 {
+		return true
 	}
+	return slices.ContainsFunc(m.allowedHosts, func(pattern string) bool {
+		return matchHostPattern(pattern, name)
+	})
+}
+
+// matchHostPattern returns true if host matches pattern, which may
+// include a leading wildcard label that matches any single label.
+func matchHostPattern(pattern, host string) bool {
+	if strings.EqualFold(pattern, host) {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(pattern, "*.")
+	if !ok {
+		return false
+	}
+	_, parent, ok := strings.Cut(host, ".")
+	return ok && strings.EqualFold(parent, suffix)
 }
 
 // GetCertificate can be assigned to tls.Config.GetCertificate.
@@ -128,33 +372,115 @@ func (m *CertServingCache) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Cert
 		return nil, fmt.Errorf("server name contains invalid character")
 	}
 
-	if len(m.allowedHosts) > 0 && !slices.Contains(m.allowedHosts, name) {
+	if !m.hostAllowed(name) {
 		return nil, fmt.Errorf("server name %v is not in the list of allowed hosts: %v", name, m.allowedHosts)
 	}
 
 	now := m.nowFunc()
-	if cert := m.get(name, now); cert != nil {
+	ctx := hello.Context()
+	storeName, cert, err := m.lookup(ctx, name, now)
+	if err != nil {
+		return nil, err
+	}
+	if isRSACertName(storeName) || hello.SupportsCertificate(cert) == nil {
 		return cert, nil
 	}
+	// The client does not support the preferred certificate, typically
+	// because it is ECDSA, so try the RSA certificate for the same host.
+	if rsaCert := m.lookupRSA(ctx, RSACertName(storeName), name, now); rsaCert != nil && hello.SupportsCertificate(rsaCert) == nil {
+		return rsaCert, nil
+	}
+	return cert, nil
+}
+
+// lookup returns the preferred certificate for name, and the name under
+// which it is stored, loading it from the store if need be.
+func (m *CertServingCache) lookup(ctx context.Context, name string, now time.Time) (string, *tls.Certificate, error) {
+	if storeName, cert := m.get(name, now); cert != nil {
+		return storeName, cert, nil
+	}
+	if err := m.revokedErr(name, now); err != nil {
+		return "", nil, err
+	}
+
+	e, err := m.load(ctx, name, name, now)
+	if err == nil {
+		m.put(name, e)
+		return name, e.cert, nil
+	}
 
-	data, err := m.certStore.ReadFileCtx(hello.Context(), name)
+	// Fall back to a cached certificate, or a wildcard or parent domain
+	// certificate in the store, whose SANs cover the server name.
+	if storeName, cert := m.covering(name, now); cert != nil {
+		return storeName, cert, nil
+	}
+	for _, storeName := range fallbackNames(name) {
+		if err := m.revokedErr(storeName, now); err != nil {
+			return "", nil, err
+		}
+		fe, ferr := m.load(ctx, storeName, name, now)
+		if ferr != nil {
+			continue
+		}
+		m.put(storeName, fe)
+		m.alias(name, storeName)
+		return storeName, fe.cert, nil
+	}
+	return "", nil, err
+}
+
+// lookupRSA returns the RSA certificate stored as storeName, if any,
+// loading it from the store if need be. Store names that do not exist, or
+// whose certificates cannot be used, are remembered for the cache's TTL to
+// avoid reading from the store on every handshake with a legacy client.
+func (m *CertServingCache) lookupRSA(ctx context.Context, storeName, name string, now time.Time) *tls.Certificate {
+	if _, cert := m.get(storeName, now); cert != nil {
+		return cert
+	}
+	if m.revokedErr(storeName, now) != nil {
+		return nil
+	}
+	m.cacheMu.Lock()
+	until, absent := m.absent[storeName]
+	m.cacheMu.Unlock()
+	if absent && now.Before(until) {
+		return nil
+	}
+	e, err := m.load(ctx, storeName, name, now)
 	if err != nil {
-		return nil, err
+		m.cacheMu.Lock()
+		m.absent[storeName] = now.Add(m.ttl)
+		m.cacheMu.Unlock()
+		return nil
+	}
+	m.cacheMu.Lock()
+	delete(m.absent, storeName)
+	m.cacheMu.Unlock()
+	m.put(storeName, e)
+	return e.cert
+}
+
+// load reads, verifies and parses the certificate stored as storeName
+// from the store, verifying that it is valid for the host name name.
+func (m *CertServingCache) load(ctx context.Context, storeName, name string, now time.Time) (entry, error) {
+	data, err := m.certStore.ReadFileCtx(ctx, storeName)
+	if err != nil {
+		return entry{}, err
 	}
 
 	// New cert file loaded.
 	privPEM, _, certsPEM := ParsePEM(data)
 	if len(certsPEM) == 0 {
-		return nil, fmt.Errorf("certServingCache: no certificates found for %v", name)
+		return entry{}, fmt.Errorf("certServingCache: no certificates found for %v", name)
 	}
 	if len(privPEM) == 0 {
-		return nil, fmt.Errorf("certServingCache: no private key found for %v", name)
+		return entry{}, fmt.Errorf("certServingCache: no private key found for %v", name)
 	}
 
 	// Verify cert chain.
 	certs, err := parseCertsPEM(certsPEM)
 	if err != nil {
-		return nil, err
+		return entry{}, err
 	}
 	opts := x509.VerifyOptions{
 		DNSName:     name,
@@ -163,11 +489,11 @@ func (m *CertServingCache) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Cert
 	}
 	_, err = verifyCertChainOpts(certs, opts)
 	if err != nil {
-		return nil, fmt.Errorf("certServingCache: failed to verify certificate for %v: %w", name, err)
+		return entry{}, fmt.Errorf("certServingCache: failed to verify certificate for %v: %w", name, err)
 	}
 
 	if certs[0].IsCA {
-		return nil, fmt.Errorf("certServingCache: leaf certificate is a CA cert for %v", name)
+		return entry{}, fmt.Errorf("certServingCache: leaf certificate is a CA cert for %v", name)
 	}
 
 	// Encode the full chain (leaf first, then intermediates) so that
@@ -181,9 +507,109 @@ func (m *CertServingCache) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Cert
 	priv := pem.EncodeToMemory(privPEM[0])
 	tlscert, err := tls.X509KeyPair(chainPEM, priv)
 	if err != nil {
-		return nil, fmt.Errorf("certServingCache: failed to load x509 key pair for %v: %w", name, err)
+		return entry{}, fmt.Errorf("certServingCache: failed to load x509 key pair for %v: %w", name, err)
+	}
+
+	e := entry{cert: &tlscert, verifyName: name}
+	if m.ocspClient != nil && len(certs) >= 2 && len(certs[0].OCSPServer) > 0 {
+		e.issuer = certs[1]
+	}
+	return e, nil
+}
+
+// staple obtains an OCSP response for a newly loaded certificate, if OCSP
+// stapling is enabled for it, and staples it to the certificate. It is used
+// when certificates are reloaded in the background, handshakes rely on put
+// to obtain the response asynchronously. It returns
+// an error that wraps ErrCertificateRevoked if the certificate has been
+// revoked, in which case the revocation is recorded until the response is
+// due to be refreshed.
+func (m *CertServingCache) staple(ctx context.Context, name string, e *entry) error {
+	if e.issuer == nil {
+		return nil
 	}
+	staple, nextUpdate, refresh, err := m.fetchOCSP(ctx, e.cert.Leaf, e.issuer)
+	if errors.Is(err, ErrCertificateRevoked) {
+		err = fmt.Errorf("certServingCache: %v: %w", name, err)
+		m.cacheMu.Lock()
+		m.revoked[name] = revocation{err: err, until: refresh}
+		m.cacheMu.Unlock()
+		return err
+	}
+	e.cert.OCSPStaple = staple
+	e.ocspExpiry = nextUpdate
+	e.ocspRefresh = refresh
+	return nil
+}
 
-	m.put(name, &tlscert, m.ttl)
-	return &tlscert, nil
+// refreshOCSP obtains a new OCSP response for the cached certificate and
+// either replaces the cached certificate with one that staples the new
+// response or evicts it if it has been revoked. If no new response is
+// obtained the existing staple is retained until its next update time
+// and dropped thereafter, or immediately if it does not specify one.
+func (m *CertServingCache) refreshOCSP(name string, cert *tls.Certificate, issuer *x509.Certificate) {
+	staple, nextUpdate, refresh, err := m.fetchOCSP(context.Background(), cert.Leaf, issuer)
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	e, ok := m.cache[name]
+	if !ok || e.cert.Leaf != cert.Leaf {
+		// The entry has been replaced whilst the response was being fetched.
+		return
+	}
+	if errors.Is(err, ErrCertificateRevoked) {
+		delete(m.cache, name)
+		m.revoked[name] = revocation{
+			err:   fmt.Errorf("certServingCache: %v: %w", name, err),
+			until: refresh,
+		}
+		return
+	}
+	switch {
+	case len(staple) > 0:
+		// The current certificate may be in use by concurrent handshakes
+		// and hence a copy is made rather than modifying it in place.
+		updated := *e.cert
+		updated.OCSPStaple = staple
+		e.cert = &updated
+		e.ocspExpiry = nextUpdate
+	case len(e.cert.OCSPStaple) > 0 && (e.ocspExpiry.IsZero() || e.stapleExpired(m.nowFunc())):
+		e.dropStaple()
+	}
+	e.ocspRefresh = refresh
+	e.ocspFetching = false
+	m.cache[name] = e
+}
+
+// fetchOCSP obtains an OCSP response for leaf from its OCSP responder and
+// returns the response to be stapled, if the certificate is good, its next
+// update time and the time at which the response should be refreshed. It
+// returns an error that wraps ErrCertificateRevoked if the certificate has
+// been revoked.
+func (m *CertServingCache) fetchOCSP(ctx context.Context, leaf, issuer *x509.Certificate) ([]byte, time.Time, time.Time, error) {
+	now := m.nowFunc()
+	retry := now.Add(m.ocspRetry)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.ocspTimeout)
+	defer cancel()
+	parsed, body, err := QueryOCSP(ctx, m.ocspClient, leaf, issuer)
+	if err != nil {
+		return nil, time.Time{}, retry, err
+	}
+	switch parsed.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		return nil, time.Time{}, retry, fmt.Errorf("serial %v revoked at %v: %w", SerialNumberHex(leaf.SerialNumber), parsed.RevokedAt, ErrCertificateRevoked)
+	default:
+		return nil, time.Time{}, retry, nil
+	}
+	if parsed.NextUpdate.IsZero() {
+		return body, time.Time{}, retry, nil
+	}
+	refresh := parsed.ThisUpdate.Add(parsed.NextUpdate.Sub(parsed.ThisUpdate) / 2)
+	if refresh.Before(now) {
+		refresh = retry
+	}
+	return body, parsed.NextUpdate, refresh, nil
 }
@@ -0,0 +1,232 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCertExpiryWarning is the default period before a stored
+// certificate expires within which CertExpiring events are reported.
+const DefaultCertExpiryWarning = time.Hour * 24 * 14
+
+// CertCacheEventKind represents the kind of a CertCacheEvent.
+type CertCacheEventKind int
+
+const (
+	// CertLoaded is reported when the refresher loads a certificate that
+	// was not previously cached.
+	CertLoaded CertCacheEventKind = iota
+	// CertRotated is reported when the refresher replaces a cached
+	// certificate with one that has a different serial number.
+	CertRotated
+	// CertExpiring is reported whenever the refresher finds that a
+	// stored certificate will expire within the expiry warning period.
+	CertExpiring
+	// CertRefreshFailed is reported when the refresher fails to load a
+	// certificate from the store, or the stored certificate has been
+	// revoked. The previously cached certificate, if any, continues to be
+	// served.
+	CertRefreshFailed
+)
+
+// String implements fmt.Stringer.
+func (k CertCacheEventKind) String() string {
+	switch k {
+	case CertLoaded:
+		return "loaded"
+	case CertRotated:
+		return "rotated"
+	case CertExpiring:
+		return "expiring"
+	case CertRefreshFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// CertCacheEventMetricsColumns returns the list of columns that will be
+// used for the event metric. Host is populated with the host name and
+// event with the kind of the event as per CertCacheEventValues.
+func CertCacheEventMetricsColumns() []string {
+	return []string{"host", "event"}
+}
+
+// CertCacheEventValues returns the list of values that will be used for
+// the "event" label of the event metric.
+func CertCacheEventValues() []string {
+	return []string{CertLoaded.String(), CertRotated.String(), CertExpiring.String(), CertRefreshFailed.String()}
+}
+
+// CertCacheEvent is reported by the CertServingCache refresher.
+type CertCacheEvent struct {
+	Kind           CertCacheEventKind
+	Host           string
+	Serial         string    // Serial number, in hex, of the current certificate.
+	PreviousSerial string    // Serial number of the replaced certificate for CertRotated.
+	NotAfter       time.Time // Expiry time of the current certificate.
+	Err            error     // The error encountered for CertRefreshFailed.
+}
+
+// WithCertCacheEventHandler sets a function to be called, synchronously,
+// for every event reported by the refresher started by
+// CertServingCache.Start.
+func WithCertCacheEventHandler(fn func(context.Context, CertCacheEvent)) CertServingCacheOption {
+	return func(cs *CertServingCache) {
+		cs.eventHandler = fn
+	}
+}
+
+// WithCertCacheEventMetric configures the cache to increment the provided
+// metric for every event reported by the refresher started by
+// CertServingCache.Start. The metric is incremented with the labels
+// returned by CertCacheEventMetricsColumns.
+func WithCertCacheEventMetric(metric CounterVecInc) CertServingCacheOption {
+	return func(cs *CertServingCache) {
+		cs.eventMetric = metric
+	}
+}
+
+// WithCertCacheExpiryWarning sets the period before a stored certificate
+// expires within which CertExpiring events are reported. The default is
+// DefaultCertExpiryWarning.
+func WithCertCacheExpiryWarning(period time.Duration) CertServingCacheOption {
+	return func(cs *CertServingCache) {
+		cs.expiryWarning = period
+	}
+}
+
+// Start starts a background refresher that immediately loads the
+// certificates for the hosts specified via WithCertCacheAllowedHosts,
+// using the WildcardCertName for wildcard patterns, and then polls the
+// store at the specified interval, reloading those certificates as well
+// as any others that have been cached as a result of calls to
+// GetCertificate. A cached certificate is replaced as soon as the stored
+// certificate's serial number changes rather than when its TTL expires.
+// The refresher runs until ctx is canceled or the returned function is
+// called, which waits for the refresher to stop.
+func (m *CertServingCache) Start(ctx context.Context, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.refresh(ctx, interval)
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func (m *CertServingCache) refresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh reloads the certificates for the allowed hosts and for all
+// currently cached hosts from the store, reporting events as per
+// Start. It is called periodically by the refresher started by Start
+// but may also be called directly, for example in response to an
+// external notification that the store has changed.
+func (m *CertServingCache) Refresh(ctx context.Context) {
+	// Map store names to the host names to verify them against.
+	hosts := map[string]string{}
+	m.cacheMu.Lock()
+	for storeName, e := range m.cache {
+		hosts[storeName] = e.verifyName
+	}
+	for _, h := range m.allowedHosts {
+		storeName, verifyName := h, h
+		if parent, ok := strings.CutPrefix(h, "*."); ok {
+			storeName, verifyName = WildcardCertName(h), "wildcard."+parent
+		}
+		if alias, ok := m.aliases[h]; ok {
+			// Served by a wildcard or parent domain certificate.
+			storeName, verifyName = alias, h
+		}
+		if _, ok := hosts[storeName]; !ok {
+			hosts[storeName] = verifyName
+		}
+	}
+	m.cacheMu.Unlock()
+	for _, host := range slices.Sorted(maps.Keys(hosts)) {
+		if ctx.Err() != nil {
+			return
+		}
+		m.refreshHost(ctx, host, hosts[host])
+	}
+}
+
+func (m *CertServingCache) refreshHost(ctx context.Context, host, verifyName string) {
+	now := m.nowFunc()
+	loaded, err := m.load(ctx, host, verifyName, now)
+	if err != nil {
+		m.report(ctx, CertCacheEvent{Kind: CertRefreshFailed, Host: host, Err: err})
+		return
+	}
+	ev := CertCacheEvent{
+		Host:     host,
+		Serial:   SerialNumberHex(loaded.cert.Leaf.SerialNumber),
+		NotAfter: loaded.cert.Leaf.NotAfter,
+	}
+	m.cacheMu.Lock()
+	current, cached := m.cache[host]
+	m.cacheMu.Unlock()
+	switch {
+	case !cached:
+		ev.Kind = CertLoaded
+	case current.cert.Leaf.SerialNumber.Cmp(loaded.cert.Leaf.SerialNumber) != 0:
+		ev.Kind = CertRotated
+		ev.PreviousSerial = SerialNumberHex(current.cert.Leaf.SerialNumber)
+	default:
+		// Unchanged, retain the current entry, and hence any OCSP staple,
+		// but extend its lifetime since it has just been validated.
+		m.cacheMu.Lock()
+		if current, ok := m.cache[host]; ok {
+			current.expiry = now.Add(m.ttl)
+			m.cache[host] = current
+		}
+		m.cacheMu.Unlock()
+		m.reportExpiring(ctx, ev, now)
+		return
+	}
+	if err := m.staple(ctx, host, &loaded); err != nil {
+		m.report(ctx, CertCacheEvent{Kind: CertRefreshFailed, Host: host, Err: err})
+		return
+	}
+	m.put(host, loaded)
+	m.report(ctx, ev)
+	m.reportExpiring(ctx, ev, now)
+}
+
+func (m *CertServingCache) reportExpiring(ctx context.Context, ev CertCacheEvent, now time.Time) {
+	if ev.NotAfter.Sub(now) < m.expiryWarning {
+		ev.Kind, ev.PreviousSerial = CertExpiring, ""
+		m.report(ctx, ev)
+	}
+}
+
+func (m *CertServingCache) report(ctx context.Context, ev CertCacheEvent) {
+	if m.eventMetric != nil {
+		m.eventMetric(ctx, ev.Host, ev.Kind.String())
+	}
+	if m.eventHandler != nil {
+		m.eventHandler(ctx, ev)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp"
+)
+
+type certCacheEvents struct {
+	sync.Mutex
+	events  []webapp.CertCacheEvent
+	metrics map[string]int
+}
+
+func (ce *certCacheEvents) handler(_ context.Context, ev webapp.CertCacheEvent) {
+	ce.Lock()
+	defer ce.Unlock()
+	ce.events = append(ce.events, ev)
+}
+
+func (ce *certCacheEvents) metric(_ context.Context, labels ...string) {
+	ce.Lock()
+	defer ce.Unlock()
+	ce.metrics[labels[0]+":"+labels[1]]++
+}
+
+func (ce *certCacheEvents) waitFor(t *testing.T, kind webapp.CertCacheEventKind) webapp.CertCacheEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ce.Lock()
+		idx := slices.IndexFunc(ce.events, func(ev webapp.CertCacheEvent) bool {
+			return ev.Kind == kind
+		})
+		if idx >= 0 {
+			ev := ce.events[idx]
+			ce.events = slices.Delete(ce.events, 0, idx+1)
+			ce.Unlock()
+			return ev
+		}
+		ce.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %v event", kind)
+	return webapp.CertCacheEvent{}
+}
+
+func TestCertServingCache_Refresh(t *testing.T) {
+	ctx := t.Context()
+	domain := "example.com"
+	ca := newOCSPTestResponder(t, time.Now())
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.ca)
+
+	store := newMockCertStore()
+	if err := store.Put(ctx, domain, ca.issue(t, domain)); err != nil {
+		t.Fatal(err)
+	}
+
+	events := &certCacheEvents{metrics: map[string]int{}}
+	cache := webapp.NewCertServingCache(ctx, store,
+		webapp.WithCertCacheRootCAs(roots),
+		webapp.WithCertCacheAllowedHosts(domain),
+		webapp.WithCertCacheExpiryWarning(24*time.Hour),
+		webapp.WithCertCacheEventHandler(events.handler),
+		webapp.WithCertCacheEventMetric(events.metric))
+
+	stop := cache.Start(ctx, 20*time.Millisecond)
+	defer stop()
+
+	// The allowed hosts are preloaded.
+	loaded := events.waitFor(t, webapp.CertLoaded)
+	if got, want := loaded.Host, domain; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The test certificates expire within the expiry warning period.
+	expiring := events.waitFor(t, webapp.CertExpiring)
+	if got, want := expiring.Serial, loaded.Serial; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	cert, err := cache.GetCertificate(&tls.ClientHelloInfo{ServerName: domain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := webapp.SerialNumberHex(cert.Leaf.SerialNumber), loaded.Serial; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A rotated certificate is swapped in without waiting for the TTL.
+	if err := store.Put(ctx, domain, ca.issue(t, domain)); err != nil {
+		t.Fatal(err)
+	}
+	rotated := events.waitFor(t, webapp.CertRotated)
+	if got, want := rotated.PreviousSerial, loaded.Serial; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if rotated.Serial == loaded.Serial {
+		t.Errorf("serial number did not change")
+	}
+	cert, err = cache.GetCertificate(&tls.ClientHelloInfo{ServerName: domain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := webapp.SerialNumberHex(cert.Leaf.SerialNumber), rotated.Serial; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Failures to read the store are reported and the cached
+	// certificate continues to be served.
+	if err := store.Delete(ctx, domain); err != nil {
+		t.Fatal(err)
+	}
+	if failed := events.waitFor(t, webapp.CertRefreshFailed); failed.Err == nil {
+		t.Errorf("expected an error")
+	}
+	cert, err = cache.GetCertificate(&tls.ClientHelloInfo{ServerName: domain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := webapp.SerialNumberHex(cert.Leaf.SerialNumber), rotated.Serial; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	stop()
+	events.Lock()
+	defer events.Unlock()
+	for _, kind := range []string{"loaded", "rotated", "expiring", "failed"} {
+		if events.metrics[domain+":"+kind] == 0 {
+			t.Errorf("no metric recorded for %v", kind)
+		}
+	}
+}
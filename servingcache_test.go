@@ -7,22 +7,29 @@ package webapp_test
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
+	"io"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"cloudeng.io/webapp"
 	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/crypto/ocsp"
 )
 
 // mockCertStore is a mock implementation of the CertStore interface for testing.
@@ -417,3 +424,526 @@ func TestCertServingCache_AllowedHosts(t *testing.T) {
 		t.Errorf("got %v, want %v", err, autocert.ErrCacheMiss)
 	}
 }
+
+// ocspTestResponder is an OCSP responder that reports the configured
+// status for all certificates issued by its CA.
+type ocspTestResponder struct {
+	*httptest.Server
+	ca       *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	status   atomic.Int32
+	requests atomic.Int32
+	now      time.Time
+	// hold, if set, delays responses until it is closed.
+	hold chan struct{}
+}
+
+func newOCSPTestResponder(t *testing.T, now time.Time) *ocspTestResponder {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ocsp-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour * 24),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &ocspTestResponder{ca: ca, caKey: caKey, now: now}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.respond))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *ocspTestResponder) respond(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	if r.hold != nil {
+		<-r.hold
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ocspReq, err := ocsp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tmpl := ocsp.Response{
+		Status:       int(r.status.Load()),
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   r.now,
+		NextUpdate:   r.now.Add(2 * time.Hour),
+	}
+	if tmpl.Status == ocsp.Revoked {
+		tmpl.RevokedAt = r.now
+		tmpl.RevocationReason = ocsp.KeyCompromise
+	}
+	resp, err := ocsp.CreateResponse(r.ca, r.ca, tmpl, r.caKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = w.Write(resp)
+}
+
+// issue returns the PEM encoded private key, leaf and CA certificates for
+// the specified domains with the responder specified as the leaf's OCSP
+// server.
+func (r *ocspTestResponder) issue(t *testing.T, domains ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.issueForKey(t, key, domains...)
+}
+
+func (r *ocspTestResponder) issueRSA(t *testing.T, domains ...string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.issueForKey(t, key, domains...)
+}
+
+func (r *ocspTestResponder) issueForKey(t *testing.T, key crypto.Signer, domains ...string) []byte {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    r.now.Add(-time.Hour),
+		NotAfter:     r.now.Add(time.Hour * 12),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		OCSPServer:   []string{r.URL},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, r.ca, key.Public(), r.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_ = pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: r.ca.Raw})
+	return buf.Bytes()
+}
+
+// waitForStaple waits for the certificate served for hello to have an
+// OCSP staple since responses are obtained in the background.
+func waitForStaple(t *testing.T, cache *webapp.CertServingCache, hello *tls.ClientHelloInfo) *tls.Certificate {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err := cache.GetCertificate(hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.OCSPStaple) > 0 {
+			return cert
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for an OCSP staple")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCertServingCache_OCSPStapling(t *testing.T) {
+	ctx := t.Context()
+	domain := "example.com"
+	startTime := time.Now().Truncate(time.Second)
+	responder := newOCSPTestResponder(t, startTime)
+	responder.status.Store(int32(ocsp.Good))
+
+	store := newMockCertStore()
+	if err := store.Put(ctx, domain, responder.issue(t, domain)); err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(responder.ca)
+
+	var mu sync.Mutex
+	mockTime := startTime
+	nowFunc := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return mockTime
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		mockTime = mockTime.Add(d)
+	}
+
+	cache := webapp.NewCertServingCache(ctx, store,
+		webapp.WithCertCacheRootCAs(roots),
+		webapp.WithCertCacheNowFunc(nowFunc),
+		webapp.WithCertCacheOCSPStapling(responder.Client()))
+
+	hello := &tls.ClientHelloInfo{ServerName: domain}
+	cert := waitForStaple(t, cache, hello)
+	staple, err := ocsp.ParseResponseForCert(cert.OCSPStaple, cert.Leaf, responder.ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := staple.Status, ocsp.Good; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The response is not refreshed until half way through its validity.
+	advance(30 * time.Minute)
+	if _, err := cache.GetCertificate(hello); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := responder.requests.Load(), int32(1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The certificate is evicted once the responder reports it as revoked
+	// and is not served thereafter.
+	responder.status.Store(int32(ocsp.Revoked))
+	advance(time.Hour)
+	if _, err := cache.GetCertificate(hello); err != nil {
+		t.Fatalf("the cached certificate should be served whilst being refreshed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err = cache.GetCertificate(hello)
+		if err != nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !errors.Is(err, webapp.ErrCertificateRevoked) {
+		t.Fatalf("got %v, want %v", err, webapp.ErrCertificateRevoked)
+	}
+	if _, err := cache.GetCertificate(hello); !errors.Is(err, webapp.ErrCertificateRevoked) {
+		t.Fatalf("got %v, want %v", err, webapp.ErrCertificateRevoked)
+	}
+
+	// The revocation is remembered so that the certificate is neither
+	// reloaded nor rechecked until the retry interval has elapsed.
+	requests := responder.requests.Load()
+	for range 3 {
+		if _, err := cache.GetCertificate(hello); !errors.Is(err, webapp.ErrCertificateRevoked) {
+			t.Fatalf("got %v, want %v", err, webapp.ErrCertificateRevoked)
+		}
+	}
+	if got, want := responder.requests.Load(), requests; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	responder.status.Store(int32(ocsp.Good))
+	advance(10 * time.Minute)
+	waitForStaple(t, cache, hello)
+	if got, want := responder.requests.Load(), requests+1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCertServingCache_OCSPUnavailable(t *testing.T) {
+	ctx := t.Context()
+	domain := "example.com"
+	responder := newOCSPTestResponder(t, time.Now())
+	store := newMockCertStore()
+	if err := store.Put(ctx, domain, responder.issue(t, domain)); err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(responder.ca)
+	// The certificate is served without a staple if the responder is
+	// unavailable.
+	responder.Close()
+	cache := webapp.NewCertServingCache(ctx, store,
+		webapp.WithCertCacheRootCAs(roots),
+		webapp.WithCertCacheOCSPStapling(nil))
+	cert, err := cache.GetCertificate(&tls.ClientHelloInfo{ServerName: domain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.OCSPStaple) != 0 {
+		t.Errorf("unexpected OCSP staple")
+	}
+}
+
+func TestCertServingCache_OCSPAsync(t *testing.T) {
+	ctx := t.Context()
+	domain := "example.com"
+	responder := newOCSPTestResponder(t, time.Now())
+	responder.status.Store(int32(ocsp.Good))
+	responder.hold = make(chan struct{})
+	store := newMockCertStore()
+	if err := store.Put(ctx, domain, responder.issue(t, domain)); err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(responder.ca)
+	cache := webapp.NewCertServingCache(ctx, store,
+		webapp.WithCertCacheRootCAs(roots),
+		webapp.WithCertCacheOCSPStapling(responder.Client()))
+
+	// Handshakes do not wait for the OCSP response and only a single
+	// query is outstanding at any one time.
+	hello := &tls.ClientHelloInfo{ServerName: domain}
+	for range 3 {
+		cert, err := cache.GetCertificate(hello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.OCSPStaple) != 0 {
+			t.Fatal("unexpected OCSP staple")
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for responder.requests.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := responder.requests.Load(), int32(1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	close(responder.hold)
+	waitForStaple(t, cache, hello)
+	if got, want := responder.requests.Load(), int32(1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCertServingCache_OCSPStapleExpiry(t *testing.T) {
+	ctx := t.Context()
+	domain := "example.com"
+	startTime := time.Now().Truncate(time.Second)
+	responder := newOCSPTestResponder(t, startTime)
+	responder.status.Store(int32(ocsp.Good))
+	store := newMockCertStore()
+	if err := store.Put(ctx, domain, responder.issue(t, domain)); err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(responder.ca)
+
+	var mu sync.Mutex
+	mockTime := startTime
+	nowFunc := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return mockTime
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		mockTime = mockTime.Add(d)
+	}
+
+	cache := webapp.NewCertServingCache(ctx, store,
+		webapp.WithCertCacheRootCAs(roots),
+		webapp.WithCertCacheNowFunc(nowFunc),
+		webapp.WithCertCacheOCSPStapling(responder.Client()))
+	hello := &tls.ClientHelloInfo{ServerName: domain}
+	waitForStaple(t, cache, hello)
+
+	// The staple continues to be served until its next update time
+	// whilst the responder is unavailable.
+	responder.Close()
+	advance(90 * time.Minute)
+	cert, err := cache.GetCertificate(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.OCSPStaple) == 0 {
+		t.Fatal("expected an OCSP staple")
+	}
+
+	// The staple is dropped once its next update time has passed.
+	advance(time.Hour)
+	cert, err = cache.GetCertificate(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.OCSPStaple) != 0 {
+		t.Errorf("unexpected expired OCSP staple")
+	}
+}
+
+func TestCertServingCache_Wildcard(t *testing.T) {
+	ctx := t.Context()
+	ca := newOCSPTestResponder(t, time.Now())
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.ca)
+
+	if got, want := webapp.WildcardCertName("*.example.com"), "_wildcard.example.com"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	store := newMockCertStore()
+	if err := store.Put(ctx, webapp.WildcardCertName("*.example.com"), ca.issue(t, "*.example.com")); err != nil {
+		t.Fatal(err)
+	}
+	cache := webapp.NewCertServingCache(ctx, store,
+		webapp.WithCertCacheRootCAs(roots),
+		webapp.WithCertCacheAllowedHosts("*.example.com"))
+
+	// A single wildcard certificate serves all matching hosts.
+	a, err := cache.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cache.GetCertificate(&tls.ClientHelloInfo{ServerName: "b.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("expected the same certificate to be served for both hosts")
+	}
+	if err := b.Leaf.VerifyHostname("b.example.com"); err != nil {
+		t.Error(err)
+	}
+	if got, want := store.GetHits(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Hosts that do not match the allowed host pattern are rejected.
+	for _, host := range []string{"example.com", "a.b.example.com", "a.example.org"} {
+		_, err := cache.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+		if err == nil || !strings.Contains(err.Error(), "not in the list of allowed hosts") {
+			t.Errorf("%v: unexpected error: %v", host, err)
+		}
+	}
+
+	// A certificate stored under a parent domain whose SANs include a
+	// wildcard serves its subdomains, but not hosts that it does not cover.
+	if err := store.Put(ctx, "example.org", ca.issue(t, "example.org", "*.example.org")); err != nil {
+		t.Fatal(err)
+	}
+	cache = webapp.NewCertServingCache(ctx, store, webapp.WithCertCacheRootCAs(roots))
+	cert, err := cache.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.VerifyHostname("www.example.org"); err != nil {
+		t.Error(err)
+	}
+	if _, err := cache.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.b.example.org"}); !errors.Is(err, autocert.ErrCacheMiss) {
+		t.Errorf("got %v, want %v", err, autocert.ErrCacheMiss)
+	}
+}
+
+func TestCertServingCache_KeyTypes(t *testing.T) {
+	ctx := t.Context()
+	now := time.Now()
+	ca := newOCSPTestResponder(t, now)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.ca)
+
+	store := newMockCertStore()
+	if err := store.Put(ctx, "example.com", ca.issue(t, "example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, webapp.RSACertName("example.com"), ca.issueRSA(t, "example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "ecdsa.example.com", ca.issue(t, "ecdsa.example.com")); err != nil {
+		t.Fatal(err)
+	}
+	cache := webapp.NewCertServingCache(ctx, store,
+		webapp.WithCertCacheRootCAs(roots),
+		webapp.WithCertCacheNowFunc(func() time.Time { return now }))
+
+	modern := func(host string) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{
+			ServerName:        host,
+			SupportedVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12},
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256, tls.PSSWithSHA256},
+		}
+	}
+	legacy := func(host string) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{
+			ServerName:        host,
+			SupportedVersions: []uint16{tls.VersionTLS12},
+			CipherSuites:      []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			SupportedCurves:   []tls.CurveID{tls.CurveP256},
+			SupportedPoints:   []uint8{0}, // uncompressed
+			SignatureSchemes:  []tls.SignatureScheme{tls.PKCS1WithSHA256},
+		}
+	}
+	keyType := func(cert *tls.Certificate) x509.PublicKeyAlgorithm {
+		return cert.Leaf.PublicKeyAlgorithm
+	}
+
+	cert, err := cache.GetCertificate(modern("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keyType(cert), x509.ECDSA; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := store.GetHits(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Clients that do not support ECDSA are served the RSA certificate,
+	// which is then cached.
+	for range 2 {
+		cert, err = cache.GetCertificate(legacy("example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := keyType(cert), x509.RSA; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	if got, want := store.GetHits(), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Hosts without an RSA certificate fall back to the ECDSA certificate
+	// and the absence of the RSA certificate is remembered for the TTL.
+	cert, err = cache.GetCertificate(legacy("ecdsa.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keyType(cert), x509.ECDSA; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := store.Put(ctx, webapp.RSACertName("ecdsa.example.com"), ca.issueRSA(t, "ecdsa.example.com")); err != nil {
+		t.Fatal(err)
+	}
+	cert, err = cache.GetCertificate(legacy("ecdsa.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keyType(cert), x509.ECDSA; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	now = now.Add(time.Hour * 7)
+	cert, err = cache.GetCertificate(legacy("ecdsa.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keyType(cert), x509.RSA; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
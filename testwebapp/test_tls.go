@@ -51,6 +51,17 @@ type TLSSpec struct {
 	SignatureAlgorithms           webapp.SignatureAlgorithms `yaml:"signature-algorithms" doc:"names of the signature algorithms that the certificate must use, e.g. SHA256-RSA; see tlsvalidate.WithAllowedSignatureAlgorithms. Use 'rsa', 'dsa', 'ecdsa', 'ed25519' or 'rsa-pss' to refer to all algorithms of that type."`
 	NotAllowedSignatureAlgorithms webapp.SignatureAlgorithms `yaml:"not-allowed-signature-algorithms" doc:"names of the signature algorithms that the certificate must not use; see tlsvalidate.WithDeniedSignatureAlgorithms"`
 
+	// CTLogList is the name of a JSON CT log list file, in the format
+	// published at https://www.gstatic.com/ct/log_list/v3/log_list.json;
+	// if set, the certificate must be accompanied by valid SCTs from at
+	// least CTMinOperators distinct log operators.
+	CTLogList      string `yaml:"ct-log-list" doc:"JSON CT log list file used to verify the certificate's SCTs; see tlsvalidate.WithCertificateTransparency"`
+	CTMinOperators int    `yaml:"ct-min-operators" doc:"minimum number of distinct CT log operators that must have issued valid SCTs for the certificate, defaults to 2 if ct-log-list is set"`
+
+	// TLSPolicy is the name of a TLS policy profile that the server must
+	// conform to; see tlsvalidate.WithTLSPolicy.
+	TLSPolicy string `yaml:"tls-policy" doc:"name of the TLS policy profile, modern, intermediate or legacy, that the server must conform to; see tlsvalidate.WithTLSPolicy"`
+
 	client *http.Client
 }
 
@@ -151,6 +162,24 @@ func (s TLSSpec) options() ([]tlsvalidate.Option, error) {
 		tlsvalidate.WithDeniedCipherSuites(s.NotAllowedCipherSuites...),
 		tlsvalidate.WithDeniedSignatureAlgorithms(s.NotAllowedSignatureAlgorithms...),
 	}
+	if len(s.CTLogList) > 0 {
+		logs, err := tlsvalidate.ReadCTLogList(s.CTLogList)
+		if err != nil {
+			return nil, err
+		}
+		minOperators := s.CTMinOperators
+		if minOperators == 0 {
+			minOperators = 2
+		}
+		o = append(o, tlsvalidate.WithCertificateTransparency(logs, minOperators))
+	}
+	if len(s.TLSPolicy) > 0 {
+		policy, err := webapp.ParseTLSPolicy(s.TLSPolicy)
+		if err != nil {
+			return nil, err
+		}
+		o = append(o, tlsvalidate.WithTLSPolicy(policy))
+	}
 	if len(s.CustomCAPEM) == 0 {
 		return o, nil
 	}
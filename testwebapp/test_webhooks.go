@@ -6,14 +6,17 @@ package testwebapp
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"cloudeng.io/logging/ctxlog"
 	"cloudeng.io/sync/errgroup"
 	"cloudeng.io/webapi/operations"
+	"cloudeng.io/webapp/webhooks"
 	"gopkg.in/yaml.v3"
 )
 
@@ -35,6 +38,15 @@ func (s WebhookRoundTripSpec) String() string {
 	return string(out)
 }
 
+// WebhookSigner returns an operations.Signer that signs webhook payloads
+// using the signature scheme implemented by provider, for use with
+// NewWebhookRoundTripTest.
+func WebhookSigner(provider webhooks.Provider, secret []byte) operations.Signer {
+	return func(_ context.Context, hdr http.Header, body []byte) error {
+		return provider.Sign(hdr, body, secret, time.Now())
+	}
+}
+
 // WebhookRoundTripTest validates webhook relay round-trips for a set of specs.
 type WebhookRoundTripTest struct {
 	signers map[string]operations.Signer
@@ -99,16 +111,17 @@ func (w *WebhookRoundTripTest) deliver(ctx context.Context, spec WebhookRoundTri
 // DrainRelayURL collects all payloads from relayURL, decoding each as T.
 // It uses timeout as an idle deadline: after receiving a payload it resets
 // the timer, so a short queue returns quickly. It returns when no payload
-// arrives within timeout or ctx is cancelled.
+// arrives within timeout or ctx is cancelled. If the relay leases deliveries
+// (see webhooks.WithLeases) each payload is acknowledged once it has been
+// decoded, so payloads that fail to decode will be redelivered.
 func DrainRelayURL[T any](ctx context.Context, client *http.Client, relayURL string, timeout time.Duration) ([]T, error) {
-	ep := operations.NewEndpoint[T](operations.WithHTTPClient(client))
 	var results []T
 	for {
 		if ctx.Err() != nil {
 			return results, ctx.Err()
 		}
 		idleCtx, cancel := context.WithTimeout(ctx, timeout)
-		got, _, _, err := ep.Get(idleCtx, relayURL)
+		got, _, err := pollRelay[T](idleCtx, client, relayURL)
 		cancel()
 		if err != nil {
 			if ctx.Err() != nil {
@@ -123,12 +136,58 @@ func DrainRelayURL[T any](ctx context.Context, client *http.Client, relayURL str
 	}
 }
 
+// pollRelay reads a single payload from relayURL, decoding it as T, and
+// acknowledges it if the relay leased it to this client.
+func pollRelay[T any](ctx context.Context, client *http.Client, relayURL string) (T, []byte, error) {
+	var result T
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, relayURL, nil)
+	if err != nil {
+		return result, nil, err
+	}
+	resp, err := client.Do(req) //nolint:gosec // G704 is too restrictive here
+	if err != nil {
+		return result, nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return result, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return result, body, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return result, body, fmt.Errorf("decoding payload: %w", err)
+	}
+	if id := resp.Header.Get(webhooks.DeliveryIDHeader); id != "" {
+		if err := ackRelay(ctx, client, relayURL+webhooks.AckPathSuffix, id); err != nil {
+			return result, body, err
+		}
+	}
+	return result, body, nil
+}
+
+func ackRelay(ctx context.Context, client *http.Client, ackURL, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ackURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(webhooks.DeliveryIDHeader, id)
+	resp, err := client.Do(req) //nolint:gosec // G704 is too restrictive here
+	if err != nil {
+		return fmt.Errorf("acknowledging delivery %v: %w", id, err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("acknowledging delivery %v: unexpected status code: %d", id, resp.StatusCode)
+	}
+	return nil
+}
+
 func (w *WebhookRoundTripTest) wait(ctx context.Context, spec WebhookRoundTripSpec, client *http.Client, want webhookTestPayload) error {
-	ep := operations.NewEndpoint[webhookTestPayload](
-		operations.WithHTTPClient(client),
-	)
 	for {
-		got, data, _, err := ep.Get(ctx, spec.RelayURL)
+		got, data, err := pollRelay[webhookTestPayload](ctx, client, spec.RelayURL)
 		if err != nil {
 			ctxlog.Error(ctx, "webhook-relay", "spec", spec, "got", string(data), "error", err)
 			return fmt.Errorf("waiting for relay: %w", err)
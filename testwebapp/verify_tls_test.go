@@ -237,6 +237,50 @@ func TestTLSTestNotAllowedSignatureAlgorithms(t *testing.T) {
 	}
 }
 
+func TestTLSTestCertificateTransparency(t *testing.T) {
+	ctx := context.Background()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "active")
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+	caFile := filepath.Join(tmpDir, "server.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	logList := filepath.Join(tmpDir, "log_list.json")
+	if err := os.WriteFile(logList, []byte(`{"version": "1.0", "operators": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var spec testwebapp.TLSSpec
+	if err := yaml.Unmarshal(fmt.Appendf(nil, `
+host: %s
+port: %s
+custom-ca-pem: %s
+ct-log-list: %s
+`, u.Hostname(), u.Port(), caFile, logList), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	// The httptest server's certificate is not accompanied by any SCTs.
+	err = testwebapp.NewTLSTest(spec).Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "at least 2 required") {
+		t.Fatalf("TLSTest.Run: expected an insufficient SCTs error: %v", err)
+	}
+
+	spec.CTLogList = filepath.Join(tmpDir, "nonexistent.json")
+	if err := testwebapp.NewTLSTest(spec).Run(ctx); err == nil {
+		t.Fatal("TLSTest.Run expected failure with nonexistent CT log list")
+	}
+}
+
 func TestCipherSuitesYAML(t *testing.T) {
 	// TLS_RSA_WITH_AES_128_CBC_SHA is one of the "insecure" ciphersuites
 	// returned by tls.InsecureCipherSuites rather than tls.CipherSuites; it
@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"cloudeng.io/cmdutil/keys"
 	"cloudeng.io/webapi/operations"
@@ -32,7 +33,7 @@ func TestWebhookRoundTripSpecString(t *testing.T) {
 
 // newWebhookRelay creates a relay server backed by an HMAC-SHA256 validator,
 // registers cleanup, and returns the test server.
-func newWebhookRelay(t *testing.T, secret []byte, signHeader string) *httptest.Server {
+func newWebhookRelay(t *testing.T, secret []byte, signHeader string, opts ...webhooks.Option) *httptest.Server {
 	t.Helper()
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -46,7 +47,7 @@ func newWebhookRelay(t *testing.T, secret []byte, signHeader string) *httptest.S
 		t.Fatalf("SignatureValidator: %v", err)
 	}
 
-	relay := webhooks.NewRelay(ctx, validator)
+	relay := webhooks.NewRelay(ctx, validator, opts...)
 	handler := relay.Handler("/webhooks/deliver", "/webhooks/relay")
 	srv := httptest.NewServer(http.HandlerFunc(handler))
 
@@ -122,4 +123,99 @@ func TestWebhookRoundTrip(t *testing.T) {
 		}
 	})
 
+	t.Run("Leased", func(t *testing.T) {
+		srv := newWebhookRelay(t, secret, header, webhooks.WithLeases(time.Minute))
+		spec := webhookSpec(srv)
+		signers := map[string]operations.Signer{spec.DeliveryURL: hmacSigner(secret, header)}
+		wrt := testwebapp.NewWebhookRoundTripTest(signers, spec)
+		if err := wrt.Run(t.Context(), srv.Client()); err != nil {
+			t.Errorf("expected success, got %v", err)
+		}
+	})
+}
+
+func TestWebhookRoundTripProviders(t *testing.T) {
+	secret := []byte("test-provider-secret")
+	for _, service := range webhooks.Providers() {
+		t.Run(service, func(t *testing.T) {
+			provider, _ := webhooks.LookupProvider(service)
+			ctx, cancel := context.WithCancel(context.Background())
+			getTokens := func(_ context.Context) ([]keys.Token, error) {
+				return []keys.Token{keys.NewToken("", "", append([]byte(nil), secret...))}, nil
+			}
+			validator, err := webhooks.ProviderValidator(provider, getTokens, time.Minute)
+			if err != nil {
+				t.Fatalf("ProviderValidator: %v", err)
+			}
+			relay := webhooks.NewRelay(ctx, validator)
+			srv := httptest.NewServer(http.HandlerFunc(relay.Handler("/webhooks/deliver", "/webhooks/relay")))
+			t.Cleanup(func() {
+				relay.Stop(context.Background())
+				cancel()
+				srv.Close()
+			})
+			spec := webhookSpec(srv)
+
+			signers := map[string]operations.Signer{spec.DeliveryURL: testwebapp.WebhookSigner(provider, secret)}
+			wrt := testwebapp.NewWebhookRoundTripTest(signers, spec)
+			if err := wrt.Run(t.Context(), srv.Client()); err != nil {
+				t.Errorf("expected success, got %v", err)
+			}
+
+			signers = map[string]operations.Signer{spec.DeliveryURL: testwebapp.WebhookSigner(provider, []byte("wrong-secret"))}
+			wrt = testwebapp.NewWebhookRoundTripTest(signers, spec)
+			if err := wrt.Run(t.Context(), srv.Client()); err == nil {
+				t.Error("expected error for wrong secret, got nil")
+			}
+		})
+	}
+}
+
+func postSignedWebhook(t *testing.T, client *http.Client, url string, secret []byte, signHeader, payload string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, url, strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := webhooks.SignHTTPRequest(req.Header, []byte(payload), secret, signHeader); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+}
+
+func TestDrainRelayURLAcknowledges(t *testing.T) {
+	secret := []byte("test-webhook-secret")
+	header := "X-Test-Signature"
+	// A short lease means that any unacknowledged payloads would be seen
+	// again by the second drain.
+	srv := newWebhookRelay(t, secret, header, webhooks.WithLeases(50*time.Millisecond))
+	spec := webhookSpec(srv)
+	postSignedWebhook(t, srv.Client(), spec.DeliveryURL, secret, header, `{"n":1}`)
+	postSignedWebhook(t, srv.Client(), spec.DeliveryURL, secret, header, `{"n":2}`)
+
+	type payload struct {
+		N int `json:"n"`
+	}
+	got, err := testwebapp.DrainRelayURL[payload](t.Context(), srv.Client(), spec.RelayURL, 250*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].N != 1 || got[1].N != 2 {
+		t.Errorf("got %v, want [{1} {2}]", got)
+	}
+	got, err = testwebapp.DrainRelayURL[payload](t.Context(), srv.Client(), spec.RelayURL, 250*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %v, want no redelivered payloads", got)
+	}
 }
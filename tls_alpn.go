@@ -0,0 +1,197 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+)
+
+// ACMETLSALPN01Proto is the ALPN protocol used by ACME TLS-ALPN-01
+// challenges as defined in RFC 8737.
+const ACMETLSALPN01Proto = "acme-tls/1"
+
+// IsACMETLSALPN01Hello returns true if hello is for an ACME TLS-ALPN-01
+// challenge, ie. it offers the acme-tls/1 protocol and no other.
+func IsACMETLSALPN01Hello(hello *tls.ClientHelloInfo) bool {
+	return hello != nil && len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == ACMETLSALPN01Proto
+}
+
+// ProxyAcmeTLSALPN01 returns a net.Listener that forwards ACME TLS-ALPN-01
+// challenge connections accepted on ln to the specified host, which
+// should be the host running the ACME client responsible for obtaining
+// certificates. If host does not include a port then port 443 is used.
+// All other connections are returned by the listener's Accept method
+// unchanged. It is the TLS-ALPN-01 analogue of RedirectAcmeHTTP01 and
+// must be used with the raw TCP listener, ie. before any TLS handshake
+// takes place, for example by wrapping the listener returned by
+// NewTLSServer.
+func ProxyAcmeTLSALPN01(ctx context.Context, ln net.Listener, host string) net.Listener {
+	h, port := splitHostPort(host)
+	if len(port) == 0 {
+		port = "443"
+	}
+	pl := &alpnProxyListener{
+		Listener: ln,
+		ctx:      ctx,
+		target:   net.JoinHostPort(h, port),
+		timeout:  10 * time.Second,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+	go pl.acceptLoop()
+	return pl
+}
+
+type alpnProxyListener struct {
+	net.Listener
+	ctx     context.Context
+	target  string
+	timeout time.Duration
+	conns   chan net.Conn
+	errs    chan error
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Accept implements net.Listener.
+func (pl *alpnProxyListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-pl.conns:
+		return conn, nil
+	case err := <-pl.errs:
+		return nil, err
+	case <-pl.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (pl *alpnProxyListener) Close() error {
+	pl.once.Do(func() { close(pl.done) })
+	return pl.Listener.Close()
+}
+
+// acceptLoop accepts connections until the listener is closed. Errors
+// are forwarded to Accept and, other than net.ErrClosed, do not stop the
+// loop since callers such as http.Server retry temporary errors.
+func (pl *alpnProxyListener) acceptLoop() {
+	for {
+		conn, err := pl.Listener.Accept()
+		if err != nil {
+			select {
+			case pl.errs <- err:
+			case <-pl.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go pl.handle(conn)
+	}
+}
+
+// handle reads the ClientHello on conn and either proxies the connection
+// to the target, if it is for a TLS-ALPN-01 challenge, or hands it to
+// Accept with the ClientHello replayed to the next reader.
+func (pl *alpnProxyListener) handle(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(pl.timeout))
+	hello, peeked, err := peekClientHello(conn)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err == nil && IsACMETLSALPN01Hello(hello) {
+		pl.proxy(conn, hello.ServerName, peeked)
+		return
+	}
+	// Leave it to the TLS server to report any handshake errors.
+	select {
+	case pl.conns <- &replayConn{Conn: conn, r: io.MultiReader(bytes.NewReader(peeked), conn)}:
+	case <-pl.done:
+		conn.Close()
+	}
+}
+
+func (pl *alpnProxyListener) proxy(conn net.Conn, serverName string, peeked []byte) {
+	defer conn.Close()
+	logger := ctxlog.Logger(pl.ctx)
+	logger.Info("proxying ACME TLS-ALPN-01 challenge", "server_name", serverName, "requestor", conn.RemoteAddr().String(), "to", pl.target)
+	dialer := net.Dialer{Timeout: pl.timeout}
+	target, err := dialer.DialContext(pl.ctx, "tcp", pl.target)
+	if err != nil {
+		logger.Warn("failed to proxy ACME TLS-ALPN-01 challenge", "server_name", serverName, "to", pl.target, "err", err.Error())
+		return
+	}
+	defer target.Close()
+	if _, err := target.Write(peeked); err != nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(conn, target)
+		close(done)
+	}()
+	_, _ = io.Copy(target, conn)
+	if tc, ok := target.(*net.TCPConn); ok {
+		_ = tc.CloseWrite()
+	}
+	<-done
+}
+
+var errHelloPeeked = errors.New("client hello peeked")
+
+// peekClientHello reads and parses the TLS ClientHello from conn without
+// writing anything to it and returns the parsed hello and the bytes read.
+func peekClientHello(conn net.Conn) (*tls.ClientHelloInfo, []byte, error) {
+	rc := &recordingConn{Conn: conn}
+	var hello *tls.ClientHelloInfo
+	err := tls.Server(rc, &tls.Config{
+		GetConfigForClient: func(h *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = h
+			return nil, errHelloPeeked
+		},
+	}).Handshake()
+	if hello == nil {
+		return nil, rc.buf.Bytes(), err
+	}
+	return hello, rc.buf.Bytes(), nil
+}
+
+// recordingConn records all data read from the underlying connection
+// and discards all writes.
+type recordingConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (rc *recordingConn) Read(p []byte) (int, error) {
+	n, err := rc.Conn.Read(p)
+	rc.buf.Write(p[:n])
+	return n, err
+}
+
+func (rc *recordingConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// replayConn replays previously read data before reading from the
+// underlying connection.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (rc *replayConn) Read(p []byte) (int, error) {
+	return rc.r.Read(p)
+}
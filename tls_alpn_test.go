@@ -0,0 +1,200 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp"
+)
+
+func newALPNTestCert(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
+
+func TestIsACMETLSALPN01Hello(t *testing.T) {
+	for _, tc := range []struct {
+		protos []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"h2", "http/1.1"}, false},
+		{[]string{"h2", webapp.ACMETLSALPN01Proto}, false},
+		{[]string{webapp.ACMETLSALPN01Proto}, true},
+	} {
+		if got, want := webapp.IsACMETLSALPN01Hello(&tls.ClientHelloInfo{SupportedProtos: tc.protos}), tc.want; got != want {
+			t.Errorf("%v: got %v, want %v", tc.protos, got, want)
+		}
+	}
+	if webapp.IsACMETLSALPN01Hello(nil) {
+		t.Errorf("nil hello should not be a challenge hello")
+	}
+}
+
+func TestProxyAcmeTLSALPN01(t *testing.T) {
+	ctx := t.Context()
+
+	// The cert manager answers the challenge handshake.
+	target, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{newALPNTestCert(t, "challenge")},
+		NextProtos:   []string{webapp.ACMETLSALPN01Proto},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln = webapp.ProxyAcmeTLSALPN01(ctx, ln, target.Addr().String())
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "hello")
+		}),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{newALPNTestCert(t, "server")},
+			MinVersion:   tls.VersionTLS12,
+		},
+		ReadHeaderTimeout: time.Minute,
+	}
+	go func() { _ = srv.ServeTLS(ln, "", "") }()
+	defer srv.Close()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		ServerName:         "example.com",
+		NextProtos:         []string{webapp.ACMETLSALPN01Proto},
+		InsecureSkipVerify: true, //nolint:gosec // G402: test only
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	if got, want := state.PeerCertificates[0].Subject.CommonName, "challenge"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := state.NegotiatedProtocol, webapp.ACMETLSALPN01Proto; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// All other connections are served as normal.
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // G402: test only
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if got, want := string(body), "hello"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := resp.TLS.PeerCertificates[0].Subject.CommonName, "server"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// flakyListener returns a temporary error from its first call to Accept.
+type flakyListener struct {
+	net.Listener
+	once sync.Once
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary accept error" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+func (fl *flakyListener) Accept() (net.Conn, error) {
+	var err error
+	fl.once.Do(func() { err = temporaryError{} })
+	if err != nil {
+		return nil, err
+	}
+	return fl.Listener.Accept()
+}
+
+func TestProxyAcmeTLSALPN01AcceptError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := webapp.ProxyAcmeTLSALPN01(t.Context(), &flakyListener{Listener: ln}, "127.0.0.1:1")
+	defer pl.Close()
+
+	if _, err := pl.Accept(); !errors.Is(err, temporaryError{}) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Connections accepted after the temporary error are still returned.
+	errCh := make(chan error, 1)
+	go func() {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			ServerName:         "example.com",
+			InsecureSkipVerify: true, //nolint:gosec // G402: test only
+		})
+		if err == nil {
+			conn.Close()
+		}
+		errCh <- err
+	}()
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	<-errCh
+
+	if err := pl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pl.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
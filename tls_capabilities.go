@@ -7,6 +7,7 @@ package webapp
 import (
 	"crypto/tls"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -41,6 +42,12 @@ func ParseSignatureScheme(name string) (tls.SignatureScheme, error) {
 	return 0, fmt.Errorf("unknown signature scheme %q", name)
 }
 
+// KnownTLSSignatureSchemes returns every signature scheme that
+// ParseSignatureScheme accepts.
+func KnownTLSSignatureSchemes() TLSSignatureSchemes {
+	return slices.Clone(signatureSchemes)
+}
+
 // TLSSignatureSchemes is a list of TLS signature scheme names, e.g.
 // "ECDSAWithP256AndSHA256" as returned by tls.SignatureScheme.String(). When
 // unmarshaled from YAML it accepts a list of such names and converts them to
@@ -107,6 +114,11 @@ func ParseCurveID(name string) (tls.CurveID, error) {
 	return 0, fmt.Errorf("unknown curve %q", name)
 }
 
+// KnownTLSCurves returns every curve/group ID that ParseCurveID accepts.
+func KnownTLSCurves() TLSCurves {
+	return slices.Clone(curveIDs)
+}
+
 // TLSCurves is a list of TLS curve/group names, e.g. "CurveP256" or "X25519"
 // as returned by tls.CurveID.String(). When unmarshaled from YAML it accepts
 // a list of such names and converts them to the corresponding crypto/tls
@@ -181,6 +193,12 @@ func ParseTLSVersion(name string) (uint16, error) {
 	return 0, fmt.Errorf("unknown TLS version %q", name)
 }
 
+// KnownTLSVersions returns every TLS version known to crypto/tls, in
+// ascending order.
+func KnownTLSVersions() TLSVersions {
+	return slices.Clone(tlsVersions)
+}
+
 // TLSVersion is a single TLS version, e.g. "TLS 1.3" as returned by
 // tls.VersionName. When unmarshaled from YAML it accepts such a name, or a
 // "0x..." hex value for a version tls.VersionName does not recognize, and
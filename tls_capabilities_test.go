@@ -236,3 +236,36 @@ func TestTLSVersionsYAML(t *testing.T) {
 		t.Errorf("marshaled output %q does not contain %q", got, wantSubstr)
 	}
 }
+
+func TestKnownTLSCapabilities(t *testing.T) {
+	for _, v := range webapp.KnownTLSVersions() {
+		if got, err := webapp.ParseTLSVersion(tls.VersionName(v)); err != nil || got != v {
+			t.Errorf("%v: got %v, %v", tls.VersionName(v), got, err)
+		}
+	}
+	for _, c := range webapp.KnownTLSCurves() {
+		if got, err := webapp.ParseCurveID(c.String()); err != nil || got != c {
+			t.Errorf("%v: got %v, %v", c, got, err)
+		}
+	}
+	for _, s := range webapp.KnownTLSSignatureSchemes() {
+		if got, err := webapp.ParseSignatureScheme(s.String()); err != nil || got != s {
+			t.Errorf("%v: got %v, %v", s, got, err)
+		}
+	}
+	suites := webapp.KnownCipherSuites()
+	if got, want := len(suites), len(tls.CipherSuites())+len(tls.InsecureCipherSuites()); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, id := range suites {
+		if got, err := webapp.ParseCipherSuite(tls.CipherSuiteName(id)); err != nil || got != id {
+			t.Errorf("%v: got %v, %v", tls.CipherSuiteName(id), got, err)
+		}
+	}
+	// The returned values are copies.
+	versions := webapp.KnownTLSVersions()
+	versions[0] = 0
+	if webapp.KnownTLSVersions()[0] == 0 {
+		t.Errorf("KnownTLSVersions returned a shared slice")
+	}
+}
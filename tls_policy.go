@@ -0,0 +1,146 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+)
+
+// Names of the supported TLS policy profiles, see ParseTLSPolicy.
+const (
+	TLSPolicyModern       = "modern"
+	TLSPolicyIntermediate = "intermediate"
+	TLSPolicyLegacy       = "legacy"
+)
+
+// TLSPolicy represents a named TLS configuration profile modelled on the
+// Mozilla server side TLS guidelines, see
+// https://wiki.mozilla.org/Security/Server_Side_TLS. CipherSuites lists
+// the TLS 1.0-1.2 cipher suites only since crypto/tls does not allow the
+// TLS 1.3 suites to be configured. SignatureSchemes cannot be configured
+// for a crypto/tls server either and is used to verify that a server
+// conforms to the policy, see tlsvalidate.WithTLSPolicy.
+type TLSPolicy struct {
+	Name             string
+	MinVersion       uint16
+	MaxVersion       uint16
+	CipherSuites     CipherSuites
+	Curves           TLSCurves
+	SignatureSchemes TLSSignatureSchemes
+}
+
+var policyCurves = TLSCurves{
+	tls.X25519MLKEM768,
+	tls.X25519,
+	tls.CurveP256,
+	tls.CurveP384,
+}
+
+var modernSignatureSchemes = TLSSignatureSchemes{
+	tls.ECDSAWithP256AndSHA256,
+	tls.ECDSAWithP384AndSHA384,
+	tls.ECDSAWithP521AndSHA512,
+	tls.Ed25519,
+	tls.PSSWithSHA256,
+	tls.PSSWithSHA384,
+	tls.PSSWithSHA512,
+}
+
+var intermediateCipherSuites = CipherSuites{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+var intermediateSignatureSchemes = append(slices.Clone(modernSignatureSchemes),
+	tls.PKCS1WithSHA256,
+	tls.PKCS1WithSHA384,
+	tls.PKCS1WithSHA512,
+)
+
+var legacyCipherSuites = append(slices.Clone(intermediateCipherSuites),
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+)
+
+var legacySignatureSchemes = append(slices.Clone(intermediateSignatureSchemes),
+	tls.PKCS1WithSHA1,
+	tls.ECDSAWithSHA1,
+)
+
+// ParseTLSPolicy returns the TLSPolicy for the given name, one of
+// TLSPolicyModern, TLSPolicyIntermediate or TLSPolicyLegacy:
+//
+//   - modern: TLS 1.3 only.
+//   - intermediate: TLS 1.2 and 1.3 with AEAD ECDHE cipher suites only.
+//   - legacy: TLS 1.0 to 1.3 including CBC, RSA key exchange and 3DES
+//     cipher suites and SHA-1 signatures for use with very old clients.
+//
+// The returned policy does not share any slices with those returned by
+// other calls.
+func ParseTLSPolicy(name string) (TLSPolicy, error) {
+	p := TLSPolicy{Name: name, MaxVersion: tls.VersionTLS13}
+	switch name {
+	case TLSPolicyModern:
+		p.MinVersion = tls.VersionTLS13
+		p.SignatureSchemes = modernSignatureSchemes
+	case TLSPolicyIntermediate:
+		p.MinVersion = tls.VersionTLS12
+		p.CipherSuites = intermediateCipherSuites
+		p.SignatureSchemes = intermediateSignatureSchemes
+	case TLSPolicyLegacy:
+		p.MinVersion = tls.VersionTLS10
+		p.CipherSuites = legacyCipherSuites
+		p.SignatureSchemes = legacySignatureSchemes
+	default:
+		return TLSPolicy{}, fmt.Errorf("unknown TLS policy %q, must be one of %v, %v or %v", name, TLSPolicyModern, TLSPolicyIntermediate, TLSPolicyLegacy)
+	}
+	p.CipherSuites = slices.Clone(p.CipherSuites)
+	p.Curves = slices.Clone(policyCurves)
+	p.SignatureSchemes = slices.Clone(p.SignatureSchemes)
+	return p, nil
+}
+
+// Versions returns the TLS versions allowed by the policy.
+func (p TLSPolicy) Versions() TLSVersions {
+	var versions TLSVersions
+	for _, v := range tlsVersions {
+		if v >= p.MinVersion && v <= p.MaxVersion {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// Configure sets the versions, cipher suites and curves of cfg to those
+// specified by the policy.
+func (p TLSPolicy) Configure(cfg *tls.Config) {
+	cfg.MinVersion = p.MinVersion
+	cfg.MaxVersion = p.MaxVersion
+	cfg.CipherSuites = slices.Clone(p.CipherSuites)
+	cfg.CurvePreferences = slices.Clone(p.Curves)
+}
+
+// TLSConfig returns a new tls.Config configured as per Configure.
+func (p TLSPolicy) TLSConfig() *tls.Config {
+	cfg := &tls.Config{} //nolint:gosec // G402 MinVersion is set by Configure.
+	p.Configure(cfg)
+	return cfg
+}
@@ -0,0 +1,120 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webapp_test
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/devtest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseTLSPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		versions webapp.TLSVersions
+		suites   int
+		cbc      bool
+		sha1     bool
+	}{
+		{webapp.TLSPolicyModern, webapp.TLSVersions{tls.VersionTLS13}, 0, false, false},
+		{webapp.TLSPolicyIntermediate, webapp.TLSVersions{tls.VersionTLS12, tls.VersionTLS13}, 6, false, false},
+		{webapp.TLSPolicyLegacy, webapp.KnownTLSVersions(), 18, true, true},
+	} {
+		p, err := webapp.ParseTLSPolicy(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := p.Name, tc.name; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := p.Versions(), tc.versions; !slices.Equal(got, want) {
+			t.Errorf("%v: got %v, want %v", tc.name, got, want)
+		}
+		if got, want := len(p.CipherSuites), tc.suites; got != want {
+			t.Errorf("%v: got %v, want %v", tc.name, got, want)
+		}
+		if got, want := strings.Contains(p.CipherSuites.String(), "_CBC_"), tc.cbc; got != want {
+			t.Errorf("%v: got %v, want %v", tc.name, got, want)
+		}
+		if got, want := slices.Contains(p.SignatureSchemes, tls.PKCS1WithSHA1), tc.sha1; got != want {
+			t.Errorf("%v: got %v, want %v", tc.name, got, want)
+		}
+		if !slices.Contains(p.Curves, tls.X25519) {
+			t.Errorf("%v: missing X25519: %v", tc.name, p.Curves)
+		}
+		cfg := p.TLSConfig()
+		if cfg.MinVersion != slices.Min(tc.versions) || cfg.MaxVersion != tls.VersionTLS13 {
+			t.Errorf("%v: unexpected versions: %v %v", tc.name, cfg.MinVersion, cfg.MaxVersion)
+		}
+		if !slices.Equal(cfg.CipherSuites, p.CipherSuites) || !slices.Equal(cfg.CurvePreferences, p.Curves) {
+			t.Errorf("%v: unexpected config: %v %v", tc.name, cfg.CipherSuites, cfg.CurvePreferences)
+		}
+	}
+
+	// Policies must not share state.
+	p1, _ := webapp.ParseTLSPolicy(webapp.TLSPolicyLegacy)
+	p1.CipherSuites[0] = 0
+	p2, _ := webapp.ParseTLSPolicy(webapp.TLSPolicyLegacy)
+	if p2.CipherSuites[0] == 0 {
+		t.Errorf("policies share cipher suites")
+	}
+
+	if _, err := webapp.ParseTLSPolicy("old"); err == nil || !strings.Contains(err.Error(), "unknown TLS policy") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHTTPServerConfigTLSPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	certFile := filepath.Join(tmpDir, "cert.pem")
+	keyFile := filepath.Join(tmpDir, "key.pem")
+	if err := devtest.NewSelfSignedCert(certFile, keyFile, devtest.CertDNSHosts("localhost")); err != nil {
+		t.Fatalf("failed to create self signed cert: %v", err)
+	}
+
+	spec := `address: :8443
+tls_certs:
+  cert_file: ` + certFile + `
+  key_file: ` + keyFile + `
+  policy: intermediate
+`
+	var hc webapp.HTTPServerConfig
+	if err := yaml.Unmarshal([]byte(spec), &hc); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := hc.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.MinVersion, uint16(tls.VersionTLS12); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(cfg.CipherSuites), 6; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(cfg.Certificates), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	hc.TLSCerts.Policy = "unknown"
+	if _, err := hc.TLSConfig(); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	hc.TLSCerts.Policy = ""
+	cfg, err = hc.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.MinVersion, uint16(webapp.PreferredTLSMinVersion); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudeng.io/webapp"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+var (
+	// oidSCTList is the OID of the X.509v3 extension used to embed SCTs in a
+	// certificate, see RFC 6962, Section 3.3.
+	oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	// oidOCSPSCTList is the OID of the OCSP single extension used to
+	// deliver SCTs in a stapled OCSP response, see RFC 6962, Section 3.3.
+	oidOCSPSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+)
+
+// ErrInsufficientSCTs is wrapped by the ErrValidator returned for a
+// certificate that is not accompanied by valid SCTs from the required
+// number of distinct CT log operators.
+var ErrInsufficientSCTs = errors.New("insufficient signed certificate timestamps")
+
+// CTLog represents a Certificate Transparency log.
+type CTLog struct {
+	Description string
+	Operator    string
+	URL         string
+	LogID       [sha256.Size]byte
+	Key         crypto.PublicKey
+}
+
+// CTLogList represents a list of Certificate Transparency logs, typically
+// obtained from a JSON log list such as the one published at
+// https://www.gstatic.com/ct/log_list/v3/log_list.json.
+type CTLogList struct {
+	logs map[[sha256.Size]byte]CTLog
+}
+
+type ctLogListJSON struct {
+	Operators []struct {
+		Name      string      `json:"name"`
+		Logs      []ctLogJSON `json:"logs"`
+		TiledLogs []ctLogJSON `json:"tiled_logs"`
+	} `json:"operators"`
+}
+
+type ctLogJSON struct {
+	Description   string                     `json:"description"`
+	LogID         string                     `json:"log_id"`
+	Key           string                     `json:"key"`
+	URL           string                     `json:"url"`
+	SubmissionURL string                     `json:"submission_url"`
+	State         map[string]json.RawMessage `json:"state"`
+}
+
+// ParseCTLogList parses a JSON CT log list in the v3 format used by
+// https://www.gstatic.com/ct/log_list/v3/log_list.json. Both the logs
+// and tiled_logs of each operator are included, except for those whose
+// state is pending or rejected since SCTs from such logs are not
+// generally trusted.
+func ParseCTLogList(data []byte) (*CTLogList, error) {
+	var list ctLogListJSON
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse CT log list: %w", err)
+	}
+	ll := &CTLogList{logs: map[[sha256.Size]byte]CTLog{}}
+	for _, op := range list.Operators {
+		for _, l := range append(op.Logs, op.TiledLogs...) {
+			if _, ok := l.State["pending"]; ok {
+				continue
+			}
+			if _, ok := l.State["rejected"]; ok {
+				continue
+			}
+			log, err := l.parse(op.Name)
+			if err != nil {
+				return nil, err
+			}
+			ll.logs[log.LogID] = log
+		}
+	}
+	return ll, nil
+}
+
+func (l ctLogJSON) parse(operator string) (CTLog, error) {
+	der, err := base64.StdEncoding.DecodeString(l.Key)
+	if err != nil {
+		return CTLog{}, fmt.Errorf("CT log %q: invalid key: %w", l.Description, err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return CTLog{}, fmt.Errorf("CT log %q: invalid key: %w", l.Description, err)
+	}
+	log := CTLog{
+		Description: l.Description,
+		Operator:    operator,
+		URL:         l.URL,
+		LogID:       sha256.Sum256(der),
+		Key:         key,
+	}
+	if len(log.URL) == 0 {
+		log.URL = l.SubmissionURL
+	}
+	if id, err := base64.StdEncoding.DecodeString(l.LogID); err != nil || string(id) != string(log.LogID[:]) {
+		return CTLog{}, fmt.Errorf("CT log %q: log_id %q does not match its key", l.Description, l.LogID)
+	}
+	return log, nil
+}
+
+// ReadCTLogList reads and parses the JSON CT log list in filename, see
+// ParseCTLogList.
+func ReadCTLogList(filename string) (*CTLogList, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CT log list %q: %w", filename, err)
+	}
+	return ParseCTLogList(data)
+}
+
+// Lookup returns the log with the specified log ID.
+func (l *CTLogList) Lookup(id [sha256.Size]byte) (CTLog, bool) {
+	log, ok := l.logs[id]
+	return log, ok
+}
+
+// Len returns the number of logs in the list.
+func (l *CTLogList) Len() int {
+	return len(l.logs)
+}
+
+// WithCertificateTransparency returns an option that configures the
+// validator to check that the leaf certificate is accompanied by valid
+// Signed Certificate Timestamps (SCTs) from logs in the supplied list
+// operated by at least minOperators distinct operators. SCTs embedded
+// in the certificate, delivered via the TLS extension and delivered in
+// a stapled OCSP response are all considered. SCTs from logs that are not
+// in the list, or that fail verification, are ignored. A certificate that
+// does not meet the requirement results in an ErrValidator that wraps
+// ErrInsufficientSCTs. A minOperators of less than 1 is treated as 1.
+func WithCertificateTransparency(logs *CTLogList, minOperators int) Option {
+	return func(o *options) {
+		o.ctLogs = logs
+		o.ctMinOperators = max(minOperators, 1)
+	}
+}
+
+type sctSource int
+
+const (
+	sctFromCertificate sctSource = iota
+	sctFromTLS
+	sctFromOCSP
+)
+
+func (s sctSource) String() string {
+	switch s {
+	case sctFromCertificate:
+		return "certificate"
+	case sctFromTLS:
+		return "tls"
+	case sctFromOCSP:
+		return "ocsp"
+	}
+	return "unknown"
+}
+
+// sct represents a parsed v1 Signed Certificate Timestamp, see RFC 6962,
+// Section 3.2.
+type sct struct {
+	source     sctSource
+	logID      [sha256.Size]byte
+	timestamp  uint64
+	extensions []byte
+	hashAlg    uint8
+	sigAlg     uint8
+	signature  []byte
+}
+
+func parseSCT(data []byte, source sctSource) (sct, error) {
+	s := sct{source: source}
+	in := cryptobyte.String(data)
+	var version uint8
+	var logID, extensions, signature []byte
+	if !in.ReadUint8(&version) {
+		return s, fmt.Errorf("truncated SCT")
+	}
+	if version != 0 {
+		return s, fmt.Errorf("unsupported SCT version: %v", version)
+	}
+	if !in.ReadBytes(&logID, sha256.Size) ||
+		!in.ReadUint64(&s.timestamp) ||
+		!in.ReadUint16LengthPrefixed((*cryptobyte.String)(&extensions)) ||
+		!in.ReadUint8(&s.hashAlg) ||
+		!in.ReadUint8(&s.sigAlg) ||
+		!in.ReadUint16LengthPrefixed((*cryptobyte.String)(&signature)) ||
+		!in.Empty() {
+		return s, fmt.Errorf("malformed SCT")
+	}
+	copy(s.logID[:], logID)
+	s.extensions, s.signature = extensions, signature
+	return s, nil
+}
+
+// parseSCTList parses a SignedCertificateTimestampList wrapped in the
+// ASN.1 OCTET STRING used by both the certificate and OCSP extensions.
+func parseSCTList(value []byte, source sctSource) ([]sct, error) {
+	var raw []byte
+	if rest, err := asn1.Unmarshal(value, &raw); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed SCT list extension")
+	}
+	in := cryptobyte.String(raw)
+	var list cryptobyte.String
+	if !in.ReadUint16LengthPrefixed(&list) || !in.Empty() {
+		return nil, fmt.Errorf("malformed SCT list")
+	}
+	var scts []sct
+	for !list.Empty() {
+		var data cryptobyte.String
+		if !list.ReadUint16LengthPrefixed(&data) {
+			return nil, fmt.Errorf("malformed SCT list")
+		}
+		s, err := parseSCT(data, source)
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, s)
+	}
+	return scts, nil
+}
+
+const (
+	ctX509Entry    = 0
+	ctPrecertEntry = 1
+
+	ctHashSHA256     = 4
+	ctSignatureRSA   = 1
+	ctSignatureECDSA = 3
+)
+
+// signedData returns the data covered by the SCT's signature for the
+// supplied log entry, see RFC 6962, Section 3.2.
+func (s sct) signedData(entryType uint16, entry func(*cryptobyte.Builder)) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddUint8(0) // v1
+	b.AddUint8(0) // certificate_timestamp
+	b.AddUint64(s.timestamp)
+	b.AddUint16(entryType)
+	entry(&b)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(s.extensions)
+	})
+	return b.Bytes()
+}
+
+// verify verifies the SCT's signature using the supplied log.
+func (s sct) verify(log CTLog, signed []byte) error {
+	if s.hashAlg != ctHashSHA256 {
+		return fmt.Errorf("unsupported SCT hash algorithm: %v", s.hashAlg)
+	}
+	digest := sha256.Sum256(signed)
+	switch key := log.Key.(type) {
+	case *ecdsa.PublicKey:
+		if s.sigAlg != ctSignatureECDSA || !ecdsa.VerifyASN1(key, digest[:], s.signature) {
+			return fmt.Errorf("invalid SCT signature")
+		}
+	case *rsa.PublicKey:
+		if s.sigAlg != ctSignatureRSA {
+			return fmt.Errorf("invalid SCT signature")
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], s.signature); err != nil {
+			return fmt.Errorf("invalid SCT signature: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported CT log key type: %T", log.Key)
+	}
+	return nil
+}
+
+// tbsWithoutSCTs returns the certificate's TBSCertificate with the
+// embedded SCT list extension removed, which is the form that was logged
+// as a precertificate.
+func tbsWithoutSCTs(cert *x509.Certificate) ([]byte, error) {
+	in := cryptobyte.String(cert.RawTBSCertificate)
+	var tbs cryptobyte.String
+	if !in.ReadASN1(&tbs, cbasn1.SEQUENCE) || !in.Empty() {
+		return nil, fmt.Errorf("malformed TBSCertificate")
+	}
+	extensionsTag := cbasn1.Tag(3).Constructed().ContextSpecific()
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !tbs.Empty() {
+			var elem cryptobyte.String
+			var tag cbasn1.Tag
+			if !tbs.ReadAnyASN1Element(&elem, &tag) {
+				b.SetError(fmt.Errorf("malformed TBSCertificate"))
+				return
+			}
+			if tag != extensionsTag {
+				b.AddBytes(elem)
+				continue
+			}
+			var explicit, exts cryptobyte.String
+			if !elem.ReadASN1(&explicit, extensionsTag) || !explicit.ReadASN1(&exts, cbasn1.SEQUENCE) {
+				b.SetError(fmt.Errorf("malformed TBSCertificate extensions"))
+				return
+			}
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					addExtensionsExcept(b, exts, oidSCTList)
+				})
+			})
+		}
+	})
+	return b.Bytes()
+}
+
+// addExtensionsExcept adds all of the DER encoded extensions in exts,
+// except for the one with the specified OID, to b.
+func addExtensionsExcept(b *cryptobyte.Builder, exts cryptobyte.String, except asn1.ObjectIdentifier) {
+	for !exts.Empty() {
+		var ext, body cryptobyte.String
+		var oid asn1.ObjectIdentifier
+		if !exts.ReadASN1Element(&ext, cbasn1.SEQUENCE) {
+			b.SetError(fmt.Errorf("malformed TBSCertificate extension"))
+			return
+		}
+		contents := ext
+		if !contents.ReadASN1(&body, cbasn1.SEQUENCE) || !body.ReadASN1ObjectIdentifier(&oid) {
+			b.SetError(fmt.Errorf("malformed TBSCertificate extension"))
+			return
+		}
+		if !oid.Equal(except) {
+			b.AddBytes(ext)
+		}
+	}
+}
+
+// certificateSCTs returns the SCTs embedded in the leaf certificate,
+// delivered via the TLS extension and included in a stapled OCSP response.
+func (cs *tlsState) certificateSCTs() ([]sct, []error) {
+	var scts []sct
+	var errs []error
+	leaf := cs.state.PeerCertificates[0]
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(oidSCTList) {
+			continue
+		}
+		s, err := parseSCTList(ext.Value, sctFromCertificate)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("certificate: %w", err))
+		}
+		scts = append(scts, s...)
+	}
+	for _, data := range cs.state.SignedCertificateTimestamps {
+		s, err := parseSCT(data, sctFromTLS)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tls: %w", err))
+			continue
+		}
+		scts = append(scts, s)
+	}
+	if staple, issuer := cs.state.OCSPResponse, cs.issuer(); len(staple) > 0 && issuer != nil {
+		resp, err := webapp.ParseOCSPResponse(staple, leaf, issuer)
+		if err != nil {
+			return scts, append(errs, fmt.Errorf("ocsp: %w", err))
+		}
+		for _, ext := range resp.Extensions {
+			if !ext.Id.Equal(oidOCSPSCTList) {
+				continue
+			}
+			s, err := parseSCTList(ext.Value, sctFromOCSP)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("ocsp: %w", err))
+			}
+			scts = append(scts, s...)
+		}
+	}
+	return scts, errs
+}
+
+// verifySCT verifies s against the log that issued it, returning the log.
+func (cs *tlsState) verifySCT(logs *CTLogList, s sct, now time.Time) (CTLog, error) {
+	log, ok := logs.Lookup(s.logID)
+	if !ok {
+		return log, fmt.Errorf("unknown CT log %v", base64.StdEncoding.EncodeToString(s.logID[:]))
+	}
+	if ts := time.UnixMilli(int64(s.timestamp)); ts.After(now) {
+		return log, fmt.Errorf("CT log %q: SCT timestamp %v is in the future", log.Description, ts)
+	}
+	leaf := cs.state.PeerCertificates[0]
+	var signed []byte
+	var err error
+	if s.source == sctFromCertificate {
+		issuer := cs.issuer()
+		if issuer == nil {
+			return log, fmt.Errorf("CT log %q: issuer certificate not found", log.Description)
+		}
+		tbs, terr := tbsWithoutSCTs(leaf)
+		if terr != nil {
+			return log, fmt.Errorf("CT log %q: %w", log.Description, terr)
+		}
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		signed, err = s.signedData(ctPrecertEntry, func(b *cryptobyte.Builder) {
+			b.AddBytes(issuerKeyHash[:])
+			b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(tbs)
+			})
+		})
+	} else {
+		signed, err = s.signedData(ctX509Entry, func(b *cryptobyte.Builder) {
+			b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(leaf.Raw)
+			})
+		})
+	}
+	if err != nil {
+		return log, fmt.Errorf("CT log %q: %w", log.Description, err)
+	}
+	if err := s.verify(log, signed); err != nil {
+		return log, fmt.Errorf("CT log %q: %v SCT: %w", log.Description, s.source, err)
+	}
+	return log, nil
+}
+
+func (v *Validator) checkCertificateTransparency(_ context.Context, cs *tlsState) error {
+	if v.opts.ctLogs == nil {
+		return nil
+	}
+	leaf := cs.state.PeerCertificates[0]
+	scts, errs := cs.certificateSCTs()
+	now := time.Now()
+	var operators []string
+	for _, s := range scts {
+		log, err := cs.verifySCT(v.opts.ctLogs, s, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !slices.Contains(operators, log.Operator) {
+			operators = append(operators, log.Operator)
+		}
+	}
+	if len(operators) >= v.opts.ctMinOperators {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return cs.error(leaf, fmt.Errorf("%v: %v found valid SCTs from %v distinct CT log operator(s) %v, at least %v required: %w: %v", cs.host, cs.addr, len(operators), operators, v.opts.ctMinOperators, ErrInsufficientSCTs, strings.Join(msgs, "; ")))
+}
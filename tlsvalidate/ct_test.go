@@ -0,0 +1,345 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/tlsvalidate"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	oidSCTList     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	oidOCSPSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+)
+
+type ctTestLog struct {
+	description, operator, state string
+	key                          *ecdsa.PrivateKey
+}
+
+func newCTTestLog(t *testing.T, description, operator string) *ctTestLog {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ctTestLog{description: description, operator: operator, state: "usable", key: key}
+}
+
+func (l *ctTestLog) keyDER(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&l.key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func (l *ctTestLog) logID(t *testing.T) [32]byte {
+	return sha256.Sum256(l.keyDER(t))
+}
+
+// sign returns an SCT for the specified entry signed by signer, which is
+// generally the log's own key.
+func (l *ctTestLog) sign(t *testing.T, signer *ecdsa.PrivateKey, entryType uint16, entry []byte) []byte {
+	t.Helper()
+	timestamp := uint64(time.Now().Add(-time.Minute).UnixMilli())
+	var signed cryptobyte.Builder
+	signed.AddUint8(0)
+	signed.AddUint8(0)
+	signed.AddUint64(timestamp)
+	signed.AddUint16(entryType)
+	signed.AddBytes(entry)
+	signed.AddUint16(0)
+	digest := sha256.Sum256(signed.BytesOrPanic())
+	sig, err := ecdsa.SignASN1(rand.Reader, signer, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := l.logID(t)
+	var b cryptobyte.Builder
+	b.AddUint8(0)
+	b.AddBytes(id[:])
+	b.AddUint64(timestamp)
+	b.AddUint16(0)
+	b.AddUint8(4) // sha256
+	b.AddUint8(3) // ecdsa
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sig)
+	})
+	return b.BytesOrPanic()
+}
+
+// signCert returns an SCT for the final certificate, as delivered via the
+// TLS extension or a stapled OCSP response.
+func (l *ctTestLog) signCert(t *testing.T, signer *ecdsa.PrivateKey, der []byte) []byte {
+	t.Helper()
+	var entry cryptobyte.Builder
+	entry.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(der)
+	})
+	return l.sign(t, signer, 0, entry.BytesOrPanic())
+}
+
+func writeCTLogList(t *testing.T, logs ...*ctTestLog) string {
+	t.Helper()
+	type log struct {
+		Description string                    `json:"description"`
+		LogID       string                    `json:"log_id"`
+		Key         string                    `json:"key"`
+		URL         string                    `json:"url"`
+		State       map[string]map[string]any `json:"state"`
+	}
+	type operator struct {
+		Name string `json:"name"`
+		Logs []log  `json:"logs"`
+	}
+	var operators []operator
+	for _, l := range logs {
+		id := l.logID(t)
+		entry := log{
+			Description: l.description,
+			LogID:       base64.StdEncoding.EncodeToString(id[:]),
+			Key:         base64.StdEncoding.EncodeToString(l.keyDER(t)),
+			URL:         "https://" + l.description + ".example.com/",
+			State:       map[string]map[string]any{l.state: {"timestamp": "2026-01-01T00:00:00Z"}},
+		}
+		if n := len(operators); n > 0 && operators[n-1].Name == l.operator {
+			operators[n-1].Logs = append(operators[n-1].Logs, entry)
+			continue
+		}
+		operators = append(operators, operator{Name: l.operator, Logs: []log{entry}})
+	}
+	data, err := json.Marshal(map[string]any{"version": "1.0", "operators": operators})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "log_list.json")
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func sctListExtension(t *testing.T, oid asn1.ObjectIdentifier, scts ...[]byte) pkix.Extension {
+	t.Helper()
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, sct := range scts {
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(sct)
+			})
+		}
+	})
+	value, err := asn1.Marshal(b.BytesOrPanic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: oid, Value: value}
+}
+
+// issueWithSCTs issues a certificate with SCTs from the specified logs
+// embedded in it, as would be the case for a certificate issued after
+// its precertificate has been logged.
+func (ca *revocationCA) issueWithSCTs(t *testing.T, logs ...*ctTestLog) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.mu.Lock()
+	ca.serial++
+	serial := ca.serial
+	ca.mu.Unlock()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Now().Add(-time.Hour).Truncate(time.Second),
+		NotAfter:     time.Now().Add(time.Hour).Truncate(time.Second),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	create := func() *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	if len(logs) > 0 {
+		precert := create()
+		issuerKeyHash := sha256.Sum256(ca.cert.RawSubjectPublicKeyInfo)
+		var entry cryptobyte.Builder
+		entry.AddBytes(issuerKeyHash[:])
+		entry.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(precert.RawTBSCertificate)
+		})
+		var scts [][]byte
+		for _, l := range logs {
+			scts = append(scts, l.sign(t, l.key, 1, entry.BytesOrPanic()))
+		}
+		template.ExtraExtensions = []pkix.Extension{sctListExtension(t, oidSCTList, scts...)}
+	}
+	leaf := create()
+	return tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+}
+
+func (ca *revocationCA) stapleWithSCTs(t *testing.T, leaf *x509.Certificate, scts ...[]byte) []byte {
+	t.Helper()
+	staple, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+		Status:          ocsp.Good,
+		SerialNumber:    leaf.SerialNumber,
+		ThisUpdate:      time.Now().Add(-time.Minute),
+		NextUpdate:      time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{sctListExtension(t, oidOCSPSCTList, scts...)},
+	}, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return staple
+}
+
+func TestParseCTLogList(t *testing.T) {
+	a := newCTTestLog(t, "a", "op1")
+	b := newCTTestLog(t, "b", "op2")
+	pending := newCTTestLog(t, "pending", "op2")
+	pending.state = "pending"
+	logs, err := tlsvalidate.ReadCTLogList(writeCTLogList(t, a, b, pending))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := logs.Len(), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	log, ok := logs.Lookup(b.logID(t))
+	if !ok {
+		t.Fatalf("log %v not found", b.description)
+	}
+	if got, want := log.Operator, "op2"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := log.URL, "https://b.example.com/"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, ok := logs.Lookup(pending.logID(t)); ok {
+		t.Errorf("pending log should not be included")
+	}
+
+	data, err := os.ReadFile(writeCTLogList(t, a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aID, bID := a.logID(t), b.logID(t)
+	data = []byte(strings.ReplaceAll(string(data),
+		base64.StdEncoding.EncodeToString(aID[:]),
+		base64.StdEncoding.EncodeToString(bID[:])))
+	if _, err := tlsvalidate.ParseCTLogList(data); err == nil || !strings.Contains(err.Error(), "does not match its key") {
+		t.Errorf("expected a log_id mismatch error: %v", err)
+	}
+}
+
+func TestCertificateTransparency(t *testing.T) {
+	ctx := context.Background()
+	ca := newRevocationCA(t)
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(ca.cert)
+
+	a := newCTTestLog(t, "a", "op1")
+	a2 := newCTTestLog(t, "a2", "op1")
+	b := newCTTestLog(t, "b", "op2")
+	unknown := newCTTestLog(t, "unknown", "op3")
+	logs, err := tlsvalidate.ReadCTLogList(writeCTLogList(t, a, a2, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embedded := ca.issueWithSCTs(t, a)
+	embeddedHost, embeddedPort := startRevocationServer(t, embedded)
+
+	withTLS := embedded
+	withTLS.SignedCertificateTimestamps = [][]byte{b.signCert(t, b.key, embedded.Leaf.Raw)}
+	tlsHost, tlsPort := startRevocationServer(t, withTLS)
+
+	sameOperator := embedded
+	sameOperator.SignedCertificateTimestamps = [][]byte{a2.signCert(t, a2.key, embedded.Leaf.Raw)}
+	sameHost, samePort := startRevocationServer(t, sameOperator)
+
+	badSignature := embedded
+	badSignature.SignedCertificateTimestamps = [][]byte{b.signCert(t, a.key, embedded.Leaf.Raw)}
+	badHost, badPort := startRevocationServer(t, badSignature)
+
+	unknownLog := embedded
+	unknownLog.SignedCertificateTimestamps = [][]byte{unknown.signCert(t, unknown.key, embedded.Leaf.Raw)}
+	unknownHost, unknownPort := startRevocationServer(t, unknownLog)
+
+	plain := ca.issueWithSCTs(t)
+	stapled := plain
+	stapled.OCSPStaple = ca.stapleWithSCTs(t, plain.Leaf,
+		a.signCert(t, a.key, plain.Leaf.Raw),
+		b.signCert(t, b.key, plain.Leaf.Raw))
+	stapledHost, stapledPort := startRevocationServer(t, stapled)
+	plainHost, plainPort := startRevocationServer(t, plain)
+
+	for _, tc := range []struct {
+		name         string
+		minOperators int
+		host, port   string
+		errorMsg     string
+	}{
+		{"embedded", 1, embeddedHost, embeddedPort, ""},
+		{"embedded only", 2, embeddedHost, embeddedPort, "1 distinct CT log operator(s) [op1]"},
+		{"embedded and tls", 2, tlsHost, tlsPort, ""},
+		{"same operator", 2, sameHost, samePort, "1 distinct CT log operator(s) [op1]"},
+		{"bad signature", 2, badHost, badPort, "invalid SCT signature"},
+		{"unknown log", 2, unknownHost, unknownPort, "unknown CT log"},
+		{"stapled", 2, stapledHost, stapledPort, ""},
+		{"none", 1, plainHost, plainPort, "0 distinct CT log operator(s)"},
+	} {
+		validator := tlsvalidate.NewValidator(
+			tlsvalidate.WithRootCAs(rootPool),
+			tlsvalidate.WithCertificateTransparency(logs, tc.minOperators),
+		)
+		err := validator.Validate(ctx, tc.host, tc.port)
+		if len(tc.errorMsg) == 0 {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+			t.Errorf("%v: got %v, want an error containing %q", tc.name, err, tc.errorMsg)
+			continue
+		}
+		if !errors.Is(err, tlsvalidate.ErrInsufficientSCTs) {
+			t.Errorf("%v: expected ErrInsufficientSCTs: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+
+	"cloudeng.io/errors"
+	"cloudeng.io/webapp"
+)
+
+// WithTLSPolicy returns an option that configures the validator to check
+// that every address for a host conforms to the supplied policy, ie. that
+// it accepts only the TLS versions, cipher suites, curves and signature
+// schemes allowed by the policy. The check uses a Scanner, configured
+// with the supplied options, and hence requires a separate handshake for
+// every value that is probed.
+func WithTLSPolicy(policy webapp.TLSPolicy, opts ...ScanOption) Option {
+	return func(o *options) {
+		o.tlsPolicy = &policy
+		o.tlsPolicyScanOpts = opts
+	}
+}
+
+// CheckPolicy returns an error describing every way in which the scanned
+// server does not conform to policy, or nil if it conforms. TLS 1.3 cipher
+// suites are ignored since they cannot be configured using crypto/tls and
+// are considered acceptable by all policies.
+func (r *ScanResult) CheckPolicy(policy webapp.TLSPolicy) error {
+	var errs errors.M
+	addr := net.JoinHostPort(r.Host, r.Port)
+	if len(r.Versions) == 0 {
+		errs.Append(fmt.Errorf("%v: does not accept any TLS versions", addr))
+	}
+	allowedVersions := policy.Versions()
+	for _, v := range r.Versions {
+		if !slices.Contains(allowedVersions, v) {
+			errs.Append(fmt.Errorf("%v: accepts %v which is not allowed by the %q policy", addr, tls.VersionName(v), policy.Name))
+		}
+	}
+	for _, cs := range r.CipherSuites {
+		if isTLS13CipherSuite(cs) {
+			continue
+		}
+		if !slices.Contains(policy.CipherSuites, cs) {
+			errs.Append(fmt.Errorf("%v: accepts cipher suite %v which is not allowed by the %q policy", addr, tls.CipherSuiteName(cs), policy.Name))
+		}
+	}
+	for _, c := range r.Curves {
+		if !slices.Contains(policy.Curves, c) {
+			errs.Append(fmt.Errorf("%v: accepts curve %v which is not allowed by the %q policy", addr, c, policy.Name))
+		}
+	}
+	for _, s := range r.SignatureSchemes {
+		if !slices.Contains(policy.SignatureSchemes, s) {
+			errs.Append(fmt.Errorf("%v: accepts signature scheme %v which is not allowed by the %q policy", addr, s, policy.Name))
+		}
+	}
+	return errs.Err()
+}
+
+func isTLS13CipherSuite(id uint16) bool {
+	info := cipherSuiteInfo(id)
+	return info != nil && slices.Equal(info.SupportedVersions, []uint16{tls.VersionTLS13})
+}
+
+func (v *Validator) checkTLSPolicy(ctx context.Context, cs *tlsState) error {
+	leaf := cs.state.PeerCertificates[0]
+	opts := append([]ScanOption{WithScanServerName(cs.host), WithScanALPNProtocols()}, v.opts.tlsPolicyScanOpts...)
+	result, err := NewScanner(opts...).Scan(ctx, cs.addr, cs.port)
+	if err != nil {
+		return cs.error(leaf, fmt.Errorf("failed to scan TLS configuration: %w", err))
+	}
+	if err := result.CheckPolicy(*v.opts.tlsPolicy); err != nil {
+		return cs.error(leaf, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate_test
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/tlsvalidate"
+)
+
+func TestTLSPolicy(t *testing.T) {
+	ctx := context.Background()
+	cert, key := newCert(t, "localhost", false, []string{"localhost"}, []net.IP{net.ParseIP("127.0.0.1")}, nil, nil)
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(cert)
+
+	policy := func(name string) webapp.TLSPolicy {
+		p, err := webapp.ParseTLSPolicy(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	intermediate := policy(webapp.TLSPolicyIntermediate)
+	host, port := startScanServer(t, cert, key, intermediate.TLSConfig(), false)
+
+	validator := tlsvalidate.NewValidator(
+		tlsvalidate.WithRootCAs(rootPool),
+		tlsvalidate.WithTLSPolicy(intermediate))
+	report, err := validator.ValidateReport(ctx, host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Addresses[0].Checks; len(got) != 1 || got[0].Name != "tls-policy" || !got[0].Passed {
+		t.Errorf("unexpected checks: %v", got)
+	}
+
+	validator = tlsvalidate.NewValidator(
+		tlsvalidate.WithRootCAs(rootPool),
+		tlsvalidate.WithTLSPolicy(policy(webapp.TLSPolicyModern)))
+	err = validator.Validate(ctx, host, port)
+	if err == nil || !strings.Contains(err.Error(), `accepts TLS 1.2 which is not allowed by the "modern" policy`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// A server using the legacy policy accepts CBC cipher suites that the
+	// intermediate policy does not allow.
+	host, port = startScanServer(t, cert, key, policy(webapp.TLSPolicyLegacy).TLSConfig(), false)
+	result, err := tlsvalidate.NewScanner().Scan(ctx, host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := result.CheckPolicy(policy(webapp.TLSPolicyLegacy)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = result.CheckPolicy(intermediate)
+	if err == nil || !strings.Contains(err.Error(), "accepts cipher suite TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA which is not allowed") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got, want := result.Versions, webapp.KnownTLSVersions(); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	"cloudeng.io/webapp"
+)
+
+// Report represents the machine readable results of validating the
+// certificates served by all of the addresses for a host and is intended
+// to be marshaled as JSON or YAML.
+type Report struct {
+	Host      string        `yaml:"host" json:"host"`
+	Port      string        `yaml:"port" json:"port"`
+	Time      time.Time     `yaml:"time" json:"time"`
+	Passed    bool          `yaml:"passed" json:"passed"`
+	Errors    []string      `yaml:"errors,omitempty" json:"errors,omitempty"`
+	Addresses []AddrReport  `yaml:"addresses" json:"addresses"`
+	Checks    []CheckResult `yaml:"checks,omitempty" json:"checks,omitempty"` // Checks performed across all addresses.
+}
+
+// AddrReport represents the results of validating the certificates
+// served by a single address.
+type AddrReport struct {
+	Addr            string            `yaml:"addr" json:"addr"`
+	TLSVersion      string            `yaml:"tls_version" json:"tls_version"`
+	CipherSuite     string            `yaml:"cipher_suite" json:"cipher_suite"`
+	OCSPStapled     bool              `yaml:"ocsp_stapled" json:"ocsp_stapled"`
+	ValidForSeconds int64             `yaml:"valid_for_seconds" json:"valid_for_seconds"` // Time remaining until the leaf certificate expires.
+	Chain           []CertificateInfo `yaml:"chain" json:"chain"`                         // The certificates presented by the server.
+	VerifiedChain   []CertificateInfo `yaml:"verified_chain" json:"verified_chain"`       // The chain used to verify the leaf certificate.
+	Checks          []CheckResult     `yaml:"checks" json:"checks"`
+}
+
+// CertificateInfo represents the details of a certificate that are
+// included in a Report.
+type CertificateInfo struct {
+	Subject            string    `yaml:"subject" json:"subject"`
+	Issuer             string    `yaml:"issuer" json:"issuer"`
+	Serial             string    `yaml:"serial" json:"serial"`
+	DNSNames           []string  `yaml:"dns_names,omitempty" json:"dns_names,omitempty"`
+	IsCA               bool      `yaml:"is_ca" json:"is_ca"`
+	NotBefore          time.Time `yaml:"not_before" json:"not_before"`
+	NotAfter           time.Time `yaml:"not_after" json:"not_after"`
+	SignatureAlgorithm string    `yaml:"signature_algorithm" json:"signature_algorithm"`
+	PublicKeyAlgorithm string    `yaml:"public_key_algorithm" json:"public_key_algorithm"`
+}
+
+// NewCertificateInfo returns the CertificateInfo for cert.
+func NewCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Serial:             webapp.SerialNumberOpenSSL(cert.SerialNumber),
+		DNSNames:           cert.DNSNames,
+		IsCA:               cert.IsCA,
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		PublicKeyAlgorithm: cert.PublicKeyAlgorithm.String(),
+	}
+}
+
+// NewCertificateInfoChain returns the CertificateInfo for each of certs.
+func NewCertificateInfoChain(certs []*x509.Certificate) []CertificateInfo {
+	infos := make([]CertificateInfo, len(certs))
+	for i, cert := range certs {
+		infos[i] = NewCertificateInfo(cert)
+	}
+	return infos
+}
+
+// CheckResult represents the result of a single check. Only the checks
+// enabled by the Validator's options are included in a Report.
+type CheckResult struct {
+	Name   string `yaml:"name" json:"name"`
+	Passed bool   `yaml:"passed" json:"passed"`
+	Error  string `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// NewCheckResult returns a CheckResult for the named check that passed
+// if err is nil.
+func NewCheckResult(name string, err error) CheckResult {
+	if err != nil {
+		return CheckResult{Name: name, Error: err.Error()}
+	}
+	return CheckResult{Name: name, Passed: true}
+}
+
+func newAddrReport(cs *tlsState, now time.Time) AddrReport {
+	state := cs.state
+	ar := AddrReport{
+		Addr:        cs.addr,
+		TLSVersion:  tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		OCSPStapled: len(state.OCSPResponse) > 0,
+		Chain:       NewCertificateInfoChain(state.PeerCertificates),
+	}
+	if len(state.VerifiedChains) > 0 {
+		ar.VerifiedChain = NewCertificateInfoChain(state.VerifiedChains[0])
+	}
+	if len(state.PeerCertificates) > 0 {
+		ar.ValidForSeconds = int64(state.PeerCertificates[0].NotAfter.Sub(now).Seconds())
+	}
+	return ar
+}
@@ -0,0 +1,108 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate_test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/tlsvalidate"
+)
+
+func TestValidateReport(t *testing.T) {
+	ctx := context.Background()
+	rootCert, rootKey := newCert(t, "root.com", true, nil, nil, nil, nil)
+	leafCert, leafKey := newCert(t, "leaf.com", false, []string{"localhost"}, []net.IP{net.ParseIP("127.0.0.1")}, rootCert, rootKey)
+	addr, cleanup := startTLSServer(t, leafCert, leafKey, "127.0.0.1:0")
+	defer cleanup()
+	host, port, _ := net.SplitHostPort(addr)
+
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(rootCert)
+
+	validator := tlsvalidate.NewValidator(
+		tlsvalidate.WithRootCAs(rootPool),
+		tlsvalidate.WithValidForAtLeast(time.Minute),
+		tlsvalidate.WithIssuerRegexps(regexp.MustCompile("not-the-issuer")),
+	)
+	report, err := validator.ValidateReport(ctx, host, port)
+	if err == nil || !strings.Contains(err.Error(), "does not match any of the specified patterns") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Passed || len(report.Errors) != 1 {
+		t.Errorf("unexpected report status: %v %v", report.Passed, report.Errors)
+	}
+	if got, want := len(report.Addresses), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	ar := report.Addresses[0]
+	if got, want := ar.Addr, host; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := ar.TLSVersion, "TLS 1.2"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(ar.Chain) != 1 || len(ar.VerifiedChain) != 2 {
+		t.Fatalf("unexpected chains: %v %v", ar.Chain, ar.VerifiedChain)
+	}
+	if got, want := ar.Chain[0].Subject, "CN=leaf.com"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := ar.VerifiedChain[1].Subject, "CN=root.com"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if ar.ValidForSeconds <= 0 || ar.ValidForSeconds > 3600 {
+		t.Errorf("unexpected valid for: %v", ar.ValidForSeconds)
+	}
+
+	// Both checks are run even though the first fails.
+	want := []tlsvalidate.CheckResult{
+		{Name: "issuer", Passed: false},
+		{Name: "valid-for", Passed: true},
+	}
+	if got := ar.Checks; len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, c := range ar.Checks {
+		if c.Name != want[i].Name || c.Passed != want[i].Passed || c.Passed != (len(c.Error) == 0) {
+			t.Errorf("%v: got %v, want %v", i, c, want[i])
+		}
+	}
+	if got, want := len(report.Checks), 1; got != want || report.Checks[0].Name != "non-zero-serial-numbers" || !report.Checks[0].Passed {
+		t.Errorf("unexpected host checks: %v", report.Checks)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded tlsvalidate.Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decoded.Addresses[0].Chain[0].Serial, ar.Chain[0].Serial; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, field := range []string{`"cipher_suite":`, `"verified_chain":`, `"valid_for_seconds":`, `"not_after":`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("%s does not contain %v", data, field)
+		}
+	}
+
+	validator = tlsvalidate.NewValidator(tlsvalidate.WithRootCAs(rootPool))
+	report, err = validator.ValidateReport(ctx, host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed || len(report.Errors) != 0 || len(report.Addresses[0].Checks) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
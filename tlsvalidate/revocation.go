@@ -0,0 +1,209 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloudeng.io/webapp"
+	"golang.org/x/crypto/ocsp"
+)
+
+// RevocationMethod specifies the means by which the revocation status of
+// a certificate is determined. Methods may be combined using |.
+type RevocationMethod int
+
+const (
+	// RevocationOCSP uses the OCSP response stapled by the server, if any,
+	// or otherwise queries the certificate's OCSP responder.
+	RevocationOCSP RevocationMethod = 1 << iota
+	// RevocationCRL fetches the certificate's CRL distribution points.
+	RevocationCRL
+)
+
+// ParseRevocationMethods parses a comma separated list of revocation
+// methods, "ocsp" and/or "crl". An empty string returns 0, ie. no
+// revocation checking.
+func ParseRevocationMethods(methods string) (RevocationMethod, error) {
+	var m RevocationMethod
+	if len(methods) == 0 {
+		return m, nil
+	}
+	for method := range strings.SplitSeq(methods, ",") {
+		switch strings.TrimSpace(method) {
+		case "ocsp":
+			m |= RevocationOCSP
+		case "crl":
+			m |= RevocationCRL
+		default:
+			return 0, fmt.Errorf("unsupported revocation method: %q", method)
+		}
+	}
+	return m, nil
+}
+
+// ErrCertificateRevoked is wrapped by the ErrValidator returned for a
+// certificate that has been revoked.
+var ErrCertificateRevoked = errors.New("certificate has been revoked")
+
+// WithRevocationCheck returns an option that configures the validator to
+// check that the leaf certificate has not been revoked using the
+// specified methods. Any OCSP response stapled by the server is always
+// verified when revocation checking is enabled. A revoked certificate
+// results in an ErrValidator that wraps ErrCertificateRevoked, whereas a
+// failure to determine the certificate's revocation status, for example
+// because it specifies neither an OCSP responder nor CRL distribution
+// point for the requested methods, results in an ErrValidator that
+// describes the failure.
+func WithRevocationCheck(methods RevocationMethod) Option {
+	return func(o *options) {
+		o.revocation = methods
+	}
+}
+
+// WithRevocationHTTPClient returns an option that configures the
+// validator to use the supplied http.Client to query OCSP responders and
+// fetch CRLs. The default is http.DefaultClient.
+func WithRevocationHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.revocationClient = client
+	}
+}
+
+// issuer returns the issuer of the leaf certificate, preferring the
+// verified chain to the certificates presented by the server.
+func (cs *tlsState) issuer() *x509.Certificate {
+	if chains := cs.state.VerifiedChains; len(chains) > 0 && len(chains[0]) > 1 {
+		return chains[0][1]
+	}
+	if peers := cs.state.PeerCertificates; len(peers) > 1 {
+		return peers[1]
+	}
+	return nil
+}
+
+func (v *Validator) checkRevocation(ctx context.Context, cs *tlsState) error {
+	if v.opts.revocation == 0 {
+		return nil
+	}
+	leaf := cs.state.PeerCertificates[0]
+	issuer := cs.issuer()
+	if issuer == nil {
+		return cs.error(leaf, fmt.Errorf("%v: %v unable to check revocation status: issuer certificate not found", cs.host, cs.addr))
+	}
+	now := time.Now()
+	stapled := false
+	if staple := cs.state.OCSPResponse; len(staple) > 0 {
+		resp, err := webapp.ParseOCSPResponse(staple, leaf, issuer)
+		if err != nil {
+			return cs.error(leaf, fmt.Errorf("%v: %v invalid stapled OCSP response: %w", cs.host, cs.addr, err))
+		}
+		if err := ocspStatus(resp, now); err != nil {
+			return cs.error(leaf, fmt.Errorf("%v: %v stapled OCSP response: %w", cs.host, cs.addr, err))
+		}
+		stapled = true
+	}
+	if v.opts.revocation&RevocationOCSP != 0 && !stapled {
+		if len(leaf.OCSPServer) == 0 {
+			return cs.error(leaf, fmt.Errorf("%v: %v unable to check revocation status: certificate does not specify an OCSP responder", cs.host, cs.addr))
+		}
+		resp, _, err := webapp.QueryOCSP(ctx, v.revocationClient(), leaf, issuer)
+		if err != nil {
+			return cs.error(leaf, fmt.Errorf("%v: %v failed to query OCSP responder: %w", cs.host, cs.addr, err))
+		}
+		if err := ocspStatus(resp, now); err != nil {
+			return cs.error(leaf, fmt.Errorf("%v: %v OCSP responder %v: %w", cs.host, cs.addr, leaf.OCSPServer[0], err))
+		}
+	}
+	if v.opts.revocation&RevocationCRL != 0 {
+		if len(leaf.CRLDistributionPoints) == 0 {
+			return cs.error(leaf, fmt.Errorf("%v: %v unable to check revocation status: certificate does not specify a CRL distribution point", cs.host, cs.addr))
+		}
+		for _, url := range leaf.CRLDistributionPoints {
+			crl, err := v.fetchCRL(ctx, url, issuer, now)
+			if err != nil {
+				return cs.error(leaf, fmt.Errorf("%v: %v failed to obtain CRL %v: %w", cs.host, cs.addr, url, err))
+			}
+			for _, entry := range crl.RevokedCertificateEntries {
+				if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+					return cs.error(leaf, fmt.Errorf("%v: %v CRL %v: serial %v revoked at %v: %w", cs.host, cs.addr, url, webapp.SerialNumberHex(leaf.SerialNumber), entry.RevocationTime, ErrCertificateRevoked))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func ocspStatus(resp *ocsp.Response, now time.Time) error {
+	switch resp.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		return fmt.Errorf("serial %v revoked at %v: %w", webapp.SerialNumberHex(resp.SerialNumber), resp.RevokedAt, ErrCertificateRevoked)
+	default:
+		return fmt.Errorf("serial %v has unknown revocation status", webapp.SerialNumberHex(resp.SerialNumber))
+	}
+	if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate) {
+		return fmt.Errorf("response expired at %v", resp.NextUpdate)
+	}
+	return nil
+}
+
+func (v *Validator) revocationClient() *http.Client {
+	if v.opts.revocationClient != nil {
+		return v.opts.revocationClient
+	}
+	return http.DefaultClient
+}
+
+// fetchCRL returns the CRL at url, verified against issuer, reusing a
+// previously fetched CRL until its next update time.
+func (v *Validator) fetchCRL(ctx context.Context, url string, issuer *x509.Certificate, now time.Time) (*x509.RevocationList, error) {
+	v.crlMu.Lock()
+	crl, ok := v.crls[url]
+	v.crlMu.Unlock()
+	if !ok || (!crl.NextUpdate.IsZero() && now.After(crl.NextUpdate)) {
+		var err error
+		if crl, err = v.downloadCRL(ctx, url); err != nil {
+			return nil, err
+		}
+		v.crlMu.Lock()
+		v.crls[url] = crl
+		v.crlMu.Unlock()
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, err
+	}
+	if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+		return nil, fmt.Errorf("CRL expired at %v", crl.NextUpdate)
+	}
+	return crl, nil
+}
+
+func (v *Validator) downloadCRL(ctx context.Context, url string) (*x509.RevocationList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.revocationClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v", resp.Status)
+	}
+	der, err := io.ReadAll(io.LimitReader(resp.Body, 1<<26))
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseRevocationList(der)
+}
@@ -0,0 +1,325 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/tlsvalidate"
+	"golang.org/x/crypto/ocsp"
+)
+
+type revocationCA struct {
+	*httptest.Server
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	serial   int64
+	revoked  map[int64]bool
+	requests int
+}
+
+func newRevocationCA(t *testing.T) *revocationCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "revocation-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour * 24),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &revocationCA{cert: cert, key: key, serial: 1, revoked: map[int64]bool{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ocsp", ca.ocsp)
+	mux.HandleFunc("/crl", ca.crl)
+	ca.Server = httptest.NewServer(mux)
+	t.Cleanup(ca.Close)
+	return ca
+}
+
+func (ca *revocationCA) ocsp(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	ca.requests++
+	ca.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	req, err := ocsp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := ca.ocspResponse(req.SerialNumber)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = w.Write(resp)
+}
+
+func (ca *revocationCA) ocspResponse(serial *big.Int) ([]byte, error) {
+	ca.mu.Lock()
+	revoked := ca.revoked[serial.Int64()]
+	ca.mu.Unlock()
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: serial,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}
+	if revoked {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = time.Now().Add(-time.Minute)
+	}
+	return ocsp.CreateResponse(ca.cert, ca.cert, template, ca.key)
+}
+
+func (ca *revocationCA) crl(w http.ResponseWriter, _ *http.Request) {
+	list := &x509.RevocationList{
+		Number:     big.NewInt(time.Now().UnixNano()),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	ca.mu.Lock()
+	for serial := range ca.revoked {
+		list.RevokedCertificateEntries = append(list.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	ca.mu.Unlock()
+	der, err := x509.CreateRevocationList(rand.Reader, list, ca.cert, ca.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(der)
+}
+
+func (ca *revocationCA) issue(t *testing.T, revoked bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.mu.Lock()
+	ca.serial++
+	serial := ca.serial
+	if revoked {
+		ca.revoked[serial] = true
+	}
+	ca.mu.Unlock()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "leaf"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		OCSPServer:            []string{ca.URL + "/ocsp"},
+		CRLDistributionPoints: []string{ca.URL + "/crl"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func startRevocationServer(t *testing.T, cert tls.Certificate) (string, string) {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background()) //nolint:errcheck
+	})
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
+
+func TestParseRevocationMethods(t *testing.T) {
+	for _, tc := range []struct {
+		methods string
+		want    tlsvalidate.RevocationMethod
+	}{
+		{"", 0},
+		{"ocsp", tlsvalidate.RevocationOCSP},
+		{"crl", tlsvalidate.RevocationCRL},
+		{"ocsp,crl", tlsvalidate.RevocationOCSP | tlsvalidate.RevocationCRL},
+	} {
+		got, err := tlsvalidate.ParseRevocationMethods(tc.methods)
+		if err != nil || got != tc.want {
+			t.Errorf("%q: got %v, %v, want %v", tc.methods, got, err, tc.want)
+		}
+	}
+	if _, err := tlsvalidate.ParseRevocationMethods("ocsp,crls"); err == nil {
+		t.Errorf("expected an error for an unsupported method")
+	}
+}
+
+func TestRevocationCheck(t *testing.T) {
+	ctx := context.Background()
+	ca := newRevocationCA(t)
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(ca.cert)
+
+	good := ca.issue(t, false)
+	revoked := ca.issue(t, true)
+	goodHost, goodPort := startRevocationServer(t, good)
+	revokedHost, revokedPort := startRevocationServer(t, revoked)
+
+	// A good certificate whose server staples a response that claims
+	// that it has been revoked.
+	stapledRevoked := good
+	staple, err := ca.ocspResponse(revoked.Leaf.SerialNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stapledRevoked.OCSPStaple = staple
+	stapledHost, stapledPort := startRevocationServer(t, stapledRevoked)
+
+	ocspAndCRL := tlsvalidate.RevocationOCSP | tlsvalidate.RevocationCRL
+	for _, tc := range []struct {
+		name       string
+		methods    tlsvalidate.RevocationMethod
+		host, port string
+		errorMsg   string
+		revoked    bool
+	}{
+		{"disabled", 0, revokedHost, revokedPort, "", false},
+		{"ocsp good", tlsvalidate.RevocationOCSP, goodHost, goodPort, "", false},
+		{"crl good", tlsvalidate.RevocationCRL, goodHost, goodPort, "", false},
+		{"both good", ocspAndCRL, goodHost, goodPort, "", false},
+		{"ocsp revoked", tlsvalidate.RevocationOCSP, revokedHost, revokedPort, "OCSP responder", true},
+		{"crl revoked", tlsvalidate.RevocationCRL, revokedHost, revokedPort, "CRL", true},
+		{"invalid staple", tlsvalidate.RevocationCRL, stapledHost, stapledPort, "invalid stapled OCSP response", false},
+	} {
+		validator := tlsvalidate.NewValidator(
+			tlsvalidate.WithRootCAs(rootPool),
+			tlsvalidate.WithRevocationCheck(tc.methods),
+		)
+		err := validator.Validate(ctx, tc.host, tc.port)
+		if len(tc.errorMsg) == 0 {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+			t.Errorf("%v: got %v, want an error containing %q", tc.name, err, tc.errorMsg)
+			continue
+		}
+		if got, want := errors.Is(err, tlsvalidate.ErrCertificateRevoked), tc.revoked; got != want {
+			t.Errorf("%v: got %v, want %v", tc.name, got, want)
+		}
+		errValidator, ok := errors.AsType[*tlsvalidate.ErrValidator](err)
+		if !ok || errValidator.Certificate == nil {
+			t.Errorf("%v: expected an ErrValidator with a certificate: %v", tc.name, err)
+		}
+	}
+
+	// A valid stapled response that reports the certificate as revoked.
+	revokedStaple, err := ca.ocspResponse(revoked.Leaf.SerialNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked.OCSPStaple = revokedStaple
+	host, port := startRevocationServer(t, revoked)
+	err = tlsvalidate.NewValidator(
+		tlsvalidate.WithRootCAs(rootPool),
+		tlsvalidate.WithRevocationCheck(tlsvalidate.RevocationOCSP),
+	).Validate(ctx, host, port)
+	if !errors.Is(err, tlsvalidate.ErrCertificateRevoked) || !strings.Contains(err.Error(), "stapled OCSP response") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateStopsAtFirstFailure(t *testing.T) {
+	ctx := context.Background()
+	ca := newRevocationCA(t)
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(ca.cert)
+	host, port := startRevocationServer(t, ca.issue(t, false))
+
+	validator := tlsvalidate.NewValidator(
+		tlsvalidate.WithRootCAs(rootPool),
+		tlsvalidate.WithIssuerRegexps(regexp.MustCompile("not-the-issuer")),
+		tlsvalidate.WithRevocationCheck(tlsvalidate.RevocationOCSP),
+	)
+	requests := func() int {
+		ca.mu.Lock()
+		defer ca.mu.Unlock()
+		return ca.requests
+	}
+
+	// Validate does not run the revocation check once the issuer check
+	// has failed.
+	if err := validator.Validate(ctx, host, port); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got, want := requests(), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// ValidateReport runs all of the checks.
+	report, err := validator.ValidateReport(ctx, host, port)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if got, want := requests(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(report.Addresses[0].Checks), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,592 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudeng.io/webapp"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// ScanOption represents an option for configuring a Scanner.
+type ScanOption func(o *scanOptions)
+
+type scanOptions struct {
+	timeout    time.Duration
+	alpn       []string
+	serverName string
+}
+
+// WithScanTimeout returns an option that configures the time allowed for
+// each of the handshakes performed by the scanner. The default is 10
+// seconds.
+func WithScanTimeout(timeout time.Duration) ScanOption {
+	return func(o *scanOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithScanALPNProtocols returns an option that configures the ALPN
+// protocols that the scanner probes for. The default is h2 and http/1.1.
+func WithScanALPNProtocols(protocols ...string) ScanOption {
+	return func(o *scanOptions) {
+		o.alpn = protocols
+	}
+}
+
+// WithScanServerName returns an option that configures the server name
+// sent via SNI by the scanner. The default is the host being scanned.
+func WithScanServerName(name string) ScanOption {
+	return func(o *scanOptions) {
+		o.serverName = name
+	}
+}
+
+// Scanner probes a server to determine exactly which of the TLS versions,
+// cipher suites, curves, signature schemes and ALPN protocols known to
+// the webapp package it accepts. Unlike a Validator, which is restricted
+// to whatever a Go client negotiates, the Scanner performs a separate
+// handshake for each value offering only that value. Certificates are
+// not verified by the Scanner since it is only concerned with the
+// parameters that the server accepts; use a Validator to verify them.
+type Scanner struct {
+	opts scanOptions
+}
+
+// NewScanner returns a new Scanner configured with the supplied options.
+func NewScanner(opts ...ScanOption) *Scanner {
+	s := &Scanner{}
+	s.opts.timeout = 10 * time.Second
+	s.opts.alpn = []string{"h2", "http/1.1"}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	return s
+}
+
+// ScanResult represents the TLS parameters accepted by a server. Each
+// list is in the order returned by the corresponding webapp.Known...
+// function.
+type ScanResult struct {
+	Host             string                     `yaml:"host" json:"host"`
+	Port             string                     `yaml:"port" json:"port"`
+	Versions         webapp.TLSVersions         `yaml:"versions" json:"versions"`
+	CipherSuites     webapp.CipherSuites        `yaml:"cipher_suites" json:"cipher_suites"`
+	Curves           webapp.TLSCurves           `yaml:"curves" json:"curves"`
+	SignatureSchemes webapp.TLSSignatureSchemes `yaml:"signature_schemes" json:"signature_schemes"`
+	ALPNProtocols    []string                   `yaml:"alpn_protocols" json:"alpn_protocols"`
+}
+
+// MarshalJSON implements json.Marshaler, representing versions, cipher
+// suites, curves and signature schemes by name as is done when marshaling
+// to YAML.
+func (r ScanResult) MarshalJSON() ([]byte, error) {
+	versions, _ := r.Versions.MarshalYAML()
+	suites, _ := r.CipherSuites.MarshalYAML()
+	curves, _ := r.Curves.MarshalYAML()
+	schemes, _ := r.SignatureSchemes.MarshalYAML()
+	return json.Marshal(struct {
+		Host             string   `json:"host"`
+		Port             string   `json:"port"`
+		Versions         any      `json:"versions"`
+		CipherSuites     any      `json:"cipher_suites"`
+		Curves           any      `json:"curves"`
+		SignatureSchemes any      `json:"signature_schemes"`
+		ALPNProtocols    []string `json:"alpn_protocols"`
+	}{r.Host, r.Port, versions, suites, curves, schemes, r.ALPNProtocols})
+}
+
+// String implements fmt.Stringer.
+func (r ScanResult) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%v:\n", net.JoinHostPort(r.Host, r.Port))
+	fmt.Fprintf(&out, "  versions: %v\n", r.Versions)
+	fmt.Fprintf(&out, "  cipher suites: %v\n", r.CipherSuites)
+	fmt.Fprintf(&out, "  curves: %v\n", r.Curves)
+	fmt.Fprintf(&out, "  signature schemes: %v\n", r.SignatureSchemes)
+	fmt.Fprintf(&out, "  alpn protocols: %v\n", strings.Join(r.ALPNProtocols, ","))
+	return out.String()
+}
+
+// Scan probes the server at host and port, returning the parameters that
+// it accepts. TLS 1.3 cipher suites and all signature schemes are probed
+// using hand crafted ClientHello messages since crypto/tls does not allow
+// them to be configured. Signature schemes are reported if the server
+// accepts them for either TLS 1.3 or for TLS 1.2 ECDHE key exchanges.
+// An error is returned only if the server cannot be contacted or ctx is
+// canceled.
+func (s *Scanner) Scan(ctx context.Context, host, port string) (*ScanResult, error) {
+	sc := &scan{Scanner: s, addr: net.JoinHostPort(host, port), serverName: host}
+	if len(s.opts.serverName) > 0 {
+		sc.serverName = s.opts.serverName
+	}
+	result := &ScanResult{Host: host, Port: port}
+	for _, scanner := range []func(context.Context, *ScanResult) error{
+		sc.versions, sc.cipherSuites, sc.curves, sc.signatureSchemes, sc.alpn,
+	} {
+		if err := scanner(ctx, result); err != nil {
+			return nil, err
+		}
+		if len(result.Versions) == 0 {
+			break
+		}
+	}
+	return result, nil
+}
+
+type scan struct {
+	*Scanner
+	addr, serverName string
+}
+
+func (s *scan) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.opts.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(s.opts.timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// handshake performs a handshake using cfg, returning false if the
+// server rejects it.
+func (s *scan) handshake(ctx context.Context, cfg *tls.Config) (tls.ConnectionState, bool, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return tls.ConnectionState{}, false, err
+	}
+	defer conn.Close()
+	cfg.ServerName = s.serverName
+	cfg.InsecureSkipVerify = true //nolint:gosec // G402 only the negotiated parameters are of interest.
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, false, ctx.Err()
+	}
+	return tlsConn.ConnectionState(), true, nil
+}
+
+func (s *scan) versions(ctx context.Context, result *ScanResult) error {
+	for _, v := range webapp.KnownTLSVersions() {
+		state, ok, err := s.handshake(ctx, &tls.Config{MinVersion: v, MaxVersion: v})
+		if err != nil {
+			return err
+		}
+		if ok && state.Version == v {
+			result.Versions = append(result.Versions, v)
+		}
+	}
+	return nil
+}
+
+func cipherSuiteInfo(id uint16) *tls.CipherSuite {
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if cs.ID == id {
+			return cs
+		}
+	}
+	return nil
+}
+
+func (s *scan) cipherSuites(ctx context.Context, result *ScanResult) error {
+	for _, id := range webapp.KnownCipherSuites() {
+		info := cipherSuiteInfo(id)
+		var versions []uint16
+		for _, v := range info.SupportedVersions {
+			if slices.Contains(result.Versions, v) {
+				versions = append(versions, v)
+			}
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		var ok bool
+		var err error
+		if slices.Equal(info.SupportedVersions, []uint16{tls.VersionTLS13}) {
+			ok, err = s.probeHello(ctx, tls.VersionTLS13, []uint16{id}, webapp.KnownTLSSignatureSchemes())
+		} else {
+			var state tls.ConnectionState
+			state, ok, err = s.handshake(ctx, &tls.Config{
+				MinVersion:   slices.Min(versions),
+				MaxVersion:   slices.Max(versions),
+				CipherSuites: []uint16{id},
+			})
+			ok = ok && state.CipherSuite == id
+		}
+		if err != nil {
+			return err
+		}
+		if ok {
+			result.CipherSuites = append(result.CipherSuites, id)
+		}
+	}
+	return nil
+}
+
+func (s *scan) curves(ctx context.Context, result *ScanResult) error {
+	for _, curve := range webapp.KnownTLSCurves() {
+		state, ok, err := s.handshake(ctx, &tls.Config{
+			MinVersion:       slices.Min(result.Versions),
+			MaxVersion:       slices.Max(result.Versions),
+			CurvePreferences: []tls.CurveID{curve},
+		})
+		if err != nil {
+			return err
+		}
+		if ok && state.CurveID == curve {
+			result.Curves = append(result.Curves, curve)
+		}
+	}
+	return nil
+}
+
+func (s *scan) signatureSchemes(ctx context.Context, result *ScanResult) error {
+	var ecdheSuites []uint16
+	for _, id := range webapp.KnownCipherSuites() {
+		info := cipherSuiteInfo(id)
+		if strings.HasPrefix(info.Name, "TLS_ECDHE_") && slices.Contains(info.SupportedVersions, tls.VersionTLS12) {
+			ecdheSuites = append(ecdheSuites, id)
+		}
+	}
+	tls13Suites := []uint16{tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384, tls.TLS_CHACHA20_POLY1305_SHA256}
+	for _, scheme := range webapp.KnownTLSSignatureSchemes() {
+		var ok bool
+		var err error
+		if slices.Contains(result.Versions, tls.VersionTLS13) {
+			ok, err = s.probeHello(ctx, tls.VersionTLS13, tls13Suites, []tls.SignatureScheme{scheme})
+		}
+		if !ok && err == nil && slices.Contains(result.Versions, tls.VersionTLS12) {
+			ok, err = s.probeHello(ctx, tls.VersionTLS12, ecdheSuites, []tls.SignatureScheme{scheme})
+		}
+		if err != nil {
+			return err
+		}
+		if ok {
+			result.SignatureSchemes = append(result.SignatureSchemes, scheme)
+		}
+	}
+	return nil
+}
+
+func (s *scan) alpn(ctx context.Context, result *ScanResult) error {
+	for _, proto := range s.opts.alpn {
+		state, ok, err := s.handshake(ctx, &tls.Config{
+			MinVersion: slices.Min(result.Versions),
+			MaxVersion: slices.Max(result.Versions),
+			NextProtos: []string{proto},
+		})
+		if err != nil {
+			return err
+		}
+		if ok && state.NegotiatedProtocol == proto {
+			result.ALPNProtocols = append(result.ALPNProtocols, proto)
+		}
+	}
+	return nil
+}
+
+// TLS protocol constants used by probeHello, see RFC 8446.
+const (
+	recordTypeAlert     = 21
+	recordTypeHandshake = 22
+
+	handshakeClientHello       = 1
+	handshakeServerHello       = 2
+	handshakeServerKeyExchange = 12
+	handshakeServerHelloDone   = 14
+
+	extensionServerName          = 0
+	extensionSupportedGroups     = 10
+	extensionECPointFormats      = 11
+	extensionSignatureAlgorithms = 13
+	extensionExtendedMasterSec   = 23
+	extensionSupportedVersions   = 43
+	extensionSignatureAlgsCert   = 50
+	extensionKeyShare            = 51
+	extensionRenegotiationInfo   = 0xff01
+
+	maxRecordLength = 1<<14 + 2048
+)
+
+// helloRetryRequestRandom is the ServerHello random value that identifies
+// a HelloRetryRequest, see RFC 8446, Section 4.1.3.
+var helloRetryRequestRandom = []byte{
+	0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11,
+	0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+	0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E,
+	0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+}
+
+// probeHello sends a ClientHello for the specified version that offers
+// only the supplied cipher suites and signature schemes and reports
+// whether the server accepts it. For TLS 1.3 the server has selected
+// its cipher suite and signature scheme by the time it sends its
+// ServerHello. For TLS 1.2 the signature scheme is only known once the
+// ServerKeyExchange message has been received.
+func (s *scan) probeHello(ctx context.Context, version uint16, suites []uint16, schemes []tls.SignatureScheme) (bool, error) {
+	hello, err := clientHello(s.serverName, version, suites, schemes)
+	if err != nil {
+		return false, err
+	}
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(hello); err != nil {
+		return false, ctx.Err()
+	}
+	probe := &helloProbe{version: version, suites: suites, schemes: schemes}
+	ok := probe.read(conn)
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	return ok, nil
+}
+
+func clientHello(serverName string, version uint16, suites []uint16, schemes []tls.SignatureScheme) ([]byte, error) {
+	random := make([]byte, 32)
+	sessionID := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(sessionID); err != nil {
+		return nil, err
+	}
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	p256, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	var b cryptobyte.Builder
+	b.AddUint8(recordTypeHandshake)
+	b.AddUint16(tls.VersionTLS10)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(handshakeClientHello)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.VersionTLS12)
+			b.AddBytes(random)
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(sessionID)
+			})
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				for _, suite := range suites {
+					b.AddUint16(suite)
+				}
+			})
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint8(0) // null compression
+			})
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				if len(serverName) > 0 && net.ParseIP(serverName) == nil {
+					addExtension(b, extensionServerName, func(b *cryptobyte.Builder) {
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddUint8(0) // host_name
+							b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+								b.AddBytes([]byte(serverName))
+							})
+						})
+					})
+				}
+				// Only groups for which a key share is provided are offered
+				// to avoid a HelloRetryRequest.
+				addExtension(b, extensionSupportedGroups, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(uint16(tls.X25519))
+						b.AddUint16(uint16(tls.CurveP256))
+					})
+				})
+				addExtension(b, extensionECPointFormats, func(b *cryptobyte.Builder) {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8(0) // uncompressed
+					})
+				})
+				addExtension(b, extensionSignatureAlgorithms, func(b *cryptobyte.Builder) {
+					addSignatureSchemes(b, schemes)
+				})
+				// Allow the certificate chain to use any signature scheme
+				// so that only the handshake signature is constrained.
+				addExtension(b, extensionSignatureAlgsCert, func(b *cryptobyte.Builder) {
+					addSignatureSchemes(b, webapp.KnownTLSSignatureSchemes())
+				})
+				addExtension(b, extensionExtendedMasterSec, func(*cryptobyte.Builder) {})
+				addExtension(b, extensionRenegotiationInfo, func(b *cryptobyte.Builder) {
+					b.AddUint8(0)
+				})
+				if version != tls.VersionTLS13 {
+					return
+				}
+				addExtension(b, extensionSupportedVersions, func(b *cryptobyte.Builder) {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(tls.VersionTLS13)
+					})
+				})
+				addExtension(b, extensionKeyShare, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						for _, share := range []struct {
+							group tls.CurveID
+							key   *ecdh.PrivateKey
+						}{{tls.X25519, x25519}, {tls.CurveP256, p256}} {
+							b.AddUint16(uint16(share.group))
+							b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+								b.AddBytes(share.key.PublicKey().Bytes())
+							})
+						}
+					})
+				})
+			})
+		})
+	})
+	return b.Bytes()
+}
+
+func addExtension(b *cryptobyte.Builder, extension uint16, body cryptobyte.BuilderContinuation) {
+	b.AddUint16(extension)
+	b.AddUint16LengthPrefixed(body)
+}
+
+func addSignatureSchemes(b *cryptobyte.Builder, schemes []tls.SignatureScheme) {
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, scheme := range schemes {
+			b.AddUint16(uint16(scheme))
+		}
+	})
+}
+
+// helloProbe reads and interprets the server's response to a ClientHello
+// sent by probeHello.
+type helloProbe struct {
+	version         uint16
+	suites          []uint16
+	schemes         []tls.SignatureScheme
+	sawServerHello  bool
+	sawKeyExchange  bool
+	pendingMessages []byte
+}
+
+// read returns true if the server accepts the ClientHello and false if it
+// responds with an alert, closes the connection or sends anything other
+// than a well formed acceptance of one of the offered cipher suites.
+func (p *helloProbe) read(r io.Reader) bool {
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return false
+		}
+		length := int(header[3])<<8 | int(header[4])
+		if length > maxRecordLength {
+			return false
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return false
+		}
+		switch header[0] {
+		case recordTypeAlert:
+			return false
+		case recordTypeHandshake:
+			p.pendingMessages = append(p.pendingMessages, body...)
+		default:
+			return false
+		}
+		for len(p.pendingMessages) >= 4 {
+			msg := p.pendingMessages
+			length := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+			if len(msg) < 4+length {
+				break
+			}
+			p.pendingMessages = msg[4+length:]
+			if done, ok := p.handle(msg[0], msg[4:4+length]); done {
+				return ok
+			}
+		}
+	}
+}
+
+// handle processes a single handshake message, returning true for done
+// once the server's acceptance, or otherwise, of the ClientHello is known.
+func (p *helloProbe) handle(msgType uint8, msg []byte) (done, ok bool) {
+	switch msgType {
+	case handshakeServerHello:
+		return p.serverHello(msg)
+	case handshakeServerKeyExchange:
+		s := cryptobyte.String(msg)
+		var curveType uint8
+		var group, scheme uint16
+		var point cryptobyte.String
+		if !s.ReadUint8(&curveType) || curveType != 3 || // named_curve
+			!s.ReadUint16(&group) || !s.ReadUint8LengthPrefixed(&point) || !s.ReadUint16(&scheme) {
+			return true, false
+		}
+		if !slices.Contains(p.schemes, tls.SignatureScheme(scheme)) {
+			return true, false
+		}
+		p.sawKeyExchange = true
+	case handshakeServerHelloDone:
+		return true, p.sawServerHello && p.sawKeyExchange
+	}
+	return false, false
+}
+
+// serverHello processes a ServerHello message. A malformed ServerHello or
+// one that selects a cipher suite that was not offered is treated as a
+// rejection of the ClientHello.
+func (p *helloProbe) serverHello(msg []byte) (done, ok bool) {
+	s := cryptobyte.String(msg)
+	var version, suite uint16
+	var random []byte
+	var sessionID, extensions cryptobyte.String
+	var compression uint8
+	if !s.ReadUint16(&version) || !s.ReadBytes(&random, 32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) || !s.ReadUint16(&suite) ||
+		!s.ReadUint8(&compression) {
+		return true, false
+	}
+	if !s.Empty() && !s.ReadUint16LengthPrefixed(&extensions) {
+		return true, false
+	}
+	if !slices.Contains(p.suites, suite) {
+		return true, false
+	}
+	if p.version != tls.VersionTLS13 {
+		p.sawServerHello = version == tls.VersionTLS12
+		return !p.sawServerHello, false
+	}
+	if string(random) == string(helloRetryRequestRandom) {
+		// Only groups with key shares are offered so a HelloRetryRequest
+		// is only expected from a server that requires a cookie, in which
+		// case the server's signature scheme is not known.
+		return true, false
+	}
+	for !extensions.Empty() {
+		var extension uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&extension) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return true, false
+		}
+		var selected uint16
+		if extension == extensionSupportedVersions && data.ReadUint16(&selected) {
+			return true, selected == tls.VersionTLS13
+		}
+	}
+	return true, false
+}
@@ -0,0 +1,57 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate
+
+import (
+	"bytes"
+	"crypto/tls"
+	"testing"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+func serverHelloRecord(t *testing.T, recordType uint8, suite uint16) []byte {
+	t.Helper()
+	var b cryptobyte.Builder
+	b.AddUint8(recordType)
+	b.AddUint16(tls.VersionTLS12)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(handshakeServerHello)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.VersionTLS12)
+			b.AddBytes(make([]byte, 32))
+			b.AddUint8LengthPrefixed(func(*cryptobyte.Builder) {})
+			b.AddUint16(suite)
+			b.AddUint8(0)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				addExtension(b, extensionSupportedVersions, func(b *cryptobyte.Builder) {
+					b.AddUint16(tls.VersionTLS13)
+				})
+			})
+		})
+	})
+	return b.BytesOrPanic()
+}
+
+func TestHelloProbe(t *testing.T) {
+	offered := []uint16{tls.TLS_AES_128_GCM_SHA256}
+	for _, tc := range []struct {
+		name     string
+		response []byte
+		accepted bool
+	}{
+		{"accepted", serverHelloRecord(t, recordTypeHandshake, tls.TLS_AES_128_GCM_SHA256), true},
+		{"suite not offered", serverHelloRecord(t, recordTypeHandshake, tls.TLS_AES_256_GCM_SHA384), false},
+		{"unexpected record type", serverHelloRecord(t, 23, tls.TLS_AES_128_GCM_SHA256), false},
+		{"record too long", []byte{recordTypeHandshake, 3, 3, 0xff, 0xff}, false},
+		{"malformed server hello", []byte{recordTypeHandshake, 3, 3, 0, 5, handshakeServerHello, 0, 0, 1, 0}, false},
+		{"closed", nil, false},
+	} {
+		probe := &helloProbe{version: tls.VersionTLS13, suites: offered}
+		if got, want := probe.read(bytes.NewReader(tc.response)), tc.accepted; got != want {
+			t.Errorf("%v: got %v, want %v", tc.name, got, want)
+		}
+	}
+}
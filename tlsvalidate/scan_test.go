@@ -0,0 +1,136 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package tlsvalidate_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/tlsvalidate"
+)
+
+func startScanServer(t *testing.T, cert *x509.Certificate, key crypto.PrivateKey, cfg *tls.Config, http1Only bool) (string, string) {
+	t.Helper()
+	cfg.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}
+	ln, srv, err := webapp.NewTLSServer(context.Background(), "127.0.0.1:0", http.NotFoundHandler(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Most probes are rejected by design.
+	srv.ErrorLog = log.New(io.Discard, "", 0)
+	if http1Only {
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	go func() {
+		_ = srv.ServeTLS(ln, "", "")
+	}()
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background()) //nolint:errcheck
+	})
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return host, port
+}
+
+func TestScanTLS13(t *testing.T) {
+	ctx := context.Background()
+	cert, key := newECDSACert(t, "localhost", false, []string{"localhost"}, []net.IP{net.ParseIP("127.0.0.1")}, nil, nil)
+	host, port := startScanServer(t, cert, key, &tls.Config{
+		MinVersion:       tls.VersionTLS13,
+		CurvePreferences: []tls.CurveID{tls.X25519},
+	}, false)
+
+	result, err := tlsvalidate.NewScanner().Scan(ctx, host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.Versions, (webapp.TLSVersions{tls.VersionTLS13}); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := result.CipherSuites, (webapp.CipherSuites{
+		tls.TLS_AES_128_GCM_SHA256,
+		tls.TLS_AES_256_GCM_SHA384,
+		tls.TLS_CHACHA20_POLY1305_SHA256,
+	}); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := result.Curves, (webapp.TLSCurves{tls.X25519}); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := result.SignatureSchemes, (webapp.TLSSignatureSchemes{tls.ECDSAWithP256AndSHA256}); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := result.ALPNProtocols, []string{"h2", "http/1.1"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `"versions":["TLS 1.3"],"cipher_suites":["TLS_AES_128_GCM_SHA256",`; !strings.Contains(got, want) {
+		t.Errorf("%v does not contain %v", got, want)
+	}
+}
+
+func TestScanTLS12(t *testing.T) {
+	ctx := context.Background()
+	cert, key := newCert(t, "localhost", false, []string{"localhost"}, []net.IP{net.ParseIP("127.0.0.1")}, nil, nil)
+	//nolint:gosec // G402 the scanner should report exactly what is configured here.
+	host, port := startScanServer(t, cert, key, &tls.Config{
+		MaxVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		},
+		CurvePreferences: []tls.CurveID{tls.CurveP256},
+	}, true)
+
+	result, err := tlsvalidate.NewScanner(tlsvalidate.WithScanALPNProtocols("h2", "http/1.1")).Scan(ctx, host, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.Versions, (webapp.TLSVersions{tls.VersionTLS12}); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := result.CipherSuites, (webapp.CipherSuites{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	}); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := result.Curves, (webapp.TLSCurves{tls.CurveP256}); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, scheme := range result.SignatureSchemes {
+		switch scheme {
+		case tls.PKCS1WithSHA256, tls.PKCS1WithSHA384, tls.PKCS1WithSHA512,
+			tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PSSWithSHA512:
+		default:
+			t.Errorf("unexpected signature scheme: %v", scheme)
+		}
+	}
+	if !slices.Contains(result.SignatureSchemes, tls.PSSWithSHA256) || !slices.Contains(result.SignatureSchemes, tls.PKCS1WithSHA256) {
+		t.Errorf("missing signature schemes: %v", result.SignatureSchemes)
+	}
+	if got, want := result.ALPNProtocols, []string{"http/1.1"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	_, err = tlsvalidate.NewScanner().Scan(ctx, "127.0.0.1", "1")
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"math/big"
 	"net"
+	"net/http"
 	"os"
 	"regexp"
 	"slices"
@@ -219,17 +220,26 @@ type options struct {
 	customDNSServer            string
 	logCertificateInfo         bool
 	checkZeroSerialNumbers     bool
+	revocation                 RevocationMethod
+	revocationClient           *http.Client
+	ctLogs                     *CTLogList
+	ctMinOperators             int
+	tlsPolicy                  *webapp.TLSPolicy
+	tlsPolicyScanOpts          []ScanOption
 }
 
 // Validator provides a way to validate TLS certificates.
 type Validator struct {
 	opts     options
 	resolver *net.Resolver
+
+	crlMu sync.Mutex
+	crls  map[string]*x509.RevocationList // keyed by distribution point
 }
 
 // NewValidator returns a new Validator configured with the supplied options.
 func NewValidator(opts ...Option) *Validator {
-	v := &Validator{}
+	v := &Validator{crls: map[string]*x509.RevocationList{}}
 	v.opts.checkZeroSerialNumbers = true // default to checking for zero serial numbers
 	for _, opt := range opts {
 		opt(&v.opts)
@@ -292,19 +302,20 @@ func (v *Validator) getStates(ctx context.Context, addrs []string, host, port st
 	return states.states, nil
 }
 
-func (v *Validator) verifyAcrossHosts(errs *errors.M, host string, states []tlsState) {
+func (v *Validator) verifyAcrossHosts(errs *errors.M, host string, states []tlsState) []CheckResult {
 	if len(states) == 0 {
 		fmt.Printf("no TLS states to verify for host %s\n", host)
-		return
+		return nil
 	}
 	if len(states[0].state.PeerCertificates) == 0 {
 		fmt.Printf("no peer certificates found for host %s\n", host)
-		return
+		return nil
 	}
 	serial := states[0].state.PeerCertificates[0].SerialNumber
 	alg := states[0].state.PeerCertificates[0].SignatureAlgorithm
 	suite := states[0].state.CipherSuite
 
+	var serialErr, signatureErr, suiteErr error
 	for _, cs := range states[1:] {
 		if len(cs.state.PeerCertificates) == 0 {
 			err := cs.error(nil, fmt.Errorf("%v: %v no peer certificates found", host, cs.addr))
@@ -320,25 +331,73 @@ func (v *Validator) verifyAcrossHosts(errs *errors.M, host string, states []tlsS
 			err := cs.error(cs.state.PeerCertificates[0],
 				fmt.Errorf("%v: %v mismatched serial numbers: (%v) != (%v)", host, cs.addr, serial, cs.state.PeerCertificates[0].SerialNumber))
 			errs.Append(err)
-
+			if serialErr == nil {
+				serialErr = err
+			}
 		}
 		if v.opts.checkSignature && alg != cs.state.PeerCertificates[0].SignatureAlgorithm {
 			err := cs.error(cs.state.PeerCertificates[0],
 				fmt.Errorf("%v: %v mismatched signature algorithms: (%v) != (%v)", host, cs.addr, alg, cs.state.PeerCertificates[0].SignatureAlgorithm))
 			errs.Append(err)
+			if signatureErr == nil {
+				signatureErr = err
+			}
 		}
 		if v.opts.checkCipherSuite && suite != cs.state.CipherSuite {
 			err := cs.error(cs.state.PeerCertificates[0],
 				fmt.Errorf("%v: %v mismatched cipher suites: (%v) != (%v)", host, cs.addr, tls.CipherSuiteName(suite), tls.CipherSuiteName(cs.state.CipherSuite)))
 			errs.Append(err)
+			if suiteErr == nil {
+				suiteErr = err
+			}
 		}
 	}
-
+	var results []CheckResult
+	if v.opts.checkSerial {
+		results = append(results, NewCheckResult("same-serial-numbers", serialErr))
+	}
+	if v.opts.checkSignature {
+		results = append(results, NewCheckResult("same-signature-algorithms", signatureErr))
+	}
+	if v.opts.checkCipherSuite {
+		results = append(results, NewCheckResult("same-cipher-suites", suiteErr))
+	}
+	return results
 }
 
 // Validate performs TLS validation for the given host and port. It may expand
 // the host to multiple IP addresses and will validate each one concurrently.
 func (v *Validator) Validate(ctx context.Context, host, port string) error {
+	return v.validate(ctx, &Report{Host: host, Port: port, Time: time.Now()}, false)
+}
+
+// ValidateReport is like Validate but also returns a Report describing
+// the certificate chains, negotiated TLS parameters and the results of
+// every enabled check for each of the host's addresses. The returned
+// error is identical to that returned by Validate and the Report is
+// returned even when validation fails, although it will contain no
+// addresses if the host's addresses could not be determined or a TLS
+// handshake failed.
+func (v *Validator) ValidateReport(ctx context.Context, host, port string) (*Report, error) {
+	report := &Report{Host: host, Port: port, Time: time.Now()}
+	err := v.validate(ctx, report, true)
+	report.Passed = err == nil
+	if err != nil {
+		if m, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range m.Unwrap() {
+				report.Errors = append(report.Errors, e.Error())
+			}
+		} else {
+			report.Errors = []string{err.Error()}
+		}
+	}
+	return report, err
+}
+
+// validate validates the host and port specified in report, recording
+// the results in report. If allChecks is false, the per-connection checks
+// for each address stop at the first that fails.
+func (v *Validator) validate(ctx context.Context, report *Report, allChecks bool) error {
 	if v.opts.rootCAs == nil && len(v.opts.pemFile) > 0 {
 		rootCAs, err := certPool(v.opts.pemFile)
 		if err != nil {
@@ -346,26 +405,34 @@ func (v *Validator) Validate(ctx context.Context, host, port string) error {
 		}
 		v.opts.rootCAs = rootCAs
 	}
-	addrs, err := v.expandHost(ctx, host)
+	addrs, err := v.expandHost(ctx, report.Host)
 	if err != nil {
 		return err
 	}
 	addrs = v.ignoreIPv6(addrs)
 
-	states, err := v.getStates(ctx, addrs, host, port)
+	states, err := v.getStates(ctx, addrs, report.Host, report.Port)
 	if err != nil {
 		return err
 	}
 	var errs errors.M
 	for _, cs := range states {
-		if err := v.validateConnectionState(ctx, &cs); err != nil {
+		ar := newAddrReport(&cs, report.Time)
+		checks, err := v.validateConnectionState(ctx, &cs, allChecks)
+		if err != nil {
 			errs.Append(err)
 		}
+		ar.Checks = checks
+		report.Addresses = append(report.Addresses, ar)
 	}
-	if err := v.ensureNonZeroSerialNumbers(&states[0]); err != nil {
+	err = v.ensureNonZeroSerialNumbers(&states[0])
+	if err != nil {
 		errs.Append(err)
 	}
-	v.verifyAcrossHosts(&errs, host, states)
+	if v.opts.checkZeroSerialNumbers {
+		report.Checks = append(report.Checks, NewCheckResult("non-zero-serial-numbers", err))
+	}
+	report.Checks = append(report.Checks, v.verifyAcrossHosts(&errs, report.Host, states)...)
 	return errs.Err()
 }
 
@@ -414,52 +481,96 @@ func (v *Validator) ensureNonZeroSerialNumbers(cs *tlsState) error {
 	return nil
 }
 
-func (v *Validator) validateConnectionState(ctx context.Context, cs *tlsState) error {
-	state := cs.state
-	if len(state.PeerCertificates) == 0 {
-		return &ErrValidator{
+type connectionCheck struct {
+	name  string
+	check func(ctx context.Context, cs *tlsState) error
+}
+
+// connectionChecks returns the per-connection checks enabled by the
+// validator's options.
+func (v *Validator) connectionChecks() []connectionCheck {
+	var checks []connectionCheck
+	add := func(enabled bool, name string, check func(context.Context, *tlsState) error) {
+		if enabled {
+			checks = append(checks, connectionCheck{name: name, check: check})
+		}
+	}
+	add(len(v.opts.issuerREs) > 0, "issuer", v.checkIssuer)
+	add(v.opts.validFor > 0, "valid-for", v.checkValidFor)
+	add(len(v.opts.allowedSignatureAlgorithms) > 0, "allowed-signature-algorithms", v.checkAllowedSignatureAlgorithms)
+	add(len(v.opts.deniedSignatureAlgorithms) > 0, "denied-signature-algorithms", v.checkDeniedSignatureAlgorithms)
+	add(len(v.opts.deniedCipherSuites) > 0, "denied-cipher-suites", v.checkDeniedCipherSuites)
+	add(v.opts.revocation != 0, "revocation", v.checkRevocation)
+	add(v.opts.ctLogs != nil, "certificate-transparency", v.checkCertificateTransparency)
+	add(v.opts.tlsPolicy != nil, "tls-policy", v.checkTLSPolicy)
+	return checks
+}
+
+// validateConnectionState runs the enabled per-connection checks, returning
+// their results and the error from the first that failed. If allChecks is
+// false it returns as soon as a check fails, otherwise all of the checks are
+// run so that their results can be reported.
+func (v *Validator) validateConnectionState(ctx context.Context, cs *tlsState, allChecks bool) ([]CheckResult, error) {
+	if len(cs.state.PeerCertificates) == 0 {
+		return nil, &ErrValidator{
 			Err: fmt.Errorf("no peer certificates found"),
 		}
 	}
-
 	v.logCertificateInfo(ctx, cs)
-	leaf := state.PeerCertificates[0]
-	if len(v.opts.issuerREs) > 0 {
-		matched := false
-		issuer := leaf.Issuer.String()
-		for _, re := range v.opts.issuerREs {
-			if re.MatchString(issuer) {
-				matched = true
-				break
-			}
+	var results []CheckResult
+	var first error
+	for _, c := range v.connectionChecks() {
+		err := c.check(ctx, cs)
+		results = append(results, NewCheckResult(c.name, err))
+		if first == nil {
+			first = err
 		}
-		if !matched {
-			return cs.error(leaf, fmt.Errorf("certificate issuer %q does not match any of the specified patterns", issuer))
+		if first != nil && !allChecks {
+			break
 		}
 	}
+	return results, first
+}
 
-	if v.opts.validFor > 0 {
-		if validFor := time.Until(leaf.NotAfter); validFor < v.opts.validFor {
-			return cs.error(leaf, fmt.Errorf("certificate is valid for %v which is less than the required %v", validFor, v.opts.validFor))
+func (v *Validator) checkIssuer(_ context.Context, cs *tlsState) error {
+	leaf := cs.state.PeerCertificates[0]
+	issuer := leaf.Issuer.String()
+	for _, re := range v.opts.issuerREs {
+		if re.MatchString(issuer) {
+			return nil
 		}
 	}
+	return cs.error(leaf, fmt.Errorf("certificate issuer %q does not match any of the specified patterns", issuer))
+}
 
-	if len(v.opts.allowedSignatureAlgorithms) > 0 {
-		if !slices.Contains(v.opts.allowedSignatureAlgorithms, leaf.SignatureAlgorithm) {
-			return cs.error(leaf, fmt.Errorf("certificate signature algorithm %v is not one of the allowed algorithms %v", leaf.SignatureAlgorithm, v.opts.allowedSignatureAlgorithms))
-		}
+func (v *Validator) checkValidFor(_ context.Context, cs *tlsState) error {
+	leaf := cs.state.PeerCertificates[0]
+	if validFor := time.Until(leaf.NotAfter); validFor < v.opts.validFor {
+		return cs.error(leaf, fmt.Errorf("certificate is valid for %v which is less than the required %v", validFor, v.opts.validFor))
 	}
+	return nil
+}
 
-	if len(v.opts.deniedSignatureAlgorithms) > 0 {
-		if slices.Contains(v.opts.deniedSignatureAlgorithms, leaf.SignatureAlgorithm) {
-			return cs.error(leaf, fmt.Errorf("certificate signature algorithm %v is one of the denied algorithms %v", leaf.SignatureAlgorithm, v.opts.deniedSignatureAlgorithms))
-		}
+func (v *Validator) checkAllowedSignatureAlgorithms(_ context.Context, cs *tlsState) error {
+	leaf := cs.state.PeerCertificates[0]
+	if !slices.Contains(v.opts.allowedSignatureAlgorithms, leaf.SignatureAlgorithm) {
+		return cs.error(leaf, fmt.Errorf("certificate signature algorithm %v is not one of the allowed algorithms %v", leaf.SignatureAlgorithm, v.opts.allowedSignatureAlgorithms))
+	}
+	return nil
+}
+
+func (v *Validator) checkDeniedSignatureAlgorithms(_ context.Context, cs *tlsState) error {
+	leaf := cs.state.PeerCertificates[0]
+	if slices.Contains(v.opts.deniedSignatureAlgorithms, leaf.SignatureAlgorithm) {
+		return cs.error(leaf, fmt.Errorf("certificate signature algorithm %v is one of the denied algorithms %v", leaf.SignatureAlgorithm, v.opts.deniedSignatureAlgorithms))
 	}
+	return nil
+}
 
-	if len(v.opts.deniedCipherSuites) > 0 {
-		if slices.Contains(v.opts.deniedCipherSuites, state.CipherSuite) {
-			return cs.error(leaf, fmt.Errorf("negotiated cipher suite %v is one of the denied ciphersuites %v", tls.CipherSuiteName(state.CipherSuite), cipherSuiteNames(v.opts.deniedCipherSuites)))
-		}
+func (v *Validator) checkDeniedCipherSuites(_ context.Context, cs *tlsState) error {
+	leaf := cs.state.PeerCertificates[0]
+	if suite := cs.state.CipherSuite; slices.Contains(v.opts.deniedCipherSuites, suite) {
+		return cs.error(leaf, fmt.Errorf("negotiated cipher suite %v is one of the denied ciphersuites %v", tls.CipherSuiteName(suite), cipherSuiteNames(v.opts.deniedCipherSuites)))
 	}
 	return nil
 }
@@ -15,6 +15,7 @@ import (
 	"cloudeng.io/logging/ctxlog"
 	"cloudeng.io/sync/errgroup"
 	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/webauth/acme/certcache"
 )
 
 // Client implements an ACME client that periodically refreshes
@@ -30,6 +31,7 @@ type clientOptions struct {
 	refreshInterval  time.Duration
 	refreshMetric    webapp.CounterVecInc
 	refreshOnFailure time.Duration
+	elector          *certcache.LeaderElector
 }
 
 // RefreshMetricsColumns returns the list of columns that will be used
@@ -72,6 +74,17 @@ func WithRefreshOnFailure(interval time.Duration) ClientOption {
 	}
 }
 
+// WithLeaderElection configures the client to refresh certificates only
+// whilst it is the leader as determined by the supplied elector. This
+// allows multiple clients, sharing the same backing store, to be run
+// with only one of them, the leader, interacting with the ACME service
+// and the others acting as hot standbys.
+func WithLeaderElection(elector *certcache.LeaderElector) ClientOption {
+	return func(o *clientOptions) {
+		o.elector = elector
+	}
+}
+
 // NewClient creates a new client that refreshes certificates for the
 // provided hosts using the autocert.Manager.
 func NewClient(mgr *Manager, opts ...ClientOption) *Client {
@@ -101,7 +114,11 @@ func (s *Client) Start(ctx context.Context, hosts ...string) (func() error, erro
 	refreshCtx, cancel := context.WithCancel(ctx) //nolint:gosec // G118: false positive
 	logger := ctxlog.Logger(ctx).With("component", "acme_client")
 	errCh := make(chan error, 1)
-	go s.refresh(refreshCtx, logger, errCh, hosts)
+	if s.opts.elector != nil {
+		go s.refreshWhenLeader(refreshCtx, logger, errCh, hosts)
+	} else {
+		go s.refresh(refreshCtx, logger, errCh, hosts)
+	}
 	return func() error {
 		return s.stop(logger, cancel, errCh)
 	}, nil
@@ -142,6 +159,22 @@ func (s *Client) getCertificate(ctx context.Context, logger *slog.Logger, host s
 }
 
 func (s *Client) refresh(ctx context.Context, logger *slog.Logger, errCh chan<- error, hosts []string) {
+	errCh <- s.refreshHosts(ctx, logger, hosts)
+}
+
+func (s *Client) refreshWhenLeader(ctx context.Context, logger *slog.Logger, errCh chan<- error, hosts []string) {
+	logger = logger.With("holder", s.opts.elector.Holder())
+	logger.Info("waiting for leadership before refreshing certificates")
+	errCh <- s.opts.elector.Run(ctx, func(ctx context.Context) {
+		logger.Info("leader: starting certificate refresh")
+		if err := s.refreshHosts(ctx, logger, hosts); err != nil {
+			logger.Error("certificate refresh failed", "error", err)
+		}
+		logger.Info("no longer leader: stopped certificate refresh")
+	})
+}
+
+func (s *Client) refreshHosts(ctx context.Context, logger *slog.Logger, hosts []string) error {
 	grp := &errgroup.T{}
 	for _, host := range hosts {
 		h := host
@@ -159,7 +192,7 @@ func (s *Client) refresh(ctx context.Context, logger *slog.Logger, errCh chan<-
 			}
 		})
 	}
-	errCh <- grp.Wait()
+	return grp.Wait()
 }
 
 func (s *Client) refreshHost(ctx context.Context, logger *slog.Logger, host string) error {
@@ -221,3 +221,110 @@ func TestClientWithMetric(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestClientLeaderElection(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	ctx = ctxlog.WithLogger(ctx, slog.New(slog.NewJSONHandler(logging.NewJSONFormatter(os.Stderr, "", "  "), &slog.HandlerOptions{AddSource: false})))
+
+	tmpDir := t.TempDir()
+
+	// Start a pebble server.
+	pebbleServer, pebbleCfg, recorder, pebbleCacheDir, pebbleTestDir := pebbletest.Start(ctx, t, tmpDir, pebbletest.WithServerOptions(pebble.WithNoSleep()))
+	defer func() {
+		then := time.Now()
+		if err := pebbleServer.EnsureStopped(context.Background(), time.Second*5); err != nil {
+			t.Errorf("failed to stop pebble server after %v: %v", time.Since(then), err)
+		}
+	}()
+	certDir := filepath.Join(pebbleCacheDir, "certs")
+	lb, err := certcache.NewLocalStore(certDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := certcache.NewCachingStore(pebbleCacheDir, lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both replicas share the same backing store, but only the first,
+	// which is started first, will become the leader and obtain the
+	// certificate.
+	var clients []*acme.Client
+	var httpHandler http.Handler
+	for _, replica := range []string{"replica-a", "replica-b"} {
+		mgr, err := acme.NewAutocertManager(cache, acme.AutocertConfig{
+			Provider: pebbleCfg.DirectoryURL(),
+		}, "pebble-test.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mgr.HostPolicy = certcache.WrapHostPolicyNoPort(mgr.HostPolicy)
+		mgr.Client.HTTPClient, err = webapp.NewHTTPClient(ctx,
+			webapp.WithCustomCAPEMFile(filepath.Join(pebbleTestDir, pebbleCfg.CAFile)))
+		if err != nil {
+			t.Fatalf("failed to create acme manager http client: %v", err)
+		}
+		if httpHandler == nil {
+			httpHandler = mgr.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			}))
+		}
+		elector, err := certcache.NewLeaderElector(lb, "acme.lease", replica,
+			certcache.WithLeaseTTL(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, acme.NewClient(mgr,
+			acme.WithRefreshInterval(time.Minute),
+			acme.WithLeaderElection(elector)))
+	}
+
+	// Start HTTP server to handle ACME HTTP-01 challenges.
+	httpListener, httpServer, err := webapp.NewHTTPServer(ctx, fmt.Sprintf(":%d", pebbleCfg.HTTPPort), httpHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		err := webapp.ServeWithShutdown(ctx, httpListener, httpServer, time.Minute)
+		errCh <- err
+	}()
+
+	var stoppers []func() error
+	for _, client := range clients {
+		stop, err := client.Start(ctx, "pebble-test.example.com")
+		if err != nil {
+			t.Fatalf("failed to start acme client: %v", err)
+		}
+		stoppers = append(stoppers, stop)
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	localhostCert := filepath.Join(certDir, "pebble-test.example.com")
+	leaf, _ := pebbletest.WaitForNewCert(ctx, t, "waiting for cert", localhostCert, "", recorder)
+	if err := leaf.VerifyHostname("pebble-test.example.com"); err != nil {
+		t.Fatalf("hostname verification failed: %v", err)
+	}
+
+	observer, err := certcache.NewLeaderElector(lb, "acme.lease", "observer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease, err := observer.Lease(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lease.Holder, "replica-a"; got != want {
+		t.Errorf("got leader %v, want %v", got, want)
+	}
+
+	cancel()
+	var errs errors.M
+	errs.Append(<-errCh)
+	for _, stop := range stoppers {
+		errs.Append(stop())
+	}
+	if err := errs.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
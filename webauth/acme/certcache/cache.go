@@ -57,6 +57,7 @@ type options struct {
 	saveAccountKeyName string
 	logger             *slog.Logger
 	allowRSAKeys       bool
+	sharedTokens       bool
 	metrics            webapp.CounterVecInc
 }
 
@@ -97,13 +98,28 @@ func WithLogger(logger *slog.Logger) Option {
 
 // WithAllowRSAKeys sets whether RSA keys are allowed to be used for ACME
 // account keys. By default, RSA keys are not allowed since they are not
-// intended for legacy clients only.
+// intended for legacy clients only. Allowing them means that RSA
+// certificates, stored under their webapp.RSACertName, are written to
+// the backing store and hence can be served to legacy clients by
+// webapp.CertServingCache alongside the ECDSA certificates.
 func WithAllowRSAKeys(allow bool) Option {
 	return func(o *options) {
 		o.allowRSAKeys = allow
 	}
 }
 
+// WithSharedChallengeTokens sets whether ACME http-01 and tls-alpn-01
+// challenge tokens are written to the backing store rather than the local
+// file system. Sharing them allows any replica that uses the same backing
+// store, and not only the one that requested the certificate, to answer
+// challenges and is required when using leader election since challenge
+// requests may be routed to a standby.
+func WithSharedChallengeTokens(shared bool) Option {
+	return func(o *options) {
+		o.sharedTokens = shared
+	}
+}
+
 // WithMetrics sets the metrics to use for logging cache operations.
 func WithMetrics(metrics webapp.CounterVecInc) Option {
 	return func(o *options) {
@@ -174,12 +190,21 @@ func IsAcmeAccountKey(name string) bool {
 // If allowRSAKeys is false, RSA keys are considered local-only and are never
 // written to backing stores since they are intended for legacy clients only.
 func IsLocalName(name string, allowRSAKeys bool) bool {
-	return strings.HasSuffix(name, "+token") ||
-		(strings.HasSuffix(name, "+rsa") && !allowRSAKeys) ||
-		strings.Contains(name, "http-01") ||
+	return isChallengeToken(name) ||
+		(strings.HasSuffix(name, webapp.RSACertNameSuffix) && !allowRSAKeys) ||
 		IsAcmeAccountKey(name)
 }
 
+func isChallengeToken(name string) bool {
+	return strings.HasSuffix(name, "+token") || strings.Contains(name, "http-01")
+}
+
+// isSharedToken returns true if name is for a challenge token that is
+// to be written to the backing store.
+func (dc *CachingStore) isSharedToken(name string) bool {
+	return dc.opts.sharedTokens && isChallengeToken(name) && !IsAcmeAccountKey(name)
+}
+
 var (
 	ErrReadonlyCache    = errors.New("readonly cache")
 	ErrLocalOperation   = errors.New("local operation")
@@ -188,7 +213,7 @@ var (
 )
 
 func (dc *CachingStore) isRSAKeyAllowed(name string) bool {
-	if !strings.HasSuffix(name, "+rsa") {
+	if !strings.HasSuffix(name, webapp.RSACertNameSuffix) {
 		return true
 	}
 	return dc.opts.allowRSAKeys
@@ -201,7 +226,7 @@ func (dc *CachingStore) Delete(ctx context.Context, name string) error {
 	}
 	dc.opts.metrics(ctx, name, "delete")
 	ctxlog.Warn(ctx, "webauth/acme/certcache: delete", "key", name)
-	if !IsLocalName(name, dc.opts.allowRSAKeys) {
+	if !IsLocalName(name, dc.opts.allowRSAKeys) || dc.isSharedToken(name) {
 		dc.opts.metrics(ctx, name, "delete-backing")
 		if err := dc.backingStore.Delete(ctx, name); err != nil {
 			return fmt.Errorf("webauth/acme/certcache: delete %q: %w", name, errors.NewM(err, ErrBackingOperation))
@@ -264,7 +289,7 @@ func (dc *CachingStore) Get(ctx context.Context, name string) ([]byte, error) {
 }
 
 func (dc *CachingStore) useBackingStore(name string) (string, bool) {
-	if !IsLocalName(name, dc.opts.allowRSAKeys) {
+	if !IsLocalName(name, dc.opts.allowRSAKeys) || dc.isSharedToken(name) {
 		return name, true
 	}
 	if len(dc.opts.saveAccountKeyName) > 0 && IsAcmeAccountKey(name) {
@@ -305,6 +330,11 @@ func (dc *CachingStore) Put(ctx context.Context, name string, data []byte) error
 	return nil
 }
 
+// BackingStore returns the backing store used by the caching store.
+func (dc *CachingStore) BackingStore() StoreFS {
+	return dc.backingStore
+}
+
 // Implement file.ReadfileFS“
 func (dc *CachingStore) ReadFile(name string) ([]byte, error) {
 	return dc.ReadFileCtx(context.Background(), name)
@@ -327,13 +357,20 @@ func (dc *CachingStore) WriteFileCtx(ctx context.Context, name string, data []by
 
 type localCache struct {
 	root string
+	lock *lockedfile.Mutex
 }
 
+// NewLocalStore returns a StoreFS that stores files in the specified
+// directory. The returned StoreFS also implements CompareAndSwapFS and
+// can therefore be used for leader election.
 func NewLocalStore(dir string) (StoreFS, error) {
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return nil, err
 	}
-	return &localCache{root: dir}, nil
+	return &localCache{
+		root: dir,
+		lock: lockedfile.MutexAt(filepath.Join(dir, "dir.lock")),
+	}, nil
 }
 
 func (lc *localCache) path(name string) string {
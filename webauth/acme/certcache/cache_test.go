@@ -374,6 +374,39 @@ func TestCacheACMEKeyInBackingStore(t *testing.T) {
 
 }
 
+func TestCacheSharedChallengeTokens(t *testing.T) {
+	ctx := context.Background()
+	for _, shared := range []bool{false, true} {
+		mockFS := newMockCacheFS()
+		cache, err := certcache.NewCachingStore(t.TempDir(), mockFS, certcache.WithSharedChallengeTokens(shared))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"abcdef+http-01", "example.com+token"} {
+			if err := cache.Put(ctx, name, []byte("token")); err != nil {
+				t.Fatal(err)
+			}
+			_, err := mockFS.ReadFileCtx(ctx, name)
+			if got, want := err == nil, shared; got != want {
+				t.Errorf("%v: shared %v: in backing store: got %v, want %v", name, shared, got, want)
+			}
+			data, err := cache.Get(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(data), "token"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+			if err := cache.Delete(ctx, name); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cache.Get(ctx, name); !errors.Is(err, certcache.ErrCacheMiss) {
+				t.Errorf("%v: shared %v: got %v, want %v", name, shared, err, certcache.ErrCacheMiss)
+			}
+		}
+	}
+}
+
 func TestMetricsColumnsAndOperationValues(t *testing.T) {
 	t.Parallel()
 	if got, want := certcache.MetricsColumns(), []string{"name", "operation"}; !slices.Equal(got, want) {
@@ -0,0 +1,335 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package certcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+
+	"cloudeng.io/errors"
+)
+
+// DefaultLeaseTTL is the default duration for which a leader election
+// lease is valid unless renewed.
+const DefaultLeaseTTL = time.Minute
+
+var (
+	// ErrLeaseConflict is returned by CompareAndSwapFS.CompareAndSwap
+	// when the current contents of the file do not match those expected.
+	ErrLeaseConflict = errors.New("lease conflict")
+	// ErrCompareAndSwapNotSupported is returned by NewLeaderElector when
+	// the store does not implement CompareAndSwapFS.
+	ErrCompareAndSwapNotSupported = errors.New("store does not support compare-and-swap")
+)
+
+// CompareAndSwapFS is implemented by StoreFS implementations that support
+// compare-and-swap writes and hence can be used for leader election.
+type CompareAndSwapFS interface {
+	StoreFS
+	// CompareAndSwap atomically replaces the contents of name with data
+	// if its current contents are equal to old, or creates it if old is
+	// nil and name does not exist. It returns an error that wraps
+	// ErrLeaseConflict if the current contents do not match.
+	CompareAndSwap(ctx context.Context, name string, old, data []byte, perm fs.FileMode) error
+}
+
+// Lease is the leader election lease stored in a CompareAndSwapFS.
+// Term is incremented every time that the lease changes hands.
+type Lease struct {
+	Holder   string    `json:"holder"`
+	Term     uint64    `json:"term"`
+	Acquired time.Time `json:"acquired"`
+	Renewed  time.Time `json:"renewed"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Expired returns true if the lease has expired at the specified time.
+func (l Lease) Expired(now time.Time) bool {
+	return !now.Before(l.Expires)
+}
+
+// ElectorOption configures a LeaderElector.
+type ElectorOption func(o *electorOptions)
+
+type electorOptions struct {
+	ttl           time.Duration
+	renewInterval time.Duration
+	logger        *slog.Logger
+}
+
+// WithLeaseTTL sets the duration for which a lease is valid unless
+// renewed. The default is DefaultLeaseTTL. Since the lease expiry is
+// compared against the local clock of each replica, the TTL should be
+// much longer than the expected clock skew between replicas.
+func WithLeaseTTL(ttl time.Duration) ElectorOption {
+	return func(o *electorOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithLeaseRenewInterval sets the interval at which the leader renews
+// its lease and at which standbys attempt to acquire it. The default is
+// one third of the lease TTL.
+func WithLeaseRenewInterval(interval time.Duration) ElectorOption {
+	return func(o *electorOptions) {
+		o.renewInterval = interval
+	}
+}
+
+// WithElectorLogger sets the logger to use for logging leadership
+// changes.
+func WithElectorLogger(logger *slog.Logger) ElectorOption {
+	return func(o *electorOptions) {
+		o.logger = logger
+	}
+}
+
+// LeaderElector elects a single leader among a set of replicas that share
+// a backing store by means of a lease stored in that store. A replica
+// becomes the leader by writing a lease naming itself as the holder using
+// a compare-and-swap write, which succeeds only if the lease has not
+// been modified since it was read and has either expired or is already
+// held by that replica. The leader must renew the lease before it
+// expires to retain leadership. Replicas that answer ACME challenges should
+// use a CachingStore created with WithSharedChallengeTokens so that
+// challenges routed to a standby can be answered.
+type LeaderElector struct {
+	store  CompareAndSwapFS
+	name   string
+	holder string
+	opts   electorOptions
+}
+
+// NewLeaderElector returns a LeaderElector for the replica identified by
+// holder that uses the lease stored as name in store. Every replica must
+// use a unique holder. It returns ErrCompareAndSwapNotSupported if store
+// does not implement CompareAndSwapFS.
+func NewLeaderElector(store StoreFS, name, holder string, opts ...ElectorOption) (*LeaderElector, error) {
+	cas, ok := store.(CompareAndSwapFS)
+	if !ok {
+		return nil, fmt.Errorf("webauth/acme/certcache: leader election using %T: %w", store, ErrCompareAndSwapNotSupported)
+	}
+	if len(name) == 0 || len(holder) == 0 {
+		return nil, fmt.Errorf("webauth/acme/certcache: leader election requires a lease name and holder")
+	}
+	var o electorOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.ttl <= 0 {
+		o.ttl = DefaultLeaseTTL
+	}
+	if o.renewInterval <= 0 || o.renewInterval >= o.ttl {
+		o.renewInterval = o.ttl / 3
+	}
+	if o.logger == nil {
+		o.logger = slog.New(slog.DiscardHandler)
+	}
+	o.logger = o.logger.With("component", "certcache.LeaderElector", "lease", name, "holder", holder)
+	return &LeaderElector{
+		store:  cas,
+		name:   name,
+		holder: holder,
+		opts:   o,
+	}, nil
+}
+
+// Holder returns the identity of this replica.
+func (e *LeaderElector) Holder() string {
+	return e.holder
+}
+
+// read returns the current lease and its encoded form, which is nil if
+// there is no lease.
+func (e *LeaderElector) read(ctx context.Context) (Lease, []byte, error) {
+	data, err := e.store.ReadFileCtx(ctx, e.name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrCacheMiss) {
+			return Lease{}, nil, nil
+		}
+		return Lease{}, nil, fmt.Errorf("webauth/acme/certcache: read lease %q: %w", e.name, err)
+	}
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return Lease{}, nil, fmt.Errorf("webauth/acme/certcache: parse lease %q: %w", e.name, err)
+	}
+	return lease, data, nil
+}
+
+// Lease returns the currently stored lease, which is the zero value if
+// no replica has ever acquired it.
+func (e *LeaderElector) Lease(ctx context.Context) (Lease, error) {
+	lease, _, err := e.read(ctx)
+	return lease, err
+}
+
+// TryAcquire attempts to acquire the lease, or to renew it if it is
+// already held by this replica. It returns the current lease and true if
+// this replica is the leader. Losing a race with another replica is not
+// an error.
+func (e *LeaderElector) TryAcquire(ctx context.Context) (Lease, bool, error) {
+	current, old, err := e.read(ctx)
+	if err != nil {
+		return Lease{}, false, err
+	}
+	now := time.Now()
+	held := old != nil && current.Holder == e.holder
+	if old != nil && !held && !current.Expired(now) {
+		return current, false, nil
+	}
+	next := Lease{
+		Holder:   e.holder,
+		Term:     current.Term,
+		Acquired: current.Acquired,
+		Renewed:  now,
+		Expires:  now.Add(e.opts.ttl),
+	}
+	if !held || current.Expired(now) {
+		next.Term++
+		next.Acquired = now
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		return Lease{}, false, err
+	}
+	if err := e.store.CompareAndSwap(ctx, e.name, old, data, 0600); err != nil {
+		if errors.Is(err, ErrLeaseConflict) {
+			current, _, err = e.read(ctx)
+			return current, false, err
+		}
+		return Lease{}, false, fmt.Errorf("webauth/acme/certcache: write lease %q: %w", e.name, err)
+	}
+	return next, true, nil
+}
+
+// Release relinquishes the lease, if it is held by this replica, so that
+// another replica may acquire it without waiting for it to expire.
+func (e *LeaderElector) Release(ctx context.Context) error {
+	current, old, err := e.read(ctx)
+	if err != nil || old == nil || current.Holder != e.holder {
+		return err
+	}
+	current.Expires = time.Now()
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if err := e.store.CompareAndSwap(ctx, e.name, old, data, 0600); err != nil && !errors.Is(err, ErrLeaseConflict) {
+		return fmt.Errorf("webauth/acme/certcache: release lease %q: %w", e.name, err)
+	}
+	return nil
+}
+
+// Run campaigns for leadership until ctx is canceled. Whenever this
+// replica becomes the leader, lead is called, in a separate goroutine,
+// with a context that is canceled when leadership is lost, which
+// happens if the lease cannot be renewed before it expires or has been
+// taken over by another replica. Run waits for lead to return before
+// campaigning again. If lead returns whilst this replica is still the
+// leader the lease is released, so that another replica may take over,
+// and Run campaigns again at the next renewal interval. The lease is
+// released when Run returns.
+func (e *LeaderElector) Run(ctx context.Context, lead func(ctx context.Context)) error {
+	ticker := time.NewTicker(e.opts.renewInterval)
+	defer ticker.Stop()
+	var (
+		cancel  context.CancelFunc
+		done    chan struct{}
+		expires time.Time
+	)
+	stop := func() {
+		if cancel == nil {
+			return
+		}
+		cancel()
+		<-done
+		cancel, done = nil, nil
+		e.opts.logger.Info("relinquished leadership")
+	}
+	released := false
+	for {
+		if released {
+			released = false
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+		lease, leader, err := e.TryAcquire(ctx)
+		switch {
+		case err != nil:
+			e.opts.logger.Warn("failed to acquire or renew lease", "error", err)
+			// Stop leading if the lease will expire before the next
+			// attempt to renew it.
+			if cancel != nil && time.Now().Add(e.opts.renewInterval).After(expires) {
+				stop()
+			}
+		case leader:
+			expires = lease.Expires
+			if cancel == nil {
+				e.opts.logger.Info("acquired leadership", "term", lease.Term, "expires", lease.Expires)
+				leadCtx, leadCancel := context.WithCancel(ctx)
+				cancel, done = leadCancel, make(chan struct{})
+				go func() {
+					defer close(done)
+					lead(leadCtx)
+				}()
+			}
+		default:
+			if cancel != nil {
+				e.opts.logger.Warn("lost leadership", "leader", lease.Holder, "term", lease.Term)
+			}
+			stop()
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			return e.Release(context.WithoutCancel(ctx))
+		case <-done:
+			e.opts.logger.Info("leader returned whilst holding the lease")
+			stop()
+			if err := e.Release(ctx); err != nil {
+				e.opts.logger.Warn("failed to release lease", "error", err)
+			}
+			// Give other replicas a chance to acquire the lease.
+			released = true
+		case <-ticker.C:
+		}
+	}
+}
+
+// CompareAndSwap implements CompareAndSwapFS. Writers are serialized
+// using a lock file in the store's directory, hence all replicas must
+// share that directory, for example via a network file system.
+func (lc *localCache) CompareAndSwap(_ context.Context, name string, old, data []byte, perm fs.FileMode) error {
+	unlock, err := lc.lock.Lock()
+	if err != nil {
+		return errors.NewM(fmt.Errorf("webauth/acme/certcache: compare-and-swap %q: %w", name, err), ErrLockFailed)
+	}
+	defer unlock()
+	current, err := os.ReadFile(lc.path(name))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if old != nil {
+			return fmt.Errorf("webauth/acme/certcache: compare-and-swap %q: %w", name, ErrLeaseConflict)
+		}
+	case err != nil:
+		return err
+	case old == nil || !bytes.Equal(current, old):
+		return fmt.Errorf("webauth/acme/certcache: compare-and-swap %q: %w", name, ErrLeaseConflict)
+	}
+	tmp := lc.path(name) + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, lc.path(name))
+}
@@ -0,0 +1,220 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package certcache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webauth/acme/certcache"
+	"github.com/stretchr/testify/require"
+)
+
+func newElectors(t *testing.T, ttl time.Duration, holders ...string) []*certcache.LeaderElector {
+	t.Helper()
+	store, err := certcache.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	var electors []*certcache.LeaderElector
+	for _, h := range holders {
+		e, err := certcache.NewLeaderElector(store, "leader.lease", h,
+			certcache.WithLeaseTTL(ttl),
+			certcache.WithLeaseRenewInterval(ttl/5))
+		require.NoError(t, err)
+		electors = append(electors, e)
+	}
+	return electors
+}
+
+func TestLocalStoreCompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	store, err := certcache.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	cas := store.(certcache.CompareAndSwapFS)
+
+	require.NoError(t, cas.CompareAndSwap(ctx, "f", nil, []byte("a"), 0600))
+	err = cas.CompareAndSwap(ctx, "f", nil, []byte("b"), 0600)
+	require.True(t, errors.Is(err, certcache.ErrLeaseConflict), "got %v", err)
+	err = cas.CompareAndSwap(ctx, "f", []byte("x"), []byte("b"), 0600)
+	require.True(t, errors.Is(err, certcache.ErrLeaseConflict), "got %v", err)
+	require.NoError(t, cas.CompareAndSwap(ctx, "f", []byte("a"), []byte("b"), 0600))
+	data, err := store.ReadFileCtx(ctx, "f")
+	require.NoError(t, err)
+	require.Equal(t, "b", string(data))
+	err = cas.CompareAndSwap(ctx, "missing", []byte("a"), []byte("b"), 0600)
+	require.True(t, errors.Is(err, certcache.ErrLeaseConflict), "got %v", err)
+}
+
+func TestLeaderElectorTryAcquire(t *testing.T) {
+	ctx := context.Background()
+	ttl := 200 * time.Millisecond
+	e := newElectors(t, ttl, "a", "b")
+	a, b := e[0], e[1]
+
+	lease, leader, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, leader)
+	require.Equal(t, "a", lease.Holder)
+	require.Equal(t, uint64(1), lease.Term)
+
+	// b cannot acquire an unexpired lease held by a.
+	lease, leader, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.False(t, leader)
+	require.Equal(t, "a", lease.Holder)
+
+	// a can renew its lease without changing the term.
+	renewed, leader, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, leader)
+	require.Equal(t, uint64(1), renewed.Term)
+	require.True(t, renewed.Expires.After(lease.Expires))
+
+	// b acquires the lease once it has expired.
+	time.Sleep(ttl + 50*time.Millisecond)
+	lease, leader, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, leader)
+	require.Equal(t, "b", lease.Holder)
+	require.Equal(t, uint64(2), lease.Term)
+
+	// a acquires the lease as soon as b releases it.
+	require.NoError(t, b.Release(ctx))
+	lease, leader, err = a.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, leader)
+	require.Equal(t, uint64(3), lease.Term)
+
+	// Releasing a lease held by another replica is a no-op.
+	require.NoError(t, b.Release(ctx))
+	stored, err := b.Lease(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "a", stored.Holder)
+	require.False(t, stored.Expired(time.Now()))
+}
+
+func TestLeaderElectorRace(t *testing.T) {
+	ctx := context.Background()
+	holders := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	electors := newElectors(t, time.Minute, holders...)
+	var wg sync.WaitGroup
+	leaders := make(chan string, len(electors))
+	for _, e := range electors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, leader, err := e.TryAcquire(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+			if leader {
+				leaders <- e.Holder()
+			}
+		}()
+	}
+	wg.Wait()
+	close(leaders)
+	var elected []string
+	for l := range leaders {
+		elected = append(elected, l)
+	}
+	require.Len(t, elected, 1)
+}
+
+func TestLeaderElectorRun(t *testing.T) {
+	ttl := 250 * time.Millisecond
+	e := newElectors(t, ttl, "a", "b")
+
+	type event struct {
+		holder string
+		leader bool
+	}
+	events := make(chan event, 10)
+	run := func(ctx context.Context, e *certcache.LeaderElector) chan error {
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- e.Run(ctx, func(ctx context.Context) {
+				events <- event{e.Holder(), true}
+				<-ctx.Done()
+				events <- event{e.Holder(), false}
+			})
+		}()
+		return errCh
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	errA := run(ctxA, e[0])
+	require.Equal(t, event{"a", true}, <-events)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	errB := run(ctxB, e[1])
+
+	// b remains a standby whilst a renews its lease.
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event: %v", ev)
+	case <-time.After(2 * ttl):
+	}
+
+	// b takes over once a stops and releases its lease.
+	cancelA()
+	require.Equal(t, event{"a", false}, <-events)
+	require.NoError(t, <-errA)
+	select {
+	case ev := <-events:
+		require.Equal(t, event{"b", true}, ev)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for b to become leader")
+	}
+
+	cancelB()
+	require.Equal(t, event{"b", false}, <-events)
+	require.NoError(t, <-errB)
+}
+
+func TestLeaderElectorRunLeadReturns(t *testing.T) {
+	ttl := 250 * time.Millisecond
+	e := newElectors(t, ttl, "a")[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := make(chan int, 10)
+	n := 0
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- e.Run(ctx, func(ctx context.Context) {
+			n++
+			calls <- n
+			if n == 1 {
+				// Return whilst still holding the lease.
+				return
+			}
+			<-ctx.Done()
+		})
+	}()
+
+	require.Equal(t, 1, <-calls)
+	select {
+	case got := <-calls:
+		require.Equal(t, 2, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for lead to be called again")
+	}
+	// The lease was released and then acquired again for a new term.
+	lease, err := e.Lease(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lease.Term)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestLeaderElectorUnsupportedStore(t *testing.T) {
+	_, err := certcache.NewLeaderElector(newMockCacheFS(), "leader.lease", "a")
+	require.True(t, errors.Is(err, certcache.ErrCompareAndSwapNotSupported), "got %v", err)
+}
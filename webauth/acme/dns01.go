@@ -0,0 +1,341 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudeng.io/webapp"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// DNSProvider is implemented by DNS providers that can create and remove
+// the TXT records required by the ACME dns-01 challenge.
+type DNSProvider interface {
+	// Present creates a TXT record for fqdn with the specified value.
+	Present(ctx context.Context, fqdn, value string) error
+	// CleanUp removes the TXT record for fqdn with the specified value
+	// that was created by Present.
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// DNS01ChallengeName returns the fully qualified name of the TXT record
+// used for the dns-01 challenge for domain. The wildcard prefix, if any,
+// is removed since the challenge for *.example.com is validated using
+// _acme-challenge.example.com.
+func DNS01ChallengeName(domain string) string {
+	domain = strings.TrimPrefix(domain, "*.")
+	return "_acme-challenge." + strings.TrimSuffix(domain, ".") + "."
+}
+
+// DNS01Option configures a DNS01Issuer.
+type DNS01Option func(o *dns01Options)
+
+type dns01Options struct {
+	httpClient       *http.Client
+	propagationDelay time.Duration
+	logger           *slog.Logger
+}
+
+// WithDNS01HTTPClient sets the http.Client used to communicate with the
+// ACME service, for example to trust a testing CA.
+func WithDNS01HTTPClient(client *http.Client) DNS01Option {
+	return func(o *dns01Options) {
+		o.httpClient = client
+	}
+}
+
+// WithPropagationDelay sets the time to wait after the TXT records have
+// been created before asking the ACME service to validate them. This
+// allows for the records to propagate to all of the authoritative servers
+// for the zone. The default is not to wait.
+func WithPropagationDelay(delay time.Duration) DNS01Option {
+	return func(o *dns01Options) {
+		o.propagationDelay = delay
+	}
+}
+
+// WithDNS01Logger sets the logger used by the issuer.
+func WithDNS01Logger(logger *slog.Logger) DNS01Option {
+	return func(o *dns01Options) {
+		o.logger = logger
+	}
+}
+
+// DNS01Issuer obtains certificates, including wildcard certificates, using
+// the ACME dns-01 challenge. Certificates and the ACME account key are
+// stored in an autocert.Cache using the same format and names as an
+// autocert.Manager so that they can be shared with, and served by, the
+// existing http-01 based tooling.
+type DNS01Issuer struct {
+	cache       autocert.Cache
+	provider    DNSProvider
+	directory   string
+	email       string
+	userAgent   string
+	renewBefore time.Duration
+	opts        dns01Options
+}
+
+// NewDNS01Issuer returns a DNS01Issuer that uses the ACME service
+// specified by cfg and creates the TXT records required by the dns-01
+// challenge using provider.
+func NewDNS01Issuer(cache autocert.Cache, cfg AutocertConfig, provider DNSProvider, opts ...DNS01Option) (*DNS01Issuer, error) {
+	if cache == nil {
+		return nil, fmt.Errorf("no cache provided")
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("no dns provider provided")
+	}
+	var o dns01Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logger == nil {
+		o.logger = slog.New(slog.DiscardHandler)
+	}
+	renewBefore := cfg.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = 720 * time.Hour
+	}
+	return &DNS01Issuer{
+		cache:       cache,
+		provider:    provider,
+		directory:   cfg.DirectoryURL(),
+		email:       cfg.Email,
+		userAgent:   cfg.UserAgent,
+		renewBefore: renewBefore,
+		opts:        o,
+	}, nil
+}
+
+const accountKeyName = "acme_account+key"
+
+// accountKey returns the ACME account key stored in the cache, creating
+// and storing a new one if none exists.
+func (d *DNS01Issuer) accountKey(ctx context.Context) (crypto.Signer, error) {
+	data, err := d.cache.Get(ctx, accountKeyName)
+	if err == nil {
+		priv, _ := pem.Decode(data)
+		if priv == nil || !strings.Contains(priv.Type, "PRIVATE") {
+			return nil, fmt.Errorf("invalid account key found in cache")
+		}
+		return webapp.ParsePrivateKeyDER(priv.Bytes)
+	}
+	if !errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := d.cache.Put(ctx, accountKeyName, pemKey); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (d *DNS01Issuer) client(ctx context.Context) (*acme.Client, error) {
+	key, err := d.accountKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain acme account key: %w", err)
+	}
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: d.directory,
+		UserAgent:    d.userAgent,
+		HTTPClient:   d.opts.httpClient,
+	}
+	acct := &acme.Account{}
+	if len(d.email) > 0 {
+		acct.Contact = []string{"mailto:" + d.email}
+	}
+	if _, err := client.Register(ctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register acme account: %w", err)
+	}
+	return client, nil
+}
+
+// Issue obtains a certificate for the specified domains, which may include
+// wildcard domains such as *.example.com, and stores it in the cache
+// under name.
+func (d *DNS01Issuer) Issue(ctx context.Context, name string, domains ...string) (*tls.Certificate, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains specified")
+	}
+	client, err := d.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order for %v: %w", domains, err)
+	}
+	for _, zurl := range order.AuthzURLs {
+		if err := d.authorize(ctx, client, zurl); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("order for %v was not authorized: %w", domains, err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain certificate for %v: %w", domains, err)
+	}
+	data, cert, err := encodeCertificate(key, chain)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.cache.Put(ctx, name, data); err != nil {
+		return nil, fmt.Errorf("failed to store certificate %q: %w", name, err)
+	}
+	d.opts.logger.Info("obtained certificate using dns-01", "name", name, "domains", domains, "not-after", cert.Leaf.NotAfter)
+	return cert, nil
+}
+
+// Renew is like Issue except that it only obtains a new certificate if
+// the certificate stored under name does not exist, does not cover all of
+// the specified domains or is due to expire within the configured
+// RenewBefore duration. It returns true if a new certificate was obtained.
+func (d *DNS01Issuer) Renew(ctx context.Context, name string, domains ...string) (*tls.Certificate, bool, error) {
+	data, err := d.cache.Get(ctx, name)
+	if err != nil && !errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, false, err
+	}
+	if err == nil {
+		cert, err := decodeCertificate(data)
+		if err == nil && !d.needsRenewal(cert.Leaf, domains) {
+			return cert, false, nil
+		}
+	}
+	cert, err := d.Issue(ctx, name, domains...)
+	return cert, err == nil, err
+}
+
+func (d *DNS01Issuer) needsRenewal(leaf *x509.Certificate, domains []string) bool {
+	if time.Now().Add(d.renewBefore).After(leaf.NotAfter) {
+		return true
+	}
+	for _, domain := range domains {
+		if !slices.Contains(leaf.DNSNames, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize completes the dns-01 challenge for the authorization at zurl.
+func (d *DNS01Issuer) authorize(ctx context.Context, client *acme.Client, zurl string) error {
+	z, err := client.GetAuthorization(ctx, zurl)
+	if err != nil {
+		return err
+	}
+	if z.Status == acme.StatusValid {
+		return nil
+	}
+	var chal *acme.Challenge
+	for _, c := range z.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %v", z.Identifier.Value)
+	}
+	value, err := client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+	fqdn := DNS01ChallengeName(z.Identifier.Value)
+	if err := d.provider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("failed to create dns-01 record %v: %w", fqdn, err)
+	}
+	defer func() {
+		if err := d.provider.CleanUp(context.WithoutCancel(ctx), fqdn, value); err != nil {
+			d.opts.logger.Warn("failed to remove dns-01 record", "fqdn", fqdn, "error", err)
+		}
+	}()
+	if d.opts.propagationDelay > 0 {
+		select {
+		case <-time.After(d.opts.propagationDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("failed to accept dns-01 challenge for %v: %w", z.Identifier.Value, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, z.URI); err != nil {
+		return fmt.Errorf("dns-01 challenge for %v failed: %w", z.Identifier.Value, err)
+	}
+	return nil
+}
+
+// encodeCertificate encodes key and chain using the same format as
+// autocert, ie. the PEM encoded private key followed by the PEM encoded
+// certificates.
+func encodeCertificate(key *ecdsa.PrivateKey, chain [][]byte) ([]byte, *tls.Certificate, error) {
+	var buf bytes.Buffer
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, nil, err
+	}
+	for _, c := range chain {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c}); err != nil {
+			return nil, nil, err
+		}
+	}
+	cert, err := decodeCertificate(buf.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), cert, nil
+}
+
+func decodeCertificate(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package acme_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"cloudeng.io/logging"
+	"cloudeng.io/logging/ctxlog"
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/webauth/acme"
+	"cloudeng.io/webapp/webauth/acme/certcache"
+	"cloudeng.io/webapp/webauth/acme/pebble"
+	"cloudeng.io/webapp/webauth/acme/pebble/pebbletest"
+)
+
+func sameNames(a, b []string) bool {
+	return slices.Equal(slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b)))
+}
+
+func TestDNS01WildcardCertificate(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	ctx = ctxlog.WithLogger(ctx, slog.New(slog.NewJSONHandler(logging.NewJSONFormatter(os.Stderr, "", "  "), &slog.HandlerOptions{AddSource: false})))
+
+	tmpDir := t.TempDir()
+
+	secret := []byte("dns01-tsig-secret")
+	dnsServer := pebbletest.StartDNSServer(ctx, t, "example.com", pebbletest.WithTSIGKey("acme-key", secret))
+	defer dnsServer.Close()
+
+	// Start a pebble server that uses the in-process dns server.
+	pebbleServer, pebbleCfg, _, pebbleCacheDir, pebbleTestDir := pebbletest.Start(ctx, t, tmpDir,
+		pebbletest.WithServerOptions(pebble.WithNoSleep(), pebble.WithDNSServer(dnsServer.Addr())))
+	defer func() {
+		then := time.Now()
+		if err := pebbleServer.EnsureStopped(context.Background(), time.Second*5); err != nil {
+			t.Errorf("failed to stop pebble server after %v: %v", time.Since(then), err)
+		}
+	}()
+	lb, err := certcache.NewLocalStore(filepath.Join(pebbleCacheDir, "certs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := certcache.NewCachingStore(pebbleCacheDir, lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := acme.NewRFC2136Provider(dnsServer.Addr(), acme.WithTSIG("acme-key", acme.TSIGHMACSHA256, secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient, err := webapp.NewHTTPClient(ctx,
+		webapp.WithCustomCAPEMFile(filepath.Join(pebbleTestDir, pebbleCfg.CAFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := acme.NewDNS01Issuer(cache, acme.AutocertConfig{
+		Provider: pebbleCfg.DirectoryURL(),
+	}, provider, acme.WithDNS01HTTPClient(httpClient), acme.WithDNS01Logger(ctxlog.Logger(ctx)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domains := []string{"*.example.com", "example.com"}
+	cert, err := issuer.Issue(ctx, "wildcard.example.com", domains...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cert.Leaf.DNSNames; !sameNames(got, domains) {
+		t.Errorf("got %v, want %v", got, domains)
+	}
+	if err := cert.Leaf.VerifyHostname("www.example.com"); err != nil {
+		t.Errorf("wildcard hostname verification failed: %v", err)
+	}
+	// The challenge records are removed once the order is complete.
+	if got := dnsServer.TXT(acme.DNS01ChallengeName("example.com")); len(got) != 0 {
+		t.Errorf("unexpected challenge records: %v", got)
+	}
+
+	// The certificate is stored in the cache and is not renewed
+	// unnecessarily.
+	stored, err := cache.Get(ctx, "wildcard.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) == 0 {
+		t.Fatal("empty certificate stored")
+	}
+	renewed, issued, err := issuer.Renew(ctx, "wildcard.example.com", domains...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued || !renewed.Leaf.Equal(cert.Leaf) {
+		t.Errorf("certificate was unexpectedly renewed")
+	}
+	// Adding a domain requires a new certificate.
+	domains = append(domains, "*.api.example.com")
+	renewed, issued, err = issuer.Renew(ctx, "wildcard.example.com", domains...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !issued || !sameNames(renewed.Leaf.DNSNames, domains) {
+		t.Errorf("certificate was not renewed: %v", renewed.Leaf.DNSNames)
+	}
+}
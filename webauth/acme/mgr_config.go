@@ -30,8 +30,8 @@ const (
 
 // ServiceFlags represents the flags required to configure an ACME client
 // instance for managing TLS certificates for hosts/domains using the
-// acme http-01 challenge. Note that wildcard domains are not supported
-// by this challenge.
+// acme http-01 or tls-alpn-01 challenges. Note that wildcard domains are
+// not supported by these challenges.
 // The currently supported/tested acme service providers are letsencrypt
 // staging and production via the values 'letsencrypt-staging' and
 // 'letsencrypt' for the --acme-service flag; however any URL can be specified
@@ -90,22 +90,60 @@ type Manager struct {
 	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 }
 
+// GetCertificate returns the certificate for the supplied hello. ACME
+// TLS-ALPN-01 challenge handshakes are answered using the challenge
+// certificate created by the underlying autocert.Manager and are not
+// subject to the AllowRSACertificates setting.
 func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if webapp.IsACMETLSALPN01Hello(hello) {
+		return m.Manager.GetCertificate(hello)
+	}
 	return m.getCertificate(hello)
 }
 
+// GetConfigForClient returns a function that can be used as the
+// GetConfigForClient callback in a tls.Config to answer ACME TLS-ALPN-01
+// challenge handshakes, ie. those that offer only the acme-tls/1 protocol,
+// using a tls.Config that negotiates acme-tls/1 and serves the challenge
+// certificate. All other handshakes are passed to next, which may be nil
+// to use the enclosing tls.Config. This allows the challenge to be
+// answered by an existing TLS server whose tls.Config was not obtained
+// from TLSConfig.
+func (m *Manager) GetConfigForClient(next func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if webapp.IsACMETLSALPN01Hello(hello) {
+			return &tls.Config{
+				GetCertificate: m.Manager.GetCertificate,
+				NextProtos:     []string{acme.ALPNProto},
+				MinVersion:     tls.VersionTLS12,
+			}, nil
+		}
+		if next == nil {
+			return nil, nil
+		}
+		return next(hello)
+	}
+}
+
 // TLSConfig returns a tls.Config obtained using from the underlying autocert.Manager,
 // but with the GetCertificate function replaced with the Manager's GetCertificate
-// function, which enforces the AllowRSACertificates setting.
+// function, which enforces the AllowRSACertificates setting, and with
+// GetConfigForClient set to answer ACME TLS-ALPN-01 challenges.
 func (m *Manager) TLSConfig() *tls.Config {
 	cfg := m.Manager.TLSConfig()
 	cfg.GetCertificate = m.GetCertificate
+	cfg.GetConfigForClient = m.GetConfigForClient(nil)
 	return cfg
 }
 
 // NewAutocertManager creates a new autocert.Manager from the supplied config.
 // Any supplied hosts specify the allowed hosts for the manager, ie. those
 // for which it will obtain/renew certificates.
+// The manager will always attempt the TLS-ALPN-01 challenge first, which
+// requires that port 443 for each host be served by a TLS server using
+// the manager's TLSConfig or GetConfigForClient, either directly or via
+// webapp.ProxyAcmeTLSALPN01. The HTTP-01 challenge is attempted only if
+// the manager's HTTPHandler method has been called.
 func NewAutocertManager(cache autocert.Cache, cl AutocertConfig, allowedHosts ...string) (*Manager, error) {
 	if cache == nil {
 		return nil, fmt.Errorf("no cache provided")
@@ -29,7 +29,8 @@ import (
 type ServerOption func(*serverOptions)
 
 type serverOptions struct {
-	noSleep bool
+	noSleep   bool
+	dnsServer string
 }
 
 // ConfigOption represents an option for configuring a new Config instance.
@@ -65,6 +66,15 @@ func WithNoSleep() ServerOption {
 	}
 }
 
+// WithDNSServer returns a ServerOption that configures pebble to use
+// the specified DNS server, of the form host:port, for all of its DNS
+// lookups, including those used to validate dns-01 challenges.
+func WithDNSServer(addr string) ServerOption {
+	return func(o *serverOptions) {
+		o.dnsServer = addr
+	}
+}
+
 // T manages a pebble instance for testing purposes.
 type T struct {
 	cmd    *exec.Cmd
@@ -95,7 +105,11 @@ func (p *T) Start(ctx context.Context, dir, cfg string, forward io.WriteCloser)
 	}
 	p.ch = make(chan []byte, 1000)
 	filter := executil.NewLineFilter(forward, p.ch)
-	p.cmd = exec.CommandContext(ctx, pebblePath, "-config", cfg)
+	args := []string{"-config", cfg}
+	if len(p.opts.dnsServer) > 0 {
+		args = append(args, "-dnsserver", p.opts.dnsServer)
+	}
+	p.cmd = exec.CommandContext(ctx, pebblePath, args...)
 	p.cmd.Dir = dir
 	p.cmd.Stdout = filter
 	p.cmd.Stderr = filter
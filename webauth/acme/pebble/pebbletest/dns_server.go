@@ -0,0 +1,412 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package pebbletest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	opcodeUpdate  dnsmessage.OpCode = 5
+	typeTSIG      dnsmessage.Type   = 250
+	classNone     dnsmessage.Class  = 254
+	rcodeNotAuth  dnsmessage.RCode  = 9
+	rcodeNotZone  dnsmessage.RCode  = 10
+	tsigAlgorithm                   = "hmac-sha256."
+)
+
+// DNSServerOption represents an option for configuring a DNSServer.
+type DNSServerOption func(o *dnsServerOptions)
+
+type dnsServerOptions struct {
+	tsigKeyName string
+	tsigSecret  []byte
+}
+
+// WithTSIGKey returns a DNSServerOption that requires that all dynamic
+// updates be signed using TSIG with the specified HMAC-SHA256 key.
+func WithTSIGKey(name string, secret []byte) DNSServerOption {
+	return func(o *dnsServerOptions) {
+		o.tsigKeyName = strings.ToLower(strings.TrimSuffix(name, ".") + ".")
+		o.tsigSecret = secret
+	}
+}
+
+// DNSServer is a minimal, in-process, authoritative DNS server for a single
+// zone that supports RFC 2136 dynamic updates of TXT records. It is
+// intended for testing dns-01 challenges with pebble's -dnsserver flag,
+// see pebble.WithDNSServer. All A queries within the zone are answered
+// with 127.0.0.1.
+type DNSServer struct {
+	zone     string
+	opts     dnsServerOptions
+	udp      net.PacketConn
+	tcp      net.Listener
+	mu       sync.Mutex
+	records  map[string][]string
+	wg       sync.WaitGroup
+	closeErr error
+	once     sync.Once
+}
+
+// StartDNSServer starts a DNSServer for zone listening on a random port on
+// 127.0.0.1 for both UDP and TCP. The server is closed when ctx is
+// canceled or Close is called.
+func StartDNSServer(ctx context.Context, t Testing, zone string, opts ...DNSServerOption) *DNSServer {
+	t.Helper()
+	s := &DNSServer{
+		zone:    strings.ToLower(strings.TrimSuffix(zone, ".") + "."),
+		records: map[string][]string{},
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	var lc net.ListenConfig
+	for range 10 {
+		udp, err := lc.ListenPacket(ctx, "udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen on udp: %v", err)
+		}
+		tcp, err := lc.Listen(ctx, "tcp", udp.LocalAddr().String())
+		if err != nil {
+			udp.Close()
+			continue
+		}
+		s.udp, s.tcp = udp, tcp
+		break
+	}
+	if s.udp == nil {
+		t.Fatalf("failed to listen on the same udp and tcp port")
+	}
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+	t.Logf("dns server for zone %v listening on %v", s.zone, s.Addr())
+	return s
+}
+
+// Addr returns the address, of the form host:port, that the server is
+// listening on.
+func (s *DNSServer) Addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// TXT returns the TXT records for name.
+func (s *DNSServer) TXT(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.records[canonical(name)])
+}
+
+// Close stops the server.
+func (s *DNSServer) Close() error {
+	s.once.Do(func() {
+		s.closeErr = errors.Join(s.udp.Close(), s.tcp.Close())
+		s.wg.Wait()
+	})
+	return s.closeErr
+}
+
+func canonical(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".") + ".")
+}
+
+func (s *DNSServer) inZone(name string) bool {
+	return name == s.zone || strings.HasSuffix(name, "."+s.zone)
+}
+
+func (s *DNSServer) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.handle(buf[:n]); resp != nil {
+			_, _ = s.udp.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *DNSServer) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *DNSServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return
+		}
+		resp := s.handle(msg)
+		if resp == nil {
+			return
+		}
+		out := binary.BigEndian.AppendUint16(nil, uint16(len(resp))) //nolint:gosec // G115 messages are smaller than 64K
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *DNSServer) handle(msg []byte) []byte {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(msg)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	if hdr.OpCode == opcodeUpdate {
+		return s.reply(hdr, q, s.update(msg, &p, q), nil)
+	}
+	name := canonical(q.Name.String())
+	if !s.inZone(name) {
+		return s.reply(hdr, q, dnsmessage.RCodeRefused, nil)
+	}
+	return s.reply(hdr, q, dnsmessage.RCodeSuccess, func(b *dnsmessage.Builder) error {
+		return s.answer(b, q, name)
+	})
+}
+
+func (s *DNSServer) reply(hdr dnsmessage.Header, q dnsmessage.Question, rcode dnsmessage.RCode, answer func(*dnsmessage.Builder) error) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:            hdr.ID,
+		Response:      true,
+		OpCode:        hdr.OpCode,
+		Authoritative: true,
+		RCode:         rcode,
+	})
+	if err := b.StartQuestions(); err != nil {
+		return nil
+	}
+	if err := b.Question(q); err != nil {
+		return nil
+	}
+	if answer != nil {
+		if err := answer(&b); err != nil {
+			return nil
+		}
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+func (s *DNSServer) soa() (dnsmessage.ResourceHeader, dnsmessage.SOAResource) {
+	zone := dnsmessage.MustNewName(s.zone)
+	return dnsmessage.ResourceHeader{Name: zone, Class: dnsmessage.ClassINET, TTL: 60},
+		dnsmessage.SOAResource{
+			NS:      dnsmessage.MustNewName("ns." + s.zone),
+			MBox:    dnsmessage.MustNewName("hostmaster." + s.zone),
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			MinTTL:  60,
+		}
+}
+
+func (s *DNSServer) answer(b *dnsmessage.Builder, q dnsmessage.Question, name string) error {
+	if err := b.StartAnswers(); err != nil {
+		return err
+	}
+	hdr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	switch q.Type {
+	case dnsmessage.TypeTXT:
+		for _, txt := range s.TXT(name) {
+			if err := b.TXTResource(hdr, dnsmessage.TXTResource{TXT: []string{txt}}); err != nil {
+				return err
+			}
+		}
+	case dnsmessage.TypeA:
+		return b.AResource(hdr, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+	case dnsmessage.TypeSOA:
+		h, soa := s.soa()
+		if name == s.zone {
+			return b.SOAResource(h, soa)
+		}
+		if err := b.StartAuthorities(); err != nil {
+			return err
+		}
+		return b.SOAResource(h, soa)
+	}
+	return nil
+}
+
+// update applies the dynamic update in msg, whose zone section has
+// already been parsed into q.
+func (s *DNSServer) update(msg []byte, p *dnsmessage.Parser, q dnsmessage.Question) dnsmessage.RCode {
+	if canonical(q.Name.String()) != s.zone || q.Type != dnsmessage.TypeSOA {
+		return rcodeNotAuth
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return dnsmessage.RCodeFormatError
+	}
+	if err := p.SkipAllAnswers(); err != nil {
+		return dnsmessage.RCodeFormatError
+	}
+	type change struct {
+		name  string
+		class dnsmessage.Class
+		txt   []string
+	}
+	var changes []change
+	for {
+		h, err := p.AuthorityHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return dnsmessage.RCodeFormatError
+		}
+		name := canonical(h.Name.String())
+		if !s.inZone(name) {
+			return rcodeNotZone
+		}
+		if h.Type != dnsmessage.TypeTXT {
+			return dnsmessage.RCodeNotImplemented
+		}
+		txt, err := p.TXTResource()
+		if err != nil {
+			return dnsmessage.RCodeFormatError
+		}
+		changes = append(changes, change{name, h.Class, txt.TXT})
+	}
+	if len(s.opts.tsigKeyName) > 0 {
+		if rcode := s.verifyTSIG(msg, p); rcode != dnsmessage.RCodeSuccess {
+			return rcode
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range changes {
+		switch c.class {
+		case dnsmessage.ClassINET:
+			for _, txt := range c.txt {
+				if !slices.Contains(s.records[c.name], txt) {
+					s.records[c.name] = append(s.records[c.name], txt)
+				}
+			}
+		case classNone:
+			s.records[c.name] = slices.DeleteFunc(s.records[c.name], func(v string) bool {
+				return slices.Contains(c.txt, v)
+			})
+		case dnsmessage.ClassANY:
+			delete(s.records, c.name)
+		}
+	}
+	return dnsmessage.RCodeSuccess
+}
+
+// verifyTSIG verifies the TSIG record that must be the last record in the
+// additional section of msg.
+func (s *DNSServer) verifyTSIG(msg []byte, p *dnsmessage.Parser) dnsmessage.RCode {
+	var (
+		h      dnsmessage.ResourceHeader
+		rdata  []byte
+		signed bool
+	)
+	for {
+		ah, err := p.AdditionalHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return dnsmessage.RCodeFormatError
+		}
+		r, err := p.UnknownResource()
+		if err != nil {
+			return dnsmessage.RCodeFormatError
+		}
+		h, rdata, signed = ah, r.Data, ah.Type == typeTSIG
+	}
+	if !signed || canonical(h.Name.String()) != s.opts.tsigKeyName {
+		return rcodeNotAuth
+	}
+	// The TSIG record is not compressed and hence its offset in msg can be
+	// computed from its length.
+	keyName := appendWireName(nil, s.opts.tsigKeyName)
+	offset := len(msg) - len(keyName) - 10 - len(rdata)
+	if offset < 12 {
+		return dnsmessage.RCodeFormatError
+	}
+	alg := appendWireName(nil, tsigAlgorithm)
+	if len(rdata) < len(alg)+10 || !strings.EqualFold(string(rdata[:len(alg)]), string(alg)) {
+		return rcodeNotAuth
+	}
+	rest := rdata[len(alg):]
+	timeAndFudge := rest[:8]
+	macSize := int(binary.BigEndian.Uint16(rest[8:10]))
+	if len(rest) < 10+macSize+6 {
+		return dnsmessage.RCodeFormatError
+	}
+	mac := rest[10 : 10+macSize]
+	trailer := rest[10+macSize:] // original id, error, other len and data
+
+	unsigned := slices.Clone(msg[:offset])
+	binary.BigEndian.PutUint16(unsigned[10:12], binary.BigEndian.Uint16(unsigned[10:12])-1)
+	copy(unsigned[0:2], trailer[0:2])
+
+	hm := hmac.New(sha256.New, s.opts.tsigSecret)
+	hm.Write(unsigned)
+	hm.Write(keyName)
+	hm.Write([]byte{0, byte(dnsmessage.ClassANY), 0, 0, 0, 0})
+	hm.Write(alg)
+	hm.Write(timeAndFudge)
+	hm.Write(trailer[2:])
+	if !hmac.Equal(hm.Sum(nil), mac) {
+		return rcodeNotAuth
+	}
+	signedAt := int64(binary.BigEndian.Uint64(append([]byte{0, 0}, timeAndFudge[:6]...))) //nolint:gosec // G115 time is 48 bits
+	fudge := int64(binary.BigEndian.Uint16(timeAndFudge[6:8]))
+	if d := time.Now().Unix() - signedAt; d > fudge || d < -fudge {
+		return rcodeNotAuth
+	}
+	return dnsmessage.RCodeSuccess
+}
+
+func appendWireName(b []byte, name string) []byte {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	for label := range strings.SplitSeq(name, ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
@@ -18,6 +18,7 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	flag.StringVar(&config, "config", "", "path to pebble config file")
+	flag.String("dnsserver", "", "dns server to use for lookups")
 	flag.Parse()
 
 	time.Sleep(100 * time.Millisecond)
@@ -0,0 +1,358 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// TSIGHMACSHA256 is the name of the HMAC-SHA256 TSIG algorithm.
+	TSIGHMACSHA256 = "hmac-sha256."
+	// TSIGHMACSHA512 is the name of the HMAC-SHA512 TSIG algorithm.
+	TSIGHMACSHA512 = "hmac-sha512."
+)
+
+const (
+	opcodeUpdate dnsmessage.OpCode = 5
+	typeTSIG     dnsmessage.Type   = 250
+	classNone    dnsmessage.Class  = 254
+	tsigFudge                      = 300
+)
+
+// RFC2136Option configures an RFC2136Provider.
+type RFC2136Option func(o *rfc2136Options)
+
+type rfc2136Options struct {
+	zone          string
+	ttl           time.Duration
+	timeout       time.Duration
+	tsigKeyName   string
+	tsigAlgorithm string
+	tsigSecret    []byte
+}
+
+// WithTSIG configures the provider to sign updates using TSIG (RFC 8945)
+// with the specified key name, algorithm and secret. The algorithm
+// defaults to TSIGHMACSHA256 if empty.
+func WithTSIG(keyName, algorithm string, secret []byte) RFC2136Option {
+	return func(o *rfc2136Options) {
+		o.tsigKeyName = keyName
+		o.tsigAlgorithm = algorithm
+		o.tsigSecret = secret
+	}
+}
+
+// WithZone sets the zone to be updated. If not set, the zone is
+// determined by querying the server for the SOA record of the name
+// being updated.
+func WithZone(zone string) RFC2136Option {
+	return func(o *rfc2136Options) {
+		o.zone = zone
+	}
+}
+
+// WithRecordTTL sets the TTL of the TXT records created by the provider.
+// The default is 60 seconds.
+func WithRecordTTL(ttl time.Duration) RFC2136Option {
+	return func(o *rfc2136Options) {
+		o.ttl = ttl
+	}
+}
+
+// WithDNSTimeout sets the timeout for each exchange with the DNS server.
+// The default is 10 seconds.
+func WithDNSTimeout(timeout time.Duration) RFC2136Option {
+	return func(o *rfc2136Options) {
+		o.timeout = timeout
+	}
+}
+
+// RFC2136Provider is a DNSProvider that creates and removes TXT records
+// using DNS dynamic updates as per RFC 2136. Updates are sent over TCP
+// and may be signed using TSIG. Note that the TSIG signature of the
+// server's response is not verified.
+type RFC2136Provider struct {
+	server string
+	opts   rfc2136Options
+}
+
+// NewRFC2136Provider returns a provider that sends updates to the
+// specified server, which must be of the form host:port.
+func NewRFC2136Provider(server string, opts ...RFC2136Option) (*RFC2136Provider, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return nil, fmt.Errorf("invalid dns server address %q: %w", server, err)
+	}
+	var o rfc2136Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.ttl <= 0 {
+		o.ttl = time.Minute
+	}
+	if o.timeout <= 0 {
+		o.timeout = 10 * time.Second
+	}
+	if len(o.tsigKeyName) > 0 {
+		if len(o.tsigAlgorithm) == 0 {
+			o.tsigAlgorithm = TSIGHMACSHA256
+		}
+		o.tsigKeyName = absName(o.tsigKeyName)
+		o.tsigAlgorithm = absName(strings.ToLower(o.tsigAlgorithm))
+		if tsigHash(o.tsigAlgorithm) == nil {
+			return nil, fmt.Errorf("unsupported tsig algorithm %q", o.tsigAlgorithm)
+		}
+	}
+	if len(o.zone) > 0 {
+		o.zone = absName(o.zone)
+	}
+	return &RFC2136Provider{server: server, opts: o}, nil
+}
+
+// Present implements DNSProvider.
+func (p *RFC2136Provider) Present(ctx context.Context, name, value string) error {
+	return p.update(ctx, name, value, dnsmessage.ClassINET, uint32(p.opts.ttl.Seconds()))
+}
+
+// CleanUp implements DNSProvider.
+func (p *RFC2136Provider) CleanUp(ctx context.Context, name, value string) error {
+	return p.update(ctx, name, value, classNone, 0)
+}
+
+func absName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func (p *RFC2136Provider) update(ctx context.Context, name, value string, class dnsmessage.Class, ttl uint32) error {
+	name = absName(name)
+	zone := p.opts.zone
+	if len(zone) == 0 {
+		var err error
+		if zone, err = p.findZone(ctx, name); err != nil {
+			return err
+		}
+	}
+	zoneName, err := dnsmessage.NewName(zone)
+	if err != nil {
+		return err
+	}
+	rrName, err := dnsmessage.NewName(name)
+	if err != nil {
+		return err
+	}
+	id := newMessageID()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, OpCode: opcodeUpdate})
+	if err := b.StartQuestions(); err != nil {
+		return err
+	}
+	if err := b.Question(dnsmessage.Question{Name: zoneName, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return err
+	}
+	// The update section of an UPDATE message occupies the authority
+	// section of a regular message.
+	if err := b.StartAuthorities(); err != nil {
+		return err
+	}
+	if err := b.TXTResource(
+		dnsmessage.ResourceHeader{Name: rrName, Class: class, TTL: ttl},
+		dnsmessage.TXTResource{TXT: []string{value}}); err != nil {
+		return err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return err
+	}
+	if len(p.opts.tsigKeyName) > 0 {
+		msg = p.sign(msg, id, time.Now())
+	}
+	resp, err := p.exchange(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("dns update for %v in zone %v: %w", name, zone, err)
+	}
+	var parser dnsmessage.Parser
+	hdr, err := parser.Start(resp)
+	if err != nil {
+		return fmt.Errorf("dns update for %v in zone %v: invalid response: %w", name, zone, err)
+	}
+	if hdr.ID != id {
+		return fmt.Errorf("dns update for %v in zone %v: mismatched response id", name, zone)
+	}
+	if hdr.RCode != dnsmessage.RCodeSuccess {
+		return fmt.Errorf("dns update for %v in zone %v: failed: %v", name, zone, hdr.RCode)
+	}
+	return nil
+}
+
+// findZone determines the zone containing name by querying for its SOA
+// record. The SOA record is returned in the answer section if name is the
+// apex of the zone and in the authority section otherwise.
+func (p *RFC2136Provider) findZone(ctx context.Context, name string) (string, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return "", err
+	}
+	id := newMessageID()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id})
+	if err := b.StartQuestions(); err != nil {
+		return "", err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return "", err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.exchange(ctx, msg)
+	if err != nil {
+		return "", fmt.Errorf("soa query for %v: %w", name, err)
+	}
+	var parser dnsmessage.Parser
+	if _, err := parser.Start(resp); err != nil {
+		return "", err
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return "", err
+	}
+	sections := []struct {
+		header func() (dnsmessage.ResourceHeader, error)
+		skip   func() error
+	}{
+		{parser.AnswerHeader, parser.SkipAnswer},
+		{parser.AuthorityHeader, parser.SkipAuthority},
+	}
+	for _, section := range sections {
+		for {
+			h, err := section.header()
+			if err != nil {
+				break
+			}
+			if h.Type == dnsmessage.TypeSOA {
+				return h.Name.String(), nil
+			}
+			if err := section.skip(); err != nil {
+				return "", err
+			}
+		}
+	}
+	return "", fmt.Errorf("failed to determine the zone for %v", name)
+}
+
+// exchange sends msg to the server over TCP and returns its response.
+func (p *RFC2136Provider) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	buf := binary.BigEndian.AppendUint16(make([]byte, 0, len(msg)+2), uint16(len(msg))) //nolint:gosec // G115 messages are smaller than 64K
+	if _, err := conn.Write(append(buf, msg...)); err != nil {
+		return nil, err
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func newMessageID() uint16 {
+	var b [2]byte
+	_, _ = rand.Read(b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
+
+func tsigHash(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case TSIGHMACSHA256:
+		return sha256.New
+	case TSIGHMACSHA512:
+		return sha512.New
+	}
+	return nil
+}
+
+// appendWireName appends name, in uncompressed, canonical (lower case),
+// wire format to b.
+func appendWireName(b []byte, name string) []byte {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if len(name) > 0 {
+		for label := range strings.SplitSeq(name, ".") {
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0)
+}
+
+func appendUint48(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// sign appends a TSIG record, as per RFC 8945, to msg.
+func (p *RFC2136Provider) sign(msg []byte, id uint16, now time.Time) []byte {
+	signed := uint64(now.Unix()) //nolint:gosec // G115 time is positive
+	// The MAC is computed over the message followed by the TSIG variables.
+	vars := appendWireName(nil, p.opts.tsigKeyName)
+	vars = binary.BigEndian.AppendUint16(vars, uint16(dnsmessage.ClassANY))
+	vars = binary.BigEndian.AppendUint32(vars, 0) // TTL
+	vars = appendWireName(vars, p.opts.tsigAlgorithm)
+	vars = appendUint48(vars, signed)
+	vars = binary.BigEndian.AppendUint16(vars, tsigFudge)
+	vars = binary.BigEndian.AppendUint16(vars, 0) // Error
+	vars = binary.BigEndian.AppendUint16(vars, 0) // Other Len
+	mac := hmac.New(tsigHash(p.opts.tsigAlgorithm), p.opts.tsigSecret)
+	mac.Write(msg)
+	mac.Write(vars)
+	sum := mac.Sum(nil)
+
+	rdata := appendWireName(nil, p.opts.tsigAlgorithm)
+	rdata = appendUint48(rdata, signed)
+	rdata = binary.BigEndian.AppendUint16(rdata, tsigFudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(sum))) //nolint:gosec // G115 MACs are small
+	rdata = append(rdata, sum...)
+	rdata = binary.BigEndian.AppendUint16(rdata, id)
+	rdata = binary.BigEndian.AppendUint16(rdata, 0) // Error
+	rdata = binary.BigEndian.AppendUint16(rdata, 0) // Other Len
+
+	out := append([]byte(nil), msg...)
+	out = appendWireName(out, p.opts.tsigKeyName)
+	out = binary.BigEndian.AppendUint16(out, uint16(typeTSIG))
+	out = binary.BigEndian.AppendUint16(out, uint16(dnsmessage.ClassANY))
+	out = binary.BigEndian.AppendUint32(out, 0)                  // TTL
+	out = binary.BigEndian.AppendUint16(out, uint16(len(rdata))) //nolint:gosec // G115 rdata is small
+	out = append(out, rdata...)
+	// Increment the additional record count.
+	binary.BigEndian.PutUint16(out[10:12], binary.BigEndian.Uint16(out[10:12])+1)
+	return out
+}
@@ -0,0 +1,77 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package acme_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"cloudeng.io/webapp/webauth/acme"
+	"cloudeng.io/webapp/webauth/acme/pebble/pebbletest"
+)
+
+func TestRFC2136Provider(t *testing.T) {
+	ctx := t.Context()
+	secret := []byte("tsig-secret-for-testing")
+	dnsServer := pebbletest.StartDNSServer(ctx, t, "example.test", pebbletest.WithTSIGKey("acme-key", secret))
+	defer dnsServer.Close()
+
+	// The zone is determined by querying the server for the SOA record.
+	provider, err := acme.NewRFC2136Provider(dnsServer.Addr(), acme.WithTSIG("acme-key", acme.TSIGHMACSHA256, secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := acme.DNS01ChallengeName("*.www.example.test")
+	if got, want := name, "_acme-challenge.www.example.test."; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, v := range []string{"value-1", "value-2"} {
+		if err := provider.Present(ctx, name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := dnsServer.TXT(name), []string{"value-1", "value-2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := provider.CleanUp(ctx, name, "value-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dnsServer.TXT(name), []string{"value-2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Updates signed with the wrong key, or not at all, are rejected.
+	for _, opts := range [][]acme.RFC2136Option{
+		{acme.WithZone("example.test"), acme.WithTSIG("acme-key", "", []byte("wrong-secret"))},
+		{acme.WithZone("example.test"), acme.WithTSIG("other-key", "", secret)},
+		{acme.WithZone("example.test")},
+	} {
+		provider, err := acme.NewRFC2136Provider(dnsServer.Addr(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := provider.Present(ctx, name, "value-3"); err == nil {
+			t.Errorf("expected an error")
+		}
+	}
+	if got, want := dnsServer.TXT(name), []string{"value-2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Names outside of the zone are rejected.
+	provider, err = acme.NewRFC2136Provider(dnsServer.Addr(),
+		acme.WithZone("example.test"), acme.WithTSIG("acme-key", "", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Present(context.Background(), "_acme-challenge.other.test", "value"); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	if _, err := acme.NewRFC2136Provider(dnsServer.Addr(), acme.WithTSIG("k", "hmac-md5", secret)); err == nil {
+		t.Errorf("expected an error for an unsupported algorithm")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package acme_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloudeng.io/errors"
+	"cloudeng.io/logging"
+	"cloudeng.io/logging/ctxlog"
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/webauth/acme"
+	"cloudeng.io/webapp/webauth/acme/certcache"
+	"cloudeng.io/webapp/webauth/acme/pebble"
+	"cloudeng.io/webapp/webauth/acme/pebble/pebbletest"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestTLSALPN01Challenge(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	ctx = ctxlog.WithLogger(ctx, slog.New(slog.NewJSONHandler(logging.NewJSONFormatter(os.Stderr, "", "  "), &slog.HandlerOptions{AddSource: false})))
+
+	tmpDir := t.TempDir()
+
+	// The dns server resolves all hosts in example.com to 127.0.0.1.
+	dnsServer := pebbletest.StartDNSServer(ctx, t, "example.com")
+	defer dnsServer.Close()
+
+	pebbleServer, pebbleCfg, _, pebbleCacheDir, pebbleTestDir := pebbletest.Start(ctx, t, tmpDir,
+		pebbletest.WithServerOptions(pebble.WithNoSleep(), pebble.WithDNSServer(dnsServer.Addr())))
+	defer func() {
+		then := time.Now()
+		if err := pebbleServer.EnsureStopped(context.Background(), time.Second*5); err != nil {
+			t.Errorf("failed to stop pebble server after %v: %v", time.Since(then), err)
+		}
+	}()
+	lb, err := certcache.NewLocalStore(filepath.Join(pebbleCacheDir, "certs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := certcache.NewCachingStore(pebbleCacheDir, lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := acme.NewAutocertManager(cache, acme.AutocertConfig{
+		Provider: pebbleCfg.DirectoryURL(),
+	}, "pebble-test.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.Client.HTTPClient, err = webapp.NewHTTPClient(ctx,
+		webapp.WithCustomCAPEMFile(filepath.Join(pebbleTestDir, pebbleCfg.CAFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The manager's TLS server answers the challenges, note that no
+	// HTTP-01 handler is configured.
+	mgrListener, mgrServer, err := webapp.NewTLSServer(ctx, "127.0.0.1:0", nil, mgr.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server that the ACME service validates against proxies the
+	// challenges to the manager.
+	proxyListener, proxyServer, err := webapp.NewTLSServer(ctx, fmt.Sprintf(":%d", pebbleCfg.TLSPort), nil, &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return nil, fmt.Errorf("unexpected non-challenge handshake")
+		},
+		MinVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyListener = webapp.ProxyAcmeTLSALPN01(ctx, proxyListener, mgrListener.Addr().String())
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- webapp.ServeTLSWithShutdown(ctx, mgrListener, mgrServer, time.Second)
+	}()
+	go func() {
+		errCh <- webapp.ServeTLSWithShutdown(ctx, proxyListener, proxyServer, time.Second)
+	}()
+
+	cert, err := mgr.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:   "pebble-test.example.com",
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.VerifyHostname("pebble-test.example.com"); err != nil {
+		t.Errorf("hostname verification failed: %v", err)
+	}
+
+	cancel()
+	var errs errors.M
+	errs.Append(<-errCh)
+	errs.Append(<-errCh)
+	if err := errs.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetConfigForClient(t *testing.T) {
+	mgr, err := acme.NewAutocertManager(autocert.DirCache(t.TempDir()), acme.AutocertConfig{}, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &tls.Config{}
+	getConfig := mgr.GetConfigForClient(func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return next, nil
+	})
+	cfg, err := getConfig(&tls.ClientHelloInfo{SupportedProtos: []string{"h2", "http/1.1"}})
+	if err != nil || cfg != next {
+		t.Errorf("expected next config: %v, %v", cfg, err)
+	}
+	cfg, err = getConfig(&tls.ClientHelloInfo{SupportedProtos: []string{webapp.ACMETLSALPN01Proto}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg == next || len(cfg.NextProtos) != 1 || cfg.NextProtos[0] != webapp.ACMETLSALPN01Proto {
+		t.Errorf("expected a challenge config: %v", cfg.NextProtos)
+	}
+	if cfg, _ := mgr.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{}); cfg != nil {
+		t.Errorf("expected nil config for a non-challenge handshake")
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package mtls provides support for authenticating clients, typically
+// other services, using verified TLS client certificates, ie. mutual TLS.
+// The server's tls.Config must be configured to verify client
+// certificates, for example via webapp.ConfigureClientAuth or the
+// ClientCAFile and ClientAuth fields of webapp.TLSCertConfig.
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/webauth/permissions"
+)
+
+// Identity represents the identity asserted by a verified client
+// certificate.
+type Identity struct {
+	SPIFFEID    string            // The spiffe:// URI SAN, if any.
+	CommonName  string            // The subject's common name.
+	DNSNames    []string          // The DNS SANs.
+	Certificate *x509.Certificate // The verified leaf certificate.
+}
+
+// IdentityFromCertificate returns the Identity asserted by cert.
+func IdentityFromCertificate(cert *x509.Certificate) Identity {
+	id := Identity{
+		CommonName:  cert.Subject.CommonName,
+		DNSNames:    cert.DNSNames,
+		Certificate: cert,
+	}
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			id.SPIFFEID = u.String()
+			break
+		}
+	}
+	return id
+}
+
+// Names returns the names by which the identity is known in order of
+// precedence, namely the SPIFFE ID, the DNS SANs and the common name.
+func (id Identity) Names() []string {
+	var names []string
+	if len(id.SPIFFEID) > 0 {
+		names = append(names, id.SPIFFEID)
+	}
+	names = append(names, id.DNSNames...)
+	if len(id.CommonName) > 0 {
+		names = append(names, id.CommonName)
+	}
+	return names
+}
+
+// Mapper maps a verified client identity to the permissions granted to
+// it, returning false if the identity is not known.
+type Mapper func(ctx context.Context, id Identity) (permissions.Set, bool)
+
+// RoleMapper returns a Mapper that grants the permissions stored in roles
+// under the first of the identity's Names that is present in roles.
+func RoleMapper(roles map[string]permissions.Set) Mapper {
+	return func(_ context.Context, id Identity) (permissions.Set, bool) {
+		for _, name := range id.Names() {
+			if set, ok := roles[name]; ok {
+				return set, true
+			}
+		}
+		return permissions.Set{}, false
+	}
+}
+
+// ErrRevoked is returned by a RevocationChecker for a revoked certificate.
+var ErrRevoked = errors.New("client certificate has been revoked")
+
+// RevocationChecker returns an error that wraps ErrRevoked if the leaf
+// certificate of the verified chain has been revoked, or any other error
+// if its revocation status cannot be determined.
+type RevocationChecker func(ctx context.Context, chain []*x509.Certificate) error
+
+// RevokedSerials returns a RevocationChecker that reports certificates
+// with the specified serial numbers, formatted as per
+// webapp.SerialNumberHex, as revoked.
+func RevokedSerials(serials ...string) RevocationChecker {
+	revoked := slices.Clone(serials)
+	return func(_ context.Context, chain []*x509.Certificate) error {
+		serial := webapp.SerialNumberHex(chain[0].SerialNumber)
+		if slices.Contains(revoked, serial) {
+			return fmt.Errorf("serial %v: %w", serial, ErrRevoked)
+		}
+		return nil
+	}
+}
+
+// Option represents an option for NewHandler.
+type Option func(o *options)
+
+type options struct {
+	revocation     RevocationChecker
+	nowFunc        func() time.Time
+	rejectedMetric webapp.CounterVecInc
+}
+
+// WithRevocationChecker sets the RevocationChecker used to reject revoked
+// client certificates. Requests are rejected if the checker returns any
+// error.
+func WithRevocationChecker(checker RevocationChecker) Option {
+	return func(o *options) {
+		o.revocation = checker
+	}
+}
+
+// WithNowFunc sets the function used to obtain the current time when
+// checking certificate expiry. This is generally only required for
+// testing purposes.
+func WithNowFunc(fn func() time.Time) Option {
+	return func(o *options) {
+		o.nowFunc = fn
+	}
+}
+
+// WithRejectedMetric configures the handler to increment the provided
+// metric for every rejected request. The metric is incremented with the
+// labels returned by RejectedMetricsColumns.
+func WithRejectedMetric(metric webapp.CounterVecInc) Option {
+	return func(o *options) {
+		o.rejectedMetric = metric
+	}
+}
+
+// RejectedMetricsColumns returns the list of columns that will be used
+// for the rejected metric. Reason is populated with one of the values
+// returned by RejectedReasons.
+func RejectedMetricsColumns() []string {
+	return []string{"reason"}
+}
+
+const (
+	reasonMissing = "missing"
+	reasonExpired = "expired"
+	reasonRevoked = "revoked"
+	reasonUnknown = "unknown"
+)
+
+// RejectedReasons returns the list of values that will be used for the
+// "reason" label of the rejected metric: missing for requests without a
+// verified client certificate, expired, revoked, and unknown for
+// identities that the Mapper does not recognize.
+func RejectedReasons() []string {
+	return []string{reasonMissing, reasonExpired, reasonRevoked, reasonUnknown}
+}
+
+// NewHandler returns an http.Handler that authenticates requests using
+// the client's verified certificate chain and maps the client's Identity
+// to a permissions.Set using mapper. Requests without a verified client
+// certificate, or whose certificate chain has expired or been revoked,
+// are rejected with a 401 Unauthorized response and those whose identity
+// is not known to mapper with a 403 Forbidden response. Expiry is checked
+// on every request since connections may outlive the certificates used
+// to establish them. The Identity and permissions.Set for authenticated
+// requests are available to handler via IdentityFromContext and
+// PermissionsFromContext.
+func NewHandler(handler http.Handler, mapper Mapper, opts ...Option) http.Handler {
+	h := &mtlsHandler{
+		handler: handler,
+		mapper:  mapper,
+		opts: options{
+			nowFunc: time.Now,
+		},
+	}
+	for _, opt := range opts {
+		opt(&h.opts)
+	}
+	return h
+}
+
+type mtlsHandler struct {
+	opts    options
+	handler http.Handler
+	mapper  Mapper
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *mtlsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		h.reject(w, r, http.StatusUnauthorized, reasonMissing, nil)
+		return
+	}
+	chain := r.TLS.VerifiedChains[0]
+	now := h.opts.nowFunc()
+	for _, cert := range chain {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			h.reject(w, r, http.StatusUnauthorized, reasonExpired, fmt.Errorf("certificate %q is not valid at %v", cert.Subject, now))
+			return
+		}
+	}
+	if h.opts.revocation != nil {
+		if err := h.opts.revocation(ctx, chain); err != nil {
+			h.reject(w, r, http.StatusUnauthorized, reasonRevoked, err)
+			return
+		}
+	}
+	id := IdentityFromCertificate(chain[0])
+	set, ok := h.mapper(ctx, id)
+	if !ok {
+		h.reject(w, r, http.StatusForbidden, reasonUnknown, fmt.Errorf("unknown identity: %v", id.Names()))
+		return
+	}
+	ctx = context.WithValue(ctx, clientKey{}, client{id: id, permissions: set})
+	h.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (h *mtlsHandler) reject(w http.ResponseWriter, r *http.Request, status int, reason string, err error) {
+	if h.opts.rejectedMetric != nil {
+		h.opts.rejectedMetric(r.Context(), reason)
+	}
+	if err != nil {
+		ctxlog.Debug(r.Context(), "client certificate rejected", "remote_addr", r.RemoteAddr, "reason", reason, "error", err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+type clientKey struct{}
+
+type client struct {
+	id          Identity
+	permissions permissions.Set
+}
+
+// IdentityFromContext returns the Identity of the client authenticated
+// by the handler returned by NewHandler.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	c, ok := ctx.Value(clientKey{}).(client)
+	return c.id, ok
+}
+
+// PermissionsFromContext returns the permissions.Set granted to the
+// client authenticated by the handler returned by NewHandler.
+func PermissionsFromContext(ctx context.Context) (permissions.Set, bool) {
+	c, ok := ctx.Value(clientKey{}).(client)
+	return c.permissions, ok
+}
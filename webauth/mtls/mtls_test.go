@@ -0,0 +1,187 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package mtls_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp"
+	"cloudeng.io/webapp/webauth/mtls"
+	"cloudeng.io/webapp/webauth/permissions"
+)
+
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-client-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour * 24),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, serial: 1}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, uris ...string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, u := range uris {
+		pu, err := url.Parse(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.URIs = append(template.URIs, pu)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCA) writePEM(t *testing.T) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "client-ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func get(t *testing.T, srv *httptest.Server, certs ...tls.Certificate) (int, string) {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	client, err := webapp.NewHTTPClient(t.Context(),
+		webapp.WithCustomCAPool(roots),
+		webapp.WithClientCertificates(certs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestHandler(t *testing.T) {
+	ca := newTestCA(t)
+	spiffe := ca.issue(t, "ignored", "spiffe://example.com/service/a")
+	named := ca.issue(t, "service-b")
+	unknown := ca.issue(t, "service-c")
+	revoked := ca.issue(t, "service-b")
+	revokedLeaf, _ := x509.ParseCertificate(revoked.Certificate[0])
+
+	readSpec := permissions.Spec{Role: "reader", Method: "GET", Resource: "/", Action: "read"}
+	roles := map[string]permissions.Set{
+		"spiffe://example.com/service/a": {Permissions: []permissions.Spec{readSpec}},
+		"service-b":                      {Permissions: []permissions.Spec{readSpec}},
+	}
+
+	now := time.Now()
+	var rejected []string
+	handler := mtls.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := mtls.IdentityFromContext(r.Context())
+		set, _ := mtls.PermissionsFromContext(r.Context())
+		fmt.Fprintf(w, "%v:%v", id.Names()[0], set.Satisfies(readSpec))
+	}), mtls.RoleMapper(roles),
+		mtls.WithRevocationChecker(mtls.RevokedSerials(webapp.SerialNumberHex(revokedLeaf.SerialNumber))),
+		mtls.WithNowFunc(func() time.Time { return now }),
+		mtls.WithRejectedMetric(func(_ context.Context, labels ...string) {
+			rejected = append(rejected, labels...)
+		}))
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	if err := webapp.ConfigureClientAuth(srv.TLS, ca.writePEM(t), "verify-if-given"); err != nil {
+		t.Fatal(err)
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		certs  []tls.Certificate
+		status int
+		body   string
+	}{
+		{[]tls.Certificate{spiffe}, http.StatusOK, "spiffe://example.com/service/a:true"},
+		{[]tls.Certificate{named}, http.StatusOK, "service-b:true"},
+		{nil, http.StatusUnauthorized, ""},
+		{[]tls.Certificate{unknown}, http.StatusForbidden, ""},
+		{[]tls.Certificate{revoked}, http.StatusUnauthorized, ""},
+	} {
+		status, body := get(t, srv, tc.certs...)
+		if got, want := status, tc.status; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if tc.status == http.StatusOK && body != tc.body {
+			t.Errorf("got %v, want %v", body, tc.body)
+		}
+	}
+
+	// Certificates that expire whilst a connection is in use are rejected.
+	now = now.Add(time.Hour * 2)
+	if status, _ := get(t, srv, named); status != http.StatusUnauthorized {
+		t.Errorf("got %v, want %v", status, http.StatusUnauthorized)
+	}
+
+	if got, want := rejected, []string{"missing", "unknown", "revoked", "expired"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
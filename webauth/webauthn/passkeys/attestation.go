@@ -0,0 +1,108 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"cloudeng.io/webapp/jsonapi"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// ErrAttestationDenied is returned by an AttestationPolicy when a
+// credential's authenticator is not allowed to be registered.
+var ErrAttestationDenied = errors.New("authenticator not allowed by attestation policy")
+
+// AttestationResult records the outcome of applying an AttestationPolicy
+// to a newly registered credential, it is stored alongside the credential.
+type AttestationResult struct {
+	// AAGUID identifies the model of the authenticator and is formatted
+	// as a UUID.
+	AAGUID string `json:"aaguid"`
+	// Format is the attestation statement format, e.g. "packed".
+	Format string `json:"format,omitempty"`
+	// Description is the authenticator's description as obtained from
+	// its metadata.
+	Description string `json:"description,omitempty"`
+	// CertificationLevel is the authenticator's most recent FIDO
+	// certification status, e.g. "FIDO_CERTIFIED_L2".
+	CertificationLevel string `json:"certification_level,omitempty"`
+	// Verified is true if the attestation statement was verified against
+	// the trust anchors published for the authenticator.
+	Verified bool      `json:"verified"`
+	Checked  time.Time `json:"checked,omitzero"`
+}
+
+// AttestationPolicy is used to decide whether a newly created credential,
+// and hence the authenticator that holds it, may be registered for the
+// specified user. Implementations should return an error that wraps
+// ErrAttestationDenied for credentials that are not allowed, any other
+// error is treated as an internal error. The returned AttestationResult
+// is stored with the credential.
+type AttestationPolicy interface {
+	CheckAttestation(ctx context.Context, user *User, cred *webauthn.Credential) (AttestationResult, error)
+}
+
+// AttestationPolicyFunc is a function that implements AttestationPolicy, it
+// is convenient for applying a policy to a subset of users, e.g:
+//
+//	passkeys.AttestationPolicyFunc(func(ctx context.Context, user *passkeys.User, cred *webauthn.Credential) (passkeys.AttestationResult, error) {
+//		if !isAdmin(user) {
+//			return passkeys.AttestationResult{}, nil
+//		}
+//		return mdsPolicy.CheckAttestation(ctx, user, cred)
+//	})
+type AttestationPolicyFunc func(ctx context.Context, user *User, cred *webauthn.Credential) (AttestationResult, error)
+
+// CheckAttestation implements AttestationPolicy.
+func (f AttestationPolicyFunc) CheckAttestation(ctx context.Context, user *User, cred *webauthn.Credential) (AttestationResult, error) {
+	return f(ctx, user, cred)
+}
+
+// WithAttestationPolicy sets the policy used to check the attestation
+// statements of all newly registered credentials, including those added
+// to existing accounts and those created during account recovery.
+// Direct attestation is requested from authenticators when a policy is
+// set, this may be overridden using WithRegistrationOptions.
+func WithAttestationPolicy(policy AttestationPolicy) HandlerOption {
+	return func(o *options) {
+		o.attestationPolicy = policy
+	}
+}
+
+// checkAttestation applies the handler's attestation policy, if any, to
+// the supplied credential. It writes an error response and returns false
+// if the credential is not allowed.
+func (h *Handler) checkAttestation(rw http.ResponseWriter, r *http.Request, logger *slog.Logger, user *User, cred *webauthn.Credential) (*AttestationResult, bool) {
+	if h.opts.attestationPolicy == nil {
+		return nil, true
+	}
+	result, err := h.opts.attestationPolicy.CheckAttestation(r.Context(), user, cred)
+	if err != nil {
+		logger.Error("attestation policy check failed", "user_id", user.ID().String(), "aaguid", formatAAGUID(cred.Authenticator.AAGUID), "error", err.Error())
+		if errors.Is(err, ErrAttestationDenied) {
+			jsonapi.WriteErrorMsg(rw, "authenticator not allowed", http.StatusForbidden)
+			return nil, false
+		}
+		jsonapi.WriteErrorMsg(rw, "failed to check attestation", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &result, true
+}
+
+// setAttestation records the result of an attestation policy check for
+// the specified credential.
+func (u *User) setAttestation(id []byte, result *AttestationResult) {
+	if result == nil {
+		return
+	}
+	u.setMetadata(id, func(md *credentialMetadata) {
+		md.Attestation = result
+	})
+}
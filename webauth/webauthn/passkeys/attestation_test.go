@@ -0,0 +1,317 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webauth/webauthn/passkeys"
+	"github.com/go-webauthn/webauthn/metadata"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+type testCert struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCert(t *testing.T, subject pkix.Name, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	}
+	issuer, signer := tmpl, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{key: key, cert: cert}
+}
+
+func (tc *testCert) base64() string {
+	return base64.StdEncoding.EncodeToString(tc.cert.Raw)
+}
+
+// writeMetadataBLOB writes a metadata BLOB, signed as per the MDS3
+// specification, containing the supplied entries.
+func writeMetadataBLOB(t *testing.T, signer, intermediate *testCert, entries ...map[string]any) string {
+	t.Helper()
+	encode := func(v any) string {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(buf)
+	}
+	header := encode(map[string]any{
+		"alg": "ES256",
+		"typ": "JWT",
+		"x5c": []string{signer.base64(), intermediate.base64()},
+	})
+	payload := encode(map[string]any{
+		"legalHeader": "test",
+		"no":          1,
+		"nextUpdate":  time.Now().AddDate(0, 1, 0).Format(time.DateOnly),
+		"entries":     entries,
+	})
+	digest := sha256.Sum256([]byte(header + "." + payload))
+	r, s, err := ecdsa.Sign(rand.Reader, signer.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	filename := filepath.Join(t.TempDir(), "blob.jwt")
+	blob := header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+	if err := os.WriteFile(filename, []byte(blob), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func metadataEntry(aaguid uuid.UUID, description string, root *testCert, statuses ...string) map[string]any {
+	reports := []map[string]any{}
+	for i, status := range statuses {
+		reports = append(reports, map[string]any{
+			"status":        status,
+			"effectiveDate": time.Date(2025, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC).Format(time.DateOnly),
+		})
+	}
+	return map[string]any{
+		"aaguid": aaguid.String(),
+		"metadataStatement": map[string]any{
+			"aaguid":                      aaguid.String(),
+			"description":                 description,
+			"attestationTypes":            []string{"basic_full"},
+			"attestationRootCertificates": []string{root.base64()},
+		},
+		"statusReports":          reports,
+		"timeOfLastStatusChange": "2025-01-01",
+	}
+}
+
+// newAttestedCredential creates a credential with a packed attestation
+// statement signed by the supplied attestation certificate.
+func newAttestedCredential(t *testing.T, aaguid uuid.UUID, attestation *testCert) *webauthn.Credential {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdhKey, err := key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := ecdhKey.Bytes()
+	publicKey, err := webauthncbor.Marshal(map[int]any{1: 2, 3: -7, -1: 1, -2: point[1:33], -3: point[33:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte("hardware-key-" + aaguid.String())
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+	authData := append(rpIDHash[:], 0x41, 0, 0, 0, 0) // user present, attested credential data.
+	authData = append(authData, aaguid[:]...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, publicKey...)
+
+	clientData := []byte(`{"type":"webauthn.create","challenge":"dGVzdC1jaGFsbGVuZ2U","origin":"https://example.com"}`)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, attestation.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "packed",
+		"authData": authData,
+		"attStmt": map[string]any{
+			"alg": -7,
+			"sig": sig,
+			"x5c": []any{attestation.cert.Raw},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &webauthn.Credential{
+		ID:              id,
+		PublicKey:       publicKey,
+		AttestationType: "packed",
+		Authenticator:   webauthn.Authenticator{AAGUID: aaguid[:]},
+		Attestation: webauthn.CredentialAttestation{
+			ClientDataJSON:     clientData,
+			ClientDataHash:     clientDataHash[:],
+			AuthenticatorData:  authData,
+			PublicKeyAlgorithm: -7,
+			Object:             object,
+		},
+	}
+}
+
+func TestMetadataPolicy(t *testing.T) {
+	mdsRoot := newTestCert(t, pkix.Name{CommonName: "MDS Root"}, true, nil)
+	mdsIntermediate := newTestCert(t, pkix.Name{CommonName: "MDS Intermediate"}, true, mdsRoot)
+	mdsSigner := newTestCert(t, pkix.Name{CommonName: "MDS Signer"}, false, mdsIntermediate)
+
+	vendorRoot := newTestCert(t, pkix.Name{CommonName: "Vendor Root"}, true, nil)
+	attestationName := pkix.Name{
+		Country:            []string{"US"},
+		Organization:       []string{"Vendor"},
+		OrganizationalUnit: []string{"Authenticator Attestation"},
+		CommonName:         "Vendor Key",
+	}
+	vendorCert := newTestCert(t, attestationName, false, vendorRoot)
+	rogueCert := newTestCert(t, attestationName, false, newTestCert(t, pkix.Name{CommonName: "Rogue Root"}, true, nil))
+
+	certified, revoked, unknown := uuid.New(), uuid.New(), uuid.New()
+	filename := writeMetadataBLOB(t, mdsSigner, mdsIntermediate,
+		metadataEntry(certified, "Certified Key", vendorRoot, "FIDO_CERTIFIED_L1", "FIDO_CERTIFIED_L2"),
+		metadataEntry(revoked, "Revoked Key", vendorRoot, "FIDO_CERTIFIED_L2", "REVOKED"),
+	)
+
+	if _, err := passkeys.LoadMetadataBLOB(filename); err == nil {
+		t.Fatal("expected an error verifying against the default root")
+	}
+	md, err := passkeys.LoadMetadataBLOB(filename, metadata.WithRootCertificate(mdsRoot.base64()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := passkeys.NewMetadataPolicy(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	result, err := policy.CheckAttestation(ctx, nil, newAttestedCredential(t, certified, vendorCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Verified || result.AAGUID != certified.String() || result.Description != "Certified Key" || result.Format != "packed" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if got, want := result.CertificationLevel, "FIDO_CERTIFIED_L2"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	noAttestation := newAttestedCredential(t, certified, vendorCert)
+	noAttestation.AttestationType = "none"
+	for i, cred := range []*webauthn.Credential{
+		newAttestedCredential(t, revoked, vendorCert),
+		newAttestedCredential(t, unknown, vendorCert),
+		newAttestedCredential(t, certified, rogueCert),
+		noAttestation,
+	} {
+		if _, err := policy.CheckAttestation(ctx, nil, cred); !errors.Is(err, passkeys.ErrAttestationDenied) {
+			t.Errorf("%v: unexpected error: %v", i, err)
+		}
+	}
+
+	for i, opts := range [][]passkeys.MetadataPolicyOption{
+		{passkeys.WithMinimumCertificationLevel(metadata.FidoCertifiedL3)},
+		{passkeys.WithAllowedAAGUIDs(revoked.String())},
+		{passkeys.WithAllowedAAGUIDs(certified.String()), passkeys.WithDeniedAAGUIDs(certified.String())},
+	} {
+		policy, err := passkeys.NewMetadataPolicy(md, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := policy.CheckAttestation(ctx, nil, newAttestedCredential(t, certified, vendorCert)); !errors.Is(err, passkeys.ErrAttestationDenied) {
+			t.Errorf("%v: unexpected error: %v", i, err)
+		}
+	}
+
+	if _, err := passkeys.NewMetadataPolicy(md, passkeys.WithAllowedAAGUIDs("not-a-uuid")); err == nil {
+		t.Error("expected an error for an invalid AAGUID")
+	}
+	if _, err := passkeys.NewMetadataPolicy(md, passkeys.WithMinimumCertificationLevel(metadata.Revoked)); err == nil {
+		t.Error("expected an error for an invalid certification level")
+	}
+}
+
+func TestHandler_AttestationPolicy(t *testing.T) {
+	allow := false
+	policy := passkeys.AttestationPolicyFunc(func(_ context.Context, _ *passkeys.User, cred *webauthn.Credential) (passkeys.AttestationResult, error) {
+		if !allow {
+			return passkeys.AttestationResult{}, passkeys.ErrAttestationDenied
+		}
+		return passkeys.AttestationResult{Format: cred.AttestationType, Verified: true}, nil
+	})
+	db := passkeys.NewRAMUserDatabase()
+	handler := passkeys.NewHandler(&mockWebAuthn{}, db, db, &mockLoginManager{}, passkeys.WithAttestationPolicy(policy))
+
+	user, err := passkeys.NewUser("test@example.com", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	finish := func() int {
+		key, _, err := db.Registering(user, &webauthn.SessionData{UserID: user.WebAuthnID()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookie := &http.Cookie{Name: string(passkeys.RegistrationCookie), Value: key}
+		return credentialRequest(t, handler.FinishRegistration, nil, cookie).Code
+	}
+
+	if got, want := finish(), http.StatusForbidden; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := db.Lookup(user.ID()); !errors.Is(err, passkeys.ErrUserNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	allow = true
+	if got, want := finish(), http.StatusOK; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	stored, err := db.Lookup(user.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos := stored.Credentials()
+	if len(infos) != 1 || infos[0].Attestation == nil || !infos[0].Attestation.Verified || infos[0].Attestation.Format != "none" {
+		t.Errorf("unexpected credentials: %+v", infos)
+	}
+}
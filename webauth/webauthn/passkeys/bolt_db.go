@@ -0,0 +1,189 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltUsersBucket    = []byte("users")
+	boltSessionsBucket = []byte("sessions")
+	boltEmailsBucket   = []byte("emails")
+)
+
+// BoltUserDatabase is an implementation of UserDatabase, UserEmailLookup,
+// SessionManager and SessionExpirer that stores users and sessions in a single file
+// using the bbolt embedded key/value database. The file is locked for
+// exclusive use by a single process.
+type BoltUserDatabase struct {
+	persistentSessions
+	db *bolt.DB
+}
+
+// NewBoltUserDatabase opens, creating if necessary, the bbolt database
+// in filename and returns a BoltUserDatabase that uses it. It waits for
+// at most a second to obtain the lock on the database file.
+func NewBoltUserDatabase(filename string, opts ...StoreOption) (*BoltUserDatabase, error) {
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open passkeys database %q: %w", filename, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltUsersBucket, boltSessionsBucket, boltEmailsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize passkeys database %q: %w", filename, err)
+	}
+	bdb := &BoltUserDatabase{db: db}
+	bdb.persistentSessions = persistentSessions{
+		store: boltSessions{db: db},
+		opts:  newStoreOptions(opts),
+	}
+	return bdb, nil
+}
+
+// Close closes the underlying database.
+func (bdb *BoltUserDatabase) Close() error {
+	return bdb.db.Close()
+}
+
+// Store implements UserDatabase. The email index is updated in the same
+// transaction as the user so that the index and the users it refers to
+// are always consistent.
+func (bdb *BoltUserDatabase) Store(user *User) error {
+	data, err := encodeUser(user)
+	if err != nil {
+		return err
+	}
+	id := []byte(user.ID().String())
+	key := []byte(emailKey(user.email))
+	return bdb.db.Update(func(tx *bolt.Tx) error {
+		emails := tx.Bucket(boltEmailsBucket)
+		if owner := emails.Get(key); owner != nil && !bytes.Equal(owner, id) {
+			return ErrEmailInUse
+		}
+		prev, err := boltLookup(tx, id)
+		switch {
+		case err == nil:
+			// Remove the index entry for a previous email address.
+			if prevKey := []byte(emailKey(prev.email)); len(prevKey) > 0 && !bytes.Equal(prevKey, key) {
+				if err := emails.Delete(prevKey); err != nil {
+					return err
+				}
+			}
+		case !errors.Is(err, ErrUserNotFound):
+			return err
+		}
+		if err := tx.Bucket(boltUsersBucket).Put(id, data); err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			return nil
+		}
+		return emails.Put(key, id)
+	})
+}
+
+// Lookup implements UserDatabase.
+func (bdb *BoltUserDatabase) Lookup(uid UserID) (*User, error) {
+	var user *User
+	err := bdb.db.View(func(tx *bolt.Tx) error {
+		var err error
+		user, err = boltLookup(tx, []byte(uid.String()))
+		return err
+	})
+	return user, err
+}
+
+// LookupByEmail implements UserEmailLookup.
+func (bdb *BoltUserDatabase) LookupByEmail(email string) (*User, error) {
+	var user *User
+	err := bdb.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(boltEmailsBucket).Get([]byte(emailKey(email)))
+		if id == nil {
+			return ErrUserNotFound
+		}
+		var err error
+		user, err = boltLookup(tx, id)
+		return err
+	})
+	return user, err
+}
+
+func boltLookup(tx *bolt.Tx, id []byte) (*User, error) {
+	data := tx.Bucket(boltUsersBucket).Get(id)
+	if data == nil {
+		return nil, ErrUserNotFound
+	}
+	return decodeUser(data)
+}
+
+type boltSessions struct {
+	db *bolt.DB
+}
+
+func (bs boltSessions) putSession(key string, data []byte, expires time.Time) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSessionsBucket).Put([]byte(key), encodeExpiry(expires, data))
+	})
+}
+
+func (bs boltSessions) takeSession(key string) ([]byte, time.Time, error) {
+	var data []byte
+	var expires time.Time
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSessionsBucket)
+		buf := bucket.Get([]byte(key))
+		if buf == nil {
+			return ErrSessionNotFound
+		}
+		var err error
+		// buf is only valid for the life of the transaction.
+		expires, data, err = decodeExpiry(append([]byte(nil), buf...))
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(key))
+	})
+	return data, expires, err
+}
+
+func (bs boltSessions) deleteExpiredSessions(_ context.Context, now time.Time) (int, error) {
+	var n int
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSessionsBucket)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			if expires, _, err := decodeExpiry(v); err != nil || now.After(expires) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,407 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"cloudeng.io/webapp/jsonapi"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	// ErrCredentialNotFound is returned when a user does not have the
+	// requested credential.
+	ErrCredentialNotFound = errors.New("credential not found")
+	// ErrLastCredential is returned when an attempt is made to remove
+	// a user's only remaining credential.
+	ErrLastCredential = errors.New("cannot remove the last credential")
+)
+
+// CredentialInfo describes a user's credential (passkey) and the
+// authenticator that holds it.
+type CredentialInfo struct {
+	// ID is the base64.RawURLEncoding representation of the credential ID.
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// AAGUID identifies the model of the authenticator and is formatted
+	// as a UUID, it is all zeros if the authenticator chose not to
+	// identify itself.
+	AAGUID     string                            `json:"aaguid"`
+	Transports []protocol.AuthenticatorTransport `json:"transports,omitempty"`
+	Attachment protocol.AuthenticatorAttachment  `json:"attachment,omitempty"`
+	// BackupEligible and BackupState indicate whether the credential
+	// can be, and has been, synchronized across multiple devices.
+	BackupEligible bool      `json:"backup_eligible"`
+	BackupState    bool      `json:"backup_state"`
+	SignCount      uint32    `json:"sign_count"`
+	Created        time.Time `json:"created,omitzero"`
+	LastUsed       time.Time `json:"last_used,omitzero"`
+	// Attestation is the outcome of checking the credential's attestation
+	// statement when it was registered, it is nil if no AttestationPolicy
+	// was configured at that time.
+	Attestation *AttestationResult `json:"attestation,omitempty"`
+}
+
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return hex.EncodeToString(aaguid)
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", aaguid[0:4], aaguid[4:6], aaguid[6:8], aaguid[8:10], aaguid[10:16])
+}
+
+// Credentials returns information on all of the user's credentials.
+func (u *User) Credentials() []CredentialInfo {
+	infos := make([]CredentialInfo, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		md := u.metadata[credentialKey(c.ID)]
+		infos = append(infos, CredentialInfo{
+			ID:             credentialKey(c.ID),
+			Name:           md.Name,
+			AAGUID:         formatAAGUID(c.Authenticator.AAGUID),
+			Transports:     c.Transport,
+			Attachment:     c.Authenticator.Attachment,
+			BackupEligible: c.Flags.BackupEligible,
+			BackupState:    c.Flags.BackupState,
+			SignCount:      c.Authenticator.SignCount,
+			Created:        md.Created,
+			LastUsed:       md.LastUsed,
+			Attestation:    md.Attestation,
+		})
+	}
+	return infos
+}
+
+// LastAuthenticated returns the most recent time that any of the user's
+// credentials was used to authenticate, or the zero time if none have
+// been used.
+func (u *User) LastAuthenticated() time.Time {
+	var last time.Time
+	for _, md := range u.metadata {
+		if md.LastUsed.After(last) {
+			last = md.LastUsed
+		}
+	}
+	return last
+}
+
+func (u *User) credentialIndex(id []byte) int {
+	return slices.IndexFunc(u.credentials, func(c webauthn.Credential) bool {
+		return bytes.Equal(c.ID, id)
+	})
+}
+
+// RenameCredential sets the name of the specified credential, it returns
+// ErrCredentialNotFound if the user has no such credential.
+func (u *User) RenameCredential(id []byte, name string) error {
+	if u.credentialIndex(id) < 0 {
+		return ErrCredentialNotFound
+	}
+	u.setMetadata(id, func(md *credentialMetadata) {
+		md.Name = name
+	})
+	return nil
+}
+
+// RemoveCredential removes the specified credential, it returns
+// ErrCredentialNotFound if the user has no such credential and
+// ErrLastCredential if it is the user's only credential since removing
+// it would prevent the user from ever logging in again.
+func (u *User) RemoveCredential(id []byte) error {
+	idx := u.credentialIndex(id)
+	if idx < 0 {
+		return ErrCredentialNotFound
+	}
+	if len(u.credentials) == 1 {
+		return ErrLastCredential
+	}
+	u.credentials = slices.Delete(u.credentials, idx, idx+1)
+	delete(u.metadata, credentialKey(id))
+	return nil
+}
+
+func (u *User) credentialDescriptors() []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		descriptors = append(descriptors, c.Descriptor())
+	}
+	return descriptors
+}
+
+// authenticatedUser returns the currently logged in user, writing an error
+// response and returning false if there is no such user.
+func (h *Handler) authenticatedUser(rw http.ResponseWriter, r *http.Request, logger *slog.Logger) (*User, bool) {
+	uid, err := h.lm.AuthenticateUser(r)
+	if err != nil {
+		logger.Error("failed to authenticate user", "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to authenticate user", http.StatusUnauthorized)
+		return nil, false
+	}
+	user, err := h.um.Lookup(uid)
+	if err != nil {
+		logger.Error("failed to lookup user", "user_id", uid.String(), "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to lookup user", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+func credentialError(rw http.ResponseWriter, logger *slog.Logger, user *User, id string, err error) {
+	logger.Error("failed to update credential", "user_id", user.ID().String(), "credential_id", id, "error", err.Error())
+	switch {
+	case errors.Is(err, ErrCredentialNotFound):
+		jsonapi.WriteErrorMsg(rw, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrLastCredential):
+		jsonapi.WriteErrorMsg(rw, err.Error(), http.StatusConflict)
+	default:
+		jsonapi.WriteErrorMsg(rw, "invalid credential id", http.StatusBadRequest)
+	}
+}
+
+// ListCredentialsEndpoint represents the endpoint for listing the
+// credentials of the currently logged in user.
+var ListCredentialsEndpoint = jsonapi.Endpoint[struct{}, ListCredentialsResponse]{}
+
+// ListCredentialsResponse represents the response body for listing
+// a user's credentials.
+type ListCredentialsResponse struct {
+	Credentials []CredentialInfo `json:"credentials"`
+}
+
+// ListCredentials lists the credentials of the currently logged in user.
+func (h *Handler) ListCredentials(rw http.ResponseWriter, r *http.Request) {
+	logger := h.opts.logger.With("method", "ListCredentials")
+	user, ok := h.authenticatedUser(rw, r, logger)
+	if !ok {
+		return
+	}
+	resp := ListCredentialsResponse{Credentials: user.Credentials()}
+	if err := ListCredentialsEndpoint.WriteResponse(rw, resp); err != nil {
+		logger.Error("failed to write response", "error", err.Error())
+		return
+	}
+}
+
+// RenameCredentialEndpoint represents the endpoint for renaming one of
+// the currently logged in user's credentials. The response on success is
+// simply a http.StatusOK with an empty body.
+var RenameCredentialEndpoint = jsonapi.Endpoint[RenameCredentialRequest, struct{}]{}
+
+// RenameCredentialRequest represents the request body for renaming a
+// credential, the ID is as returned by ListCredentials.
+type RenameCredentialRequest struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RenameCredential renames one of the currently logged in user's
+// credentials.
+func (h *Handler) RenameCredential(rw http.ResponseWriter, r *http.Request) {
+	var req RenameCredentialRequest
+	logger := h.opts.logger.With("method", "RenameCredential")
+	if err := RenameCredentialEndpoint.ParseRequest(rw, r, &req); err != nil {
+		logger.Error("failed to parse request", "err", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to parse request", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.authenticatedUser(rw, r, logger)
+	if !ok {
+		return
+	}
+	id, err := base64.RawURLEncoding.DecodeString(req.ID)
+	if err == nil {
+		err = user.RenameCredential(id, req.Name)
+	}
+	if err != nil {
+		credentialError(rw, logger, user, req.ID, err)
+		return
+	}
+	if err := h.um.Store(user); err != nil {
+		logger.Error("failed to store user", "user_id", user.ID().String(), "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to store user", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("credential renamed", "user_id", user.ID().String(), "credential_id", req.ID, "name", req.Name)
+}
+
+// RevokeCredentialEndpoint represents the endpoint for revoking one of the
+// currently logged in user's credentials. The user's last remaining
+// credential cannot be revoked. The response on success is simply a
+// http.StatusOK with an empty body.
+var RevokeCredentialEndpoint = jsonapi.Endpoint[RevokeCredentialRequest, struct{}]{}
+
+// RevokeCredentialRequest represents the request body for revoking a
+// credential, the ID is as returned by ListCredentials.
+type RevokeCredentialRequest struct {
+	ID string `json:"id"`
+}
+
+// RevokeCredential revokes one of the currently logged in user's
+// credentials, it fails with http.StatusConflict if the credential is
+// the user's last remaining one.
+func (h *Handler) RevokeCredential(rw http.ResponseWriter, r *http.Request) {
+	var req RevokeCredentialRequest
+	logger := h.opts.logger.With("method", "RevokeCredential")
+	if err := RevokeCredentialEndpoint.ParseRequest(rw, r, &req); err != nil {
+		logger.Error("failed to parse request", "err", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to parse request", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.authenticatedUser(rw, r, logger)
+	if !ok {
+		return
+	}
+	id, err := base64.RawURLEncoding.DecodeString(req.ID)
+	if err == nil {
+		err = user.RemoveCredential(id)
+	}
+	if err != nil {
+		credentialError(rw, logger, user, req.ID, err)
+		return
+	}
+	if err := h.um.Store(user); err != nil {
+		logger.Error("failed to store user", "user_id", user.ID().String(), "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to store user", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("credential revoked", "user_id", user.ID().String(), "credential_id", req.ID)
+}
+
+// BeginAddCredentialEndpoint represents the endpoint for beginning the
+// process of adding a new credential, typically for a new device, to the
+// currently logged in user's account. The user must have authenticated
+// using a passkey, for the current session, within the re-authentication
+// window configured via WithReauthenticationWindow, which requires that
+// the LoginManager implement AuthenticationTimer.
+var BeginAddCredentialEndpoint = jsonapi.Endpoint[struct{}, *protocol.PublicKeyCredentialCreationOptions]{}
+
+// BeginAddCredential starts the process of adding a new credential to the
+// currently logged in user's account. The user's existing credentials are
+// excluded so that an authenticator cannot be registered twice.
+func (h *Handler) BeginAddCredential(rw http.ResponseWriter, r *http.Request) {
+	logger := h.opts.logger.With("method", "BeginAddCredential")
+	user, ok := h.authenticatedUser(rw, r, logger)
+	if !ok {
+		return
+	}
+	timer, ok := h.lm.(AuthenticationTimer)
+	if !ok {
+		logger.Error("login manager does not implement AuthenticationTimer", "user_id", user.ID().String())
+		jsonapi.WriteErrorMsg(rw, "re-authentication required", http.StatusUnauthorized)
+		return
+	}
+	authTime, err := timer.AuthenticationTime(r)
+	if err != nil {
+		logger.Error("failed to determine authentication time", "user_id", user.ID().String(), "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "re-authentication required", http.StatusUnauthorized)
+		return
+	}
+	if time.Since(authTime) > h.opts.reauthWindow {
+		logger.Error("re-authentication required", "user_id", user.ID().String(), "authenticated", authTime)
+		jsonapi.WriteErrorMsg(rw, "re-authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	creds, ok := h.beginCredentialRegistration(rw, logger, user)
+	if !ok {
+		return
+	}
+	if err := BeginAddCredentialEndpoint.WriteResponse(rw, &creds.Response); err != nil {
+		logger.Error("failed to write response", "error", err.Error())
+		return
+	}
+	logger.Info("add credential started", "user_id", user.ID().String(), "webauthn_name", user.WebAuthnName())
+}
+
+// beginCredentialRegistration begins the registration of an additional
+// credential for an existing user, excluding the user's existing credentials
+// and setting the RegistrationCookie. It writes an error response and
+// returns false on failure.
+func (h *Handler) beginCredentialRegistration(rw http.ResponseWriter, logger *slog.Logger, user *User) (*protocol.CredentialCreation, bool) {
+	opts := append(slices.Clone(h.opts.registrationOptions), webauthn.WithExclusions(user.credentialDescriptors()))
+	creds, session, err := h.w.BeginMediatedRegistration(user, h.opts.mediationRequirement, opts...)
+	if err != nil {
+		logger.Error("failed to begin mediated registration", "err", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to begin mediated registration", http.StatusInternalServerError)
+		return nil, false
+	}
+	tmpKey, _, err := h.sm.Registering(user, session)
+	if err != nil {
+		logger.Error("failed to begin registration", "err", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to begin registration", http.StatusInternalServerError)
+		return nil, false
+	}
+	RegistrationCookie.Set(rw, h.opts.sessionCookie.Cookie(tmpKey))
+	return creds, true
+}
+
+// FinishAddCredentialEndpoint represents the endpoint for finishing the
+// process of adding a new credential. It expects a request with a JSON
+// body containing the verification data as expected by the
+// webauthn.FinishRegistration method. The response on success is simply
+// a http.StatusOK with an empty body. Strictly speaking this variable is
+// not used but serves to document the endpoint.
+var FinishAddCredentialEndpoint = jsonapi.Endpoint[struct{}, struct{}]{}
+
+// FinishAddCredential completes the process of adding a new credential to
+// the currently logged in user's account.
+func (h *Handler) FinishAddCredential(rw http.ResponseWriter, r *http.Request) {
+	logger := h.opts.logger.With("method", "FinishAddCredential")
+
+	sessionKey, ok := RegistrationCookie.ReadAndClear(rw, r)
+	if !ok {
+		logger.Error("missing registration cookie")
+		jsonapi.WriteErrorMsg(rw, "missing registration cookie", http.StatusBadRequest)
+		return
+	}
+	user, ok := h.authenticatedUser(rw, r, logger)
+	if !ok {
+		return
+	}
+	sessionUser, sessionData, err := h.sm.Registered(sessionKey)
+	if err != nil {
+		logger.Error("failed to retrieve session data", "session_key", sessionKey, "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to retrieve session data", http.StatusInternalServerError)
+		return
+	}
+	if sessionUser == nil || sessionData == nil || !bytes.Equal(sessionUser.WebAuthnID(), user.WebAuthnID()) {
+		logger.Error("invalid session data", "session_key", sessionKey, "user_id", user.ID().String())
+		jsonapi.WriteErrorMsg(rw, "invalid session data", http.StatusBadRequest)
+		return
+	}
+
+	cred, err := h.w.FinishRegistration(user, *sessionData, r)
+	if err != nil {
+		logger.Error("failed to finish registration", "error", err.Error(), webauthError(err))
+		jsonapi.WriteErrorMsg(rw, "failed to finish registration", http.StatusBadRequest)
+		return
+	}
+	if user.credentialIndex(cred.ID) >= 0 {
+		logger.Error("credential already registered", "user_id", user.ID().String(), "credential_id", credentialKey(cred.ID))
+		jsonapi.WriteErrorMsg(rw, "credential already registered", http.StatusConflict)
+		return
+	}
+	attestation, ok := h.checkAttestation(rw, r, logger, user, cred)
+	if !ok {
+		return
+	}
+	user.AddCredential(*cred)
+	user.setAttestation(cred.ID, attestation)
+	if err := h.um.Store(user); err != nil {
+		logger.Error("failed to store user", "user_id", user.ID().String(), "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to store user", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("credential added", "user_id", user.ID().String(), "credential_id", credentialKey(cred.ID))
+}
@@ -0,0 +1,239 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloudeng.io/webapp/webauth/webauthn/passkeys"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func TestUser_CredentialMetadata(t *testing.T) {
+	user, err := passkeys.NewUser("test@example.com", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone, laptop := []byte("phone"), []byte("laptop")
+	user.AddCredential(webauthn.Credential{ID: phone})
+	user.AddCredential(webauthn.Credential{ID: laptop})
+
+	if !user.LastAuthenticated().IsZero() {
+		t.Errorf("unexpected last authenticated time: %v", user.LastAuthenticated())
+	}
+	if !user.UpdateCredential(webauthn.Credential{ID: phone}) {
+		t.Fatal("failed to update credential")
+	}
+	if user.LastAuthenticated().IsZero() {
+		t.Errorf("last authenticated time was not set")
+	}
+
+	if err := user.RenameCredential(laptop, "my laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.RenameCredential([]byte("tablet"), "my tablet"); !errors.Is(err, passkeys.ErrCredentialNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	infos := user.Credentials()
+	if got, want := len(infos), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := infos[1].Name, "my laptop"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if infos[0].Created.IsZero() || infos[0].LastUsed.IsZero() || !infos[1].LastUsed.IsZero() {
+		t.Errorf("unexpected times: %+v", infos)
+	}
+
+	if err := user.RemoveCredential(phone); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.RemoveCredential(phone); !errors.Is(err, passkeys.ErrCredentialNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := user.RemoveCredential(laptop); !errors.Is(err, passkeys.ErrLastCredential) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got, want := len(user.WebAuthnCredentials()), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func credentialRequest(t *testing.T, fn http.HandlerFunc, body any, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest("POST", "/credentials", &buf)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	fn(rec, req)
+	return rec
+}
+
+func TestHandler_ManageCredentials(t *testing.T) {
+	db := passkeys.NewRAMUserDatabase()
+	lm := &mockLoginManager{}
+	handler := passkeys.NewHandler(&mockWebAuthn{}, db, db, lm)
+
+	user, err := passkeys.NewUser("test@example.com", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aaguid := []byte{0xea, 0x9b, 0x8d, 0x66, 0x4d, 0x01, 0x1d, 0x21, 0x3c, 0xe4, 0xb6, 0xb4, 0x8c, 0xb5, 0x75, 0xd4}
+	user.AddCredential(webauthn.Credential{
+		ID:        []byte("phone"),
+		Transport: []protocol.AuthenticatorTransport{protocol.Internal, protocol.Hybrid},
+		Flags:     webauthn.CredentialFlags{BackupEligible: true, BackupState: true},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:     aaguid,
+			Attachment: protocol.Platform,
+		},
+	})
+	user.AddCredential(webauthn.Credential{ID: []byte("key")})
+	if err := db.Store(user); err != nil {
+		t.Fatal(err)
+	}
+	lm.authenticatedUserID = user.ID()
+
+	list := func() []passkeys.CredentialInfo {
+		rec := credentialRequest(t, handler.ListCredentials, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+		}
+		var resp passkeys.ListCredentialsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Credentials
+	}
+
+	creds := list()
+	if got, want := len(creds), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	phone := creds[0]
+	if got, want := phone.ID, base64.RawURLEncoding.EncodeToString([]byte("phone")); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := phone.AAGUID, "ea9b8d66-4d01-1d21-3ce4-b6b48cb575d4"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(phone.Transports) != 2 || phone.Attachment != protocol.Platform || !phone.BackupEligible || !phone.BackupState || phone.Created.IsZero() {
+		t.Errorf("unexpected credential info: %+v", phone)
+	}
+
+	rec := credentialRequest(t, handler.RenameCredential, passkeys.RenameCredentialRequest{ID: phone.ID, Name: "my phone"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	if got, want := list()[0].Name, "my phone"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	rec = credentialRequest(t, handler.RenameCredential, passkeys.RenameCredentialRequest{ID: "unknown", Name: "x"})
+	if got, want := rec.Code, http.StatusNotFound; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	rec = credentialRequest(t, handler.RevokeCredential, passkeys.RevokeCredentialRequest{ID: creds[1].ID})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	rec = credentialRequest(t, handler.RevokeCredential, passkeys.RevokeCredentialRequest{ID: phone.ID})
+	if got, want := rec.Code, http.StatusConflict; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(list()), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHandler_AddCredential(t *testing.T) {
+	db := passkeys.NewRAMUserDatabase()
+	lm := &mockLoginManager{}
+	handler := passkeys.NewHandler(&mockWebAuthn{}, db, db, lm)
+
+	user, err := passkeys.NewUser("test@example.com", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.AddCredential(webauthn.Credential{ID: []byte("phone")})
+	if err := db.Store(user); err != nil {
+		t.Fatal(err)
+	}
+	lm.authenticatedUserID = user.ID()
+
+	// The user has not recently authenticated using a passkey.
+	rec := credentialRequest(t, handler.BeginAddCredential, nil)
+	if got, want := rec.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Authenticating using a passkey in another session is not sufficient.
+	user.UpdateCredential(webauthn.Credential{ID: []byte("phone")})
+	if err := db.Store(user); err != nil {
+		t.Fatal(err)
+	}
+	rec = credentialRequest(t, handler.BeginAddCredential, nil)
+	if got, want := rec.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := lm.UserAuthenticated(nil, nil, user.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A LoginManager that does not implement AuthenticationTimer cannot
+	// be used to add credentials.
+	noTimer := passkeys.NewHandler(&mockWebAuthn{}, db, db, struct{ passkeys.LoginManager }{lm})
+	rec = credentialRequest(t, noTimer.BeginAddCredential, nil)
+	if got, want := rec.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	rec = credentialRequest(t, handler.BeginAddCredential, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	var registrationCookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == string(passkeys.RegistrationCookie) {
+			registrationCookie = c
+		}
+	}
+	if registrationCookie == nil {
+		t.Fatal("registration cookie not set")
+	}
+
+	rec = credentialRequest(t, handler.FinishAddCredential, nil, registrationCookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	stored, err := db.Lookup(user.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(stored.WebAuthnCredentials()), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The session can only be used once.
+	rec = credentialRequest(t, handler.FinishAddCredential, nil, registrationCookie)
+	if got, want := rec.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloudeng.io/webapp/jsonapi"
+	"cloudeng.io/webapp/webauth/jwtutil"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// DefaultEmailTokenTTL is the default period for which the links sent in
+// email verification and account recovery messages are valid.
+const DefaultEmailTokenTTL = 10 * time.Minute
+
+const (
+	emailVerificationSubject = "email-verification"
+	accountRecoverySubject   = "account-recovery"
+	emailTokenAudience       = "webauthn"
+	emailClaim               = "email"
+	recoveryClaim            = "recovery"
+)
+
+// WithMailer sets the Mailer used to send email verification and account
+// recovery messages and the Signer used to sign, and subsequently
+// validate, the tokens contained in the links that they contain. The
+// issuer is included in, and required of, all such tokens.
+func WithMailer(mailer Mailer, signer jwtutil.Signer, issuer string) HandlerOption {
+	return func(o *options) {
+		o.mailer = mailer
+		o.tokenSigner = signer
+		o.tokenIssuer = issuer
+	}
+}
+
+// WithEmailVerification requires that users verify their email address
+// before registering a passkey. SendVerificationEmail sends a link to
+// verificationURL with a signed token appended as the "token" query
+// parameter, this token must be supplied to BeginRegistration along with
+// the email address it was sent to. WithMailer must also be specified.
+func WithEmailVerification(verificationURL string) HandlerOption {
+	return func(o *options) {
+		o.verificationURL = verificationURL
+	}
+}
+
+// WithAccountRecovery enables account recovery for users who have lost
+// their passkeys. SendRecoveryEmail sends a single-use link to recoveryURL
+// with a signed token appended as the "token" query parameter, this token
+// must be supplied to BeginRecovery in order to register a new passkey.
+// WithMailer and WithEmailVerification must also be specified and the
+// UserDatabase must implement UserEmailLookup. Recovery links are only
+// sent to users whose email address was verified when they registered.
+func WithAccountRecovery(recoveryURL string) HandlerOption {
+	return func(o *options) {
+		o.recoveryURL = recoveryURL
+	}
+}
+
+// WithEmailTokenTTL sets the period for which the links sent in email
+// verification and account recovery messages are valid, the default is
+// DefaultEmailTokenTTL. Note that recovery links are also limited by
+// the time-to-live of the sessions maintained by the SessionManager.
+func WithEmailTokenTTL(ttl time.Duration) HandlerOption {
+	return func(o *options) {
+		o.emailTokenTTL = ttl
+	}
+}
+
+func (h *Handler) emailEnabled(rw http.ResponseWriter, logger *slog.Logger, url string) bool {
+	if len(url) == 0 || h.opts.mailer == nil || h.opts.tokenSigner == nil {
+		logger.Error("email verification or account recovery is not configured")
+		jsonapi.WriteErrorMsg(rw, "not configured", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+// recoveryEnabled returns true if account recovery is configured, which
+// requires that email verification is also enabled.
+func (h *Handler) recoveryEnabled(rw http.ResponseWriter, logger *slog.Logger) bool {
+	if len(h.opts.recoveryURL) > 0 && len(h.opts.verificationURL) == 0 {
+		logger.Error("account recovery requires email verification")
+		jsonapi.WriteErrorMsg(rw, "not configured", http.StatusNotImplemented)
+		return false
+	}
+	return h.emailEnabled(rw, logger, h.opts.recoveryURL)
+}
+
+// sendTokenEmail sends msg with a link to baseURL, containing a token with
+// the specified subject and claim, appended to its body.
+func (h *Handler) sendTokenEmail(ctx context.Context, msg Message, baseURL, subject, claimKey, claimValue string) error {
+	token, err := jwtutil.CreateVerificationToken(ctx, h.opts.tokenSigner, subject, claimKey, claimValue, h.opts.emailTokenTTL, h.opts.tokenIssuer, emailTokenAudience)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	url, err := jwtutil.VerificationURL(baseURL, token)
+	if err != nil {
+		return fmt.Errorf("failed to create url: %w", err)
+	}
+	msg.Body = fmt.Sprintf("%s, it is valid for %v:\n\n%s\n", msg.Body, h.opts.emailTokenTTL, url)
+	msg.URL = url
+	return h.opts.mailer.Send(ctx, msg)
+}
+
+func (h *Handler) validateEmailToken(ctx context.Context, token, subject, claimKey string) (string, error) {
+	var value string
+	if err := jwtutil.ValidateVerificationToken(ctx, h.opts.tokenSigner, token, subject, h.opts.tokenIssuer, emailTokenAudience, claimKey, &value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// lookupByEmail returns the user with the specified email address if the
+// UserDatabase implements UserEmailLookup, and if not, it returns
+// ErrUserNotFound.
+func (h *Handler) lookupByEmail(email string) (*User, error) {
+	if el, ok := h.um.(UserEmailLookup); ok {
+		return el.LookupByEmail(email)
+	}
+	return nil, ErrUserNotFound
+}
+
+// checkVerifiedEmail checks that the email address in a registration
+// request has been verified and is not already registered, it returns
+// the http status and message to be returned to the client on failure.
+func (h *Handler) checkVerifiedEmail(ctx context.Context, req BeginRegistrationRequest) (int, string, error) {
+	email, err := h.validateEmailToken(ctx, req.Token, emailVerificationSubject, emailClaim)
+	if err != nil {
+		return http.StatusUnauthorized, "invalid email verification token", err
+	}
+	if !strings.EqualFold(email, req.Email) {
+		return http.StatusUnauthorized, "invalid email verification token", fmt.Errorf("token is for %q and not %q", email, req.Email)
+	}
+	_, err = h.lookupByEmail(req.Email)
+	switch {
+	case err == nil:
+		return http.StatusConflict, "user already registered", fmt.Errorf("user %q already registered", req.Email)
+	case !errors.Is(err, ErrUserNotFound):
+		return http.StatusInternalServerError, "failed to lookup user", err
+	}
+	return http.StatusOK, "", nil
+}
+
+// EmailRequest represents the request body for requesting an email
+// verification or account recovery message.
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// SendVerificationEmailEndpoint represents the endpoint for requesting
+// an email verification message. The response on success is simply a
+// http.StatusOK with an empty body.
+var SendVerificationEmailEndpoint = jsonapi.Endpoint[EmailRequest, struct{}]{}
+
+// SendVerificationEmail sends an email containing a link that can be used
+// to register a passkey to the requested address, see WithEmailVerification.
+// If the address is already registered a message suggesting account
+// recovery is sent instead. The response does not reveal whether the
+// address is already registered.
+func (h *Handler) SendVerificationEmail(rw http.ResponseWriter, r *http.Request) {
+	var req EmailRequest
+	logger := h.opts.logger.With("method", "SendVerificationEmail")
+	if !h.emailEnabled(rw, logger, h.opts.verificationURL) {
+		return
+	}
+	if err := SendVerificationEmailEndpoint.ParseRequest(rw, r, &req); err != nil {
+		logger.Error("failed to parse request", "err", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to parse request", http.StatusBadRequest)
+		return
+	}
+	if h.opts.emailValidator != nil {
+		if err := h.opts.emailValidator.Validate(req.Email); err != nil {
+			logger.Error("invalid email address", "email", req.Email, "err", err.Error())
+			jsonapi.WriteErrorMsg(rw, "invalid email address", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	msg := Message{To: req.Email, Subject: "Verify your email address"}
+	var err error
+	if _, lerr := h.lookupByEmail(req.Email); lerr == nil {
+		msg.Body = "A passkey has already been registered for this email address, use account recovery if you no longer have access to it.\n"
+		err = h.opts.mailer.Send(ctx, msg)
+	} else {
+		msg.Body = "Use the following link to verify your email address and register a passkey"
+		err = h.sendTokenEmail(ctx, msg, h.opts.verificationURL, emailVerificationSubject, emailClaim, req.Email)
+	}
+	if err != nil {
+		logger.Error("failed to send verification email", "email", req.Email, "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("verification email sent", "email", req.Email)
+}
+
+// SendRecoveryEmailEndpoint represents the endpoint for requesting an
+// account recovery message. The response on success is simply a
+// http.StatusOK with an empty body.
+var SendRecoveryEmailEndpoint = jsonapi.Endpoint[EmailRequest, struct{}]{}
+
+// SendRecoveryEmail sends an email containing a single-use link that can
+// be used to register a new passkey for an existing user, see
+// WithAccountRecovery. The response does not reveal whether a user with
+// the requested email address exists.
+func (h *Handler) SendRecoveryEmail(rw http.ResponseWriter, r *http.Request) {
+	var req EmailRequest
+	logger := h.opts.logger.With("method", "SendRecoveryEmail")
+	if !h.recoveryEnabled(rw, logger) {
+		return
+	}
+	if err := SendRecoveryEmailEndpoint.ParseRequest(rw, r, &req); err != nil {
+		logger.Error("failed to parse request", "err", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to parse request", http.StatusBadRequest)
+		return
+	}
+	user, err := h.lookupByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			logger.Info("recovery requested for unknown user", "email", req.Email)
+			return
+		}
+		logger.Error("failed to lookup user", "email", req.Email, "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to lookup user", http.StatusInternalServerError)
+		return
+	}
+	if !user.emailVerified {
+		logger.Info("recovery requested for user with an unverified email address", "user_id", user.ID().String(), "email", req.Email)
+		return
+	}
+	// The session key is used to make the recovery link single-use.
+	recoveryKey, _, err := h.sm.Registering(user, &webauthn.SessionData{UserID: user.WebAuthnID()})
+	if err != nil {
+		logger.Error("failed to begin recovery", "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to begin recovery", http.StatusInternalServerError)
+		return
+	}
+	msg := Message{
+		To:      req.Email,
+		Subject: "Recover your account",
+		Body:    "Use the following link to register a new passkey for your account",
+	}
+	if err := h.sendTokenEmail(r.Context(), msg, h.opts.recoveryURL, accountRecoverySubject, recoveryClaim, recoveryKey); err != nil {
+		logger.Error("failed to send recovery email", "email", req.Email, "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to send recovery email", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("recovery email sent", "user_id", user.ID().String(), "email", req.Email)
+}
+
+// BeginRecoveryEndpoint represents the endpoint for beginning the
+// registration of a new passkey using the token from an account recovery
+// link. The registration is completed using FinishRegistration.
+var BeginRecoveryEndpoint = jsonapi.Endpoint[BeginRecoveryRequest, *protocol.PublicKeyCredentialCreationOptions]{}
+
+// BeginRecoveryRequest represents the request body for beginning account
+// recovery, the token is the "token" query parameter from the recovery
+// link.
+type BeginRecoveryRequest struct {
+	Token string `json:"token"`
+}
+
+// BeginRecovery starts the registration of a new passkey for the user
+// identified by an account recovery link, each link may be used only
+// once. The client should use FinishRegistration to complete the
+// registration.
+func (h *Handler) BeginRecovery(rw http.ResponseWriter, r *http.Request) {
+	var req BeginRecoveryRequest
+	logger := h.opts.logger.With("method", "BeginRecovery")
+	if !h.recoveryEnabled(rw, logger) {
+		return
+	}
+	if err := BeginRecoveryEndpoint.ParseRequest(rw, r, &req); err != nil {
+		logger.Error("failed to parse request", "err", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to parse request", http.StatusBadRequest)
+		return
+	}
+	recoveryKey, err := h.validateEmailToken(r.Context(), req.Token, accountRecoverySubject, recoveryClaim)
+	if err != nil {
+		logger.Error("invalid recovery token", "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "invalid recovery token", http.StatusUnauthorized)
+		return
+	}
+	sessionUser, _, err := h.sm.Registered(recoveryKey)
+	if err != nil || sessionUser == nil {
+		logger.Error("recovery link has expired or has already been used", "error", err)
+		jsonapi.WriteErrorMsg(rw, "recovery link has expired or has already been used", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.um.Lookup(sessionUser.ID())
+	if err != nil {
+		logger.Error("failed to lookup user", "user_id", sessionUser.ID().String(), "error", err.Error())
+		jsonapi.WriteErrorMsg(rw, "failed to lookup user", http.StatusInternalServerError)
+		return
+	}
+	creds, ok := h.beginCredentialRegistration(rw, logger, user)
+	if !ok {
+		return
+	}
+	if err := BeginRecoveryEndpoint.WriteResponse(rw, &creds.Response); err != nil {
+		logger.Error("failed to write response", "error", err.Error())
+		return
+	}
+	logger.Info("recovery started", "user_id", user.ID().String(), "webauthn_name", user.WebAuthnName())
+}
@@ -0,0 +1,215 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"cloudeng.io/webapp/webauth/jwtutil"
+	"cloudeng.io/webapp/webauth/webauthn/passkeys"
+)
+
+func newEmailTestHandler(t *testing.T, db *passkeys.RAMUserDatabase, opts ...passkeys.HandlerOption) (*passkeys.Handler, *passkeys.RAMMailer) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jwtutil.NewED25519Signer(priv, "email-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailer := passkeys.NewRAMMailer()
+	opts = append(opts, passkeys.WithMailer(mailer, signer, "test-issuer"))
+	return passkeys.NewHandler(&mockWebAuthn{}, db, db, &mockLoginManager{}, opts...), mailer
+}
+
+func tokenFromMessage(t *testing.T, msg passkeys.Message, prefix string) string {
+	t.Helper()
+	if !strings.HasPrefix(msg.URL, prefix) || !strings.Contains(msg.Body, msg.URL) {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	u, err := url.Parse(msg.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("token")
+}
+
+func TestHandler_EmailVerification(t *testing.T) {
+	db := passkeys.NewRAMUserDatabase()
+	handler, mailer := newEmailTestHandler(t, db,
+		passkeys.WithEmailVerification("https://example.com/verify?source=email"))
+
+	register := func(email, token string) int {
+		req := passkeys.BeginRegistrationRequest{Email: email, DisplayName: "Test User", Token: token}
+		return credentialRequest(t, handler.BeginRegistration, req).Code
+	}
+
+	if got, want := register("test@example.com", ""), http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	rec := credentialRequest(t, handler.SendVerificationEmail, passkeys.EmailRequest{Email: "test@example.com"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	msgs := mailer.Messages()
+	if got, want := len(msgs), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := msgs[0].To, "test@example.com"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	token := tokenFromMessage(t, msgs[0], "https://example.com/verify?")
+
+	if got, want := register("other@example.com", token), http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := register("test@example.com", token+"x"), http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := register("Test@Example.com", token), http.StatusOK; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Email addresses can only be registered once.
+	user, err := passkeys.NewUser("test@example.com", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Store(user); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := register("test@example.com", token), http.StatusConflict; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	rec = credentialRequest(t, handler.SendVerificationEmail, passkeys.EmailRequest{Email: "test@example.com"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	msgs = mailer.Messages()
+	if got, want := len(msgs), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if msgs[1].URL != "" || !strings.Contains(msgs[1].Body, "account recovery") {
+		t.Errorf("unexpected message: %+v", msgs[1])
+	}
+
+	// Account recovery is not configured.
+	rec = credentialRequest(t, handler.SendRecoveryEmail, passkeys.EmailRequest{Email: "test@example.com"})
+	if got, want := rec.Code, http.StatusNotImplemented; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// registerVerifiedUser registers a user with a verified email address.
+func registerVerifiedUser(t *testing.T, handler *passkeys.Handler, db *passkeys.RAMUserDatabase, mailer *passkeys.RAMMailer, email string) *passkeys.User {
+	t.Helper()
+	rec := credentialRequest(t, handler.SendVerificationEmail, passkeys.EmailRequest{Email: email})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	msgs := mailer.Messages()
+	token := tokenFromMessage(t, msgs[len(msgs)-1], "https://example.com/verify?")
+	req := passkeys.BeginRegistrationRequest{Email: email, DisplayName: "Test User", Token: token}
+	rec = credentialRequest(t, handler.BeginRegistration, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	rec = credentialRequest(t, handler.FinishRegistration, nil, rec.Result().Cookies()...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	user, err := db.LookupByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestHandler_AccountRecovery(t *testing.T) {
+	db := passkeys.NewRAMUserDatabase()
+
+	// Account recovery requires email verification.
+	handler, _ := newEmailTestHandler(t, db,
+		passkeys.WithAccountRecovery("https://example.com/recover"))
+	rec := credentialRequest(t, handler.SendRecoveryEmail, passkeys.EmailRequest{Email: "test@example.com"})
+	if got, want := rec.Code, http.StatusNotImplemented; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	handler, mailer := newEmailTestHandler(t, db,
+		passkeys.WithEmailVerification("https://example.com/verify"),
+		passkeys.WithAccountRecovery("https://example.com/recover"))
+
+	user := registerVerifiedUser(t, handler, db, mailer, "test@example.com")
+	sent := len(mailer.Messages())
+
+	// Users whose email address has not been verified cannot recover
+	// their accounts.
+	unverified, err := passkeys.NewUser("unverified@example.com", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Store(unverified); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown users are not revealed.
+	for _, email := range []string{"unknown@example.com", "unverified@example.com"} {
+		rec = credentialRequest(t, handler.SendRecoveryEmail, passkeys.EmailRequest{Email: email})
+		if rec.Code != http.StatusOK || len(mailer.Messages()) != sent {
+			t.Fatalf("unexpected status or messages: %v: %v", rec.Code, mailer.Messages())
+		}
+	}
+
+	rec = credentialRequest(t, handler.SendRecoveryEmail, passkeys.EmailRequest{Email: "test@example.com"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	msgs := mailer.Messages()
+	if got, want := len(msgs), sent+1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	token := tokenFromMessage(t, msgs[sent], "https://example.com/recover?")
+
+	rec = credentialRequest(t, handler.BeginRecovery, passkeys.BeginRecoveryRequest{Token: token})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	var registrationCookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == string(passkeys.RegistrationCookie) {
+			registrationCookie = c
+		}
+	}
+	if registrationCookie == nil {
+		t.Fatal("registration cookie not set")
+	}
+
+	// Recovery links can only be used once.
+	rec = credentialRequest(t, handler.BeginRecovery, passkeys.BeginRecoveryRequest{Token: token})
+	if got, want := rec.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	rec = credentialRequest(t, handler.FinishRegistration, nil, registrationCookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %v: %s", rec.Code, rec.Body)
+	}
+	stored, err := db.Lookup(user.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(stored.WebAuthnCredentials()), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Message represents an email message sent by the email verification and
+// account recovery flows.
+type Message struct {
+	To      string
+	Subject string
+	// Body is a plain text body that includes URL, if any.
+	Body string
+	// URL is the verification or recovery link contained in the message,
+	// it is provided separately so that Mailers may format their own
+	// messages, e.g. using HTML templates.
+	URL string
+}
+
+// Mailer is the interface used to send email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// RAMMailer is an in-memory implementation of Mailer that records all
+// messages sent to it, it is intended for testing.
+type RAMMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewRAMMailer returns a new RAMMailer.
+func NewRAMMailer() *RAMMailer {
+	return &RAMMailer{}
+}
+
+// Send implements Mailer.
+func (m *RAMMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns all of the messages sent so far.
+func (m *RAMMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.messages)
+}
@@ -0,0 +1,196 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/go-webauthn/webauthn/metadata"
+	"github.com/go-webauthn/webauthn/metadata/providers/memory"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// LoadMetadataBLOB reads, verifies and parses a FIDO Metadata Service (MDS3)
+// BLOB from the specified file, typically a locally cached copy of
+// https://mds3.fidoalliance.org/. The BLOB's signature is verified against
+// the FIDO Alliance's root certificate unless another is specified using
+// metadata.WithRootCertificate.
+func LoadMetadataBLOB(filename string, opts ...metadata.DecoderOption) (*metadata.Metadata, error) {
+	blob, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := metadata.NewDecoder(opts...)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decoder.DecodeBytes(blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata BLOB %v: %w", filename, err)
+	}
+	md, err := decoder.Parse(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metadata BLOB %v: %w", filename, err)
+	}
+	return md, nil
+}
+
+// certificationLevels lists the FIDO certification statuses in increasing
+// order of assurance.
+var certificationLevels = []metadata.AuthenticatorStatus{
+	metadata.FidoCertified,
+	metadata.FidoCertifiedL1,
+	metadata.FidoCertifiedL1plus,
+	metadata.FidoCertifiedL2,
+	metadata.FidoCertifiedL2plus,
+	metadata.FidoCertifiedL3,
+	metadata.FidoCertifiedL3plus,
+}
+
+// certificationLevel returns the most recent certification status in
+// the supplied status reports, or the empty string if there is none.
+func certificationLevel(reports []metadata.StatusReport) metadata.AuthenticatorStatus {
+	var level metadata.AuthenticatorStatus
+	var effective time.Time
+	for _, r := range reports {
+		if !slices.Contains(certificationLevels, r.Status) || r.EffectiveDate.Before(effective) {
+			continue
+		}
+		level, effective = r.Status, r.EffectiveDate
+	}
+	return level
+}
+
+// MetadataPolicyOption represents an option for configuring a MetadataPolicy.
+type MetadataPolicyOption func(*metadataPolicyOptions)
+
+type metadataPolicyOptions struct {
+	allowed  []string
+	denied   []string
+	minLevel metadata.AuthenticatorStatus
+}
+
+// WithAllowedAAGUIDs restricts registration to authenticators with the
+// specified AAGUIDs, formatted as UUIDs. All authenticators with metadata
+// are allowed by default.
+func WithAllowedAAGUIDs(aaguids ...string) MetadataPolicyOption {
+	return func(o *metadataPolicyOptions) {
+		o.allowed = append(o.allowed, aaguids...)
+	}
+}
+
+// WithDeniedAAGUIDs prevents registration of authenticators with the
+// specified AAGUIDs, formatted as UUIDs. Denied AAGUIDs take precedence
+// over allowed ones.
+func WithDeniedAAGUIDs(aaguids ...string) MetadataPolicyOption {
+	return func(o *metadataPolicyOptions) {
+		o.denied = append(o.denied, aaguids...)
+	}
+}
+
+// WithMinimumCertificationLevel restricts registration to authenticators
+// whose most recent FIDO certification is at least the specified level,
+// e.g. metadata.FidoCertifiedL2.
+func WithMinimumCertificationLevel(level metadata.AuthenticatorStatus) MetadataPolicyOption {
+	return func(o *metadataPolicyOptions) {
+		o.minLevel = level
+	}
+}
+
+// MetadataPolicy is an AttestationPolicy that verifies attestation
+// statements against the authenticator metadata contained in a FIDO
+// Metadata Service BLOB. Only authenticators that provide an attestation
+// statement that chains to one of the attestation root certificates
+// listed in their metadata, and that have not been revoked or otherwise
+// compromised, are allowed. Authenticators may be further restricted by
+// AAGUID and certification level.
+type MetadataPolicy struct {
+	entries  map[uuid.UUID]*metadata.Entry
+	provider metadata.Provider
+	allowed  map[uuid.UUID]bool
+	denied   map[uuid.UUID]bool
+	minLevel int
+}
+
+func parseAAGUIDs(aaguids []string) (map[uuid.UUID]bool, error) {
+	parsed := make(map[uuid.UUID]bool, len(aaguids))
+	for _, a := range aaguids {
+		id, err := uuid.Parse(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AAGUID %q: %w", a, err)
+		}
+		parsed[id] = true
+	}
+	return parsed, nil
+}
+
+// NewMetadataPolicy creates a new MetadataPolicy using the supplied
+// metadata, typically obtained via LoadMetadataBLOB.
+func NewMetadataPolicy(md *metadata.Metadata, opts ...MetadataPolicyOption) (*MetadataPolicy, error) {
+	var o metadataPolicyOptions
+	for _, fn := range opts {
+		fn(&o)
+	}
+	p := &MetadataPolicy{
+		entries:  md.ToMap(),
+		minLevel: -1,
+	}
+	var err error
+	if p.allowed, err = parseAAGUIDs(o.allowed); err != nil {
+		return nil, err
+	}
+	if p.denied, err = parseAAGUIDs(o.denied); err != nil {
+		return nil, err
+	}
+	if len(o.minLevel) > 0 {
+		if p.minLevel = slices.Index(certificationLevels, o.minLevel); p.minLevel < 0 {
+			return nil, fmt.Errorf("invalid certification level: %q", o.minLevel)
+		}
+	}
+	if p.provider, err = memory.New(memory.WithMetadata(p.entries)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CheckAttestation implements AttestationPolicy.
+func (p *MetadataPolicy) CheckAttestation(_ context.Context, _ *User, cred *webauthn.Credential) (AttestationResult, error) {
+	result := AttestationResult{
+		AAGUID: formatAAGUID(cred.Authenticator.AAGUID),
+		Format: cred.AttestationType,
+	}
+	aaguid, err := uuid.FromBytes(cred.Authenticator.AAGUID)
+	if err != nil {
+		return result, fmt.Errorf("%w: invalid AAGUID: %v", ErrAttestationDenied, err)
+	}
+	if p.denied[aaguid] || (len(p.allowed) > 0 && !p.allowed[aaguid]) {
+		return result, fmt.Errorf("%w: authenticator %v is not allowed", ErrAttestationDenied, aaguid)
+	}
+	entry := p.entries[aaguid]
+	if entry == nil {
+		return result, fmt.Errorf("%w: no metadata for authenticator %v", ErrAttestationDenied, aaguid)
+	}
+	level := certificationLevel(entry.StatusReports)
+	result.Description = entry.MetadataStatement.Description
+	result.CertificationLevel = string(level)
+	if slices.Index(certificationLevels, level) < p.minLevel {
+		return result, fmt.Errorf("%w: authenticator %v has insufficient certification level %q", ErrAttestationDenied, aaguid, level)
+	}
+	if len(cred.AttestationType) == 0 || protocol.AttestationFormat(cred.AttestationType) == protocol.AttestationFormatNone {
+		return result, fmt.Errorf("%w: authenticator %v did not provide an attestation statement", ErrAttestationDenied, aaguid)
+	}
+	if err := cred.Verify(p.provider); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrAttestationDenied, err)
+	}
+	result.Verified = true
+	result.Checked = time.Now()
+	return result, nil
+}
@@ -5,6 +5,8 @@
 package passkeys
 
 import (
+	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,6 +14,7 @@ import (
 
 	"cloudeng.io/logging/ctxlog"
 	"cloudeng.io/webapp/cookies"
+	"cloudeng.io/webapp/jsonapi"
 	"cloudeng.io/webapp/webauth/jwtutil"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 )
@@ -30,75 +33,448 @@ type LoginManager interface {
 	AuthenticateUser(r *http.Request) (UserID, error)
 }
 
-// JWTCookieLoginManager implements the LoginManager interface using JWTs stored in cookies.
+// AuthenticationTimer may be implemented by a LoginManager to report when
+// the user authenticated using a passkey for the session associated with
+// a request. It is used to require recent authentication before sensitive
+// operations, such as adding a credential, which are refused if the
+// LoginManager does not implement it.
+type AuthenticationTimer interface {
+	AuthenticationTime(r *http.Request) (time.Time, error)
+}
+
+// ErrTokenRevoked is returned when a login or refresh token has been revoked.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+const (
+	// DefaultRefreshTokenTTL is the default period of inactivity after
+	// which a refresh token expires.
+	DefaultRefreshTokenTTL = 24 * time.Hour
+	// DefaultRefreshTokenMaxLifetime is the default maximum lifetime of
+	// a login session that is extended using refresh tokens.
+	DefaultRefreshTokenMaxLifetime = 30 * 24 * time.Hour
+
+	refreshAudience = "webauthn-refresh"
+	authTimeClaim   = "auth_time"
+)
+
+// LoginManagerOption represents an option for configuring a JWTCookieLoginManager.
+type LoginManagerOption func(*loginManagerOptions)
+
+type loginManagerOptions struct {
+	refreshCookie cookies.ScopeAndDuration
+	maxLifetime   time.Duration
+	revocations   RevocationStore
+}
+
+// WithRefreshTokens enables the use of refresh tokens which are stored in
+// RefreshCookie and may be exchanged for new login and refresh tokens using
+// Refresh. The cookie's duration is the period of inactivity after which
+// the refresh token expires, it defaults to DefaultRefreshTokenTTL.
+// Since every refresh issues a new refresh token the session's expiry
+// slides forward, but never beyond maxLifetime from when the user
+// authenticated using a passkey. maxLifetime defaults to
+// DefaultRefreshTokenMaxLifetime.
+func WithRefreshTokens(cookie cookies.ScopeAndDuration, maxLifetime time.Duration) LoginManagerOption {
+	return func(o *loginManagerOptions) {
+		o.refreshCookie = cookie.SetDefaults("", "/", DefaultRefreshTokenTTL)
+		o.maxLifetime = maxLifetime
+		if o.maxLifetime == 0 {
+			o.maxLifetime = DefaultRefreshTokenMaxLifetime
+		}
+	}
+}
+
+// WithRevocationStore sets the store used to record revoked tokens, the
+// default is a RAMRevocationStore which is only suitable for applications
+// that run as a single process.
+func WithRevocationStore(store RevocationStore) LoginManagerOption {
+	return func(o *loginManagerOptions) {
+		o.revocations = store
+	}
+}
+
+// JWTCookieLoginManager implements the LoginManager interface using JWTs
+// stored in cookies. Login tokens are short lived and, if enabled via
+// WithRefreshTokens, are accompanied by longer lived refresh tokens that
+// are rotated on every use. Tokens may be revoked server side, either
+// individually when a user logs out or for all of a user's sessions.
 type JWTCookieLoginManager struct {
 	signer   jwtutil.Signer
 	issuer   string
 	audience []string
 
 	loginCookie cookies.ScopeAndDuration
+	opts        loginManagerOptions
 	// LoginCookie is set when the user has successfully logged in using
 	// webauthn and is used to inform the server that the user has
 	// successfully logged in
 	LoginCookie cookies.Secure // initialized as cookies.T("webauthn_login")
+	// RefreshCookie is set along with LoginCookie when refresh tokens
+	// are enabled.
+	RefreshCookie cookies.Secure // initialized as cookies.Secure("webauthn_refresh")
 }
 
 // NewJWTCookieLoginManager creates a new JWTCookieLoginManager instance.
-func NewJWTCookieLoginManager(signer jwtutil.Signer, issuer string, cookie cookies.ScopeAndDuration) JWTCookieLoginManager {
+func NewJWTCookieLoginManager(signer jwtutil.Signer, issuer string, cookie cookies.ScopeAndDuration, opts ...LoginManagerOption) JWTCookieLoginManager {
 	m := JWTCookieLoginManager{
-		signer:      signer,
-		loginCookie: cookie.SetDefaults("", "/", 10*time.Minute),
-		issuer:      issuer,
-		audience:    []string{"webauthn"},
-		LoginCookie: cookies.Secure("webauthn_login"),
+		signer:        signer,
+		loginCookie:   cookie.SetDefaults("", "/", 10*time.Minute),
+		issuer:        issuer,
+		audience:      []string{"webauthn"},
+		LoginCookie:   cookies.Secure("webauthn_login"),
+		RefreshCookie: cookies.Secure("webauthn_refresh"),
+	}
+	for _, fn := range opts {
+		fn(&m.opts)
+	}
+	if m.opts.revocations == nil {
+		m.opts.revocations = NewRAMRevocationStore()
 	}
 	return m
 }
 
-func (m JWTCookieLoginManager) UserAuthenticated(r *http.Request, rw http.ResponseWriter, user UserID) error {
-	ctx := r.Context()
+func (m JWTCookieLoginManager) refreshEnabled() bool {
+	return m.opts.refreshCookie.Duration > 0
+}
+
+func (m JWTCookieLoginManager) signToken(ctx context.Context, user UserID, audience []string, expires, authTime time.Time) (string, error) {
 	now := time.Now()
 	// Create the JWT claims.
-	token, err := jwt.NewBuilder().
+	builder := jwt.NewBuilder().
 		Issuer(m.issuer).
-		Audience(m.audience).
+		Audience(audience).
 		Subject(user.String()).
-		Expiration(now.Add(m.loginCookie.Duration)).
+		JwtID(rand.Text()).
+		IssuedAt(now).
+		Expiration(expires).
 		NotBefore(now).
-		Build()
+		Claim(authTimeClaim, authTime.Unix())
+	token, err := builder.Build()
+	if err != nil {
+		ctxlog.Error(ctx, "failed to create jwt token", "error", err)
+		return "", fmt.Errorf("failed to create token: %v", err)
+	}
+	tokenString, err := m.signer.Sign(ctx, token)
 	if err != nil {
-		ctxlog.Error(ctx, "failed to create jwt token: %v", err)
-		return fmt.Errorf("failed to create token: %v", err)
+		ctxlog.Error(ctx, "failed to sign jwt token", "error", err)
+		return "", err
+	}
+	return string(tokenString), nil
+}
+
+// issueTokens sets new login and, if enabled, refresh cookies for the
+// user who authenticated using a passkey at authTime.
+func (m JWTCookieLoginManager) issueTokens(ctx context.Context, rw http.ResponseWriter, user UserID, authTime time.Time) error {
+	now := time.Now()
+	login, err := m.signToken(ctx, user, m.audience, now.Add(m.loginCookie.Duration), authTime)
+	if err != nil {
+		return err
 	}
-	tokenString, err := m.signer.Sign(r.Context(), token)
+	if !m.refreshEnabled() {
+		m.LoginCookie.Set(rw, m.loginCookie.Cookie(login))
+		return nil
+	}
+	expires := now.Add(m.opts.refreshCookie.Duration)
+	if limit := authTime.Add(m.opts.maxLifetime); expires.After(limit) {
+		expires = limit
+	}
+	refresh, err := m.signToken(ctx, user, []string{refreshAudience}, expires, authTime)
 	if err != nil {
-		ctxlog.Error(ctx, "failed to sign jwt token: %v", err)
 		return err
 	}
-	m.LoginCookie.Set(rw, m.loginCookie.Cookie(string(tokenString)))
+	m.LoginCookie.Set(rw, m.loginCookie.Cookie(login))
+	ck := m.opts.refreshCookie.Cookie(refresh)
+	ck.Expires = expires
+	m.RefreshCookie.Set(rw, ck)
 	return nil
 }
 
-func (m JWTCookieLoginManager) AuthenticateUser(r *http.Request) (UserID, error) {
-	tokenString, ok := m.LoginCookie.Read(r)
-	if !ok {
-		return nil, errors.New("missing authentication cookie")
-	}
+func (m JWTCookieLoginManager) UserAuthenticated(r *http.Request, rw http.ResponseWriter, user UserID) error {
+	return m.issueTokens(r.Context(), rw, user, time.Now())
+}
+
+// validate parses and validates the token, returning it along with the
+// user it was issued to. It does not check for revocation.
+func (m JWTCookieLoginManager) validate(ctx context.Context, tokenString string, audience []string) (jwt.Token, UserID, error) {
 	validationOptions := []jwt.ValidateOption{jwt.WithIssuer(m.issuer)}
-	for _, aud := range m.audience {
+	for _, aud := range audience {
 		validationOptions = append(validationOptions, jwt.WithAudience(aud))
 	}
-	token, err := m.signer.ParseAndValidate(r.Context(), []byte(tokenString), validationOptions...)
+	token, err := m.signer.ParseAndValidate(ctx, []byte(tokenString), validationOptions...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	subject, ok := token.Subject()
 	if !ok {
-		return nil, errors.New("missing subject")
+		return nil, nil, errors.New("missing subject")
 	}
 	uid, err := UserIDFromString(subject)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	return token, uid, nil
+}
+
+// tokenDenied returns true if the token's ID is in the denylist.
+func (m JWTCookieLoginManager) tokenDenied(ctx context.Context, token jwt.Token) (bool, error) {
+	id, ok := token.JwtID()
+	if !ok {
+		return false, errors.New("missing token id")
+	}
+	return m.opts.revocations.TokenRevoked(ctx, id)
+}
+
+// checkRevoked returns an error wrapping ErrTokenRevoked if the token is
+// in the denylist or was issued before the user's "not before" time.
+func (m JWTCookieLoginManager) checkRevoked(ctx context.Context, token jwt.Token, user UserID) error {
+	denied, err := m.tokenDenied(ctx, token)
+	if err != nil {
+		return err
+	}
+	if denied {
+		return fmt.Errorf("%w: token is in the denylist", ErrTokenRevoked)
+	}
+	return m.checkNotBefore(ctx, token, user)
+}
+
+func (m JWTCookieLoginManager) checkNotBefore(ctx context.Context, token jwt.Token, user UserID) error {
+	notBefore, err := m.opts.revocations.UserNotBefore(ctx, user)
+	if err != nil {
+		return err
+	}
+	if issued, _ := token.IssuedAt(); issued.Before(notBefore) {
+		return fmt.Errorf("%w: token was issued before %v", ErrTokenRevoked, notBefore)
+	}
+	return nil
+}
+
+// revokeToken adds the token to the denylist, returning true if it was
+// already there.
+func (m JWTCookieLoginManager) revokeToken(ctx context.Context, token jwt.Token) (bool, error) {
+	id, ok := token.JwtID()
+	if !ok {
+		return false, errors.New("missing token id")
+	}
+	expires, _ := token.Expiration()
+	return m.opts.revocations.RevokeToken(ctx, id, expires)
+}
+
+// RevokeUser revokes all login and refresh tokens issued to the user,
+// including any issued within the current second, since JWT timestamps
+// have a resolution of one second.
+func (m JWTCookieLoginManager) RevokeUser(ctx context.Context, user UserID) error {
+	return m.opts.revocations.RevokeUser(ctx, user, time.Now().Truncate(time.Second).Add(time.Second))
+}
+
+// authenticate validates the login token presented with the request.
+func (m JWTCookieLoginManager) authenticate(r *http.Request) (jwt.Token, UserID, error) {
+	tokenString, ok := m.LoginCookie.Read(r)
+	if !ok {
+		return nil, nil, errors.New("missing authentication cookie")
+	}
+	token, uid, err := m.validate(r.Context(), tokenString, m.audience)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.checkRevoked(r.Context(), token, uid); err != nil {
+		return nil, nil, err
+	}
+	return token, uid, nil
+}
+
+// AuthenticateUser implements LoginManager. It validates the login token
+// presented with the request and rejects tokens that have been revoked,
+// individually or via RevokeUser, and is therefore the point at which
+// revocation is enforced. Handlers must use it, directly or via
+// RequireAuthentication, rather than validating the login cookie themselves.
+func (m JWTCookieLoginManager) AuthenticateUser(r *http.Request) (UserID, error) {
+	_, uid, err := m.authenticate(r)
+	return uid, err
+}
+
+type userIDKey struct{}
+
+// RequireAuthentication returns an http.Handler that calls next only if
+// lm.AuthenticateUser succeeds for the request, which for a
+// JWTCookieLoginManager requires a valid login token that has not been
+// revoked, and otherwise responds with http.StatusUnauthorized. The
+// authenticated user's UserID is available to next via UserIDFromContext.
+func RequireAuthentication(lm LoginManager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		uid, err := lm.AuthenticateUser(r)
+		if err != nil {
+			ctxlog.Debug(r.Context(), "passkeys: request not authenticated", "error", err)
+			jsonapi.WriteErrorMsg(rw, "failed to authenticate user", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), userIDKey{}, uid)))
+	})
+}
+
+// UserIDFromContext returns the UserID of the user authenticated by the
+// handler returned by RequireAuthentication.
+func UserIDFromContext(ctx context.Context) (UserID, bool) {
+	uid, ok := ctx.Value(userIDKey{}).(UserID)
+	return uid, ok
+}
+
+// AuthenticationTime returns the time at which the user authenticated
+// using a passkey for the session associated with the request's login
+// token. The time is carried over to the tokens issued by Refresh.
+func (m JWTCookieLoginManager) AuthenticationTime(r *http.Request) (time.Time, error) {
+	token, _, err := m.authenticate(r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return authenticatedAt(token)
+}
+
+// authenticatedAt returns the value of the token's auth_time claim.
+func authenticatedAt(token jwt.Token) (time.Time, error) {
+	var authTime float64
+	if err := token.Get(authTimeClaim, &authTime); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(authTime), 0), nil
+}
+
+// RefreshEndpoint represents the endpoint for exchanging the refresh token
+// stored in RefreshCookie for new login and refresh tokens. The response
+// on success is simply a http.StatusOK with an empty body.
+var RefreshEndpoint = jsonapi.Endpoint[struct{}, struct{}]{}
+
+// Refresh issues new login and refresh tokens in exchange for a valid
+// refresh token, which is revoked. Refresh tokens can only be used once
+// and any attempt to reuse one is treated as evidence that it has been
+// stolen and hence all of the user's tokens are revoked. Since the refresh
+// token is revoked atomically, only one of any concurrent requests that
+// present the same refresh token can succeed, and the others are treated
+// as reuse. Clients should therefore not issue concurrent refresh requests.
+func (m JWTCookieLoginManager) Refresh(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tokenString, ok := m.RefreshCookie.Read(r)
+	if !ok {
+		jsonapi.WriteErrorMsg(rw, "missing refresh cookie", http.StatusUnauthorized)
+		return
+	}
+	token, uid, err := m.validate(ctx, tokenString, []string{refreshAudience})
+	if err != nil {
+		ctxlog.Error(ctx, "invalid refresh token", "error", err)
+		jsonapi.WriteErrorMsg(rw, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err := m.checkNotBefore(ctx, token, uid); err != nil {
+		ctxlog.Error(ctx, "revoked refresh token", "user_id", uid.String(), "error", err)
+		jsonapi.WriteErrorMsg(rw, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	authTime, err := authenticatedAt(token)
+	if err != nil {
+		ctxlog.Error(ctx, "invalid refresh token", "user_id", uid.String(), "error", err)
+		jsonapi.WriteErrorMsg(rw, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	reused, err := m.revokeToken(ctx, token)
+	if err != nil {
+		ctxlog.Error(ctx, "failed to revoke refresh token", "user_id", uid.String(), "error", err)
+		jsonapi.WriteErrorMsg(rw, "failed to refresh tokens", http.StatusInternalServerError)
+		return
+	}
+	if reused {
+		ctxlog.Error(ctx, "refresh token reused, revoking all tokens", "user_id", uid.String())
+		if err := m.RevokeUser(ctx, uid); err != nil {
+			ctxlog.Error(ctx, "failed to revoke user tokens", "user_id", uid.String(), "error", err)
+		}
+		jsonapi.WriteErrorMsg(rw, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err := m.issueTokens(ctx, rw, uid, authTime); err != nil {
+		jsonapi.WriteErrorMsg(rw, "failed to refresh tokens", http.StatusInternalServerError)
+		return
+	}
+}
+
+// LogoutEndpoint represents the endpoint for logging out, it revokes the
+// login and refresh tokens presented with the request and clears their
+// cookies. The response on success is simply a http.StatusOK with an
+// empty body.
+var LogoutEndpoint = jsonapi.Endpoint[struct{}, struct{}]{}
+
+// LogoutAllSessionsEndpoint represents the endpoint for logging out of all
+// sessions, i.e. on all devices. It behaves as LogoutEndpoint but also
+// revokes all other tokens issued to the user. It fails with
+// http.StatusUnauthorized unless the request presents a token that has
+// not been revoked.
+var LogoutAllSessionsEndpoint = jsonapi.Endpoint[struct{}, struct{}]{}
+
+// Logout logs out the current session.
+func (m JWTCookieLoginManager) Logout(rw http.ResponseWriter, r *http.Request) {
+	m.logout(rw, r, false)
+}
+
+// LogoutAllSessions logs out all of the user's sessions.
+func (m JWTCookieLoginManager) LogoutAllSessions(rw http.ResponseWriter, r *http.Request) {
+	m.logout(rw, r, true)
+}
+
+func clearCookie(rw http.ResponseWriter, name cookies.Secure, scope cookies.ScopeAndDuration) {
+	ck := scope.Cookie("")
+	ck.MaxAge = -1
+	name.Set(rw, ck)
+}
+
+func (m JWTCookieLoginManager) logout(rw http.ResponseWriter, r *http.Request, all bool) {
+	ctx := r.Context()
+	type tokenCookie struct {
+		name     cookies.Secure
+		scope    cookies.ScopeAndDuration
+		audience []string
+	}
+	tokenCookies := []tokenCookie{{m.LoginCookie, m.loginCookie, m.audience}}
+	if m.refreshEnabled() {
+		tokenCookies = append(tokenCookies, tokenCookie{m.RefreshCookie, m.opts.refreshCookie, []string{refreshAudience}})
+	}
+	var user UserID
+	for _, tc := range tokenCookies {
+		tokenString, ok := tc.name.Read(r)
+		if !ok {
+			continue
+		}
+		clearCookie(rw, tc.name, tc.scope)
+		token, uid, err := m.validate(ctx, tokenString, tc.audience)
+		if err != nil {
+			// Invalid or expired tokens do not need to be revoked.
+			continue
+		}
+		if all {
+			// Revoked tokens, such as copies of tokens from a session that
+			// has been logged out, cannot be used to log out other sessions.
+			if err := m.checkRevoked(ctx, token, uid); err != nil {
+				if errors.Is(err, ErrTokenRevoked) {
+					continue
+				}
+				ctxlog.Error(ctx, "failed to check token revocation", "user_id", uid.String(), "error", err)
+				jsonapi.WriteErrorMsg(rw, "failed to logout", http.StatusInternalServerError)
+				return
+			}
+		}
+		if _, err := m.revokeToken(ctx, token); err != nil {
+			ctxlog.Error(ctx, "failed to revoke token", "user_id", uid.String(), "error", err)
+			jsonapi.WriteErrorMsg(rw, "failed to logout", http.StatusInternalServerError)
+			return
+		}
+		user = uid
+	}
+	if !all {
+		return
+	}
+	if user == nil {
+		jsonapi.WriteErrorMsg(rw, "not logged in", http.StatusUnauthorized)
+		return
+	}
+	if err := m.RevokeUser(ctx, user); err != nil {
+		ctxlog.Error(ctx, "failed to revoke user tokens", "user_id", user.String(), "error", err)
+		jsonapi.WriteErrorMsg(rw, "failed to logout", http.StatusInternalServerError)
+		return
 	}
-	return uid, nil
 }
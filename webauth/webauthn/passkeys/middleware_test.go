@@ -0,0 +1,347 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/cookies"
+	"cloudeng.io/webapp/webauth/jwtutil"
+	"cloudeng.io/webapp/webauth/webauthn/passkeys"
+)
+
+func newTestLoginManager(t *testing.T, opts ...passkeys.LoginManagerOption) passkeys.JWTCookieLoginManager {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jwtutil.NewED25519Signer(priv, "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return passkeys.NewJWTCookieLoginManager(signer, "test-issuer",
+		cookies.ScopeAndDuration{Duration: time.Minute}, opts...)
+}
+
+// browser records the cookies set by the server in the same way
+// as a browser would.
+type browser map[string]*http.Cookie
+
+func (b browser) update(rr *httptest.ResponseRecorder) {
+	for _, ck := range rr.Result().Cookies() {
+		if ck.MaxAge < 0 {
+			delete(b, ck.Name)
+			continue
+		}
+		b[ck.Name] = ck
+	}
+}
+
+func (b browser) request(method, path string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	for _, ck := range b {
+		req.AddCookie(&http.Cookie{Name: ck.Name, Value: ck.Value})
+	}
+	return req
+}
+
+func (b browser) clone() browser {
+	c := browser{}
+	for k, v := range b {
+		c[k] = v
+	}
+	return c
+}
+
+func login(t *testing.T, lm passkeys.JWTCookieLoginManager, user passkeys.UserID) browser {
+	t.Helper()
+	b := browser{}
+	rr := httptest.NewRecorder()
+	if err := lm.UserAuthenticated(b.request(http.MethodPost, "/login"), rr, user); err != nil {
+		t.Fatalf("UserAuthenticated: %v", err)
+	}
+	b.update(rr)
+	return b
+}
+
+func authenticate(lm passkeys.JWTCookieLoginManager, b browser) (passkeys.UserID, error) {
+	return lm.AuthenticateUser(b.request(http.MethodGet, "/"))
+}
+
+func call(b browser, handler http.HandlerFunc, path string) int {
+	rr := httptest.NewRecorder()
+	handler(rr, b.request(http.MethodPost, path))
+	b.update(rr)
+	return rr.Code
+}
+
+func newTestUserID(t *testing.T) passkeys.UserID {
+	t.Helper()
+	user, err := passkeys.NewUser("test@example.com", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID()
+}
+
+func TestJWTCookieLoginManager_Logout(t *testing.T) {
+	lm := newTestLoginManager(t)
+	uid := newTestUserID(t)
+
+	b := login(t, lm, uid)
+	stolen := b.clone()
+	got, err := authenticate(lm, b)
+	if err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+	if got.String() != uid.String() {
+		t.Errorf("got %v, want %v", got, uid)
+	}
+
+	if got, want := call(b, lm.Logout, "/logout"), http.StatusOK; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if len(b) != 0 {
+		t.Errorf("cookies were not cleared: %v", b)
+	}
+	// A copy of the logged out token must be rejected.
+	if _, err := authenticate(lm, stolen); !errors.Is(err, passkeys.ErrTokenRevoked) {
+		t.Errorf("got %v, want %v", err, passkeys.ErrTokenRevoked)
+	}
+	if got, want := call(b, lm.LogoutAllSessions, "/logout-all"), http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestJWTCookieLoginManager_Refresh(t *testing.T) {
+	lm := newTestLoginManager(t, passkeys.WithRefreshTokens(cookies.ScopeAndDuration{}, 0))
+	uid := newTestUserID(t)
+
+	b := login(t, lm, uid)
+	if _, ok := b[string(lm.RefreshCookie)]; !ok {
+		t.Fatalf("missing refresh cookie: %v", b)
+	}
+	original := b.clone()
+
+	if got, want := call(b, lm.Refresh, "/refresh"), http.StatusOK; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if b[string(lm.RefreshCookie)].Value == original[string(lm.RefreshCookie)].Value {
+		t.Errorf("refresh token was not rotated")
+	}
+	if _, err := authenticate(lm, b); err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+
+	// Reusing the original refresh token revokes all of the user's tokens.
+	if got, want := call(original, lm.Refresh, "/refresh"), http.StatusUnauthorized; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if _, err := authenticate(lm, b); !errors.Is(err, passkeys.ErrTokenRevoked) {
+		t.Errorf("got %v, want %v", err, passkeys.ErrTokenRevoked)
+	}
+	if got, want := call(b, lm.Refresh, "/refresh"), http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestJWTCookieLoginManager_ConcurrentRefresh(t *testing.T) {
+	lm := newTestLoginManager(t, passkeys.WithRefreshTokens(cookies.ScopeAndDuration{}, 0))
+	uid := newTestUserID(t)
+
+	b := login(t, lm, uid)
+	const concurrency = 10
+	browsers := make([]browser, concurrency)
+	codes := make([]int, concurrency)
+	var wg sync.WaitGroup
+	for i := range concurrency {
+		browsers[i] = b.clone()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = call(browsers[i], lm.Refresh, "/refresh")
+		}()
+	}
+	wg.Wait()
+
+	// Only one of the requests can succeed, the others are treated as
+	// reuse of the refresh token and hence revoke all of the user's tokens.
+	succeeded := 0
+	for i, code := range codes {
+		switch code {
+		case http.StatusOK:
+			succeeded++
+			if _, err := authenticate(lm, browsers[i]); !errors.Is(err, passkeys.ErrTokenRevoked) {
+				t.Errorf("got %v, want %v", err, passkeys.ErrTokenRevoked)
+			}
+		case http.StatusUnauthorized:
+		default:
+			t.Errorf("unexpected status: %v", code)
+		}
+	}
+	if got, want := succeeded, 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestJWTCookieLoginManager_AuthenticationTime(t *testing.T) {
+	lm := newTestLoginManager(t, passkeys.WithRefreshTokens(cookies.ScopeAndDuration{}, 0))
+	uid := newTestUserID(t)
+
+	before := time.Now().Truncate(time.Second)
+	b := login(t, lm, uid)
+	authTime, err := lm.AuthenticationTime(b.request(http.MethodGet, "/"))
+	if err != nil {
+		t.Fatalf("AuthenticationTime: %v", err)
+	}
+	if authTime.Before(before) || authTime.After(time.Now()) {
+		t.Errorf("unexpected authentication time: %v", authTime)
+	}
+
+	// Refreshing the tokens does not change the authentication time.
+	if got, want := call(b, lm.Refresh, "/refresh"), http.StatusOK; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	refreshed, err := lm.AuthenticationTime(b.request(http.MethodGet, "/"))
+	if err != nil {
+		t.Fatalf("AuthenticationTime: %v", err)
+	}
+	if !refreshed.Equal(authTime) {
+		t.Errorf("got %v, want %v", refreshed, authTime)
+	}
+
+	if _, err := lm.AuthenticationTime(httptest.NewRequest(http.MethodGet, "/", nil)); err == nil {
+		t.Errorf("expected an error for a request without a login cookie")
+	}
+}
+
+func TestJWTCookieLoginManager_LogoutAllSessions(t *testing.T) {
+	store := passkeys.NewRAMRevocationStore()
+	lm := newTestLoginManager(t,
+		passkeys.WithRefreshTokens(cookies.ScopeAndDuration{}, 0),
+		passkeys.WithRevocationStore(store))
+	uid := newTestUserID(t)
+
+	laptop := login(t, lm, uid)
+	phone := login(t, lm, uid)
+
+	// A copy of the tokens from a logged out session cannot be used to
+	// log out of all sessions.
+	stolen := laptop.clone()
+	if got, want := call(laptop, lm.Logout, "/logout"), http.StatusOK; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := call(stolen, lm.LogoutAllSessions, "/logout-all"), http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := authenticate(lm, phone); err != nil {
+		t.Errorf("AuthenticateUser: %v", err)
+	}
+
+	laptop = login(t, lm, uid)
+	if got, want := call(laptop, lm.LogoutAllSessions, "/logout-all"), http.StatusOK; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if _, err := authenticate(lm, phone); !errors.Is(err, passkeys.ErrTokenRevoked) {
+		t.Errorf("got %v, want %v", err, passkeys.ErrTokenRevoked)
+	}
+	if got, want := call(phone, lm.Refresh, "/refresh"), http.StatusUnauthorized; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	nb, err := store.UserNotBefore(context.Background(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb.IsZero() {
+		t.Errorf("not before time was not set")
+	}
+}
+
+func TestRequireAuthentication(t *testing.T) {
+	lm := newTestLoginManager(t)
+	uid := newTestUserID(t)
+	handler := passkeys.RequireAuthentication(lm, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got, ok := passkeys.UserIDFromContext(r.Context())
+		if !ok || got.String() != uid.String() {
+			t.Errorf("got %v, %v, want %v", got, ok, uid)
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	b := login(t, lm, uid)
+	stolen := b.clone()
+	if got, want := call(b, handler.ServeHTTP, "/"), http.StatusOK; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := call(b, lm.Logout, "/logout"), http.StatusOK; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, br := range []browser{b, stolen} {
+		if got, want := call(br, handler.ServeHTTP, "/"), http.StatusUnauthorized; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestJWTCookieLoginManager_MaxLifetime(t *testing.T) {
+	lm := newTestLoginManager(t,
+		passkeys.WithRefreshTokens(cookies.ScopeAndDuration{Duration: time.Hour}, time.Minute))
+	uid := newTestUserID(t)
+
+	b := login(t, lm, uid)
+	for range 2 {
+		if got, want := call(b, lm.Refresh, "/refresh"), http.StatusOK; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		// The refresh token's expiry is limited by the maximum lifetime
+		// rather than the cookie's duration.
+		expires := b[string(lm.RefreshCookie)].Expires
+		if limit := time.Now().Add(time.Minute); expires.After(limit) {
+			t.Errorf("refresh cookie expires at %v, after %v", expires, limit)
+		}
+	}
+}
+
+func TestRAMRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	store := passkeys.NewRAMRevocationStore()
+	uid := newTestUserID(t)
+
+	now := time.Now()
+	if err := store.RevokeUser(ctx, uid, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeUser(ctx, uid, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if nb, _ := store.UserNotBefore(ctx, uid); !nb.Equal(now) {
+		t.Errorf("got %v, want %v", nb, now)
+	}
+
+	if _, err := store.RevokeToken(ctx, "expired", now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := store.RevokeToken(ctx, "current", now.Add(time.Minute)); err != nil || revoked {
+		t.Fatalf("unexpected result: %v, %v", revoked, err)
+	}
+	if revoked, err := store.RevokeToken(ctx, "current", now.Add(time.Minute)); err != nil || !revoked {
+		t.Fatalf("unexpected result: %v, %v", revoked, err)
+	}
+	if revoked, _ := store.TokenRevoked(ctx, "current"); !revoked {
+		t.Errorf("current token is not revoked")
+	}
+	if revoked, _ := store.TokenRevoked(ctx, "unknown"); revoked {
+		t.Errorf("unknown token is revoked")
+	}
+}
@@ -7,6 +7,7 @@ package passkeys
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -16,6 +17,7 @@ import (
 
 	"cloudeng.io/webapp/cookies"
 	"cloudeng.io/webapp/jsonapi"
+	"cloudeng.io/webapp/webauth/jwtutil"
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
 )
@@ -49,6 +51,14 @@ type options struct {
 	emailValidator       EmailValidator
 	mediationRequirement protocol.CredentialMediationRequirement
 	registrationOptions  []webauthn.RegistrationOption
+	reauthWindow         time.Duration
+	mailer               Mailer
+	tokenSigner          jwtutil.Signer
+	tokenIssuer          string
+	verificationURL      string
+	recoveryURL          string
+	emailTokenTTL        time.Duration
+	attestationPolicy    AttestationPolicy
 }
 
 // HandlerOption represents an option for configuring the Handler.
@@ -91,6 +101,22 @@ func WithSessionCookieScopeAndDuration(ck cookies.ScopeAndDuration) HandlerOptio
 	}
 }
 
+// DefaultReauthenticationWindow is the default period within which a user
+// must have authenticated using a passkey in order to add a new credential
+// to their account.
+const DefaultReauthenticationWindow = 5 * time.Minute
+
+// WithReauthenticationWindow sets the period within which a user must
+// have authenticated using a passkey, rather than simply being logged in,
+// in order to add a new credential to their account. The time of
+// authentication is obtained from the LoginManager, which must implement
+// AuthenticationTimer, for the current session. The default is DefaultReauthenticationWindow.
+func WithReauthenticationWindow(d time.Duration) HandlerOption {
+	return func(o *options) {
+		o.reauthWindow = d
+	}
+}
+
 // NewHandler creates a new passkeys handler with the provided WebAuthn
 // implementation, session and user managers.
 func NewHandler(w WebAuthn, sm SessionManager, um UserDatabase, lm LoginManager, opts ...HandlerOption) *Handler {
@@ -104,9 +130,20 @@ func NewHandler(w WebAuthn, sm SessionManager, um UserDatabase, lm LoginManager,
 		fn(&h.opts)
 	}
 	h.opts.sessionCookie = h.opts.sessionCookie.SetDefaults("", "/", 10*time.Minute)
+	if h.opts.reauthWindow == 0 {
+		h.opts.reauthWindow = DefaultReauthenticationWindow
+	}
+	if h.opts.emailTokenTTL == 0 {
+		h.opts.emailTokenTTL = DefaultEmailTokenTTL
+	}
 	if h.opts.logger == nil {
 		h.opts.logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
 	}
+	if h.opts.attestationPolicy != nil {
+		h.opts.registrationOptions = append([]webauthn.RegistrationOption{
+			webauthn.WithConveyancePreference(protocol.PreferDirectAttestation),
+		}, h.opts.registrationOptions...)
+	}
 
 	return h
 }
@@ -118,9 +155,11 @@ var BeginRegistrationEndpoint = jsonapi.Endpoint[
 
 // BeginRegistrationRequest represents the request body for beginning the registration process,
 // the client should send a JSON object with the user's email address and display name.
+// The token is required when email verification is enabled, see WithEmailVerification.
 type BeginRegistrationRequest struct {
 	Email       string `json:"email"`
 	DisplayName string `json:"display_name"`
+	Token       string `json:"token,omitempty"`
 }
 
 // BeginRegistration starts the registration process for a user.
@@ -143,12 +182,22 @@ func (h *Handler) BeginRegistration(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if len(h.opts.verificationURL) > 0 {
+		if status, msg, err := h.checkVerifiedEmail(r.Context(), req); err != nil {
+			logger.Error("email verification failed", "email", req.Email, "err", err.Error())
+			jsonapi.WriteErrorMsg(rw, msg, status)
+			return
+		}
+	}
+
 	user, err := NewUser(req.Email, req.DisplayName)
 	if err != nil {
 		logger.Error("failed to create user", "err", err.Error())
 		jsonapi.WriteErrorMsg(rw, "failed to create user", http.StatusInternalServerError)
 		return
 	}
+	// The email address has been verified above if verification is enabled.
+	user.emailVerified = len(h.opts.verificationURL) > 0
 
 	creds, session, err := h.w.BeginMediatedRegistration(
 		user, h.opts.mediationRequirement, h.opts.registrationOptions...)
@@ -222,10 +271,19 @@ func (h *Handler) FinishRegistration(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	attestation, ok := h.checkAttestation(rw, r, logger, user, cred)
+	if !ok {
+		return
+	}
 	user.AddCredential(*cred)
+	user.setAttestation(cred.ID, attestation)
 
 	if err := h.um.Store(user); err != nil {
 		logger.Error("failed to store user", "error", err.Error())
+		if errors.Is(err, ErrEmailInUse) {
+			jsonapi.WriteErrorMsg(rw, "user already registered", http.StatusConflict)
+			return
+		}
 		jsonapi.WriteErrorMsg(rw, "failed to store user", http.StatusInternalServerError)
 		return
 	}
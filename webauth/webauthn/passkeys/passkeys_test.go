@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"cloudeng.io/webapp/webauth/webauthn/passkeys"
 	"github.com/go-webauthn/webauthn/protocol"
@@ -80,13 +81,16 @@ func (m *mockWebAuthn) FinishPasskeyLogin(handler webauthn.DiscoverableUserHandl
 	return user, cred, nil
 }
 
-// mockLoginManager implements the LoginManager interface for testing.
+// mockLoginManager implements the LoginManager and AuthenticationTimer
+// interfaces for testing.
 type mockLoginManager struct {
 	authenticatedUserID passkeys.UserID
+	authenticated       time.Time
 }
 
 func (m *mockLoginManager) UserAuthenticated(_ *http.Request, _ http.ResponseWriter, userID passkeys.UserID) error {
 	m.authenticatedUserID = userID
+	m.authenticated = time.Now()
 	return nil
 }
 
@@ -94,6 +98,10 @@ func (m *mockLoginManager) AuthenticateUser(_ *http.Request) (passkeys.UserID, e
 	return m.authenticatedUserID, nil
 }
 
+func (m *mockLoginManager) AuthenticationTime(_ *http.Request) (time.Time, error) {
+	return m.authenticated, nil
+}
+
 func TestRAMUserDatabase(t *testing.T) {
 	db := passkeys.NewRAMUserDatabase()
 
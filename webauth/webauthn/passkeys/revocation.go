@@ -0,0 +1,98 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationStore is used by JWTCookieLoginManager to record revoked
+// tokens. Individual tokens are revoked by adding their IDs (the JWT
+// "jti" claim) to a denylist, and all of a user's tokens may be revoked
+// by recording a per-user "not before" time before which all tokens
+// issued to that user are considered revoked.
+type RevocationStore interface {
+	// RevokeToken adds the specified token ID to the denylist, the entry
+	// may be discarded once the token expires. It returns true if the
+	// token ID was already in the denylist. The check and the addition
+	// must be atomic so that only one of any concurrent calls for the
+	// same token ID returns false.
+	RevokeToken(ctx context.Context, id string, expires time.Time) (alreadyRevoked bool, err error)
+	// TokenRevoked returns true if the specified token ID is in the denylist.
+	TokenRevoked(ctx context.Context, id string) (bool, error)
+	// RevokeUser revokes all tokens issued to the user before notBefore.
+	// Implementations must ignore attempts to move notBefore backwards.
+	RevokeUser(ctx context.Context, user UserID, notBefore time.Time) error
+	// UserNotBefore returns the time set by RevokeUser for the specified
+	// user, or the zero time if there is none.
+	UserNotBefore(ctx context.Context, user UserID) (time.Time, error)
+}
+
+// RAMRevocationStore is an in-memory implementation of RevocationStore,
+// it is only suitable for applications that run as a single process.
+type RAMRevocationStore struct {
+	mu        sync.Mutex
+	tokens    map[string]time.Time
+	users     map[string]time.Time
+	nextSweep time.Time
+}
+
+// ramRevocationSweepInterval is the minimum interval between sweeps of
+// the denylist for expired entries.
+const ramRevocationSweepInterval = time.Minute
+
+// NewRAMRevocationStore returns a new RAMRevocationStore.
+func NewRAMRevocationStore() *RAMRevocationStore {
+	return &RAMRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+// RevokeToken implements RevocationStore. Expired entries are discarded
+// as new ones are added, but no more than once a minute so that the cost
+// of doing so is amortized over many calls.
+func (s *RAMRevocationStore) RevokeToken(_ context.Context, id string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, revoked := s.tokens[id]
+	if now := time.Now(); !now.Before(s.nextSweep) {
+		for k, exp := range s.tokens {
+			if exp.Before(now) {
+				delete(s.tokens, k)
+			}
+		}
+		s.nextSweep = now.Add(ramRevocationSweepInterval)
+	}
+	s.tokens[id] = expires
+	return revoked, nil
+}
+
+// TokenRevoked implements RevocationStore.
+func (s *RAMRevocationStore) TokenRevoked(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.tokens[id]
+	return ok, nil
+}
+
+// RevokeUser implements RevocationStore.
+func (s *RAMRevocationStore) RevokeUser(_ context.Context, user UserID, notBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if notBefore.After(s.users[user.String()]) {
+		s.users[user.String()] = notBefore
+	}
+	return nil
+}
+
+// UserNotBefore implements RevocationStore.
+func (s *RAMRevocationStore) UserNotBefore(_ context.Context, user UserID) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users[user.String()], nil
+}
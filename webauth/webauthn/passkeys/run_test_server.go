@@ -87,7 +87,10 @@ func main() {
 		Path:     "/",
 		Domain:   serverURL.Hostname(),
 		Duration: time.Hour * 24 * 30,
-	})
+	}, passkeys.WithRefreshTokens(cookies.ScopeAndDuration{
+		Path:   "/",
+		Domain: serverURL.Hostname(),
+	}, 0))
 	requireResidentKey := true
 	w := passkeys.NewHandler(wa, db, db, mw,
 		passkeys.WithLogger(logger),
@@ -109,6 +112,14 @@ func main() {
 	mux.HandleFunc("/generate-authentication-options", w.BeginDiscoverableAuthentication)
 	mux.HandleFunc("/verify-authentication", w.FinishAuthentication)
 	mux.HandleFunc("/verify", w.VerifyAuthentication)
+	mux.HandleFunc("/credentials", w.ListCredentials)
+	mux.HandleFunc("/credentials/rename", w.RenameCredential)
+	mux.HandleFunc("/credentials/revoke", w.RevokeCredential)
+	mux.HandleFunc("/credentials/add/begin", w.BeginAddCredential)
+	mux.HandleFunc("/credentials/add/finish", w.FinishAddCredential)
+	mux.HandleFunc("/refresh", mw.Refresh)
+	mux.HandleFunc("/logout", mw.Logout)
+	mux.HandleFunc("/logout-all", mw.LogoutAllSessions)
 
 	tsc := devtest.NewTypescriptSources(
 		devtest.WithTypescriptTarget("es2017"),
@@ -5,10 +5,11 @@
 package passkeys
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"fmt"
 	"sync"
+	"time"
 
 	"github.com/go-webauthn/webauthn/webauthn"
 )
@@ -28,9 +29,11 @@ type SessionManager interface {
 type sessionState struct {
 	user    *User
 	session *webauthn.SessionData
+	expires time.Time
 }
 
 type sessionManager struct {
+	opts     storeOptions
 	mu       sync.Mutex
 	sessions map[string]sessionState // Maps temporary keys to state.
 }
@@ -51,18 +54,35 @@ func (sm *sessionManager) Registering(user *User, sessionData *webauthn.SessionD
 	}
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	sm.sessions[tmpKey] = sessionState{user: user, session: sessionData}
+	sm.sessions[tmpKey] = sessionState{user: user, session: sessionData, expires: sm.expires()}
 	return tmpKey, false, nil
 }
 
-func (sm *sessionManager) Registered(tmpKey string) (user *User, sessionData *webauthn.SessionData, err error) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+func (sm *sessionManager) expires() time.Time {
+	return sm.opts.nowFunc().Add(sm.opts.sessionTTL)
+}
+
+// take retrieves and removes the session for tmpKey, it must be called
+// with sm.mu held.
+func (sm *sessionManager) take(tmpKey string) (sessionState, error) {
 	data, exists := sm.sessions[tmpKey]
 	if !exists {
-		return nil, nil, fmt.Errorf("session not found")
+		return sessionState{}, ErrSessionNotFound
 	}
 	delete(sm.sessions, tmpKey) // Remove the session after retrieval.
+	if sm.opts.nowFunc().After(data.expires) {
+		return sessionState{}, ErrSessionNotFound
+	}
+	return data, nil
+}
+
+func (sm *sessionManager) Registered(tmpKey string) (user *User, sessionData *webauthn.SessionData, err error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	data, err := sm.take(tmpKey)
+	if err != nil {
+		return nil, nil, err
+	}
 	return data.user, data.session, nil
 }
 
@@ -73,17 +93,31 @@ func (sm *sessionManager) Authenticating(sessionData *webauthn.SessionData) (tmp
 	}
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	sm.sessions[tmpKey] = sessionState{session: sessionData}
+	sm.sessions[tmpKey] = sessionState{session: sessionData, expires: sm.expires()}
 	return tmpKey, nil
 }
 
 func (sm *sessionManager) Authenticated(tmpKey string) (sessionData *webauthn.SessionData, err error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	data, exists := sm.sessions[tmpKey]
-	if !exists {
-		return nil, fmt.Errorf("session not found")
+	data, err := sm.take(tmpKey)
+	if err != nil {
+		return nil, err
 	}
-	delete(sm.sessions, tmpKey) // Remove the session after retrieval.
 	return data.session, nil
 }
+
+// DeleteExpiredSessions implements SessionExpirer.
+func (sm *sessionManager) DeleteExpiredSessions(_ context.Context) (int, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	now := sm.opts.nowFunc()
+	n := 0
+	for key, data := range sm.sessions {
+		if now.After(data.expires) {
+			delete(sm.sessions, key)
+			n++
+		}
+	}
+	return n, nil
+}
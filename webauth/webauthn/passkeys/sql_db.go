@@ -0,0 +1,272 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WithSQLTableNames sets the names of the tables used by SQLUserDatabase,
+// the defaults are passkey_users and passkey_sessions.
+func WithSQLTableNames(users, sessions string) StoreOption {
+	return func(o *storeOptions) {
+		o.sqlUsersTable = users
+		o.sqlSessionTable = sessions
+	}
+}
+
+// WithSQLPlaceholder sets the function used by SQLUserDatabase to
+// generate the placeholder for the n'th (starting at 1) parameter of a
+// query. The default is to use ? as supported by SQLite and MySQL, see
+// DollarPlaceholder for PostgreSQL.
+func WithSQLPlaceholder(fn func(n int) string) StoreOption {
+	return func(o *storeOptions) {
+		o.sqlPlaceholder = fn
+	}
+}
+
+// DollarPlaceholder returns $n and can be used with WithSQLPlaceholder
+// for databases, such as PostgreSQL, that use numbered placeholders.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQLUserDatabase is an implementation of UserDatabase, UserEmailLookup,
+// SessionManager and SessionExpirer that stores users and sessions in an
+// SQL database accessed via database/sql. Only portable SQL is used and
+// the required tables are created if they do not already exist. A users
+// table created without an email column, by an earlier version of this
+// package, is migrated to include one.
+type SQLUserDatabase struct {
+	persistentSessions
+	db *sql.DB
+	q  sqlQueries
+}
+
+type sqlQueries struct {
+	createUsers, createSessions        string
+	deleteUser, insertUser, lookupUser string
+	lookupEmail, lookupEmailOwner      string
+	probeEmail, addEmail, indexEmail   string
+	selectUsers, updateEmail           string
+	insertSession, selectSession       string
+	deleteSession, deleteExpired       string
+}
+
+func newSQLQueries(o storeOptions) sqlQueries {
+	users, sessions, p := o.sqlUsersTable, o.sqlSessionTable, o.sqlPlaceholder
+	return sqlQueries{
+		createUsers:      fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id VARCHAR(128) PRIMARY KEY, email VARCHAR(320) UNIQUE, data TEXT NOT NULL)", users),
+		createSessions:   fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (session_key VARCHAR(64) PRIMARY KEY, data TEXT NOT NULL, expires BIGINT NOT NULL)", sessions),
+		deleteUser:       fmt.Sprintf("DELETE FROM %s WHERE id = %s", users, p(1)),
+		insertUser:       fmt.Sprintf("INSERT INTO %s (id, email, data) VALUES (%s, %s, %s)", users, p(1), p(2), p(3)),
+		lookupUser:       fmt.Sprintf("SELECT data FROM %s WHERE id = %s", users, p(1)),
+		lookupEmail:      fmt.Sprintf("SELECT data FROM %s WHERE email = %s", users, p(1)),
+		lookupEmailOwner: fmt.Sprintf("SELECT id FROM %s WHERE email = %s", users, p(1)),
+		probeEmail:       fmt.Sprintf("SELECT email FROM %s WHERE 1 = 0", users),
+		addEmail:         fmt.Sprintf("ALTER TABLE %s ADD COLUMN email VARCHAR(320)", users),
+		indexEmail:       fmt.Sprintf("CREATE UNIQUE INDEX %s_email ON %s (email)", users, users),
+		selectUsers:      fmt.Sprintf("SELECT id, data FROM %s", users),
+		updateEmail:      fmt.Sprintf("UPDATE %s SET email = %s WHERE id = %s", users, p(1), p(2)),
+		insertSession:    fmt.Sprintf("INSERT INTO %s (session_key, data, expires) VALUES (%s, %s, %s)", sessions, p(1), p(2), p(3)),
+		selectSession:    fmt.Sprintf("SELECT data, expires FROM %s WHERE session_key = %s", sessions, p(1)),
+		deleteSession:    fmt.Sprintf("DELETE FROM %s WHERE session_key = %s", sessions, p(1)),
+		deleteExpired:    fmt.Sprintf("DELETE FROM %s WHERE expires < %s", sessions, p(1)),
+	}
+}
+
+// NewSQLUserDatabase returns a SQLUserDatabase that uses db, creating
+// the tables it requires if they do not already exist.
+func NewSQLUserDatabase(ctx context.Context, db *sql.DB, opts ...StoreOption) (*SQLUserDatabase, error) {
+	o := newStoreOptions(opts)
+	sdb := &SQLUserDatabase{db: db, q: newSQLQueries(o)}
+	for _, stmt := range []string{sdb.q.createUsers, sdb.q.createSessions} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to create passkeys table: %w", err)
+		}
+	}
+	if err := sdb.migrateUsers(ctx); err != nil {
+		return nil, fmt.Errorf("failed to migrate passkeys users table: %w", err)
+	}
+	sdb.persistentSessions = persistentSessions{
+		store: sqlSessions{db: db, q: &sdb.q},
+		opts:  o,
+	}
+	return sdb, nil
+}
+
+// inTx runs fn within a transaction, committing it if fn returns nil and
+// rolling it back otherwise.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+// migrateUsers adds the email column, and a unique index on it, to a
+// users table that was created without one, populating it from the
+// stored users. It fails if more than one user has the same email address.
+func (sdb *SQLUserDatabase) migrateUsers(ctx context.Context) error {
+	var email sql.NullString
+	if err := sdb.db.QueryRowContext(ctx, sdb.q.probeEmail).Scan(&email); errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return inTx(ctx, sdb.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, sdb.q.addEmail); err != nil {
+			return err
+		}
+		emails, err := sqlUserEmails(ctx, tx, sdb.q.selectUsers)
+		if err != nil {
+			return err
+		}
+		for id, email := range emails {
+			if _, err := tx.ExecContext(ctx, sdb.q.updateEmail, email, id); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, sdb.q.indexEmail)
+		return err
+	})
+}
+
+// sqlUserEmails returns the email keys of all users that have one, keyed
+// by user ID.
+func sqlUserEmails(ctx context.Context, tx *sql.Tx, query string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	emails := map[string]string{}
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		user, err := decodeUser([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		if key := emailKey(user.email); len(key) > 0 {
+			emails[id] = key
+		}
+	}
+	return emails, rows.Err()
+}
+
+// sqlEmail returns the value of the email column for key, which is NULL
+// for users without an email address so that they are not subject to the
+// column's uniqueness constraint.
+func sqlEmail(key string) sql.NullString {
+	return sql.NullString{String: key, Valid: len(key) > 0}
+}
+
+// Store implements UserDatabase.
+func (sdb *SQLUserDatabase) Store(user *User) error {
+	data, err := encodeUser(user)
+	if err != nil {
+		return err
+	}
+	id, key := user.ID().String(), emailKey(user.email)
+	// Delete followed by insert is used in place of the various
+	// non-portable forms of 'upsert'.
+	return inTx(context.Background(), sdb.db, func(tx *sql.Tx) error {
+		if len(key) > 0 {
+			// Check explicitly so that ErrEmailInUse can be returned
+			// rather than a driver specific constraint violation.
+			var owner string
+			err := tx.QueryRow(sdb.q.lookupEmailOwner, key).Scan(&owner)
+			switch {
+			case err == nil && owner != id:
+				return ErrEmailInUse
+			case err != nil && !errors.Is(err, sql.ErrNoRows):
+				return err
+			}
+		}
+		if _, err := tx.Exec(sdb.q.deleteUser, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(sdb.q.insertUser, id, sqlEmail(key), string(data))
+		return err
+	})
+}
+
+// Lookup implements UserDatabase.
+func (sdb *SQLUserDatabase) Lookup(uid UserID) (*User, error) {
+	return sdb.lookup(sdb.q.lookupUser, uid.String())
+}
+
+// LookupByEmail implements UserEmailLookup.
+func (sdb *SQLUserDatabase) LookupByEmail(email string) (*User, error) {
+	return sdb.lookup(sdb.q.lookupEmail, emailKey(email))
+}
+
+func (sdb *SQLUserDatabase) lookup(query, key string) (*User, error) {
+	var data string
+	err := sdb.db.QueryRow(query, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeUser([]byte(data))
+}
+
+type sqlSessions struct {
+	db *sql.DB
+	q  *sqlQueries
+}
+
+func (ss sqlSessions) putSession(key string, data []byte, expires time.Time) error {
+	_, err := ss.db.Exec(ss.q.insertSession, key, string(data), expires.UnixNano())
+	return err
+}
+
+func (ss sqlSessions) takeSession(key string) ([]byte, time.Time, error) {
+	var data string
+	var expires int64
+	err := inTx(context.Background(), ss.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(ss.q.selectSession, key).Scan(&data, &expires)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec(ss.q.deleteSession, key)
+		if err != nil {
+			return err
+		}
+		// A concurrent request may have already used this session.
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrSessionNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return []byte(data), time.Unix(0, expires), nil
+}
+
+func (ss sqlSessions) deleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	res, err := ss.db.ExecContext(ctx, ss.q.deleteExpired, now.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,270 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloudeng.io/logging/ctxlog"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	// ErrUserNotFound is returned by UserDatabase.Lookup when the user
+	// does not exist.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrSessionNotFound is returned by the SessionManager implementations
+	// in this package when a session does not exist, has already been used
+	// or has expired.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrEmailInUse is returned by the UserDatabase implementations in
+	// this package when storing a user whose email address is already
+	// in use by a different user.
+	ErrEmailInUse = errors.New("email address already in use")
+)
+
+// DefaultSessionTTL is the default time-to-live for the state stored
+// between the 'begin' and 'finish' registration and authentication
+// requests. It matches the default duration of the session cookies used
+// by Handler.
+const DefaultSessionTTL = 10 * time.Minute
+
+// StoreOption represents an option for configuring the UserDatabase and
+// SessionManager implementations provided by this package.
+type StoreOption func(o *storeOptions)
+
+type storeOptions struct {
+	sessionTTL      time.Duration
+	nowFunc         func() time.Time
+	sqlUsersTable   string
+	sqlSessionTable string
+	sqlPlaceholder  func(n int) string
+}
+
+// WithSessionTTL sets the time-to-live for session entries, the default
+// is DefaultSessionTTL. Expired entries are never returned and are deleted
+// by DeleteExpiredSessions.
+func WithSessionTTL(ttl time.Duration) StoreOption {
+	return func(o *storeOptions) {
+		o.sessionTTL = ttl
+	}
+}
+
+// WithNowFunc sets the function used to obtain the current time when
+// setting and checking session expiry. This is generally only required
+// for testing purposes.
+func WithNowFunc(fn func() time.Time) StoreOption {
+	return func(o *storeOptions) {
+		o.nowFunc = fn
+	}
+}
+
+func newStoreOptions(opts []StoreOption) storeOptions {
+	o := storeOptions{
+		sessionTTL:      DefaultSessionTTL,
+		nowFunc:         time.Now,
+		sqlUsersTable:   "passkey_users",
+		sqlSessionTable: "passkey_sessions",
+		sqlPlaceholder:  func(int) string { return "?" },
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// SessionExpirer is implemented by the SessionManagers in this package
+// to allow for the removal of expired sessions.
+type SessionExpirer interface {
+	// DeleteExpiredSessions deletes all expired sessions and returns
+	// the number deleted.
+	DeleteExpiredSessions(ctx context.Context) (int, error)
+}
+
+// GarbageCollectSessions calls DeleteExpiredSessions every interval until
+// the context is canceled. Errors are logged and do not stop the garbage
+// collection.
+func GarbageCollectSessions(ctx context.Context, interval time.Duration, se SessionExpirer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := se.DeleteExpiredSessions(ctx)
+		if err != nil {
+			ctxlog.Error(ctx, "passkeys: failed to delete expired sessions", "error", err)
+			continue
+		}
+		ctxlog.Debug(ctx, "passkeys: deleted expired sessions", "deleted", n)
+	}
+}
+
+// storedUser is the serialized form of a User.
+type storedUser struct {
+	ID            []byte                        `json:"id"`
+	Email         string                        `json:"email"`
+	DisplayName   string                        `json:"display_name"`
+	EmailVerified bool                          `json:"email_verified,omitempty"`
+	Credentials   []webauthn.Credential         `json:"credentials,omitempty"`
+	Metadata      map[string]credentialMetadata `json:"metadata,omitempty"`
+}
+
+func encodeUser(user *User) ([]byte, error) {
+	return json.Marshal(storedUser{
+		ID:            user.id[:],
+		Email:         user.email,
+		DisplayName:   user.displayName,
+		EmailVerified: user.emailVerified,
+		Credentials:   user.credentials,
+		Metadata:      user.metadata,
+	})
+}
+
+func decodeUser(data []byte) (*User, error) {
+	var su storedUser
+	if err := json.Unmarshal(data, &su); err != nil {
+		return nil, fmt.Errorf("failed to decode user: %w", err)
+	}
+	if len(su.ID) != len(User{}.id) {
+		return nil, fmt.Errorf("invalid user id length: %d", len(su.ID))
+	}
+	user := &User{
+		email:         su.Email,
+		displayName:   su.DisplayName,
+		emailVerified: su.EmailVerified,
+		credentials:   su.Credentials,
+		metadata:      su.Metadata,
+	}
+	copy(user.id[:], su.ID)
+	return user, nil
+}
+
+// storedSession is the serialized form of a sessionState.
+type storedSession struct {
+	User    json.RawMessage       `json:"user,omitempty"`
+	Session *webauthn.SessionData `json:"session"`
+}
+
+func encodeSession(user *User, sessionData *webauthn.SessionData) ([]byte, error) {
+	ss := storedSession{Session: sessionData}
+	if user != nil {
+		data, err := encodeUser(user)
+		if err != nil {
+			return nil, err
+		}
+		ss.User = data
+	}
+	return json.Marshal(ss)
+}
+
+func decodeSession(data []byte) (*User, *webauthn.SessionData, error) {
+	var ss storedSession
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	if len(ss.User) == 0 {
+		return nil, ss.Session, nil
+	}
+	user, err := decodeUser(ss.User)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, ss.Session, nil
+}
+
+// sessionStore is implemented by the persistent stores to save session
+// state with an expiry time.
+type sessionStore interface {
+	// putSession stores data under key.
+	putSession(key string, data []byte, expires time.Time) error
+	// takeSession retrieves and deletes the session for key, it returns
+	// ErrSessionNotFound if there is no such session.
+	takeSession(key string) (data []byte, expires time.Time, err error)
+	// deleteExpiredSessions deletes all sessions that expired before now.
+	deleteExpiredSessions(ctx context.Context, now time.Time) (int, error)
+}
+
+// persistentSessions implements SessionManager and SessionExpirer using
+// a sessionStore.
+type persistentSessions struct {
+	store sessionStore
+	opts  storeOptions
+}
+
+func (ps *persistentSessions) put(user *User, sessionData *webauthn.SessionData) (string, error) {
+	tmpKey, err := generateSecureRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	data, err := encodeSession(user, sessionData)
+	if err != nil {
+		return "", err
+	}
+	if err := ps.store.putSession(tmpKey, data, ps.opts.nowFunc().Add(ps.opts.sessionTTL)); err != nil {
+		return "", err
+	}
+	return tmpKey, nil
+}
+
+func (ps *persistentSessions) take(tmpKey string) (*User, *webauthn.SessionData, error) {
+	data, expires, err := ps.store.takeSession(tmpKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ps.opts.nowFunc().After(expires) {
+		return nil, nil, ErrSessionNotFound
+	}
+	return decodeSession(data)
+}
+
+// Registering implements SessionManager.
+func (ps *persistentSessions) Registering(user *User, sessionData *webauthn.SessionData) (tmpKey string, exists bool, err error) {
+	tmpKey, err = ps.put(user, sessionData)
+	return tmpKey, false, err
+}
+
+// Registered implements SessionManager.
+func (ps *persistentSessions) Registered(tmpKey string) (user *User, sessionData *webauthn.SessionData, err error) {
+	return ps.take(tmpKey)
+}
+
+// Authenticating implements SessionManager.
+func (ps *persistentSessions) Authenticating(sessionData *webauthn.SessionData) (tmpKey string, err error) {
+	return ps.put(nil, sessionData)
+}
+
+// Authenticated implements SessionManager.
+func (ps *persistentSessions) Authenticated(tmpKey string) (sessionData *webauthn.SessionData, err error) {
+	_, sessionData, err = ps.take(tmpKey)
+	return sessionData, err
+}
+
+// DeleteExpiredSessions implements SessionExpirer.
+func (ps *persistentSessions) DeleteExpiredSessions(ctx context.Context) (int, error) {
+	return ps.store.deleteExpiredSessions(ctx, ps.opts.nowFunc())
+}
+
+// encodeExpiry and decodeExpiry are used to prefix session data with its
+// expiry time for stores that do not otherwise support structured values.
+func encodeExpiry(expires time.Time, data []byte) []byte {
+	buf := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(buf, uint64(expires.UnixNano()))
+	return append(buf, data...)
+}
+
+func decodeExpiry(buf []byte) (time.Time, []byte, error) {
+	if len(buf) < 8 {
+		return time.Time{}, nil, fmt.Errorf("invalid session data length: %d", len(buf))
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(buf))), buf[8:], nil
+}
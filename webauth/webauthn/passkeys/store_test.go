@@ -0,0 +1,339 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package passkeys_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webauth/webauthn/passkeys"
+	"github.com/go-webauthn/webauthn/webauthn"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type store interface {
+	passkeys.UserDatabase
+	passkeys.SessionManager
+	passkeys.SessionExpirer
+}
+
+var (
+	_ store = (*passkeys.RAMUserDatabase)(nil)
+	_ store = (*passkeys.BoltUserDatabase)(nil)
+	_ store = (*passkeys.SQLUserDatabase)(nil)
+
+	_ passkeys.UserEmailLookup = (*passkeys.RAMUserDatabase)(nil)
+	_ passkeys.UserEmailLookup = (*passkeys.BoltUserDatabase)(nil)
+	_ passkeys.UserEmailLookup = (*passkeys.SQLUserDatabase)(nil)
+)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestUser(t *testing.T) *passkeys.User {
+	t.Helper()
+	user, err := passkeys.NewUser("test@example.com", "Test User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.AddCredential(webauthn.Credential{
+		ID:              []byte("credential-id"),
+		PublicKey:       []byte("public-key"),
+		AttestationType: "none",
+		Authenticator:   webauthn.Authenticator{SignCount: 3},
+	})
+	return user
+}
+
+func testUserStore(t *testing.T, db passkeys.UserDatabase) *passkeys.User {
+	t.Helper()
+	user := newTestUser(t)
+	if _, err := db.Lookup(user.ID()); !errors.Is(err, passkeys.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := db.Store(user); err != nil {
+		t.Fatal(err)
+	}
+	// Store must overwrite existing entries.
+	user.AddCredential(webauthn.Credential{ID: []byte("second-credential-id")})
+	if err := db.Store(user); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.Lookup(user.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareUsers(t, got, user)
+
+	el := db.(passkeys.UserEmailLookup)
+	got, err = el.LookupByEmail(" TEST@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareUsers(t, got, user)
+	if _, err := el.LookupByEmail("other@example.com"); !errors.Is(err, passkeys.ErrUserNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Email addresses must be unique, other than for users without one.
+	other, err := passkeys.NewUser(" Test@Example.com", "Other User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Store(other); !errors.Is(err, passkeys.ErrEmailInUse) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := db.Lookup(other.ID()); !errors.Is(err, passkeys.ErrUserNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for range 2 {
+		anon, err := passkeys.NewUser("", "Anonymous User")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Store(anon); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user
+}
+
+func compareUsers(t *testing.T, got, want *passkeys.User) {
+	t.Helper()
+	if got.ID().String() != want.ID().String() {
+		t.Errorf("got %v, want %v", got.ID(), want.ID())
+	}
+	if got.WebAuthnName() != want.WebAuthnName() || got.WebAuthnDisplayName() != want.WebAuthnDisplayName() {
+		t.Errorf("got %v/%v, want %v/%v", got.WebAuthnName(), got.WebAuthnDisplayName(), want.WebAuthnName(), want.WebAuthnDisplayName())
+	}
+	if !reflect.DeepEqual(got.WebAuthnCredentials(), want.WebAuthnCredentials()) {
+		t.Errorf("got %#v, want %#v", got.WebAuthnCredentials(), want.WebAuthnCredentials())
+	}
+}
+
+func testSessionStore(ctx context.Context, t *testing.T, sm store, clock *testClock) {
+	t.Helper()
+	user := newTestUser(t)
+	session := &webauthn.SessionData{
+		Challenge:        "challenge",
+		UserID:           user.WebAuthnID(),
+		UserVerification: "required",
+	}
+
+	tmpKey, _, err := sm.Registering(user, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotUser, gotSession, err := sm.Registered(tmpKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareUsers(t, gotUser, user)
+	if got, want := gotSession.Challenge, session.Challenge; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Sessions can only be used once.
+	if _, _, err := sm.Registered(tmpKey); !errors.Is(err, passkeys.ErrSessionNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tmpKey, err = sm.Authenticating(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotSession, err = sm.Authenticated(tmpKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gotSession.UserVerification, session.UserVerification; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := sm.Authenticated(tmpKey); !errors.Is(err, passkeys.ErrSessionNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Expired sessions are never returned.
+	tmpKey, err = sm.Authenticating(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute + time.Second)
+	if _, err := sm.Authenticated(tmpKey); !errors.Is(err, passkeys.ErrSessionNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Expired sessions are garbage collected.
+	for range 3 {
+		if _, err := sm.Authenticating(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(30 * time.Second)
+	live, err := sm.Authenticating(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := sm.DeleteExpiredSessions(ctx); err != nil || n != 0 {
+		t.Errorf("got %v, %v, want 0, nil", n, err)
+	}
+	clock.Advance(31 * time.Second)
+	if n, err := sm.DeleteExpiredSessions(ctx); err != nil || n != 3 {
+		t.Errorf("got %v, %v, want 3, nil", n, err)
+	}
+	if _, err := sm.Authenticated(live); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func storeOptions() (*testClock, []passkeys.StoreOption) {
+	clock := &testClock{now: time.Now()}
+	return clock, []passkeys.StoreOption{
+		passkeys.WithSessionTTL(time.Minute),
+		passkeys.WithNowFunc(clock.Now),
+	}
+}
+
+func TestRAMUserDatabaseStore(t *testing.T) {
+	ctx := context.Background()
+	clock, opts := storeOptions()
+	db := passkeys.NewRAMUserDatabase(opts...)
+	testUserStore(t, db)
+	testSessionStore(ctx, t, db, clock)
+}
+
+func TestBoltUserDatabase(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "passkeys.db")
+	clock, opts := storeOptions()
+	db, err := passkeys.NewBoltUserDatabase(filename, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := testUserStore(t, db)
+	testSessionStore(ctx, t, db, clock)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = passkeys.NewBoltUserDatabase(filename, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got, err := db.Lookup(user.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareUsers(t, got, user)
+}
+
+func TestSQLUserDatabase(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "passkeys.sqlite")
+	sqldb, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+
+	clock, opts := storeOptions()
+	db, err := passkeys.NewSQLUserDatabase(ctx, sqldb, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := testUserStore(t, db)
+	testSessionStore(ctx, t, db, clock)
+
+	// Creating a second database over the same tables must succeed and
+	// see the existing users.
+	db, err = passkeys.NewSQLUserDatabase(ctx, sqldb, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.Lookup(user.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareUsers(t, got, user)
+
+	// Alternate table names and numbered placeholders.
+	opts = append(opts,
+		passkeys.WithSQLTableNames("users", "sessions"),
+		passkeys.WithSQLPlaceholder(passkeys.DollarPlaceholder))
+	db, err = passkeys.NewSQLUserDatabase(ctx, sqldb, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Lookup(user.ID()); !errors.Is(err, passkeys.ErrUserNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	testUserStore(t, db)
+	testSessionStore(ctx, t, db, clock)
+}
+
+func TestSQLUserDatabaseMigration(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "passkeys.sqlite")
+	sqldb, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+
+	// Create a users table without an email column, as created by
+	// earlier versions of SQLUserDatabase, and copy a user into it.
+	db, err := passkeys.NewSQLUserDatabase(ctx, sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newTestUser(t)
+	if err := db.Store(user); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE legacy_users (id VARCHAR(128) PRIMARY KEY, data TEXT NOT NULL)",
+		"INSERT INTO legacy_users (id, data) SELECT id, data FROM passkey_users",
+	} {
+		if _, err := sqldb.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := []passkeys.StoreOption{passkeys.WithSQLTableNames("legacy_users", "legacy_sessions")}
+	for range 2 {
+		db, err = passkeys.NewSQLUserDatabase(ctx, sqldb, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.LookupByEmail("test@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareUsers(t, got, user)
+	}
+	if err := db.Store(newTestUser(t)); !errors.Is(err, passkeys.ErrEmailInUse) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
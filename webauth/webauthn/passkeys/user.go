@@ -9,6 +9,9 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"maps"
+	"slices"
+	"time"
 
 	"github.com/go-webauthn/webauthn/webauthn"
 )
@@ -74,10 +77,46 @@ func UserIDFromString(s string) (UserID, error) {
 
 // User represents a user that registers to use a passkey and implements webauthn.User
 type User struct {
-	id          [64]byte              // Unique identifier for the user, used in WebAuthn.
-	email       string                // Email address of the user, supplied by the user and not verfied in any way.
-	displayName string                // Display name of the user, can be used for UI purposes.
-	credentials []webauthn.Credential // List of WebAuthn credentials associated with the user.
+	id            [64]byte              // Unique identifier for the user, used in WebAuthn.
+	email         string                // Email address of the user, supplied by the user.
+	emailVerified bool                  // True if the email address was verified, see WithEmailVerification.
+	displayName   string                // Display name of the user, can be used for UI purposes.
+	credentials   []webauthn.Credential // List of WebAuthn credentials associated with the user.
+
+	// Information about each credential not provided by WebAuthn, keyed
+	// by credentialKey(credential.ID).
+	metadata map[string]credentialMetadata
+}
+
+type credentialMetadata struct {
+	Name     string    `json:"name,omitempty"`
+	Created  time.Time `json:"created,omitzero"`
+	LastUsed time.Time `json:"last_used,omitzero"`
+	// Attestation is set if the credential was checked by an
+	// AttestationPolicy when it was registered.
+	Attestation *AttestationResult `json:"attestation,omitempty"`
+}
+
+func credentialKey(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func (u *User) setMetadata(id []byte, fn func(*credentialMetadata)) {
+	if u.metadata == nil {
+		u.metadata = make(map[string]credentialMetadata)
+	}
+	key := credentialKey(id)
+	md := u.metadata[key]
+	fn(&md)
+	u.metadata[key] = md
+}
+
+// clone returns a deep copy of the user's credentials and metadata.
+func (u *User) clone() *User {
+	c := *u
+	c.credentials = slices.Clone(u.credentials)
+	c.metadata = maps.Clone(u.metadata)
+	return &c
 }
 
 // NewUser creates a new user with the given email and display name.
@@ -102,11 +141,15 @@ func (u *User) ID() UserID {
 	return &tmp
 }
 
-// UpdateCredential updates an existing credential for the user.
+// UpdateCredential updates an existing credential for the user and records
+// the current time as the time it was last used.
 func (u *User) UpdateCredential(cred webauthn.Credential) bool {
 	for i, c := range u.credentials {
 		if bytes.Equal(c.ID, cred.ID) {
 			u.credentials[i] = cred
+			u.setMetadata(cred.ID, func(md *credentialMetadata) {
+				md.LastUsed = time.Now()
+			})
 			return true
 		}
 	}
@@ -145,7 +188,11 @@ func (u *User) WebAuthnCredentials() []webauthn.Credential {
 	return u.credentials
 }
 
-// Implements webauthn.User.
+// AddCredential adds a credential for the user and records the current
+// time as the time it was created.
 func (u *User) AddCredential(cred webauthn.Credential) {
 	u.credentials = append(u.credentials, cred)
+	u.setMetadata(cred.ID, func(md *credentialMetadata) {
+		md.Created = time.Now()
+	})
 }
@@ -5,7 +5,7 @@
 package passkeys
 
 import (
-	"fmt"
+	"strings"
 	"sync"
 )
 
@@ -20,31 +20,68 @@ type UserDatabase interface {
 	Lookup(uid UserID) (*User, error)
 }
 
+// UserEmailLookup is implemented by UserDatabases that can look up users
+// by their email address. It is required for account recovery and to
+// prevent the same email address being registered more than once when
+// email verification is enabled. Email addresses are compared without
+// regard to case. The implementations in this package also refuse to
+// store a user whose email address is already in use by a different user,
+// returning ErrEmailInUse; users without an email address are not
+// indexed.
+type UserEmailLookup interface {
+	// LookupByEmail retrieves the user with the specified email address,
+	// it returns ErrUserNotFound if there is no such user.
+	LookupByEmail(email string) (*User, error)
+}
+
+func emailKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// RAMUserDatabase is an in-memory implementation of UserDatabase,
+// UserEmailLookup, SessionManager and SessionExpirer. All users and sessions are lost
+// when the process exits, see BoltUserDatabase and SQLUserDatabase for
+// persistent implementations.
 type RAMUserDatabase struct {
 	*sessionManager
 	*userDatabase
 }
 
-func NewRAMUserDatabase() *RAMUserDatabase {
+// NewRAMUserDatabase returns a new RAMUserDatabase configured with the
+// supplied options.
+func NewRAMUserDatabase(opts ...StoreOption) *RAMUserDatabase {
 	return &RAMUserDatabase{
 		sessionManager: &sessionManager{
+			opts:     newStoreOptions(opts),
 			sessions: make(map[string]sessionState),
 		},
 		userDatabase: &userDatabase{
-			users: make(map[string]User),
+			users:  make(map[string]*User),
+			emails: make(map[string]string),
 		},
 	}
 }
 
 type userDatabase struct {
-	mu    sync.Mutex
-	users map[string]User // Maps user IDs to user data.
+	mu     sync.Mutex
+	users  map[string]*User  // Maps user IDs to user data.
+	emails map[string]string // Maps email keys to user IDs.
 }
 
 func (um *userDatabase) Store(user *User) error {
 	um.mu.Lock()
 	defer um.mu.Unlock()
-	um.users[user.ID().String()] = *user
+	id, key := user.ID().String(), emailKey(user.email)
+	if owner, ok := um.emails[key]; ok && owner != id {
+		return ErrEmailInUse
+	}
+	if prev, ok := um.users[id]; ok {
+		delete(um.emails, emailKey(prev.email))
+	}
+	if len(key) > 0 {
+		um.emails[key] = id
+	}
+	um.users[id] = user.clone()
 	return nil
 }
 
@@ -53,7 +90,17 @@ func (um *userDatabase) Lookup(userID UserID) (*User, error) {
 	defer um.mu.Unlock()
 	user, exists := um.users[userID.String()]
 	if !exists {
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrUserNotFound
+	}
+	return user.clone(), nil
+}
+
+func (um *userDatabase) LookupByEmail(email string) (*User, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	id, ok := um.emails[emailKey(email)]
+	if !ok {
+		return nil, ErrUserNotFound
 	}
-	return &user, nil
+	return um.users[id].clone(), nil
 }
@@ -0,0 +1,131 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultDeduplicationSize is the default maximum number of delivery keys
+// remembered for de-duplication.
+const DefaultDeduplicationSize = 10000
+
+// DefaultDeduplicationHeaders are the request headers used to identify a
+// delivery for de-duplication when Deduplication.KeyHeaders is not set.
+// They carry a per-delivery ID that is preserved when a delivery is retried
+// by the sender and that is covered by the sender's signature. Headers that
+// are not signed, such as X-GitHub-Delivery, are not included since a
+// captured request could be replayed with a fresh ID; such deliveries are
+// identified by their payload digest alone.
+var DefaultDeduplicationHeaders = []string{
+	SvixIDHeader,
+}
+
+// Deduplication configures the detection of duplicate deliveries, whether
+// they are retries by the sender or replays of a captured request. Each
+// validated delivery is identified by the SHA256 digest of its payload
+// combined with the value of the first of KeyHeaders that is present in the
+// request, if any. KeyHeaders should only list headers that are covered by
+// the sender's signature. A delivery whose key has been seen within Window
+// is a duplicate. At most Size keys are remembered, the oldest are
+// forgotten first. For providers that sign a timestamp, see
+// ProviderValidator, Window should be at least as long as the signature
+// tolerance so that a replayed request is rejected either as stale or as
+// a duplicate.
+type Deduplication struct {
+	Window     time.Duration `yaml:"window" doc:"if set, deliveries with the same key seen within this duration are treated as duplicates, leave empty to disable de-duplication"`
+	Size       int           `yaml:"size" doc:"maximum number of delivery keys to remember, leave empty for the default of 10000"`
+	KeyHeaders []string      `yaml:"key_headers" doc:"request headers that identify a delivery, the first present is combined with the payload digest, leave empty for Svix-Id"`
+	Reject     bool          `yaml:"reject" doc:"if set, duplicates are rejected with 409 Conflict, otherwise they are accepted with 202 Accepted but are not relayed"`
+}
+
+// WithDeduplication enables de-duplication of deliveries as configured by
+// dedup. De-duplication is disabled (the default) when dedup.Window is
+// <= 0.
+func WithDeduplication(dedup Deduplication) Option {
+	return func(opts *options) {
+		opts.dedup = dedup
+	}
+}
+
+// dedupCache is a bounded, time-windowed, set of delivery keys.
+type dedupCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	size   int
+	seen   map[string]time.Time
+	order  []dedupEntry // oldest first
+}
+
+type dedupEntry struct {
+	key string
+	at  time.Time
+}
+
+func newDedupCache(dedup Deduplication) *dedupCache {
+	size := dedup.Size
+	if size <= 0 {
+		size = DefaultDeduplicationSize
+	}
+	return &dedupCache{
+		window: dedup.Window,
+		size:   size,
+		seen:   make(map[string]time.Time, size),
+	}
+}
+
+// add records key as seen at now, returning false if it had already been
+// seen within the window.
+func (c *dedupCache) add(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cutoff := now.Add(-c.window)
+	for len(c.order) > 0 && !c.order[0].at.After(cutoff) {
+		c.forget(c.order[0])
+		c.order = c.order[1:]
+	}
+	if _, ok := c.seen[key]; ok {
+		return false
+	}
+	for len(c.order) >= c.size {
+		c.forget(c.order[0])
+		c.order = c.order[1:]
+	}
+	c.seen[key] = now
+	c.order = append(c.order, dedupEntry{key: key, at: now})
+	return true
+}
+
+// forget removes e's key unless it has since been seen again.
+func (c *dedupCache) forget(e dedupEntry) {
+	if at, ok := c.seen[e.key]; ok && at.Equal(e.at) {
+		delete(c.seen, e.key)
+	}
+}
+
+// remove forgets key, for example when the delivery it identifies could
+// not be accepted and the sender is expected to retry. The key's entry in
+// order is left to be discarded by add.
+func (c *dedupCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.seen, key)
+}
+
+// dedupKey returns the key that identifies the delivery of payload by req.
+func (r *Relay) dedupKey(req *http.Request, payload []byte) string {
+	sum := sha256.Sum256(payload)
+	key := req.PathValue(SubscriptionPathValue) + "\x00sha256:" + hex.EncodeToString(sum[:])
+	for _, name := range r.opts.dedup.KeyHeaders {
+		if v := req.Header.Get(name); v != "" {
+			return key + "\x00" + http.CanonicalHeaderKey(name) + ":" + v
+		}
+	}
+	return key
+}
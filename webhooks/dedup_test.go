@@ -0,0 +1,142 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webhooks"
+)
+
+func postDelivery(t *testing.T, handler func(http.ResponseWriter, *http.Request), id string, body []byte) int {
+	t.Helper()
+	return postDeliveryWithHeader(t, handler, webhooks.SvixIDHeader, id, body)
+}
+
+func postDeliveryWithHeader(t *testing.T, handler func(http.ResponseWriter, *http.Request), header, id string, body []byte) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/webhook", bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+	if id != "" {
+		req.Header.Set(header, id)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Code
+}
+
+func TestRelayDeduplicationAccept(t *testing.T) {
+	duplicates, duplicatesN := makeCounter()
+	relayed, relayedN := makeCounter()
+	handler, _ := newTestRelay(t,
+		webhooks.WithDeduplication(webhooks.Deduplication{Window: time.Minute}),
+		webhooks.WithCounters(nil, relayed, nil),
+		webhooks.WithDuplicateCounter(duplicates))
+
+	payload := []byte(`"payload"`)
+	for range 2 {
+		// A retry has the same delivery ID and payload.
+		if got := postDelivery(t, handler, "id-1", payload); got != http.StatusAccepted {
+			t.Errorf("post: got status %d, want %d", got, http.StatusAccepted)
+		}
+	}
+	if got := pollWebhook(t, handler); !bytes.Equal(got, payload) {
+		t.Errorf("got %s, want %s", got, payload)
+	}
+	assertQueueEmpty(t, handler)
+
+	// The same payload with a different delivery ID is a new delivery.
+	if got := postDelivery(t, handler, "id-2", payload); got != http.StatusAccepted {
+		t.Errorf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	if got := pollWebhook(t, handler); !bytes.Equal(got, payload) {
+		t.Errorf("got %s, want %s", got, payload)
+	}
+	if got, want := duplicatesN(), int64(1); got != want {
+		t.Errorf("duplicates: got %d, want %d", got, want)
+	}
+	if got, want := relayedN(), int64(2); got != want {
+		t.Errorf("relayed: got %d, want %d", got, want)
+	}
+}
+
+func TestRelayDeduplicationReject(t *testing.T) {
+	handler, _ := newTestRelay(t,
+		webhooks.WithDeduplication(webhooks.Deduplication{Window: time.Minute, Reject: true}))
+
+	payload := []byte(`"payload"`)
+	// Without a delivery ID header the payload digest is used.
+	for i, want := range []int{http.StatusAccepted, http.StatusConflict} {
+		if got := postDelivery(t, handler, "", payload); got != want {
+			t.Errorf("%v: got status %d, want %d", i, got, want)
+		}
+	}
+	if got := postDelivery(t, handler, "", []byte(`"other"`)); got != http.StatusAccepted {
+		t.Errorf("got status %d, want %d", got, http.StatusAccepted)
+	}
+}
+
+func TestRelayDeduplicationReplay(t *testing.T) {
+	handler, _ := newTestRelay(t,
+		webhooks.WithDeduplication(webhooks.Deduplication{Window: time.Minute, Reject: true}))
+
+	// X-GitHub-Delivery is not signed and hence is not used by default,
+	// so replaying a payload with a fresh delivery ID is detected.
+	payload := []byte(`"payload"`)
+	for i, want := range []int{http.StatusAccepted, http.StatusConflict} {
+		id := fmt.Sprintf("id-%v", i)
+		if got := postDeliveryWithHeader(t, handler, "X-GitHub-Delivery", id, payload); got != want {
+			t.Errorf("%v: got status %d, want %d", i, got, want)
+		}
+	}
+	// A payload with a signed delivery ID is keyed on both.
+	if got := postDelivery(t, handler, "id-1", []byte(`"other"`)); got != http.StatusAccepted {
+		t.Errorf("got status %d, want %d", got, http.StatusAccepted)
+	}
+	if got := postDelivery(t, handler, "id-1", []byte(`"changed"`)); got != http.StatusAccepted {
+		t.Errorf("got status %d, want %d", got, http.StatusAccepted)
+	}
+}
+
+func TestRelayDeduplicationWindow(t *testing.T) {
+	handler, _ := newTestRelay(t,
+		webhooks.WithDeduplication(webhooks.Deduplication{Window: 50 * time.Millisecond, Reject: true}))
+
+	payload := []byte(`"payload"`)
+	if got := postDelivery(t, handler, "id-1", payload); got != http.StatusAccepted {
+		t.Errorf("got status %d, want %d", got, http.StatusAccepted)
+	}
+	if got := postDelivery(t, handler, "id-1", payload); got != http.StatusConflict {
+		t.Errorf("got status %d, want %d", got, http.StatusConflict)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := postDelivery(t, handler, "id-1", payload); got != http.StatusAccepted {
+		t.Errorf("after window: got status %d, want %d", got, http.StatusAccepted)
+	}
+}
+
+func TestRelayDeduplicationSize(t *testing.T) {
+	handler, _ := newTestRelay(t,
+		webhooks.WithDeduplication(webhooks.Deduplication{Window: time.Minute, Size: 2, Reject: true}))
+
+	for _, id := range []string{"id-1", "id-2", "id-3"} {
+		if got := postDelivery(t, handler, id, []byte(`"`+id+`"`)); got != http.StatusAccepted {
+			t.Errorf("%v: got status %d, want %d", id, got, http.StatusAccepted)
+		}
+	}
+	// id-1 has been forgotten to make room for id-3.
+	if got := postDelivery(t, handler, "id-1", []byte(`"id-1"`)); got != http.StatusAccepted {
+		t.Errorf("got status %d, want %d", got, http.StatusAccepted)
+	}
+	if got := postDelivery(t, handler, "id-3", []byte(`"id-3"`)); got != http.StatusConflict {
+		t.Errorf("got status %d, want %d", got, http.StatusConflict)
+	}
+}
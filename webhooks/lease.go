@@ -0,0 +1,168 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DeliveryIDHeader is set on long-poll responses when leases are enabled
+	// and identifies the delivery that must be acknowledged. Clients echo it
+	// back, in the same header, when acknowledging the delivery.
+	DeliveryIDHeader = "X-Relay-Delivery-ID"
+	// LeaseDeadlineHeader is set on long-poll responses when leases are
+	// enabled and contains the time, in RFC 3339 format, at which an
+	// unacknowledged delivery becomes visible to other clients again.
+	LeaseDeadlineHeader = "X-Relay-Lease-Deadline"
+	// AckPathSuffix is appended to the relay path passed to Relay.Handler to
+	// form the path on which acknowledgements are accepted.
+	AckPathSuffix = "/ack"
+)
+
+// WithLeases enables at-least-once delivery to long-polling clients. Rather
+// than being discarded as soon as it is written to a client, each delivery is
+// leased to that client for ttl and its response carries DeliveryIDHeader and
+// LeaseDeadlineHeader. The client must acknowledge the delivery, see
+// AcknowledgeWebhook, before the deadline, otherwise the delivery is returned
+// to the back of the queue and will be handed out again. Leases are disabled
+// (the default) when ttl is <= 0.
+func WithLeases(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.leaseTTL = ttl
+	}
+}
+
+type lease struct {
+	d     delivery
+	timer *time.Timer
+}
+
+// leases tracks the deliveries that have been handed out to clients but
+// not yet acknowledged.
+type leases struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	stopped bool
+	leased  map[string]*lease
+}
+
+func newRandomID() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+// grant leases d, calling expired with d if it is not acknowledged before
+// the returned deadline.
+func (l *leases) grant(d delivery, expired func(delivery)) (string, time.Time) {
+	id := newRandomID()
+	deadline := time.Now().Add(l.ttl)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ls := &lease{d: d}
+	ls.timer = time.AfterFunc(l.ttl, func() {
+		l.mu.Lock()
+		_, ok := l.leased[id]
+		delete(l.leased, id)
+		stopped := l.stopped
+		l.mu.Unlock()
+		if ok && !stopped {
+			expired(d)
+		}
+	})
+	l.leased[id] = ls
+	return id, deadline
+}
+
+// release removes the lease for id, returning the leased delivery and
+// true if the lease was still outstanding.
+func (l *leases) release(id string) (delivery, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ls, ok := l.leased[id]
+	if !ok {
+		return delivery{}, false
+	}
+	ls.timer.Stop()
+	delete(l.leased, id)
+	return ls.d, true
+}
+
+func (l *leases) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = true
+	for id, ls := range l.leased {
+		ls.timer.Stop()
+		delete(l.leased, id)
+	}
+}
+
+// leaseDelivery leases d to the client and sets the lease headers on w.
+func (r *Relay) leaseDelivery(w http.ResponseWriter, s *subscriber, d delivery) {
+	id, deadline := s.leases.grant(d, func(d delivery) { r.requeue(s, d) })
+	w.Header().Set(DeliveryIDHeader, id)
+	w.Header().Set(LeaseDeadlineHeader, deadline.UTC().Format(time.RFC3339Nano))
+}
+
+// requeue returns a delivery whose lease has expired to the subscriber's
+// queue.
+func (r *Relay) requeue(s *subscriber, d delivery) {
+	r.opts.logger.Info("webhook delivery lease expired, requeueing", "subscription", s.name, "id", d.id, "size", len(d.body))
+	select {
+	case s.fifo.In() <- d:
+	case <-r.done:
+	}
+}
+
+// AcknowledgeWebhook handles acknowledgements from long-polling clients when
+// leases are enabled. It expects a POST request with DeliveryIDHeader set to
+// the value returned by WaitForWebhook and responds with 204 No Content if
+// the lease was still outstanding or 404 Not Found if the ID is unknown or
+// the lease has already expired, in which case the delivery will be, or has
+// been, handed out again. Leases are specific to the subscription named by
+// SubscriptionPathValue.
+func (r *Relay) AcknowledgeWebhook(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s := r.subscriber(req)
+	if s == nil {
+		http.NotFound(w, req)
+		return
+	}
+	if s.leases == nil {
+		http.Error(w, "acknowledgements are not enabled", http.StatusNotFound)
+		return
+	}
+	id := req.Header.Get(DeliveryIDHeader)
+	if id == "" {
+		http.Error(w, "missing delivery id", http.StatusBadRequest)
+		return
+	}
+	d, ok := s.leases.release(id)
+	if !ok {
+		r.opts.logger.Info("AcknowledgeWebhook: unknown or expired lease", "lease", id)
+		http.Error(w, "unknown or expired delivery id", http.StatusNotFound)
+		return
+	}
+	r.removeFromStore(d.id, 1, "acknowledged")
+	r.opts.logger.Info("AcknowledgeWebhook: delivery acknowledged", "id", d.id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AckHandler returns an http.Handler that serves the acknowledgement endpoint
+// for long polling clients when leases are enabled.
+func (r *Relay) AckHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.AcknowledgeWebhook(w, req)
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webhooks"
+)
+
+// pollLeased polls the relay and returns the response recorder so that the
+// lease headers can be inspected.
+func pollLeased(t *testing.T, handler func(http.ResponseWriter, *http.Request)) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/wait", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func ackWebhook(t *testing.T, handler func(http.ResponseWriter, *http.Request), id string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/wait"+webhooks.AckPathSuffix, nil)
+	req.Header.Set(webhooks.DeliveryIDHeader, id)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Code
+}
+
+func assertQueueEmpty(t *testing.T, handler func(http.ResponseWriter, *http.Request)) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/wait", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Body.Len() > 0 {
+		t.Errorf("queue not empty: got %q", w.Body.String())
+	}
+}
+
+func TestRelayLeaseAck(t *testing.T) {
+	handler, _ := newTestRelay(t, webhooks.WithLeases(time.Minute))
+	payload := []byte(`"leased"`)
+	if got := postWebhook(t, handler, payload); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+
+	w := pollLeased(t, handler)
+	if !bytes.Equal(w.Body.Bytes(), payload) {
+		t.Errorf("body: got %s, want %s", w.Body.Bytes(), payload)
+	}
+	id := w.Header().Get(webhooks.DeliveryIDHeader)
+	if id == "" {
+		t.Fatalf("missing %v header", webhooks.DeliveryIDHeader)
+	}
+	deadline, err := time.Parse(time.RFC3339Nano, w.Header().Get(webhooks.LeaseDeadlineHeader))
+	if err != nil {
+		t.Fatalf("failed to parse lease deadline: %v", err)
+	}
+	if time.Until(deadline) <= 0 || time.Until(deadline) > time.Minute {
+		t.Errorf("unexpected lease deadline: %v", deadline)
+	}
+
+	if got := ackWebhook(t, handler, id); got != http.StatusNoContent {
+		t.Errorf("ack: got status %d, want %d", got, http.StatusNoContent)
+	}
+	if got := ackWebhook(t, handler, id); got != http.StatusNotFound {
+		t.Errorf("second ack: got status %d, want %d", got, http.StatusNotFound)
+	}
+	if got := ackWebhook(t, handler, ""); got != http.StatusBadRequest {
+		t.Errorf("empty ack: got status %d, want %d", got, http.StatusBadRequest)
+	}
+	assertQueueEmpty(t, handler)
+}
+
+func TestRelayLeaseExpiry(t *testing.T) {
+	handler, _ := newTestRelay(t, webhooks.WithLeases(20*time.Millisecond))
+	payload := []byte(`"redeliver"`)
+	if got := postWebhook(t, handler, payload); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	first := pollLeased(t, handler)
+	firstID := first.Header().Get(webhooks.DeliveryIDHeader)
+
+	// The first client never acknowledges, so the delivery is handed out
+	// again once its lease expires.
+	second := pollLeased(t, handler)
+	if !bytes.Equal(second.Body.Bytes(), payload) {
+		t.Errorf("body: got %s, want %s", second.Body.Bytes(), payload)
+	}
+	secondID := second.Header().Get(webhooks.DeliveryIDHeader)
+	if secondID == "" || secondID == firstID {
+		t.Errorf("expected a new lease id: first %q, second %q", firstID, secondID)
+	}
+	if got := ackWebhook(t, handler, firstID); got != http.StatusNotFound {
+		t.Errorf("ack of expired lease: got status %d, want %d", got, http.StatusNotFound)
+	}
+	if got := ackWebhook(t, handler, secondID); got != http.StatusNoContent {
+		t.Errorf("ack: got status %d, want %d", got, http.StatusNoContent)
+	}
+}
+
+func TestRelayLeaseStore(t *testing.T) {
+	store := openSegmentStore(t, t.TempDir())
+	handler, _ := newTestRelay(t, webhooks.WithStore(store), webhooks.WithLeases(time.Minute))
+	if got := postWebhook(t, handler, []byte(`"stored"`)); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	w := pollLeased(t, handler)
+	// The delivery must remain in the store until it is acknowledged.
+	if got, want := len(store.Pending()), 1; got != want {
+		t.Errorf("got %v pending before ack, want %v", got, want)
+	}
+	if got := ackWebhook(t, handler, w.Header().Get(webhooks.DeliveryIDHeader)); got != http.StatusNoContent {
+		t.Errorf("ack: got status %d, want %d", got, http.StatusNoContent)
+	}
+	if got := len(store.Pending()); got != 0 {
+		t.Errorf("got %v pending after ack, want 0", got)
+	}
+}
+
+func TestRelayAckWithoutLeases(t *testing.T) {
+	handler, _ := newTestRelay(t)
+	if got := ackWebhook(t, handler, "any"); got != http.StatusNotFound {
+		t.Errorf("ack: got status %d, want %d", got, http.StatusNotFound)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/wait"+webhooks.AckPathSuffix, nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if got := w.Code; got != http.StatusMethodNotAllowed {
+		t.Errorf("get ack: got status %d, want %d", got, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRelayStopTwice(t *testing.T) {
+	_, relay := newTestRelay(t, webhooks.WithLeases(time.Minute))
+	// newTestRelay also calls Stop when the test completes.
+	relay.Stop(context.Background())
+	relay.Stop(context.Background())
+}
@@ -0,0 +1,377 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudeng.io/cmdutil/keys"
+)
+
+// DefaultSignatureTolerance is the default maximum difference between the
+// time at which a webhook was signed, for providers that include a
+// timestamp in the signature, and the time at which it is verified.
+const DefaultSignatureTolerance = 5 * time.Minute
+
+// Provider implements the signature scheme used by a particular webhook
+// sender. All of the built-in providers use HMAC SHA256 but differ in how
+// the signature, and any timestamp or message ID, are encoded in the
+// request headers.
+type Provider interface {
+	// Verify returns http.StatusOK if header carries a signature of
+	// payload computed using one of secrets. Providers whose signatures
+	// include a timestamp must reject those that differ from now by more
+	// than tolerance. It returns http.StatusBadRequest if the signature
+	// headers are missing or malformed and http.StatusUnauthorized if the
+	// signature does not match or is outside of tolerance.
+	Verify(header http.Header, payload []byte, secrets [][]byte, now time.Time, tolerance time.Duration) int
+	// Sign signs payload using secret, as of now, and sets the resulting
+	// signature headers in header.
+	Sign(header http.Header, payload, secret []byte, now time.Time) error
+}
+
+var providers = struct {
+	sync.Mutex
+	registered map[string]Provider
+}{
+	registered: map[string]Provider{
+		"github": GitHubProvider{},
+		"stripe": StripeProvider{},
+		"slack":  SlackProvider{},
+		"svix":   SvixProvider{},
+	},
+}
+
+// RegisterProvider registers p as the provider for the named service, see
+// Config.Service, replacing any existing registration. The github, stripe,
+// slack and svix providers are registered by default.
+func RegisterProvider(service string, p Provider) {
+	providers.Lock()
+	defer providers.Unlock()
+	providers.registered[service] = p
+}
+
+// LookupProvider returns the provider registered for the named service.
+func LookupProvider(service string) (Provider, bool) {
+	providers.Lock()
+	defer providers.Unlock()
+	p, ok := providers.registered[service]
+	return p, ok
+}
+
+// Providers returns the sorted names of all registered providers.
+func Providers() []string {
+	providers.Lock()
+	defer providers.Unlock()
+	names := make([]string, 0, len(providers.registered))
+	for name := range providers.registered {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ProviderValidator returns a Validator that verifies webhook payloads
+// using the signature scheme implemented by p and one of possibly multiple
+// Tokens returned by getTokens, see SignatureValidator. Signature
+// timestamps that differ from the current time by more than tolerance are
+// rejected to protect against replayed requests; tolerance defaults to
+// DefaultSignatureTolerance if it is <= 0.
+func ProviderValidator(p Provider, getTokens func(ctx context.Context) ([]keys.Token, error), tolerance time.Duration) (Validator, error) {
+	if p == nil {
+		return nil, fmt.Errorf("webhooks: nil provider")
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+	return func(req *http.Request) ([]byte, int) {
+		payload, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, http.StatusBadRequest
+		}
+		defer req.Body.Close()
+
+		tokens, err := getTokens(req.Context())
+		if err != nil {
+			return nil, http.StatusInternalServerError
+		}
+		secrets := make([][]byte, len(tokens))
+		for i, token := range tokens {
+			secrets[i] = token.Value()
+			defer token.Clear() // Clear the token value from memory after use
+		}
+		if code := p.Verify(req.Header, payload, secrets, time.Now(), tolerance); code != http.StatusOK {
+			return nil, code
+		}
+		return payload, http.StatusOK
+	}, nil
+}
+
+func hmacSHA256(secret []byte, parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	for _, p := range parts {
+		_, _ = mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// matchAny returns true if any of the signatures is the HMAC SHA256 of
+// the concatenated parts using any of the secrets.
+func matchAny(sigs, secrets [][]byte, parts ...[]byte) bool {
+	for _, secret := range secrets {
+		expected := hmacSHA256(secret, parts...)
+		for _, sig := range sigs {
+			if hmac.Equal(sig, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseUnixTimestamp parses a decimal Unix timestamp in seconds.
+func parseUnixTimestamp(ts string) (time.Time, bool) {
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(secs, 0), true
+}
+
+func withinTolerance(ts, now time.Time, tolerance time.Duration) bool {
+	d := now.Sub(ts)
+	return d <= tolerance && d >= -tolerance
+}
+
+// GitHubProvider implements GitHub's signature scheme, a hex encoded HMAC
+// SHA256 of the payload, prefixed by "sha256=", in the X-Hub-Signature-256
+// header. The signature does not include a timestamp and hence tolerance
+// is not used.
+type GitHubProvider struct {
+	// Header overrides the default signature header.
+	Header string
+}
+
+// GitHubSignatureHeader is the header used by GitHubProvider by default.
+const GitHubSignatureHeader = "X-Hub-Signature-256"
+
+func (p GitHubProvider) header() string {
+	if p.Header == "" {
+		return GitHubSignatureHeader
+	}
+	return p.Header
+}
+
+// Verify implements Provider.
+func (p GitHubProvider) Verify(header http.Header, payload []byte, secrets [][]byte, _ time.Time, _ time.Duration) int {
+	req := &http.Request{Header: header}
+	sig, code := SHA256SignatureFromHeader(p.header())(req)
+	if code != http.StatusOK {
+		return code
+	}
+	if !matchAny([][]byte{sig}, secrets, payload) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusOK
+}
+
+// Sign implements Provider.
+func (p GitHubProvider) Sign(header http.Header, payload, secret []byte, _ time.Time) error {
+	return SignHTTPRequest(header, payload, secret, p.header())
+}
+
+// StripeProvider implements Stripe's signature scheme. The Stripe-Signature
+// header contains a Unix timestamp and one or more hex encoded HMAC SHA256
+// signatures of the timestamp and payload, separated by a '.', in the form
+// "t=<timestamp>,v1=<signature>[,v1=<signature>...]".
+type StripeProvider struct{}
+
+// StripeSignatureHeader is the header used by StripeProvider.
+const StripeSignatureHeader = "Stripe-Signature"
+
+// Verify implements Provider.
+func (StripeProvider) Verify(header http.Header, payload []byte, secrets [][]byte, now time.Time, tolerance time.Duration) int {
+	value := header.Get(StripeSignatureHeader)
+	if value == "" {
+		return http.StatusBadRequest
+	}
+	var timestamp string
+	var sigs [][]byte
+	for item := range strings.SplitSeq(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return http.StatusBadRequest
+		}
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			sig, err := hex.DecodeString(v)
+			if err != nil {
+				return http.StatusBadRequest
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+	ts, ok := parseUnixTimestamp(timestamp)
+	if !ok || len(sigs) == 0 {
+		return http.StatusBadRequest
+	}
+	if !withinTolerance(ts, now, tolerance) {
+		return http.StatusUnauthorized
+	}
+	if !matchAny(sigs, secrets, []byte(timestamp), []byte("."), payload) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusOK
+}
+
+// Sign implements Provider.
+func (StripeProvider) Sign(header http.Header, payload, secret []byte, now time.Time) error {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	sig := hmacSHA256(secret, []byte(timestamp), []byte("."), payload)
+	header.Set(StripeSignatureHeader, "t="+timestamp+",v1="+hex.EncodeToString(sig))
+	return nil
+}
+
+// SlackProvider implements Slack's signature scheme. The X-Slack-Signature
+// header contains "v0=" followed by the hex encoded HMAC SHA256 of
+// "v0:<timestamp>:<payload>" where the Unix timestamp is taken from the
+// X-Slack-Request-Timestamp header.
+type SlackProvider struct{}
+
+const (
+	// SlackSignatureHeader is the signature header used by SlackProvider.
+	SlackSignatureHeader = "X-Slack-Signature"
+	// SlackTimestampHeader is the timestamp header used by SlackProvider.
+	SlackTimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// Verify implements Provider.
+func (SlackProvider) Verify(header http.Header, payload []byte, secrets [][]byte, now time.Time, tolerance time.Duration) int {
+	timestamp := header.Get(SlackTimestampHeader)
+	ts, ok := parseUnixTimestamp(timestamp)
+	if !ok {
+		return http.StatusBadRequest
+	}
+	encoded, ok := strings.CutPrefix(header.Get(SlackSignatureHeader), "v0=")
+	if !ok {
+		return http.StatusBadRequest
+	}
+	sig, err := hex.DecodeString(encoded)
+	if err != nil {
+		return http.StatusBadRequest
+	}
+	if !withinTolerance(ts, now, tolerance) {
+		return http.StatusUnauthorized
+	}
+	if !matchAny([][]byte{sig}, secrets, []byte("v0:"+timestamp+":"), payload) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusOK
+}
+
+// Sign implements Provider.
+func (SlackProvider) Sign(header http.Header, payload, secret []byte, now time.Time) error {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	sig := hmacSHA256(secret, []byte("v0:"+timestamp+":"), payload)
+	header.Set(SlackTimestampHeader, timestamp)
+	header.Set(SlackSignatureHeader, "v0="+hex.EncodeToString(sig))
+	return nil
+}
+
+// SvixProvider implements the signature scheme used by Svix and other
+// Standard Webhooks senders. The svix-signature header contains one or
+// more space separated, base64 encoded, HMAC SHA256 signatures, each
+// prefixed by "v1,", of "<id>.<timestamp>.<payload>" where the message ID
+// and Unix timestamp are taken from the svix-id and svix-timestamp headers.
+// Secrets of the form "whsec_<base64>" are base64 decoded before use.
+type SvixProvider struct{}
+
+const (
+	// SvixIDHeader is the message ID header used by SvixProvider.
+	SvixIDHeader = "Svix-Id"
+	// SvixTimestampHeader is the timestamp header used by SvixProvider.
+	SvixTimestampHeader = "Svix-Timestamp"
+	// SvixSignatureHeader is the signature header used by SvixProvider.
+	SvixSignatureHeader = "Svix-Signature"
+)
+
+func svixSecret(secret []byte) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(string(secret), "whsec_")
+	if !ok {
+		return secret, nil
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// Verify implements Provider.
+func (SvixProvider) Verify(header http.Header, payload []byte, secrets [][]byte, now time.Time, tolerance time.Duration) int {
+	id := header.Get(SvixIDHeader)
+	timestamp := header.Get(SvixTimestampHeader)
+	ts, ok := parseUnixTimestamp(timestamp)
+	if id == "" || !ok {
+		return http.StatusBadRequest
+	}
+	var sigs [][]byte
+	for item := range strings.FieldsSeq(header.Get(SvixSignatureHeader)) {
+		encoded, ok := strings.CutPrefix(item, "v1,")
+		if !ok {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return http.StatusBadRequest
+		}
+		sigs = append(sigs, sig)
+	}
+	if len(sigs) == 0 {
+		return http.StatusBadRequest
+	}
+	if !withinTolerance(ts, now, tolerance) {
+		return http.StatusUnauthorized
+	}
+	decoded := make([][]byte, 0, len(secrets))
+	for _, secret := range secrets {
+		if s, err := svixSecret(secret); err == nil {
+			decoded = append(decoded, s)
+		}
+	}
+	if !matchAny(sigs, decoded, []byte(id+"."+timestamp+"."), payload) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusOK
+}
+
+// Sign implements Provider. The message ID is taken from header if
+// already set, otherwise a new one is generated.
+func (SvixProvider) Sign(header http.Header, payload, secret []byte, now time.Time) error {
+	key, err := svixSecret(secret)
+	if err != nil {
+		return fmt.Errorf("invalid svix secret: %v", err)
+	}
+	id := header.Get(SvixIDHeader)
+	if id == "" {
+		id = "msg_" + newRandomID()
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	sig := hmacSHA256(key, []byte(id+"."+timestamp+"."), payload)
+	header.Set(SvixIDHeader, id)
+	header.Set(SvixTimestampHeader, timestamp)
+	header.Set(SvixSignatureHeader, "v1,"+base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"cloudeng.io/cmdutil/keys"
+	"cloudeng.io/webapp/webhooks"
+	"gopkg.in/yaml.v3"
+)
+
+func TestProviderRegistry(t *testing.T) {
+	for _, name := range []string{"github", "stripe", "slack", "svix"} {
+		if _, ok := webhooks.LookupProvider(name); !ok {
+			t.Errorf("provider %q is not registered", name)
+		}
+		if !slices.Contains(webhooks.Providers(), name) {
+			t.Errorf("provider %q is not listed", name)
+		}
+	}
+	if _, ok := webhooks.LookupProvider("unknown"); ok {
+		t.Errorf("unexpected provider for unknown service")
+	}
+	webhooks.RegisterProvider("custom", webhooks.GitHubProvider{Header: "X-Custom-Signature"})
+	if p, ok := webhooks.LookupProvider("custom"); !ok || p.(webhooks.GitHubProvider).Header != "X-Custom-Signature" {
+		t.Errorf("custom provider: got %v, %v", p, ok)
+	}
+}
+
+func TestProviderSignVerify(t *testing.T) {
+	payload := []byte(`{"event":"test"}`)
+	secret := []byte("provider-secret")
+	svixSecret := []byte("whsec_" + base64.StdEncoding.EncodeToString(secret))
+	now := time.Now()
+	tolerance := time.Minute
+
+	for _, tc := range []struct {
+		name     string
+		provider webhooks.Provider
+		secret   []byte
+		signed   bool // the signature includes a timestamp
+	}{
+		{"github", webhooks.GitHubProvider{}, secret, false},
+		{"stripe", webhooks.StripeProvider{}, secret, true},
+		{"slack", webhooks.SlackProvider{}, secret, true},
+		{"svix", webhooks.SvixProvider{}, svixSecret, true},
+		{"svix-raw", webhooks.SvixProvider{}, secret, true},
+	} {
+		header := http.Header{}
+		if err := tc.provider.Sign(header, payload, tc.secret, now); err != nil {
+			t.Fatalf("%v: sign: %v", tc.name, err)
+		}
+		secrets := [][]byte{[]byte("other"), tc.secret}
+		if got := tc.provider.Verify(header, payload, secrets, now, tolerance); got != http.StatusOK {
+			t.Errorf("%v: verify: got %d, want %d", tc.name, got, http.StatusOK)
+		}
+		if got := tc.provider.Verify(header, []byte(`{}`), secrets, now, tolerance); got != http.StatusUnauthorized {
+			t.Errorf("%v: tampered payload: got %d, want %d", tc.name, got, http.StatusUnauthorized)
+		}
+		if got := tc.provider.Verify(header, payload, [][]byte{[]byte("other")}, now, tolerance); got != http.StatusUnauthorized {
+			t.Errorf("%v: wrong secret: got %d, want %d", tc.name, got, http.StatusUnauthorized)
+		}
+		later := now.Add(2 * tolerance)
+		want := http.StatusOK
+		if tc.signed {
+			want = http.StatusUnauthorized
+		}
+		if got := tc.provider.Verify(header, payload, secrets, later, tolerance); got != want {
+			t.Errorf("%v: replayed: got %d, want %d", tc.name, got, want)
+		}
+		if got := tc.provider.Verify(http.Header{}, payload, secrets, now, tolerance); got != http.StatusBadRequest {
+			t.Errorf("%v: unsigned: got %d, want %d", tc.name, got, http.StatusBadRequest)
+		}
+	}
+}
+
+func hexHMAC(secret []byte, msg string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestProviderHeaderFormats(t *testing.T) {
+	// The expected headers are computed independently of the providers.
+	payload := `{"id":"evt_1"}`
+	secret := []byte("test-secret")
+	now := time.Unix(1700000000, 0)
+
+	header := http.Header{}
+	if err := (webhooks.StripeProvider{}).Sign(header, []byte(payload), secret, now); err != nil {
+		t.Fatal(err)
+	}
+	stripeSig := hexHMAC(secret, "1700000000."+payload)
+	if got, want := header.Get("Stripe-Signature"), "t=1700000000,v1="+stripeSig; got != want {
+		t.Errorf("stripe: got %q, want %q", got, want)
+	}
+	// Multiple v1 signatures, as sent during secret rotation, are accepted.
+	header.Set("Stripe-Signature", "t=1700000000,v1="+hexHMAC([]byte("old"), payload)+",v1="+stripeSig+",v0=ignored")
+	if got := (webhooks.StripeProvider{}).Verify(header, []byte(payload), [][]byte{secret}, now, time.Minute); got != http.StatusOK {
+		t.Errorf("stripe: got %d, want %d", got, http.StatusOK)
+	}
+
+	header = http.Header{}
+	if err := (webhooks.SlackProvider{}).Sign(header, []byte(payload), secret, now); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := header.Get("X-Slack-Request-Timestamp"), "1700000000"; got != want {
+		t.Errorf("slack timestamp: got %q, want %q", got, want)
+	}
+	if got, want := header.Get("X-Slack-Signature"), "v0="+hexHMAC(secret, "v0:1700000000:"+payload); got != want {
+		t.Errorf("slack: got %q, want %q", got, want)
+	}
+
+	header = http.Header{}
+	header.Set("svix-id", "msg_1")
+	svixSecret := "whsec_" + base64.StdEncoding.EncodeToString(secret)
+	if err := (webhooks.SvixProvider{}).Sign(header, []byte(payload), []byte(svixSecret), now); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("msg_1.1700000000." + payload))
+	if got, want := header.Get("svix-signature"), "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("svix: got %q, want %q", got, want)
+	}
+	// Unknown signature versions are ignored.
+	header.Set("svix-signature", "v1a,ignored "+header.Get("svix-signature"))
+	if got := (webhooks.SvixProvider{}).Verify(header, []byte(payload), [][]byte{[]byte(svixSecret)}, now, time.Minute); got != http.StatusOK {
+		t.Errorf("svix: got %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestProviderValidator(t *testing.T) {
+	secret := []byte("validator-secret")
+	payload := []byte(`{"n":1}`)
+	validator, err := webhooks.ProviderValidator(webhooks.SlackProvider{}, staticSecrets(secret), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		signedAt time.Time
+		want     int
+	}{
+		{time.Now(), http.StatusOK},
+		{time.Now().Add(-10 * time.Minute), http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+		if err := (webhooks.SlackProvider{}).Sign(req.Header, payload, secret, tc.signedAt); err != nil {
+			t.Fatal(err)
+		}
+		got, code := validator(req)
+		if code != tc.want {
+			t.Errorf("signed at %v: got %d, want %d", tc.signedAt, code, tc.want)
+		}
+		if code == http.StatusOK && !bytes.Equal(got, payload) {
+			t.Errorf("got %s, want %s", got, payload)
+		}
+	}
+	if _, err := webhooks.ProviderValidator(nil, staticSecrets(secret), 0); err == nil {
+		t.Error("expected an error for a nil provider")
+	}
+}
+
+func TestConfigValidator(t *testing.T) {
+	const cfgYAML = `
+service: stripe
+signature_tolerance: 1m
+service_specific:
+  stripe-account:
+    - stripe-secret
+`
+	var cfg webhooks.Config
+	if err := yaml.Unmarshal([]byte(cfgYAML), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.SignatureTolerance, time.Minute; got != want {
+		t.Errorf("SignatureTolerance: got %v, want %v", got, want)
+	}
+	validator, err := cfg.Validator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("stripe-signing-secret")
+	ctx := keys.ContextWithKey(context.Background(), keys.NewInfo("stripe-secret", "stripe-account", slices.Clone(secret)))
+
+	payload := []byte(`{"type":"charge.succeeded"}`)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload)).WithContext(ctx)
+	if err := (webhooks.StripeProvider{}).Sign(req.Header, payload, secret, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := validator(req); code != http.StatusOK {
+		t.Errorf("got %d, want %d", code, http.StatusOK)
+	}
+
+	cfg.Service = "unknown"
+	if _, err := cfg.Validator(); err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"log/slog"
 	"net/http"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"cloudeng.io/sync/patterns"
@@ -24,16 +27,26 @@ import (
 // payloads and the Wait endpoint will accept GET requests and will block
 // until a payload is received.
 // When the internal buffer is full the oldest webhook is dropped to make
-// room for the new one.
+// room for the new one. By default deliveries are held only in memory,
+// WithStore can be used to persist them across restarts. By default every
+// delivery is handed to a single client, WithSubscriptions can be used to
+// fan deliveries out to multiple, optionally filtered, groups of clients.
 type Relay struct {
-	fifo      *patterns.FIFO[delivery]
-	validator Validator
-	opts      options
+	subscribers map[string]*subscriber
+	validator   Validator
+	opts        options
+	refs        *storeRefs  // nil unless WithStore is used
+	dedup       *dedupCache // nil unless WithDeduplication is used
+	seq         atomic.Uint64
+	done        chan struct{}
+	stopOnce    sync.Once
 }
 
 // delivery is a validated webhook payload together with the subset of the
 // incoming request headers that the relay forwards to long-polling clients.
 type delivery struct {
+	id         uint64 // assigned by the Store, if any
+	seq        uint64 // assigned by the Relay, used as the stream event ID
 	header     http.Header
 	body       []byte
 	expiration time.Time // when the webhook expires
@@ -45,10 +58,16 @@ type options struct {
 	forwardedHeaders []string
 	expiry           time.Duration
 	expiryScan       time.Duration
+	store            Store
+	leaseTTL         time.Duration
+	subscriptions    []Subscription
+	streamKeepAlive  time.Duration
+	dedup            Deduplication
 	logger           *slog.Logger
 	deniedCounter    webapp.CounterInc // validation failed, e.g. due to invalid signature
 	relayedCounter   webapp.CounterInc // successfully relayed to FIFO
 	readCounter      webapp.CounterInc // successfully read from FIFO and sent to client
+	duplicateCounter webapp.CounterInc // rejected or discarded as a duplicate
 }
 
 const (
@@ -133,6 +152,15 @@ func WithCounters(deniedCounter, relayedCounter, readCounter webapp.CounterInc)
 	}
 }
 
+// WithDuplicateCounter sets a counter that is incremented when a payload is
+// rejected or discarded as a duplicate, see WithDeduplication. If nil, it
+// will be set to a no-op counter.
+func WithDuplicateCounter(duplicateCounter webapp.CounterInc) Option {
+	return func(opts *options) {
+		opts.duplicateCounter = duplicateCounter
+	}
+}
+
 func noopCounter(context.Context) {}
 
 // Validator is called to validate and extract the webhook payload
@@ -166,6 +194,9 @@ func NewRelay(ctx context.Context, validator Validator, opts ...Option) *Relay {
 	if options.payloadLimit == 0 {
 		options.payloadLimit = DefaultPayloadLimit
 	}
+	if options.streamKeepAlive <= 0 {
+		options.streamKeepAlive = DefaultStreamKeepAlive
+	}
 	if options.forwardedHeaders == nil {
 		options.forwardedHeaders = slices.Clone(DefaultForwardedHeaders)
 	}
@@ -178,28 +209,137 @@ func NewRelay(ctx context.Context, validator Validator, opts ...Option) *Relay {
 	if options.readCounter == nil {
 		options.readCounter = noopCounter
 	}
+	if options.duplicateCounter == nil {
+		options.duplicateCounter = noopCounter
+	}
+	if options.dedup.Window > 0 && options.dedup.KeyHeaders == nil {
+		options.dedup.KeyHeaders = slices.Clone(DefaultDeduplicationHeaders)
+	}
 	options.logger = options.logger.With("component", "webhooks.Relay")
-	return &Relay{
-		fifo:      patterns.NewFIFO(ctx, int(options.size), expiryScan(options)...),
-		validator: validator,
-		opts:      options,
+	r := &Relay{
+		subscribers: map[string]*subscriber{},
+		validator:   validator,
+		opts:        options,
+		done:        make(chan struct{}),
+	}
+	if options.store != nil {
+		r.refs = &storeRefs{limit: int(options.size), refs: map[uint64]int{}}
+	}
+	if options.dedup.Window > 0 {
+		r.dedup = newDedupCache(options.dedup)
+	}
+	subs := options.subscriptions
+	if len(subs) == 0 {
+		// The unnamed, unfiltered, default subscription.
+		subs = []Subscription{{}}
+	}
+	for _, sub := range subs {
+		if len(options.subscriptions) > 0 && !validSubscriptionName(sub.Name) {
+			options.logger.Error("ignoring webhook subscription with an invalid name", "subscription", sub.Name)
+			continue
+		}
+		if _, ok := r.subscribers[sub.Name]; ok {
+			options.logger.Error("ignoring duplicate webhook subscription", "subscription", sub.Name)
+			continue
+		}
+		s := newSubscriber(sub, int(options.size))
+		s.fifo = patterns.NewFIFO(ctx, int(options.size), r.expiryScan()...)
+		if options.leaseTTL > 0 {
+			s.leases = &leases{ttl: options.leaseTTL, leased: map[string]*lease{}}
+		}
+		r.subscribers[sub.Name] = s
+	}
+	r.replay(ctx)
+	return r
+}
+
+// matchingSubscribers returns the subscribers that a delivery with the
+// specified forwarded headers should be relayed to.
+func (r *Relay) matchingSubscribers(h http.Header) []*subscriber {
+	var matched []*subscriber
+	for _, s := range r.subscribers {
+		if s.matches(h) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// subscriber returns the subscriber named by the request's
+// SubscriptionPathValue, or nil if there is no such subscriber.
+func (r *Relay) subscriber(req *http.Request) *subscriber {
+	return r.subscribers[req.PathValue(SubscriptionPathValue)]
+}
+
+// replay queues any deliveries that are pending in the store, skipping
+// those that have expired.
+func (r *Relay) replay(ctx context.Context) {
+	if r.opts.store == nil {
+		return
+	}
+	pending := r.opts.store.Pending()
+	if len(pending) == 0 {
+		return
+	}
+	if extra := len(pending) - int(r.opts.size); extra > 0 {
+		for _, sd := range pending[:extra] {
+			r.removeFromStore(sd.ID, 1, "dropped")
+		}
+		pending = pending[extra:]
+	}
+	now := time.Now()
+	var replayed int
+	for _, sd := range pending {
+		if r.opts.expiry > 0 && now.After(sd.Expiration) {
+			r.removeFromStore(sd.ID, 1, "expired")
+			continue
+		}
+		d := delivery{id: sd.ID, seq: r.seq.Add(1), header: sd.Header, body: sd.Body, expiration: sd.Expiration}
+		matched := r.matchingSubscribers(d.header)
+		if len(matched) == 0 {
+			r.removeFromStore(sd.ID, 1, "unsubscribed")
+			continue
+		}
+		r.refs.add(d.id, len(matched))
+		for _, s := range matched {
+			select {
+			case s.fifo.In() <- d:
+			case <-ctx.Done():
+				return
+			}
+		}
+		replayed++
+	}
+	r.opts.logger.Info("replayed webhook deliveries from store", "replayed", replayed, "pending", len(pending))
+}
+
+// removeFromStore releases the specified number of subscriber copies of the
+// delivery with the specified id and removes it from the store, if one is
+// configured, once all copies have been released. Errors are logged rather
+// than returned since the delivery has already left the queue.
+func (r *Relay) removeFromStore(id uint64, copies int, reason string) {
+	if r.opts.store == nil || !r.refs.release(id, copies) {
+		return
+	}
+	if err := r.opts.store.Remove(id); err != nil {
+		r.opts.logger.Warn("failed to remove webhook delivery from store", "id", id, "reason", reason, "err", err)
 	}
 }
 
 // expiryScan returns the FIFO options that implement delivery expiry, or nil
 // when expiry is disabled.
-func expiryScan(opts options) []patterns.Option[delivery] {
-	if opts.expiry <= 0 {
+func (r *Relay) expiryScan() []patterns.Option[delivery] {
+	if r.opts.expiry <= 0 {
 		return nil
 	}
-	interval := opts.expiryScan
+	interval := r.opts.expiryScan
 	if interval <= 0 {
-		interval = opts.expiry
+		interval = r.opts.expiry
 	}
-	ttl, logger := opts.expiry, opts.logger
 	remove := func(d delivery) bool {
 		if time.Now().After(d.expiration) {
-			logger.Info("dropping expired webhook delivery", "expiration", d.expiration, "ttl", ttl, "size", len(d.body))
+			r.opts.logger.Info("dropping expired webhook delivery", "expiration", d.expiration, "ttl", r.opts.expiry, "size", len(d.body))
+			r.removeFromStore(d.id, 1, "expired")
 			return true
 		}
 		return false
@@ -208,16 +348,37 @@ func expiryScan(opts options) []patterns.Option[delivery] {
 }
 
 // Stop shuts down the internal FIFO goroutine. It blocks until the goroutine
-// exits or ctx is cancelled.
+// exits or ctx is cancelled. Any outstanding leases are abandoned, their
+// deliveries remain in the Store, if one is configured. It is safe to call
+// Stop more than once.
 func (r *Relay) Stop(ctx context.Context) {
-	r.fifo.Stop(ctx)
+	r.stopOnce.Do(func() {
+		close(r.done)
+		for _, s := range r.subscribers {
+			if s.leases != nil {
+				s.leases.stop()
+			}
+			s.fifo.Stop(ctx)
+		}
+	})
 }
 
 // ServeWebhook handles incoming webhook requests, validates them using the
 // provided Validator, and relays the payload to the FIFO for processing.
 // If the internal buffer is full the oldest payload is dropped to make room.
 // It responds with appropriate HTTP status codes based on the validation outcome.
+// The payload is relayed to every matching subscription unless the request
+// names a single subscription via SubscriptionPathValue. If de-duplication
+// is enabled, see WithDeduplication, duplicate payloads are either rejected
+// with 409 Conflict or accepted but not relayed.
 func (r *Relay) ServeWebhook(w http.ResponseWriter, req *http.Request) {
+	var target *subscriber
+	if name := req.PathValue(SubscriptionPathValue); name != "" {
+		if target = r.subscribers[name]; target == nil {
+			http.NotFound(w, req)
+			return
+		}
+	}
 	if req.ContentLength > r.opts.payloadLimit {
 		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
 		return
@@ -248,30 +409,89 @@ func (r *Relay) ServeWebhook(w http.ResponseWriter, req *http.Request) {
 		r.opts.logger.Info("ServeWebhook: context already cancelled before send", "err", err)
 		return
 	}
-	select {
-	case r.fifo.In() <- delivery{header: r.forwardedHeaders(req.Header), body: payload, expiration: time.Now().Add(r.opts.expiry)}:
-		r.opts.logger.Info("ServeWebhook: received payload and sent to FIFO", "size", len(payload))
-		r.opts.relayedCounter(req.Context())
-	case <-req.Context().Done():
-		err := req.Context().Err()
-		r.opts.logger.Info("ServeWebhook: context cancelled while trying to send payload to FIFO", "err", err)
+	var dedupKey string
+	if r.dedup != nil {
+		dedupKey = r.dedupKey(req, payload)
+		if !r.dedup.add(dedupKey, time.Now()) {
+			r.opts.logger.Info("ServeWebhook: duplicate delivery", "key", dedupKey, "size", len(payload), "rejected", r.opts.dedup.Reject)
+			r.opts.duplicateCounter(req.Context())
+			if r.opts.dedup.Reject {
+				http.Error(w, "duplicate delivery", http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	}
+	d := delivery{seq: r.seq.Add(1), header: r.forwardedHeaders(req.Header), body: payload, expiration: time.Now().Add(r.opts.expiry)}
+	var matched []*subscriber
+	if target == nil {
+		matched = r.matchingSubscribers(d.header)
+	} else if target.matches(d.header) {
+		matched = []*subscriber{target}
+	}
+	if len(matched) == 0 {
+		// The sender has done nothing wrong, so acknowledge the payload.
+		r.opts.logger.Info("ServeWebhook: no matching subscriptions, discarding payload", "size", len(payload))
+		w.WriteHeader(http.StatusAccepted)
 		return
 	}
+	if r.opts.store != nil {
+		id, err := r.opts.store.Append(StoredDelivery{Header: d.header, Body: d.body, Expiration: d.expiration}, int(r.opts.size))
+		if err != nil {
+			r.opts.logger.Error("ServeWebhook: failed to persist payload", "err", err)
+			r.forgetDelivery(dedupKey)
+			http.Error(w, "failed to persist payload", http.StatusInternalServerError)
+			return
+		}
+		d.id = id
+		r.refs.add(id, len(matched))
+	}
+	for i, s := range matched {
+		select {
+		case s.fifo.In() <- d:
+		case <-req.Context().Done():
+			err := req.Context().Err()
+			r.opts.logger.Info("ServeWebhook: context cancelled while trying to send payload to FIFO", "subscription", s.name, "err", err)
+			// The sender will not see a 202 and is expected to retry.
+			r.removeFromStore(d.id, len(matched)-i, "cancelled")
+			r.forgetDelivery(dedupKey)
+			return
+		}
+	}
+	r.opts.logger.Info("ServeWebhook: received payload and sent to FIFO", "size", len(payload), "subscriptions", len(matched))
+	r.opts.relayedCounter(req.Context())
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// forgetDelivery allows a delivery that was not accepted to be retried
+// without being treated as a duplicate.
+func (r *Relay) forgetDelivery(dedupKey string) {
+	if r.dedup != nil {
+		r.dedup.remove(dedupKey)
+	}
+}
+
 // WaitForWebhook waits for a payload to be received on the FIFO and responds
 // with the payload as JSON. It is intended to support long polling by
 // blocking until a webhook payload is available.
 // If the request context is cancelled while waiting, it logs the cancellation
-// and returns without responding.
+// and returns without responding. If leases are enabled, see WithLeases, the
+// delivery is leased to the client rather than being discarded.
+// The subscription to wait on is named by SubscriptionPathValue and
+// unknown subscriptions receive a 404 Not Found response.
 func (r *Relay) WaitForWebhook(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	s := r.subscriber(req)
+	if s == nil {
+		http.NotFound(w, req)
+		return
+	}
 	select {
-	case job, ok := <-r.fifo.Out():
+	case job, ok := <-s.fifo.Out():
 		if !ok {
 			return
 		}
@@ -281,8 +501,14 @@ func (r *Relay) WaitForWebhook(w http.ResponseWriter, req *http.Request) {
 			}
 		}
 		w.Header().Set("Content-Type", "application/json")
+		if s.leases != nil {
+			r.leaseDelivery(w, s, job)
+		}
 		_, _ = w.Write(job.body)
-		r.opts.logger.Info("WaitForWebhook: sent payload to client", "size", len(job.body))
+		if s.leases == nil {
+			r.removeFromStore(job.id, 1, "delivered")
+		}
+		r.opts.logger.Info("WaitForWebhook: sent payload to client", "subscription", s.name, "size", len(job.body))
 		r.opts.readCounter(req.Context())
 	case <-req.Context().Done():
 		err := req.Context().Err()
@@ -324,15 +550,43 @@ func (r *Relay) PollingHandler() http.Handler {
 
 // Handler returns an http.HandlerFunc that routes requests to the appropriate
 // handler based on the URL path. It expects the webhook endpoint to be at
-// deliveryPath and the wait endpoint to be at relayPath. Requests to
-// other paths will receive a 404 Not Found response.
+// deliveryPath and the wait endpoint to be at relayPath. Acknowledgements,
+// when leases are enabled, are accepted at relayPath + AckPathSuffix and
+// the streaming endpoint is at relayPath + StreamPathSuffix.
+// When subscriptions are configured, see WithSubscriptions, the wait,
+// acknowledgement and streaming endpoints for a subscription are at
+// relayPath/<name> followed by the corresponding suffix, if any, and
+// payloads posted to deliveryPath/<name> are relayed to that subscription
+// only. Requests to other paths will receive a 404 Not Found response.
 func (r *Relay) Handler(deliveryPath, relayPath string) func(w http.ResponseWriter, req *http.Request) {
+	_, hasDefault := r.subscribers[""]
 	return func(w http.ResponseWriter, req *http.Request) {
-		switch req.URL.Path {
-		case deliveryPath:
+		path := req.URL.Path
+		if path == deliveryPath {
+			r.ServeWebhook(w, req)
+			return
+		}
+		if name, suffix, ok := subscriptionFromPath(path, deliveryPath); ok && len(suffix) == 0 {
+			req.SetPathValue(SubscriptionPathValue, name)
 			r.ServeWebhook(w, req)
-		case relayPath:
+			return
+		}
+		suffix, ok := strings.CutPrefix(path, relayPath)
+		if !ok || (len(suffix) > 0 && !hasDefault) {
+			var name string
+			if name, suffix, ok = subscriptionFromPath(path, relayPath); !ok {
+				http.NotFound(w, req)
+				return
+			}
+			req.SetPathValue(SubscriptionPathValue, name)
+		}
+		switch suffix {
+		case "":
 			r.WaitForWebhook(w, req)
+		case AckPathSuffix:
+			r.AcknowledgeWebhook(w, req)
+		case StreamPathSuffix:
+			r.ServeStream(w, req)
 		default:
 			http.NotFound(w, req)
 		}
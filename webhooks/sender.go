@@ -0,0 +1,497 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloudeng.io/webapp"
+)
+
+const (
+	DefaultSendAttempts       = 5
+	DefaultSendBackoff        = 500 * time.Millisecond
+	DefaultSendMaxBackoff     = 30 * time.Second
+	DefaultBreakerThreshold   = 5
+	DefaultBreakerCooldown    = 30 * time.Second
+	DefaultSendRequestTimeout = 10 * time.Second
+)
+
+// ErrCircuitOpen is returned by Sender.Send when the circuit breaker for
+// the destination endpoint is open.
+var ErrCircuitOpen = errors.New("webhooks: circuit breaker is open")
+
+// errNotRetryable is wrapped by errors returned by Sender.attempt that
+// occur before the request is sent and hence will not succeed if retried.
+var errNotRetryable = errors.New("not retryable")
+
+// SendError is returned by Sender.Send when a payload could not be
+// delivered.
+type SendError struct {
+	URL        string
+	Attempts   int
+	StatusCode int // the status code of the last response, if any
+	Err        error
+}
+
+func (e *SendError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("webhooks: failed to deliver to %v after %d attempt(s): status %d: %v", e.URL, e.Attempts, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("webhooks: failed to deliver to %v after %d attempt(s): %v", e.URL, e.Attempts, e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// DeadLetter is a payload that a Sender failed to deliver.
+type DeadLetter struct {
+	ID       string      `json:"id"`
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header,omitempty"`
+	Payload  []byte      `json:"payload"`
+	Attempts int         `json:"attempts"`
+	Error    string      `json:"error"`
+	Time     time.Time   `json:"time"`
+}
+
+// DeadLetterStore is used by a Sender to record payloads that could not be
+// delivered so that they may be inspected and replayed, see
+// Sender.Replay.
+type DeadLetterStore interface {
+	// Add records dl, replacing any existing entry with the same ID.
+	Add(dl DeadLetter) error
+	// Remove removes the entry with the specified ID. Removing an unknown
+	// ID is not an error.
+	Remove(id string) error
+	// List returns all entries, oldest first.
+	List() []DeadLetter
+}
+
+// MemoryDeadLetterStore is an in-memory DeadLetterStore that holds at most
+// a fixed number of entries, dropping the oldest when full.
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	limit   int
+	entries []DeadLetter
+}
+
+// NewMemoryDeadLetterStore returns a MemoryDeadLetterStore that holds at
+// most limit entries, or an unlimited number if limit is <= 0.
+func NewMemoryDeadLetterStore(limit int) *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{limit: limit}
+}
+
+// Add implements DeadLetterStore.
+func (m *MemoryDeadLetterStore) Add(dl DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = slices.DeleteFunc(m.entries, func(e DeadLetter) bool { return e.ID == dl.ID })
+	m.entries = append(m.entries, dl)
+	if m.limit > 0 && len(m.entries) > m.limit {
+		m.entries = slices.Delete(m.entries, 0, len(m.entries)-m.limit)
+	}
+	return nil
+}
+
+// Remove implements DeadLetterStore.
+func (m *MemoryDeadLetterStore) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = slices.DeleteFunc(m.entries, func(e DeadLetter) bool { return e.ID == id })
+	return nil
+}
+
+// List implements DeadLetterStore.
+func (m *MemoryDeadLetterStore) List() []DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.entries)
+}
+
+// SenderOption configures a Sender.
+type SenderOption func(*senderOptions)
+
+type senderOptions struct {
+	client           *http.Client
+	attempts         int
+	backoff          time.Duration
+	maxBackoff       time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	deadLetters      DeadLetterStore
+	logger           *slog.Logger
+	metrics          webapp.CounterVecInc
+}
+
+// WithSenderClient sets the http.Client used to deliver payloads. It
+// defaults to a client with a timeout of DefaultSendRequestTimeout.
+func WithSenderClient(client *http.Client) SenderOption {
+	return func(o *senderOptions) {
+		o.client = client
+	}
+}
+
+// WithRetries sets the maximum number of delivery attempts and the initial
+// and maximum delays between attempts. The delay doubles after each failed
+// attempt, up to maxBackoff, and a random jitter of up to half of the delay
+// is subtracted from it so that retries from multiple senders do not
+// synchronize. A Retry-After header on a 429 or 503 response is honoured
+// if it is longer than the computed delay, but not beyond maxBackoff.
+func WithRetries(attempts int, backoff, maxBackoff time.Duration) SenderOption {
+	return func(o *senderOptions) {
+		o.attempts = attempts
+		o.backoff = backoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithCircuitBreaker configures the per-endpoint circuit breaker. The
+// breaker for an endpoint opens after threshold consecutive failed
+// attempts, after which deliveries to that endpoint fail immediately with
+// ErrCircuitOpen until cooldown has elapsed. A single trial delivery is
+// then allowed; the breaker closes if it succeeds and re-opens if it fails.
+// The breaker is disabled if threshold is < 0.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) SenderOption {
+	return func(o *senderOptions) {
+		o.breakerThreshold = threshold
+		o.breakerCooldown = cooldown
+	}
+}
+
+// WithDeadLetters sets the store used to record payloads that could not be
+// delivered. By default failed payloads are only logged.
+func WithDeadLetters(store DeadLetterStore) SenderOption {
+	return func(o *senderOptions) {
+		o.deadLetters = store
+	}
+}
+
+// WithSenderLogger sets the logger for the Sender.
+func WithSenderLogger(logger *slog.Logger) SenderOption {
+	return func(o *senderOptions) {
+		o.logger = logger
+	}
+}
+
+// WithSenderMetrics sets the metric used to count delivery attempts and
+// their outcomes, see SenderMetricsColumns and SenderMetricsOutcomeValues.
+func WithSenderMetrics(metrics webapp.CounterVecInc) SenderOption {
+	return func(o *senderOptions) {
+		o.metrics = metrics
+	}
+}
+
+// SenderMetricsColumns returns the list of columns that will be used for
+// the Sender's metric. Endpoint is the destination URL and outcome is
+// the outcome of an attempt or delivery.
+func SenderMetricsColumns() []string {
+	return []string{"endpoint", "outcome"}
+}
+
+// SenderMetricsOutcomeValues returns the list of values that will be used
+// for the "outcome" label of the Sender's metric.
+func SenderMetricsOutcomeValues() []string {
+	return []string{"delivered", "retried", "failed", "circuit-open", "dead-lettered", "replayed"}
+}
+
+// Sender delivers signed JSON payloads to webhook endpoints, retrying
+// failed attempts with exponential backoff and jitter. Each endpoint has
+// its own circuit breaker so that an endpoint that is down does not
+// consume the resources of the sender. Payloads that cannot be delivered
+// are recorded in a DeadLetterStore, if one is configured, from which
+// they can be inspected and replayed.
+type Sender struct {
+	provider Provider
+	secret   []byte
+	opts     senderOptions
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// NewSender returns a Sender that signs payloads using provider and secret,
+// see Provider.Sign. The GitHubProvider is used if provider is nil.
+func NewSender(provider Provider, secret []byte, opts ...SenderOption) *Sender {
+	if provider == nil {
+		provider = GitHubProvider{}
+	}
+	var o senderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.client == nil {
+		o.client = &http.Client{Timeout: DefaultSendRequestTimeout}
+	}
+	if o.attempts <= 0 {
+		o.attempts = DefaultSendAttempts
+	}
+	if o.backoff <= 0 {
+		o.backoff = DefaultSendBackoff
+	}
+	if o.maxBackoff <= 0 {
+		o.maxBackoff = DefaultSendMaxBackoff
+	}
+	if o.breakerThreshold == 0 {
+		o.breakerThreshold = DefaultBreakerThreshold
+	}
+	if o.breakerCooldown <= 0 {
+		o.breakerCooldown = DefaultBreakerCooldown
+	}
+	if o.logger == nil {
+		o.logger = slog.New(slog.DiscardHandler)
+	}
+	if o.metrics == nil {
+		o.metrics = func(context.Context, ...string) {}
+	}
+	o.logger = o.logger.With("component", "webhooks.Sender")
+	return &Sender{
+		provider: provider,
+		secret:   slices.Clone(secret),
+		opts:     o,
+		breakers: map[string]*breaker{},
+	}
+}
+
+// Send delivers payload, which must be JSON encoded, to url with the
+// specified additional headers, e.g. an event type. It returns once the
+// payload has been accepted with a 2xx status code or all attempts have
+// failed, in which case the payload is dead-lettered and a *SendError is
+// returned. Responses with a 4xx status code, other than 408 and 429, are
+// not retried, nor are failures to create or sign the request.
+func (s *Sender) Send(ctx context.Context, url string, payload []byte, header http.Header) error {
+	dl := DeadLetter{ID: newRandomID(), URL: url, Header: header.Clone(), Payload: payload}
+	err := s.send(ctx, dl)
+	if err == nil {
+		return nil
+	}
+	s.deadLetter(ctx, dl, err)
+	return err
+}
+
+func (s *Sender) send(ctx context.Context, dl DeadLetter) error {
+	br := s.breaker(dl.URL)
+	var status int
+	var err error
+	for attempt := 1; ; attempt++ {
+		if !br.allow(time.Now()) {
+			s.opts.metrics(ctx, dl.URL, "circuit-open")
+			return &SendError{URL: dl.URL, Attempts: attempt - 1, Err: ErrCircuitOpen}
+		}
+		var retryAfter time.Duration
+		status, retryAfter, err = s.attempt(ctx, dl)
+		br.record(err == nil, time.Now())
+		if err == nil {
+			s.opts.metrics(ctx, dl.URL, "delivered")
+			return nil
+		}
+		s.opts.logger.Info("webhook delivery attempt failed", "url", dl.URL, "attempt", attempt, "status", status, "err", err)
+		if attempt >= s.opts.attempts || !retryable(status) || errors.Is(err, errNotRetryable) || ctx.Err() != nil {
+			s.opts.metrics(ctx, dl.URL, "failed")
+			return &SendError{URL: dl.URL, Attempts: attempt, StatusCode: status, Err: err}
+		}
+		s.opts.metrics(ctx, dl.URL, "retried")
+		delay := max(s.backoff(attempt), min(retryAfter, s.opts.maxBackoff))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return &SendError{URL: dl.URL, Attempts: attempt, StatusCode: status, Err: ctx.Err()}
+		}
+	}
+}
+
+// attempt makes a single delivery attempt, returning the response status
+// code, if any, and the delay requested by a Retry-After header, if any.
+// Failures to create or sign the request wrap errNotRetryable.
+func (s *Sender) attempt(ctx context.Context, dl DeadLetter) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", errNotRetryable, err)
+	}
+	for k, v := range dl.Header {
+		req.Header[k] = slices.Clone(v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := s.provider.Sign(req.Header, dl.Payload, s.secret, time.Now()); err != nil {
+		return 0, 0, fmt.Errorf("%w: failed to sign request: %w", errNotRetryable, err)
+	}
+	resp, err := s.opts.client.Do(req) //nolint:gosec // G704 the URL is supplied by the caller
+	if err != nil {
+		return 0, 0, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, 0, nil
+	}
+	var retryAfter time.Duration
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		retryAfter = time.Duration(secs) * time.Second
+	}
+	return resp.StatusCode, retryAfter, fmt.Errorf("unexpected status: %v", resp.Status)
+}
+
+// retryable returns true if an attempt that failed with the specified
+// status code, or zero for a transport error, should be retried.
+func retryable(status int) bool {
+	switch {
+	case status == 0, status >= 500:
+		return true
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay to wait after the specified attempt.
+func (s *Sender) backoff(attempt int) time.Duration {
+	delay := s.opts.maxBackoff
+	if shift := attempt - 1; shift < 32 {
+		delay = min(delay, s.opts.backoff<<shift)
+	}
+	if delay <= 1 {
+		return delay
+	}
+	return delay - rand.N(delay/2) //nolint:gosec // jitter need not be cryptographically secure
+}
+
+func (s *Sender) deadLetter(ctx context.Context, dl DeadLetter, err error) {
+	var se *SendError
+	if errors.As(err, &se) {
+		dl.Attempts = se.Attempts
+	}
+	dl.Error = err.Error()
+	dl.Time = time.Now()
+	if s.opts.deadLetters == nil {
+		s.opts.logger.Error("failed to deliver webhook", "url", dl.URL, "id", dl.ID, "err", err)
+		return
+	}
+	if err := s.opts.deadLetters.Add(dl); err != nil {
+		s.opts.logger.Error("failed to dead-letter webhook", "url", dl.URL, "id", dl.ID, "err", err)
+		return
+	}
+	s.opts.logger.Warn("dead-lettered webhook", "url", dl.URL, "id", dl.ID, "err", err)
+	s.opts.metrics(ctx, dl.URL, "dead-lettered")
+}
+
+// DeadLetters returns the payloads that could not be delivered, or nil if
+// no DeadLetterStore is configured.
+func (s *Sender) DeadLetters() []DeadLetter {
+	if s.opts.deadLetters == nil {
+		return nil
+	}
+	return s.opts.deadLetters.List()
+}
+
+// Replay attempts to redeliver the dead-lettered payload with the
+// specified ID, removing it from the DeadLetterStore if it is delivered and
+// updating its entry otherwise.
+func (s *Sender) Replay(ctx context.Context, id string) error {
+	if s.opts.deadLetters == nil {
+		return fmt.Errorf("webhooks: no dead letter store configured")
+	}
+	entries := s.opts.deadLetters.List()
+	idx := slices.IndexFunc(entries, func(dl DeadLetter) bool { return dl.ID == id })
+	if idx < 0 {
+		return fmt.Errorf("webhooks: unknown dead letter %q", id)
+	}
+	return s.replay(ctx, entries[idx])
+}
+
+// ReplayAll attempts to redeliver all dead-lettered payloads, oldest first,
+// returning the errors for those that could not be delivered.
+func (s *Sender) ReplayAll(ctx context.Context) error {
+	if s.opts.deadLetters == nil {
+		return fmt.Errorf("webhooks: no dead letter store configured")
+	}
+	var errs []error
+	for _, dl := range s.opts.deadLetters.List() {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if err := s.replay(ctx, dl); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", dl.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Sender) replay(ctx context.Context, dl DeadLetter) error {
+	if err := s.send(ctx, dl); err != nil {
+		s.deadLetter(ctx, dl, err)
+		return err
+	}
+	s.opts.metrics(ctx, dl.URL, "replayed")
+	return s.opts.deadLetters.Remove(dl.ID)
+}
+
+// breaker returns the circuit breaker for url.
+func (s *Sender) breaker(url string) *breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	br, ok := s.breakers[url]
+	if !ok {
+		br = &breaker{threshold: s.opts.breakerThreshold, cooldown: s.opts.breakerCooldown}
+		s.breakers[url] = br
+	}
+	return br
+}
+
+// breaker is a per-endpoint circuit breaker. It is open while openUntil
+// is in the future and half-open, allowing a single trial attempt, once
+// it has passed.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool // a half-open trial attempt is in progress
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	if b.threshold < 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *breaker) record(success bool, now time.Time) {
+	if b.threshold < 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webhooks"
+)
+
+// receiver is an httptest webhook receiver that verifies signatures and
+// responds with the queued status codes, then with 202 Accepted.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	received [][]byte
+	attempts atomic.Int64
+}
+
+func newReceiver(t *testing.T, secret []byte, statuses ...int) *receiver {
+	t.Helper()
+	rc := &receiver{statuses: statuses}
+	validator, err := webhooks.ProviderValidator(webhooks.StripeProvider{}, staticSecrets(secret), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rc.attempts.Add(1)
+		payload, status := validator(req)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		if got := req.Header.Get("Content-Type"); got != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		if len(rc.statuses) > 0 {
+			status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+			w.WriteHeader(status)
+			return
+		}
+		rc.received = append(rc.received, payload)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) payloads() [][]byte {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return slices.Clone(rc.received)
+}
+
+type metricsRecorder struct {
+	mu       sync.Mutex
+	outcomes []string
+}
+
+func (m *metricsRecorder) inc(_ context.Context, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outcomes = append(m.outcomes, labels[1])
+}
+
+func (m *metricsRecorder) get() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.outcomes)
+}
+
+func newTestSender(secret []byte, opts ...webhooks.SenderOption) *webhooks.Sender {
+	opts = append([]webhooks.SenderOption{webhooks.WithRetries(3, time.Millisecond, 5*time.Millisecond)}, opts...)
+	return webhooks.NewSender(webhooks.StripeProvider{}, secret, opts...)
+}
+
+func TestSenderRetries(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("sender-secret")
+	rc := newReceiver(t, secret, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	var metrics metricsRecorder
+	sender := newTestSender(secret, webhooks.WithSenderMetrics(metrics.inc))
+
+	payload := []byte(`{"event":"created"}`)
+	if err := sender.Send(ctx, rc.URL, payload, http.Header{"X-Event": {"created"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rc.payloads(); len(got) != 1 || !bytes.Equal(got[0], payload) {
+		t.Errorf("got %s, want %s", got, payload)
+	}
+	if got, want := metrics.get(), []string{"retried", "retried", "delivered"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSenderDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("sender-secret")
+	store := webhooks.NewMemoryDeadLetterStore(0)
+
+	// Client errors are not retried.
+	rc := newReceiver(t, secret, http.StatusBadRequest)
+	sender := newTestSender(secret, webhooks.WithDeadLetters(store))
+	payload := []byte(`{"n":1}`)
+	err := sender.Send(ctx, rc.URL, payload, nil)
+	var se *webhooks.SendError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest || se.Attempts != 1 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dls := sender.DeadLetters()
+	if len(dls) != 1 || dls[0].URL != rc.URL || !bytes.Equal(dls[0].Payload, payload) || dls[0].Attempts != 1 {
+		t.Fatalf("unexpected dead letters: %+v", dls)
+	}
+
+	// Retries are exhausted.
+	rc = newReceiver(t, secret, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	if err := sender.Send(ctx, rc.URL, []byte(`{"n":2}`), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got, want := rc.attempts.Load(), int64(3); got != want {
+		t.Errorf("attempts: got %d, want %d", got, want)
+	}
+	dls = sender.DeadLetters()
+	if len(dls) != 2 || dls[1].Attempts != 3 {
+		t.Fatalf("unexpected dead letters: %+v", dls)
+	}
+
+	// The receiver now accepts deliveries so the dead letters can be
+	// replayed.
+	if err := sender.Replay(ctx, dls[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := rc.payloads(); len(got) != 1 || string(got[0]) != `{"n":2}` {
+		t.Errorf("replayed: got %s", got)
+	}
+	if got := sender.DeadLetters(); len(got) != 1 || got[0].ID != dls[0].ID {
+		t.Errorf("unexpected dead letters: %+v", got)
+	}
+	if err := sender.ReplayAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := sender.DeadLetters(); len(got) != 0 {
+		t.Errorf("unexpected dead letters: %+v", got)
+	}
+	if err := sender.Replay(ctx, "unknown"); err == nil {
+		t.Error("expected an error for an unknown dead letter")
+	}
+}
+
+// failingSigner is a provider whose Sign method always fails.
+type failingSigner struct {
+	webhooks.StripeProvider
+}
+
+var errSign = errors.New("sign failed")
+
+func (failingSigner) Sign(http.Header, []byte, []byte, time.Time) error {
+	return errSign
+}
+
+func TestSenderSignFailure(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("sender-secret")
+	rc := newReceiver(t, secret)
+	store := webhooks.NewMemoryDeadLetterStore(0)
+	sender := webhooks.NewSender(failingSigner{}, secret,
+		webhooks.WithRetries(3, time.Millisecond, 5*time.Millisecond),
+		webhooks.WithDeadLetters(store))
+
+	// Failures to sign the request are not retried.
+	err := sender.Send(ctx, rc.URL, []byte(`{"n":1}`), nil)
+	var se *webhooks.SendError
+	if !errors.As(err, &se) || se.Attempts != 1 || se.StatusCode != 0 || !errors.Is(err, errSign) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := rc.attempts.Load(), int64(0); got != want {
+		t.Errorf("attempts: got %d, want %d", got, want)
+	}
+	if dls := sender.DeadLetters(); len(dls) != 1 || dls[0].Attempts != 1 {
+		t.Fatalf("unexpected dead letters: %+v", dls)
+	}
+
+	// Nor are failures to create the request.
+	err = sender.Send(ctx, "http://invalid host", []byte(`{"n":2}`), nil)
+	if !errors.As(err, &se) || se.Attempts != 1 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSenderCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("sender-secret")
+	rc := newReceiver(t, secret, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	var metrics metricsRecorder
+	sender := newTestSender(secret,
+		webhooks.WithRetries(1, time.Millisecond, time.Millisecond),
+		webhooks.WithCircuitBreaker(2, 50*time.Millisecond),
+		webhooks.WithSenderMetrics(metrics.inc))
+
+	for range 2 {
+		if err := sender.Send(ctx, rc.URL, []byte(`{}`), nil); err == nil || errors.Is(err, webhooks.ErrCircuitOpen) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// The breaker is now open and the receiver is not contacted.
+	if err := sender.Send(ctx, rc.URL, []byte(`{}`), nil); !errors.Is(err, webhooks.ErrCircuitOpen) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := rc.attempts.Load(), int64(2); got != want {
+		t.Errorf("attempts: got %d, want %d", got, want)
+	}
+
+	// The trial attempt after the cooldown fails and re-opens the breaker.
+	time.Sleep(75 * time.Millisecond)
+	if err := sender.Send(ctx, rc.URL, []byte(`{}`), nil); err == nil || errors.Is(err, webhooks.ErrCircuitOpen) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sender.Send(ctx, rc.URL, []byte(`{}`), nil); !errors.Is(err, webhooks.ErrCircuitOpen) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The next trial succeeds and closes the breaker.
+	time.Sleep(75 * time.Millisecond)
+	for range 2 {
+		if err := sender.Send(ctx, rc.URL, []byte(`{}`), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := metrics.get(), []string{"failed", "failed", "circuit-open", "failed", "circuit-open", "delivered", "delivered"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSenderRelayRoundTrip(t *testing.T) {
+	secret := []byte("relay-secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	validator, err := webhooks.ProviderValidator(webhooks.GitHubProvider{}, staticSecrets(secret), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := webhooks.NewRelay(ctx, validator)
+	defer relay.Stop(context.Background())
+	handler := relay.Handler("/api/webhook", "/api/wait")
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	sender := webhooks.NewSender(nil, secret)
+	payload := []byte(`{"relayed":true}`)
+	if err := sender.Send(ctx, srv.URL+"/api/webhook", payload, http.Header{"X-GitHub-Event": {"push"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := pollWebhook(t, handler); !bytes.Equal(got, payload) {
+		t.Errorf("got %s, want %s", got, payload)
+	}
+}
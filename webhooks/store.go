@@ -0,0 +1,440 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredDelivery is a validated webhook delivery as recorded by a Store.
+type StoredDelivery struct {
+	ID         uint64      `json:"id"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body"`
+	Expiration time.Time   `json:"expiration"`
+}
+
+// Store is used by a Relay to persist deliveries so that they survive
+// a restart of the relay process. Deliveries are appended before the
+// webhook request is acknowledged and removed once they have been handed
+// to a client, expired or dropped to make room for newer deliveries.
+type Store interface {
+	// Append durably records d, assigning it a new ID which is returned.
+	// If more than limit deliveries are pending once d has been appended,
+	// the oldest are removed to mirror the relay's drop-oldest queue.
+	Append(d StoredDelivery, limit int) (uint64, error)
+	// Remove records that the delivery with the specified ID is no longer
+	// pending. Removing an unknown ID is not an error.
+	Remove(id uint64) error
+	// Pending returns the deliveries that have been appended but not
+	// removed, oldest first.
+	Pending() []StoredDelivery
+}
+
+// WithStore configures the Relay to persist deliveries using store.
+// Each validated delivery is appended to the store before ServeWebhook
+// responds with 202 Accepted and deliveries still pending in the store
+// are replayed into the queue by NewRelay. The store is owned by the
+// caller and is not closed by Relay.Stop.
+func WithStore(store Store) Option {
+	return func(opts *options) {
+		opts.store = store
+	}
+}
+
+const (
+	// DefaultSegmentSize is the size at which a SegmentStore starts a new
+	// log segment.
+	DefaultSegmentSize = 4 * 1024 * 1024 // 4MB
+
+	segmentSuffix = ".seg"
+)
+
+type segmentOp uint8
+
+const (
+	opAppend segmentOp = iota + 1
+	opRemove
+)
+
+// segmentRecord is the JSON encoded payload of a single log entry.
+type segmentRecord struct {
+	Op       segmentOp       `json:"op"`
+	Delivery *StoredDelivery `json:"delivery,omitempty"`
+	ID       uint64          `json:"id,omitempty"`
+}
+
+// segment is a single append-only log file. live holds the IDs of the
+// deliveries appended to this segment that are still pending.
+type segment struct {
+	path string
+	live map[uint64]struct{}
+}
+
+// SegmentStore is a Store implemented as an append-only log of segment files
+// in a local directory. Appends and removals are written as framed,
+// checksummed records; a torn record at the end of the log, as may be left by
+// a crash, is discarded when the store is opened. Segments are deleted once
+// none of the deliveries they contain remain pending, and the log is reset
+// entirely whenever there are no pending deliveries.
+type SegmentStore struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+	sync        bool
+	nextID      uint64
+	segments    []*segment // oldest first, the last is the active segment
+	active      *os.File
+	activeSize  int64
+	pending     []StoredDelivery // oldest first
+}
+
+// SegmentStoreOption configures a SegmentStore.
+type SegmentStoreOption func(*SegmentStore)
+
+// WithSegmentSize sets the size in bytes at which a new segment is started.
+func WithSegmentSize(size int64) SegmentStoreOption {
+	return func(s *SegmentStore) {
+		s.segmentSize = size
+	}
+}
+
+// WithSyncWrites controls whether appended deliveries are fsync'ed before
+// Append returns. It defaults to true.
+func WithSyncWrites(sync bool) SegmentStoreOption {
+	return func(s *SegmentStore) {
+		s.sync = sync
+	}
+}
+
+// NewSegmentStore opens, or creates, a SegmentStore in dir and reads any
+// existing segments to determine the set of pending deliveries.
+func NewSegmentStore(dir string, opts ...SegmentStoreOption) (*SegmentStore, error) {
+	s := &SegmentStore{
+		dir:  dir,
+		sync: true,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.segmentSize <= 0 {
+		s.segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("webhooks: failed to load segment store %q: %w", dir, err)
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SegmentStore) segmentPath(base uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", base, segmentSuffix))
+}
+
+func (s *SegmentStore) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var bases []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	slices.Sort(bases)
+	return bases, nil
+}
+
+func (s *SegmentStore) load() error {
+	bases, err := s.listSegments()
+	if err != nil {
+		return err
+	}
+	pending := map[uint64]StoredDelivery{}
+	owner := map[uint64]*segment{}
+	for _, base := range bases {
+		seg := &segment{path: s.segmentPath(base), live: map[uint64]struct{}{}}
+		s.nextID = max(s.nextID, base)
+		if err := s.replaySegment(seg, pending, owner); err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+	}
+	s.pending = make([]StoredDelivery, 0, len(pending))
+	for _, d := range pending {
+		s.pending = append(s.pending, d)
+	}
+	slices.SortFunc(s.pending, func(a, b StoredDelivery) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return nil
+}
+
+// replaySegment reads the records in seg, applying them to pending and
+// truncating any torn record found at the end of the file.
+func (s *SegmentStore) replaySegment(seg *segment, pending map[uint64]StoredDelivery, owner map[uint64]*segment) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rd := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, n, err := readRecord(rd)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			// A partially written record can only be the last one in the
+			// log, so it is safe to discard it.
+			return os.Truncate(seg.path, offset)
+		}
+		offset += n
+		switch rec.Op {
+		case opAppend:
+			if rec.Delivery == nil {
+				continue
+			}
+			id := rec.Delivery.ID
+			pending[id] = *rec.Delivery
+			owner[id] = seg
+			seg.live[id] = struct{}{}
+			s.nextID = max(s.nextID, id+1)
+		case opRemove:
+			delete(pending, rec.ID)
+			if o, ok := owner[rec.ID]; ok {
+				delete(o.live, rec.ID)
+				delete(owner, rec.ID)
+			}
+		}
+	}
+}
+
+// readRecord reads a single length prefixed, checksummed record.
+func readRecord(rd io.Reader) (segmentRecord, int64, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+		return segmentRecord{}, 0, err
+	}
+	size := binary.LittleEndian.Uint32(hdr[0:4])
+	sum := binary.LittleEndian.Uint32(hdr[4:8])
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(rd, buf); err != nil {
+		return segmentRecord{}, 0, io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(buf) != sum {
+		return segmentRecord{}, 0, fmt.Errorf("checksum mismatch")
+	}
+	var rec segmentRecord
+	if err := json.Unmarshal(buf, &rec); err != nil {
+		return segmentRecord{}, 0, err
+	}
+	return rec, int64(len(hdr)) + int64(size), nil
+}
+
+func encodeRecord(rec segmentRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	return append(buf, payload...), nil
+}
+
+// newSegment creates a new, empty, active segment named for the next ID
+// to be assigned.
+func (s *SegmentStore) newSegment() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			return err
+		}
+		s.active, s.activeSize = nil, 0
+	}
+	seg := &segment{path: s.segmentPath(s.nextID), live: map[uint64]struct{}{}}
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, seg)
+	s.active = f
+	return nil
+}
+
+// openActive opens the last segment for appending.
+func (s *SegmentStore) openActive() error {
+	if s.active != nil {
+		return nil
+	}
+	if len(s.segments) == 0 {
+		return s.newSegment()
+	}
+	f, err := os.OpenFile(s.segments[len(s.segments)-1].path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.active, s.activeSize = f, fi.Size()
+	return nil
+}
+
+func (s *SegmentStore) write(rec segmentRecord, sync bool) error {
+	if err := s.openActive(); err != nil {
+		return err
+	}
+	buf, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	n, err := s.active.Write(buf)
+	s.activeSize += int64(n)
+	if err != nil {
+		return err
+	}
+	if sync {
+		return s.active.Sync()
+	}
+	return nil
+}
+
+// Append implements Store.
+func (s *SegmentStore) Append(d StoredDelivery, limit int) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != nil && s.activeSize >= s.segmentSize {
+		// Segments are only started by appends so that every segment is
+		// named for a distinct ID.
+		if err := s.newSegment(); err != nil {
+			return 0, fmt.Errorf("webhooks: failed to create segment: %w", err)
+		}
+	}
+	d.ID = s.nextID
+	if err := s.write(segmentRecord{Op: opAppend, Delivery: &d}, s.sync); err != nil {
+		return 0, fmt.Errorf("webhooks: failed to append delivery: %w", err)
+	}
+	s.nextID++
+	s.segments[len(s.segments)-1].live[d.ID] = struct{}{}
+	s.pending = append(s.pending, d)
+	for limit > 0 && len(s.pending) > limit {
+		if err := s.remove(s.pending[0].ID); err != nil {
+			return d.ID, err
+		}
+	}
+	return d.ID, nil
+}
+
+// Remove implements Store.
+func (s *SegmentStore) Remove(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(id)
+}
+
+func (s *SegmentStore) remove(id uint64) error {
+	idx := slices.IndexFunc(s.pending, func(d StoredDelivery) bool { return d.ID == id })
+	if idx < 0 {
+		return nil
+	}
+	if err := s.write(segmentRecord{Op: opRemove, ID: id}, false); err != nil {
+		return fmt.Errorf("webhooks: failed to remove delivery %v: %w", id, err)
+	}
+	s.pending = slices.Delete(s.pending, idx, idx+1)
+	for _, seg := range s.segments {
+		delete(seg.live, id)
+	}
+	return s.compact()
+}
+
+// compact deletes the oldest segments that no longer contain any pending
+// deliveries. Segments are only deleted oldest first so that a removal
+// record is never lost while the delivery it refers to is still on disk.
+// If there are no pending deliveries at all the log is reset.
+func (s *SegmentStore) compact() error {
+	if len(s.pending) == 0 {
+		return s.reset()
+	}
+	for len(s.segments) > 1 && len(s.segments[0].live) == 0 {
+		if err := os.Remove(s.segments[0].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// reset replaces all existing segments with a single empty one, which is
+// named for the next ID to be assigned so that IDs are never reused
+// across restarts.
+func (s *SegmentStore) reset() error {
+	if len(s.segments) == 1 && s.activeSize == 0 && s.active != nil {
+		return nil
+	}
+	old := s.segments
+	s.segments = nil
+	if err := s.newSegment(); err != nil {
+		return err
+	}
+	for _, seg := range old {
+		if seg.path == s.segments[0].path {
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending implements Store.
+func (s *SegmentStore) Pending() []StoredDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.pending)
+}
+
+// Close closes the active segment.
+func (s *SegmentStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
@@ -0,0 +1,226 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webhooks"
+)
+
+func openSegmentStore(t *testing.T, dir string, opts ...webhooks.SegmentStoreOption) *webhooks.SegmentStore {
+	t.Helper()
+	store, err := webhooks.NewSegmentStore(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func appendBodies(t *testing.T, store webhooks.Store, limit int, bodies ...string) []uint64 {
+	t.Helper()
+	ids := make([]uint64, 0, len(bodies))
+	for _, b := range bodies {
+		id, err := store.Append(webhooks.StoredDelivery{Body: []byte(b)}, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func pendingBodies(store webhooks.Store) []string {
+	var bodies []string
+	for _, d := range store.Pending() {
+		bodies = append(bodies, string(d.Body))
+	}
+	return bodies
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSegmentStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	store := openSegmentStore(t, dir)
+	hdr := http.Header{"X-Github-Event": []string{"push"}}
+	id, err := store.Append(webhooks.StoredDelivery{Header: hdr, Body: []byte(`"a"`)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := appendBodies(t, store, 0, `"b"`, `"c"`)
+	if err := store.Remove(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openSegmentStore(t, dir)
+	pending := store.Pending()
+	if got, want := len(pending), 2; got != want {
+		t.Fatalf("got %v pending, want %v", got, want)
+	}
+	if got, want := pending[0].ID, id; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := pending[0].Header.Get("X-GitHub-Event"), "push"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := string(pending[1].Body), `"c"`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	next := appendBodies(t, store, 0, `"d"`)
+	if next[0] <= ids[1] {
+		t.Errorf("id %v was reused, last id was %v", next[0], ids[1])
+	}
+}
+
+func TestSegmentStoreLimit(t *testing.T) {
+	store := openSegmentStore(t, t.TempDir())
+	appendBodies(t, store, 2, `"a"`, `"b"`, `"c"`)
+	got := pendingBodies(store)
+	if len(got) != 2 || got[0] != `"b"` || got[1] != `"c"` {
+		t.Errorf("got %v, want [\"b\" \"c\"]", got)
+	}
+}
+
+func TestSegmentStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store := openSegmentStore(t, dir, webhooks.WithSegmentSize(128), webhooks.WithSyncWrites(false))
+	ids := appendBodies(t, store, 0, `"0123456789"`, `"0123456789"`, `"0123456789"`, `"0123456789"`, `"0123456789"`)
+	if got := len(segmentFiles(t, dir)); got < 2 {
+		t.Fatalf("got %v segments, want at least 2", got)
+	}
+
+	// Removing the oldest deliveries allows the oldest segments to be deleted.
+	for _, id := range ids[:len(ids)-1] {
+		if err := store.Remove(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(segmentFiles(t, dir)); got > 2 {
+		t.Errorf("got %v segments, want at most 2", got)
+	}
+
+	// Removing everything resets the log to a single empty segment.
+	if err := store.Remove(ids[len(ids)-1]); err != nil {
+		t.Fatal(err)
+	}
+	files := segmentFiles(t, dir)
+	if got, want := len(files), 1; got != want {
+		t.Fatalf("got %v segments, want %v", got, want)
+	}
+	if fi, err := os.Stat(files[0]); err != nil || fi.Size() != 0 {
+		t.Errorf("expected an empty segment: %v, %v", fi, err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// IDs must not be reused after the log has been reset.
+	store = openSegmentStore(t, dir)
+	if got := len(store.Pending()); got != 0 {
+		t.Errorf("got %v pending, want 0", got)
+	}
+	next := appendBodies(t, store, 0, `"x"`)
+	if next[0] <= ids[len(ids)-1] {
+		t.Errorf("id %v was reused, last id was %v", next[0], ids[len(ids)-1])
+	}
+}
+
+func TestSegmentStoreTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	store := openSegmentStore(t, dir)
+	appendBodies(t, store, 0, `"a"`, `"b"`)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := segmentFiles(t, dir)
+	f, err := os.OpenFile(files[len(files)-1], os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A record header that claims more data than follows it.
+	if _, err := f.Write([]byte{0xff, 0x00, 0x00, 0x00, 0x01, 0x02}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	store = openSegmentStore(t, dir)
+	got := pendingBodies(store)
+	if len(got) != 2 || got[0] != `"a"` || got[1] != `"b"` {
+		t.Errorf("got %v, want [\"a\" \"b\"]", got)
+	}
+	appendBodies(t, store, 0, `"c"`)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store = openSegmentStore(t, dir)
+	if got, want := len(store.Pending()), 3; got != want {
+		t.Errorf("got %v pending, want %v", got, want)
+	}
+}
+
+func TestRelayStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	store := openSegmentStore(t, dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	relay := webhooks.NewRelay(ctx, webhooks.NoopValidator, webhooks.WithStore(store))
+	handler := relay.Handler("/api/webhook", "/api/wait")
+	first, second := []byte(`"first"`), []byte(`"second"`)
+	for _, p := range [][]byte{first, second} {
+		if got := postWebhook(t, handler, p); got != http.StatusAccepted {
+			t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+		}
+	}
+	// Simulate a restart before any client has polled.
+	relay.Stop(context.Background())
+	cancel()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openSegmentStore(t, dir)
+	handler, _ = newTestRelay(t, webhooks.WithStore(store))
+	if got := pollWebhook(t, handler); !bytes.Equal(got, first) {
+		t.Errorf("first read: got %s, want %s", got, first)
+	}
+	if got := pollWebhook(t, handler); !bytes.Equal(got, second) {
+		t.Errorf("second read: got %s, want %s", got, second)
+	}
+	if got := len(store.Pending()); got != 0 {
+		t.Errorf("got %v pending after delivery, want 0", got)
+	}
+}
+
+func TestRelayStoreExpiry(t *testing.T) {
+	dir := t.TempDir()
+	store := openSegmentStore(t, dir)
+	if _, err := store.Append(webhooks.StoredDelivery{
+		Body:       []byte(`"stale"`),
+		Expiration: time.Now().Add(-time.Minute),
+	}, 0); err != nil {
+		t.Fatal(err)
+	}
+	newTestRelay(t, webhooks.WithStore(store), webhooks.WithExpiry(time.Hour, 0))
+	if got := len(store.Pending()); got != 0 {
+		t.Errorf("got %v pending, want expired deliveries to be removed", got)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// StreamPathSuffix is appended to the relay path passed to Relay.Handler
+	// to form the path on which streaming clients are served.
+	StreamPathSuffix = "/stream"
+	// StreamEventType is the Server-Sent Events event type used for
+	// webhook deliveries.
+	StreamEventType = "webhook"
+	// DefaultStreamKeepAlive is the default interval at which keep-alives
+	// are sent to idle streaming clients.
+	DefaultStreamKeepAlive = 30 * time.Second
+
+	// lastEventIDParam may be used by WebSocket clients, which cannot set
+	// the Last-Event-ID header from a browser, to resume a stream.
+	lastEventIDParam = "last_event_id"
+)
+
+// WithStreamKeepAlive sets the interval at which a comment, for
+// Server-Sent Events, or a ping, for WebSockets, is sent to an idle
+// streaming client to keep intermediate proxies from closing the
+// connection. It defaults to DefaultStreamKeepAlive.
+func WithStreamKeepAlive(interval time.Duration) Option {
+	return func(opts *options) {
+		opts.streamKeepAlive = interval
+	}
+}
+
+// StreamEvent is a single delivery as sent to streaming clients. It is
+// the JSON encoded data of a Server-Sent Event and the JSON encoded
+// message of a WebSocket stream.
+type StreamEvent struct {
+	// ID identifies the event within the relay and is also sent as the
+	// Server-Sent Events id, see ServeStream for how it is used to resume
+	// a stream.
+	ID uint64 `json:"id"`
+	// Header contains the forwarded headers of the delivery, see
+	// WithForwardedHeaders.
+	Header http.Header `json:"header,omitempty"`
+	// DeliveryID and LeaseDeadline are set when leases are enabled, see
+	// WithLeases, and have the same meaning as DeliveryIDHeader and
+	// LeaseDeadlineHeader.
+	DeliveryID    string    `json:"delivery_id,omitempty"`
+	LeaseDeadline time.Time `json:"lease_deadline,omitzero"`
+	// Body is the webhook payload. Payloads that are not valid JSON are
+	// sent as a JSON string.
+	Body json.RawMessage `json:"body"`
+}
+
+// streamHistory records the most recent deliveries sent to the streaming
+// clients of a subscription so that a client that reconnects can resume
+// from the last event it received.
+type streamHistory struct {
+	mu     sync.Mutex
+	size   int
+	events []delivery // oldest first
+}
+
+func (h *streamHistory) record(d delivery) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.size <= 0 {
+		return
+	}
+	if len(h.events) == h.size {
+		h.events = append(h.events[:0], h.events[1:]...)
+	}
+	h.events = append(h.events, d)
+}
+
+// since returns the recorded deliveries that were assigned a sequence
+// number greater than seq.
+func (h *streamHistory) since(seq uint64) []delivery {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, d := range h.events {
+		if d.seq > seq {
+			return append([]delivery(nil), h.events[i:]...)
+		}
+	}
+	return nil
+}
+
+// streamWriter is implemented by the Server-Sent Events and WebSocket
+// transports.
+type streamWriter interface {
+	writeEvent(StreamEvent) error
+	keepAlive() error
+}
+
+type sseWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (s *sseWriter) writeEvent(ev StreamEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, StreamEventType, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseWriter) keepAlive() error {
+	if _, err := io.WriteString(s.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+type wsWriter struct {
+	ws *websocket.Conn
+}
+
+func (s *wsWriter) writeEvent(ev StreamEvent) error {
+	return websocket.JSON.Send(s.ws, ev)
+}
+
+func (s *wsWriter) keepAlive() error {
+	s.ws.PayloadType = websocket.PingFrame
+	defer func() { s.ws.PayloadType = websocket.TextFrame }()
+	_, err := s.ws.Write(nil)
+	return err
+}
+
+// ServeStream serves a long-lived stream of deliveries to a client. By
+// default deliveries are sent as Server-Sent Events of type
+// StreamEventType whose id is the event's ID and whose data is a JSON
+// encoded StreamEvent. Requests that ask to be upgraded to a WebSocket
+// are instead sent one JSON encoded StreamEvent per message.
+// Streaming clients compete with each other, and with long-polling
+// clients, for the deliveries of the subscription named by
+// SubscriptionPathValue.
+// A client that reconnects with the Last-Event-ID header, or for
+// WebSockets the last_event_id query parameter, set to the ID of the last
+// event it received is first resent any newer events that were streamed
+// to the subscription's clients, provided that they are still among the
+// most recent queue-size events. Event IDs are only meaningful for the
+// lifetime of the relay process. When leases are enabled, see WithLeases,
+// each event must be acknowledged in the same way as a long-poll response
+// and resumption is unnecessary, and not supported, since unacknowledged
+// deliveries are handed out again once their lease expires.
+func (r *Relay) ServeStream(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s := r.subscriber(req)
+	if s == nil {
+		http.NotFound(w, req)
+		return
+	}
+	lastID, err := lastEventID(req)
+	if err != nil {
+		http.Error(w, "invalid last event id", http.StatusBadRequest)
+		return
+	}
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		// The origin is deliberately not checked, the relay does not use
+		// cookies or other ambient credentials.
+		srv := websocket.Server{Handler: func(ws *websocket.Conn) {
+			ctx, cancel := context.WithCancel(req.Context())
+			defer cancel()
+			go func() {
+				// Read, and discard, client messages so that control frames
+				// are processed and a closed connection is noticed.
+				_, _ = io.Copy(io.Discard, ws)
+				cancel()
+			}()
+			r.stream(ctx, s, &wsWriter{ws: ws}, lastID)
+		}}
+		srv.ServeHTTP(w, req)
+		return
+	}
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		r.opts.logger.Error("ServeStream: streaming is not supported by the response writer", "err", err)
+		return
+	}
+	r.stream(req.Context(), s, &sseWriter{w: w, rc: rc}, lastID)
+}
+
+// lastEventID returns the ID of the last event received by a client that
+// is resuming a stream, or zero if it is not.
+func lastEventID(req *http.Request) (uint64, error) {
+	id := req.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = req.URL.Query().Get(lastEventIDParam)
+	}
+	if id == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(id, 10, 64)
+}
+
+// stream sends deliveries for s to sw until ctx is cancelled, the relay
+// is stopped or a write fails.
+func (r *Relay) stream(ctx context.Context, s *subscriber, sw streamWriter, lastID uint64) {
+	if lastID > 0 && s.leases == nil {
+		resent := s.history.since(lastID)
+		for _, d := range resent {
+			if err := sw.writeEvent(newStreamEvent(d)); err != nil {
+				r.opts.logger.Info("ServeStream: failed to resend event", "subscription", s.name, "err", err)
+				return
+			}
+		}
+		r.opts.logger.Info("ServeStream: resumed stream", "subscription", s.name, "last_event_id", lastID, "resent", len(resent))
+	}
+	keepAlive := time.NewTicker(r.opts.streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case d, ok := <-s.fifo.Out():
+			if !ok {
+				return
+			}
+			if !r.streamDelivery(ctx, s, sw, d) {
+				return
+			}
+			keepAlive.Reset(r.opts.streamKeepAlive)
+		case <-keepAlive.C:
+			if err := sw.keepAlive(); err != nil {
+				r.opts.logger.Info("ServeStream: failed to send keep-alive", "subscription", s.name, "err", err)
+				return
+			}
+		case <-ctx.Done():
+			r.opts.logger.Info("ServeStream: stream closed", "subscription", s.name, "err", ctx.Err())
+			return
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// streamDelivery sends d to sw, returning it to the subscriber's queue if
+// it cannot be sent, and returns false if the stream should be closed.
+func (r *Relay) streamDelivery(ctx context.Context, s *subscriber, sw streamWriter, d delivery) bool {
+	ev := newStreamEvent(d)
+	if s.leases != nil {
+		ev.DeliveryID, ev.LeaseDeadline = s.leases.grant(d, func(d delivery) { r.requeue(s, d) })
+		ev.LeaseDeadline = ev.LeaseDeadline.UTC()
+	}
+	if err := sw.writeEvent(ev); err != nil {
+		r.opts.logger.Info("ServeStream: failed to send event, requeueing", "subscription", s.name, "id", d.id, "err", err)
+		if s.leases != nil {
+			if _, ok := s.leases.release(ev.DeliveryID); !ok {
+				// The lease has already expired and requeued d.
+				return false
+			}
+		}
+		r.requeue(s, d)
+		return false
+	}
+	if s.leases == nil {
+		s.history.record(d)
+		r.removeFromStore(d.id, 1, "delivered")
+	}
+	r.opts.logger.Info("ServeStream: sent payload to client", "subscription", s.name, "size", len(d.body))
+	r.opts.readCounter(ctx)
+	return true
+}
+
+func newStreamEvent(d delivery) StreamEvent {
+	body := json.RawMessage(d.body)
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(d.body))
+	}
+	return StreamEvent{ID: d.seq, Header: d.header, Body: body}
+}
+
+// StreamHandler returns an http.Handler that serves the streaming endpoint
+// for Server-Sent Events and WebSocket clients.
+func (r *Relay) StreamHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.ServeStream(w, req)
+	})
+}
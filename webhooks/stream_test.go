@@ -0,0 +1,267 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webhooks"
+	"golang.org/x/net/websocket"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  webhooks.StreamEvent
+}
+
+// openStream opens a Server-Sent Events stream on path and returns a
+// channel of the events received and the response headers.
+func openStream(t *testing.T, ctx context.Context, url, lastEventID string) (<-chan sseEvent, http.Header) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream: got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	ch := make(chan sseEvent, 10)
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+		sc := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if ev.id != "" {
+					ch <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.data); err != nil {
+					t.Errorf("data: %v", err)
+				}
+			}
+		}
+	}()
+	return ch, resp.Header
+}
+
+func nextEvent(t *testing.T, ch <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return sseEvent{}
+}
+
+func newStreamServer(t *testing.T, opts ...webhooks.Option) (func(http.ResponseWriter, *http.Request), *httptest.Server) {
+	t.Helper()
+	handler, _ := newTestRelay(t, opts...)
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	t.Cleanup(srv.Close)
+	return handler, srv
+}
+
+func TestRelayStreamSSE(t *testing.T) {
+	handler, srv := newStreamServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, header := openStream(t, ctx, srv.URL+"/api/wait"+webhooks.StreamPathSuffix, "")
+	if got, want := header.Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("content type: got %q, want %q", got, want)
+	}
+
+	if got := postEvent(t, handler, "/api/webhook", "push", []byte(`{"a":1}`)); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	ev := nextEvent(t, events)
+	if got, want := ev.event, webhooks.StreamEventType; got != want {
+		t.Errorf("event: got %q, want %q", got, want)
+	}
+	if got, want := ev.id, strconv.FormatUint(ev.data.ID, 10); got != want {
+		t.Errorf("id: got %q, want %q", got, want)
+	}
+	if got, want := string(ev.data.Body), `{"a":1}`; got != want {
+		t.Errorf("body: got %s, want %s", got, want)
+	}
+	if got, want := ev.data.Header.Get("X-GitHub-Event"), "push"; got != want {
+		t.Errorf("header: got %q, want %q", got, want)
+	}
+	if ev.data.DeliveryID != "" {
+		t.Errorf("unexpected delivery id: %q", ev.data.DeliveryID)
+	}
+	// The delivery was consumed by the stream.
+	assertQueueEmpty(t, handler)
+}
+
+func TestRelayStreamResume(t *testing.T) {
+	handler, srv := newStreamServer(t)
+	url := srv.URL + "/api/wait" + webhooks.StreamPathSuffix
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, _ := openStream(t, ctx, url, "")
+	var ids []string
+	for _, body := range []string{`"one"`, `"two"`, `"three"`} {
+		if got := postEvent(t, handler, "/api/webhook", "push", []byte(body)); got != http.StatusAccepted {
+			t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+		}
+		ev := nextEvent(t, events)
+		if got := string(ev.data.Body); got != body {
+			t.Errorf("body: got %s, want %s", got, body)
+		}
+		ids = append(ids, ev.id)
+	}
+	cancel()
+
+	// Resume after the first event, the remaining two are resent.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	events, _ = openStream(t, ctx, url, ids[0])
+	for _, want := range ids[1:] {
+		if got := nextEvent(t, events).id; got != want {
+			t.Errorf("resumed id: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRelayStreamSubscriptions(t *testing.T) {
+	handler, srv := newStreamServer(t, webhooks.WithSubscriptions(testSubscriptions...))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	builds, _ := openStream(t, ctx, srv.URL+"/api/wait/builds"+webhooks.StreamPathSuffix, "")
+	issues, _ := openStream(t, ctx, srv.URL+"/api/wait/issues"+webhooks.StreamPathSuffix, "")
+	for _, event := range []string{"issues", "push"} {
+		if got := postEvent(t, handler, "/api/webhook", event, []byte(`"`+event+`"`)); got != http.StatusAccepted {
+			t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+		}
+	}
+	if got, want := string(nextEvent(t, builds).data.Body), `"push"`; got != want {
+		t.Errorf("builds: got %s, want %s", got, want)
+	}
+	if got, want := string(nextEvent(t, issues).data.Body), `"issues"`; got != want {
+		t.Errorf("issues: got %s, want %s", got, want)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/wait/unknown" + webhooks.StreamPathSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("unknown: got status %d, want %d", got, want)
+	}
+}
+
+func TestRelayStreamLeases(t *testing.T) {
+	handler, srv := newStreamServer(t, webhooks.WithLeases(time.Minute))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, _ := openStream(t, ctx, srv.URL+"/api/wait"+webhooks.StreamPathSuffix, "")
+	if got := postWebhook(t, handler, []byte(`"leased"`)); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	ev := nextEvent(t, events)
+	if ev.data.DeliveryID == "" || ev.data.LeaseDeadline.IsZero() {
+		t.Fatalf("missing lease: %+v", ev.data)
+	}
+	if got, want := ackWebhook(t, handler, ev.data.DeliveryID), http.StatusNoContent; got != want {
+		t.Errorf("ack: got status %d, want %d", got, want)
+	}
+}
+
+func TestRelayStreamKeepAlive(t *testing.T) {
+	_, srv := newStreamServer(t, webhooks.WithStreamKeepAlive(10*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/wait"+webhooks.StreamPathSuffix, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := line, ": keep-alive\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRelayStreamWebSocket(t *testing.T) {
+	handler, srv := newStreamServer(t)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/wait" + webhooks.StreamPathSuffix
+
+	ws, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first webhooks.StreamEvent
+	for i, body := range []string{`"one"`, `"two"`} {
+		if got := postEvent(t, handler, "/api/webhook", "push", []byte(body)); got != http.StatusAccepted {
+			t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+		}
+		var ev webhooks.StreamEvent
+		if err := websocket.JSON.Receive(ws, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(ev.Body); got != body {
+			t.Errorf("body: got %s, want %s", got, body)
+		}
+		if got, want := ev.Header.Get("X-GitHub-Event"), "push"; got != want {
+			t.Errorf("header: got %q, want %q", got, want)
+		}
+		if i == 0 {
+			first = ev
+		}
+	}
+	ws.Close()
+
+	// Resume using the query parameter.
+	ws, err = websocket.Dial(url+"?last_event_id="+strconv.FormatUint(first.ID, 10), "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	var ev webhooks.StreamEvent
+	if err := websocket.JSON.Receive(ws, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(ev.Body), `"two"`; got != want {
+		t.Errorf("resumed body: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"cloudeng.io/sync/patterns"
+)
+
+// SubscriptionPathValue is the name of the request path value, see
+// http.Request.PathValue, used to select a subscription. Relay.Handler
+// sets it from the path and it may also be set by an http.ServeMux
+// pattern such as "GET /relay/{subscription}".
+const SubscriptionPathValue = "subscription"
+
+// Subscription is a named group of long-polling clients. Every subscription
+// has its own queue and receives its own copy of each delivery that matches
+// its header filter, so multiple consumers can share a single relay and
+// webhook registration. Clients within a subscription compete for its
+// deliveries, i.e. each delivery is handed to one client per subscription.
+type Subscription struct {
+	// Name identifies the subscription in the relay and delivery paths,
+	// it must be non-empty and must not contain a '/'.
+	Name string `yaml:"name" doc:"name of the subscription, used as the final path component of the relay and delivery paths"`
+	// Headers restricts the subscription to deliveries whose forwarded
+	// headers, see WithForwardedHeaders, match. A delivery matches if it
+	// carries every named header with one of the listed values, or with any
+	// value if none are listed. Values are compared case-sensitively.
+	Headers map[string][]string `yaml:"headers" doc:"forwarded headers and their allowed values that a delivery must carry to be relayed to this subscription, e.g. X-GitHub-Event: [push], leave empty to receive all deliveries"`
+}
+
+// WithSubscriptions configures the relay to fan out deliveries to the named
+// subscriptions rather than to a single unnamed queue. Deliveries that match
+// no subscription are accepted but discarded. When subscriptions are
+// configured, polling and acknowledgement requests must name one, see
+// SubscriptionPathValue and Relay.Handler. Invalid or duplicate
+// subscriptions are logged and ignored.
+func WithSubscriptions(subs ...Subscription) Option {
+	return func(opts *options) {
+		opts.subscriptions = append(opts.subscriptions, subs...)
+	}
+}
+
+// subscriber is the per-subscription state of a relay.
+type subscriber struct {
+	name    string
+	headers http.Header
+	fifo    *patterns.FIFO[delivery]
+	leases  *leases // nil unless WithLeases is used
+	history *streamHistory
+}
+
+func newSubscriber(sub Subscription, historySize int) *subscriber {
+	s := &subscriber{name: sub.Name, history: &streamHistory{size: historySize}}
+	if len(sub.Headers) > 0 {
+		s.headers = make(http.Header, len(sub.Headers))
+		for k, v := range sub.Headers {
+			s.headers[http.CanonicalHeaderKey(k)] = slices.Clone(v)
+		}
+	}
+	return s
+}
+
+// matches returns true if a delivery with the specified forwarded headers
+// should be relayed to this subscriber.
+func (s *subscriber) matches(h http.Header) bool {
+	for name, allowed := range s.headers {
+		values := h.Values(name)
+		if len(values) == 0 {
+			return false
+		}
+		if len(allowed) == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(values, func(v string) bool {
+			return slices.Contains(allowed, v)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// validSubscriptionName returns true if name can be used as a path
+// component.
+func validSubscriptionName(name string) bool {
+	return len(name) > 0 && !strings.Contains(name, "/")
+}
+
+// subscriptionFromPath returns the subscription name and endpoint suffix,
+// if any, for paths of the form prefix/<name>, prefix/<name>/ack and
+// prefix/<name>/stream.
+func subscriptionFromPath(path, prefix string) (name, suffix string, ok bool) {
+	rest, found := strings.CutPrefix(path, prefix+"/")
+	if !found {
+		return "", "", false
+	}
+	for _, sfx := range []string{AckPathSuffix, StreamPathSuffix} {
+		if n, found := strings.CutSuffix(rest, sfx); found {
+			rest, suffix = n, sfx
+			break
+		}
+	}
+	if !validSubscriptionName(rest) {
+		return "", "", false
+	}
+	return rest, suffix, true
+}
+
+// storeRefs counts the subscriber copies of each stored delivery that have
+// yet to be delivered so that a delivery is only removed from the store
+// once every matching subscription has consumed it.
+type storeRefs struct {
+	mu    sync.Mutex
+	limit int
+	refs  map[uint64]int
+	// order holds the ids in refs, along with some that may since have
+	// been released, in the order in which they were added. Since ids
+	// only ever increase the oldest is always at the front.
+	order []uint64
+}
+
+func (s *storeRefs) add(id uint64, copies int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs[id] = copies
+	s.order = append(s.order, id)
+	// Copies dropped by a full subscriber queue are never released, so
+	// discard the oldest entries once there are more than the store can
+	// hold; the store will already have dropped them.
+	for len(s.refs) > s.limit {
+		delete(s.refs, s.order[0])
+		s.order = s.order[1:]
+	}
+	// Remove released ids so that order does not grow without bound
+	// behind an entry that is never released.
+	if len(s.order) > 2*s.limit {
+		s.order = slices.DeleteFunc(s.order, func(k uint64) bool {
+			_, ok := s.refs[k]
+			return !ok
+		})
+	}
+}
+
+// release releases the specified number of copies of the delivery with
+// the given id and returns true if it should now be removed from the store.
+func (s *storeRefs) release(id uint64, copies int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.refs[id]
+	if !ok {
+		return true
+	}
+	if n -= copies; n > 0 {
+		s.refs[id] = n
+		return false
+	}
+	delete(s.refs, id)
+	return true
+}
@@ -0,0 +1,203 @@
+// Copyright 2026 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package webhooks_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloudeng.io/webapp/webhooks"
+)
+
+func postEvent(t *testing.T, handler func(http.ResponseWriter, *http.Request), path, event string, body []byte) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+	if event != "" {
+		req.Header.Set("X-GitHub-Event", event)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Code
+}
+
+func pollPath(t *testing.T, handler func(http.ResponseWriter, *http.Request), path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func assertPathEmpty(t *testing.T, handler func(http.ResponseWriter, *http.Request), path string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	handler(w, req.WithContext(ctx))
+	if w.Body.Len() > 0 {
+		t.Errorf("%v: queue not empty: got %q", path, w.Body.String())
+	}
+}
+
+var testSubscriptions = []webhooks.Subscription{
+	{Name: "builds", Headers: map[string][]string{"x-github-event": {"push", "workflow_run"}}},
+	{Name: "issues", Headers: map[string][]string{"X-GitHub-Event": {"issues"}}},
+	{Name: "all"},
+}
+
+func TestRelaySubscriptionsFanOut(t *testing.T) {
+	handler, _ := newTestRelay(t, webhooks.WithSubscriptions(testSubscriptions...))
+
+	push, issue := []byte(`"push"`), []byte(`"issue"`)
+	for _, tc := range []struct {
+		event string
+		body  []byte
+	}{{"push", push}, {"issues", issue}, {"ping", []byte(`"ping"`)}} {
+		if got := postEvent(t, handler, "/api/webhook", tc.event, tc.body); got != http.StatusAccepted {
+			t.Fatalf("post %v: got status %d, want %d", tc.event, got, http.StatusAccepted)
+		}
+	}
+
+	if got := pollPath(t, handler, "/api/wait/builds").Body.Bytes(); !bytes.Equal(got, push) {
+		t.Errorf("builds: got %s, want %s", got, push)
+	}
+	if got := pollPath(t, handler, "/api/wait/issues").Body.Bytes(); !bytes.Equal(got, issue) {
+		t.Errorf("issues: got %s, want %s", got, issue)
+	}
+	for _, want := range []string{`"push"`, `"issue"`, `"ping"`} {
+		if got := pollPath(t, handler, "/api/wait/all").Body.String(); got != want {
+			t.Errorf("all: got %s, want %s", got, want)
+		}
+	}
+	for _, path := range []string{"/api/wait/builds", "/api/wait/issues", "/api/wait/all"} {
+		assertPathEmpty(t, handler, path)
+	}
+
+	// There is no unnamed subscription when subscriptions are configured.
+	if got := pollPath(t, handler, "/api/wait").Code; got != http.StatusNotFound {
+		t.Errorf("unnamed: got status %d, want %d", got, http.StatusNotFound)
+	}
+	if got := pollPath(t, handler, "/api/wait/unknown").Code; got != http.StatusNotFound {
+		t.Errorf("unknown: got status %d, want %d", got, http.StatusNotFound)
+	}
+}
+
+func TestRelaySubscriptionDeliveryPath(t *testing.T) {
+	handler, _ := newTestRelay(t, webhooks.WithSubscriptions(testSubscriptions...))
+
+	body := []byte(`"targeted"`)
+	if got := postEvent(t, handler, "/api/webhook/all", "push", body); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	if got := pollPath(t, handler, "/api/wait/all").Body.Bytes(); !bytes.Equal(got, body) {
+		t.Errorf("all: got %s, want %s", got, body)
+	}
+	assertPathEmpty(t, handler, "/api/wait/builds")
+
+	// The subscription's filter still applies to targeted deliveries.
+	if got := postEvent(t, handler, "/api/webhook/issues", "push", body); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	assertPathEmpty(t, handler, "/api/wait/issues")
+
+	if got := postEvent(t, handler, "/api/webhook/unknown", "push", body); got != http.StatusNotFound {
+		t.Errorf("unknown: got status %d, want %d", got, http.StatusNotFound)
+	}
+}
+
+func TestRelaySubscriptionLeases(t *testing.T) {
+	handler, _ := newTestRelay(t,
+		webhooks.WithSubscriptions(testSubscriptions...),
+		webhooks.WithLeases(time.Minute))
+
+	if got := postEvent(t, handler, "/api/webhook", "push", []byte(`"push"`)); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	builds := pollPath(t, handler, "/api/wait/builds").Header().Get(webhooks.DeliveryIDHeader)
+	all := pollPath(t, handler, "/api/wait/all").Header().Get(webhooks.DeliveryIDHeader)
+	if builds == "" || all == "" {
+		t.Fatalf("missing lease ids: %q, %q", builds, all)
+	}
+	ack := func(path, id string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set(webhooks.DeliveryIDHeader, id)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+	// Leases are specific to a subscription.
+	if got := ack("/api/wait/all"+webhooks.AckPathSuffix, builds); got != http.StatusNotFound {
+		t.Errorf("ack via wrong subscription: got status %d, want %d", got, http.StatusNotFound)
+	}
+	if got := ack("/api/wait/builds"+webhooks.AckPathSuffix, builds); got != http.StatusNoContent {
+		t.Errorf("ack builds: got status %d, want %d", got, http.StatusNoContent)
+	}
+	if got := ack("/api/wait/all"+webhooks.AckPathSuffix, all); got != http.StatusNoContent {
+		t.Errorf("ack all: got status %d, want %d", got, http.StatusNoContent)
+	}
+}
+
+func TestRelaySubscriptionStore(t *testing.T) {
+	dir := t.TempDir()
+	store := openSegmentStore(t, dir)
+	handler, _ := newTestRelay(t,
+		webhooks.WithStore(store),
+		webhooks.WithSubscriptions(testSubscriptions...))
+
+	if got := postEvent(t, handler, "/api/webhook", "push", []byte(`"push"`)); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	// Deliveries that match no subscription are not persisted.
+	if got := postEvent(t, handler, "/api/webhook/issues", "ping", []byte(`"ping"`)); got != http.StatusAccepted {
+		t.Fatalf("post: got status %d, want %d", got, http.StatusAccepted)
+	}
+	if got, want := len(store.Pending()), 1; got != want {
+		t.Fatalf("got %v pending, want %v", got, want)
+	}
+	pollPath(t, handler, "/api/wait/builds")
+	// The delivery must remain in the store until every matching
+	// subscription has consumed it.
+	if got, want := len(store.Pending()), 1; got != want {
+		t.Errorf("got %v pending, want %v", got, want)
+	}
+	pollPath(t, handler, "/api/wait/all")
+	if got := len(store.Pending()); got != 0 {
+		t.Errorf("got %v pending, want 0", got)
+	}
+}
+
+func TestRelaySubscriptionReplay(t *testing.T) {
+	store := openSegmentStore(t, t.TempDir())
+	for _, event := range []string{"push", "issues", "ping"} {
+		if _, err := store.Append(webhooks.StoredDelivery{
+			Header: http.Header{"X-Github-Event": {event}},
+			Body:   []byte(`"` + event + `"`),
+		}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subs := testSubscriptions[:2]
+	handler, _ := newTestRelay(t, webhooks.WithStore(store), webhooks.WithSubscriptions(subs...))
+	// The ping delivery matches no subscription and is discarded.
+	if got, want := len(store.Pending()), 2; got != want {
+		t.Errorf("got %v pending, want %v", got, want)
+	}
+	if got := pollPath(t, handler, "/api/wait/builds").Body.String(); got != `"push"` {
+		t.Errorf("builds: got %s, want %s", got, `"push"`)
+	}
+	if got := pollPath(t, handler, "/api/wait/issues").Body.String(); got != `"issues"` {
+		t.Errorf("issues: got %s, want %s", got, `"issues"`)
+	}
+	if got := len(store.Pending()); got != 0 {
+		t.Errorf("got %v pending, want 0", got)
+	}
+}
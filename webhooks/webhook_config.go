@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"time"
 
 	"cloudeng.io/cmdutil/cmdyaml"
 	"cloudeng.io/cmdutil/keys"
@@ -16,12 +17,16 @@ import (
 
 // Config represents the configuration for a webhook server.
 type Config struct {
-	DeliveryPath    string            `yaml:"delivery_path" doc:"path to receive webhooks on"`
-	RelayPath       string            `yaml:"relay_path" doc:"path to read relay payloads from"`
-	MaxPayloadSize  cmdyaml.ByteSize  `yaml:"max_payload_size" doc:"maximum allowed payload size for incoming webhook requests in bytes, e.g. 1048576 for 1MB"`
-	MaxQueueSize    int               `yaml:"max_queue_size" doc:"maximum number of payloads to hold in the queue for processing, leave empty for default"`
-	Service         string            `yaml:"service" doc:"type of webhook to serve, e.g. github, etc."`
-	ServiceSpecific *cmdyaml.Deferred `yaml:"service_specific" doc:"additional details specific to the type of webhook being served, leave empty for default"`
+	DeliveryPath       string            `yaml:"delivery_path" doc:"path to receive webhooks on"`
+	RelayPath          string            `yaml:"relay_path" doc:"path to read relay payloads from"`
+	MaxPayloadSize     cmdyaml.ByteSize  `yaml:"max_payload_size" doc:"maximum allowed payload size for incoming webhook requests in bytes, e.g. 1048576 for 1MB"`
+	MaxQueueSize       int               `yaml:"max_queue_size" doc:"maximum number of payloads to hold in the queue for processing, leave empty for default"`
+	AckLease           time.Duration     `yaml:"ack_lease" doc:"if set, payloads are leased to polling clients for this duration and must be acknowledged before it expires, leave empty to disable acknowledgements"`
+	Subscriptions      []Subscription    `yaml:"subscriptions" doc:"if set, payloads are relayed to each matching subscription which is polled at relay_path/<name>, leave empty for a single, unnamed, queue"`
+	Service            string            `yaml:"service" doc:"type of webhook to serve, e.g. github, stripe, slack or svix, see RegisterProvider"`
+	ServiceSpecific    *cmdyaml.Deferred `yaml:"service_specific" doc:"additional details specific to the type of webhook being served, leave empty for default"`
+	SignatureTolerance time.Duration     `yaml:"signature_tolerance" doc:"maximum age of a signature's timestamp, for services that sign one, before a webhook is rejected as a replay, leave empty for the default of 5m"`
+	Deduplication      Deduplication     `yaml:"deduplication" doc:"if set, duplicate deliveries, e.g. retries or replayed requests, are detected and rejected or discarded"`
 }
 
 func (c *Config) UnmarshalYAML(node *yaml.Node) error {
@@ -65,9 +70,35 @@ func (c Config) Options() []Option {
 		WithQueueSize(int64(c.MaxQueueSize)),
 		WithMaxPayloadSize(int64(c.MaxPayloadSize)),
 	}
+	if c.AckLease > 0 {
+		opts = append(opts, WithLeases(c.AckLease))
+	}
+	if len(c.Subscriptions) > 0 {
+		opts = append(opts, WithSubscriptions(c.Subscriptions...))
+	}
+	if c.Deduplication.Window > 0 {
+		opts = append(opts, WithDeduplication(c.Deduplication))
+	}
 	return opts
 }
 
+// Validator returns a Validator for the provider registered for
+// c.Service, see RegisterProvider, that uses the secrets specified by
+// ServiceSpecific, which must be a SecretsConfig. The secrets are
+// retrieved from the context of each request, see
+// SecretsConfig.TokensFromContext.
+func (c Config) Validator() (Validator, error) {
+	p, ok := LookupProvider(c.Service)
+	if !ok {
+		return nil, fmt.Errorf("unsupported webhook service %q, registered services are: %v", c.Service, Providers())
+	}
+	sc, err := ParseSpecific[SecretsConfig](c)
+	if err != nil {
+		return nil, err
+	}
+	return ProviderValidator(p, sc.TokensFromContext, c.SignatureTolerance)
+}
+
 // SecretsConfig represents the secrets used to validate incoming webhooks.
 // Keys are users (e.g. a GitHub username or email address) and values are
 // lists of secret IDs that identify entries in the key store. SecretSpecs is
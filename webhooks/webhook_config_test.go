@@ -9,6 +9,7 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"cloudeng.io/cmdutil/cmdyaml"
 	"cloudeng.io/cmdutil/keys"
@@ -200,6 +201,16 @@ relay_path: "/relay"
 service: "github"
 max_queue_size: 5
 max_payload_size: 512
+ack_lease: 30s
+subscriptions:
+  - name: builds
+    headers:
+      X-GitHub-Event: [push, workflow_run]
+  - name: all
+deduplication:
+  window: 10m
+  key_headers: [X-Request-ID]
+  reject: true
 `
 	var cfg webhooks.Config
 	if err := yaml.Unmarshal([]byte(input), &cfg); err != nil {
@@ -220,6 +231,25 @@ max_payload_size: 512
 	if cfg.MaxPayloadSize != 512 {
 		t.Errorf("MaxPayloadSize: got %d, want 512", cfg.MaxPayloadSize)
 	}
+	if cfg.AckLease != 30*time.Second {
+		t.Errorf("AckLease: got %v, want 30s", cfg.AckLease)
+	}
+	if got, want := len(cfg.Subscriptions), 2; got != want {
+		t.Fatalf("Subscriptions: got %d, want %d", got, want)
+	}
+	if got, want := cfg.Subscriptions[0].Name, "builds"; got != want {
+		t.Errorf("Subscriptions[0].Name: got %q, want %q", got, want)
+	}
+	if got, want := cfg.Subscriptions[0].Headers["X-GitHub-Event"], []string{"push", "workflow_run"}; !slices.Equal(got, want) {
+		t.Errorf("Subscriptions[0].Headers: got %v, want %v", got, want)
+	}
+	if got := cfg.Subscriptions[1].Headers; got != nil {
+		t.Errorf("Subscriptions[1].Headers: got %v, want nil", got)
+	}
+	want := webhooks.Deduplication{Window: 10 * time.Minute, KeyHeaders: []string{"X-Request-ID"}, Reject: true}
+	if got := cfg.Deduplication; got.Window != want.Window || got.Reject != want.Reject || !slices.Equal(got.KeyHeaders, want.KeyHeaders) {
+		t.Errorf("Deduplication: got %+v, want %+v", got, want)
+	}
 }
 
 // TestConfigInOuterStruct verifies that Config's UnmarshalYAML works correctly